@@ -0,0 +1,31 @@
+package cmds
+
+import (
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+)
+
+// TestAuth checks clientID and clientKey against the stored config with the same flow.Auth the service uses,
+// and prints whether they authenticate. The returned error tells an unknown client (wrapping types.ErrNotFound)
+// from a bad key.
+func TestAuth(ctx context.Context, store ports.ClientStore, clientID, clientKey string) error {
+	cc, err := store.GetClientConfig(ctx, clientID)
+	if errors.Is(err, types.ErrNotFound) {
+		err = fmt.Errorf("unknown client %s: %w", clientID, err)
+	}
+	if err == nil {
+		if authErr := flow.Auth(ctx, cc, clientID, clientKey); authErr != nil {
+			err = fmt.Errorf("bad key for client %s: %w", clientID, authErr)
+		}
+	}
+	if err != nil {
+		fmt.Printf("auth FAILED: %v\n", err)
+		return err
+	}
+	fmt.Printf("auth OK for client %s\n", clientID)
+	return nil
+}
@@ -0,0 +1,22 @@
+package cmds
+
+import (
+	"context"
+	"enoti/internal/types"
+)
+
+func (s *UnitTestSuite) TestTestAuth() {
+	ctx := context.Background()
+	store := newMemClientStore()
+	s.Require().NoError(store.PutClientConfig(ctx, "c1", types.ClientConfig{ClientID: "c1", ClientKey: "key-0123456789"}))
+
+	s.NoError(TestAuth(ctx, store, "c1", "key-0123456789"))
+
+	err := TestAuth(ctx, store, "c1", "key-9876543210")
+	s.ErrorContains(err, "bad key")
+	s.NotErrorIs(err, types.ErrNotFound)
+
+	err = TestAuth(ctx, store, "nobody", "key-0123456789")
+	s.ErrorIs(err, types.ErrNotFound)
+	s.ErrorContains(err, "unknown client")
+}
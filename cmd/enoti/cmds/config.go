@@ -0,0 +1,110 @@
+package cmds
+
+import (
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/goccy/go-yaml"
+)
+
+// LoadConfigFile reads and validates a client config from a YAML file.
+func LoadConfigFile(path string) (types.ClientConfig, error) {
+	var cc types.ClientConfig
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cc, err
+	}
+	if err := yaml.Unmarshal(b, &cc); err != nil {
+		return cc, types.Err(types.ErrInvalidClientConfig, err, "parse %s", path)
+	}
+	if err := cc.Validate(); err != nil {
+		return cc, types.Err(types.ErrInvalidClientConfig, err, "validate %s", path)
+	}
+	return cc, nil
+}
+
+// PutConfig validates the client config in the YAML file at path and writes it to the store, with its client keys
+// replaced by their Argon2id hashes. The config cached by the process, if any, is dropped. The write is refused with
+// types.ErrVersionConflict if the stored config is no longer at the version of the file, e.g. as printed by
+// GetConfig, or, for files without one, if it changed since it was read.
+func PutConfig(ctx context.Context, store ports.ClientStore, path string) error {
+	cc, _, err := loadForPut(ctx, store, path)
+	if err != nil {
+		return err
+	}
+	if err := store.PutClientConfigCAS(ctx, cc.ClientID, cc.Version, cc); err != nil {
+		return err
+	}
+	flow.InvalidateClientConfig(cc.ClientID)
+	return nil
+}
+
+// PutConfigDryRun validates the client config in the YAML file at path and writes to w what PutConfig would change
+// in the stored config, without writing it.
+func PutConfigDryRun(ctx context.Context, store ports.ClientStore, path string, w io.Writer) error {
+	cc, existing, err := loadForPut(ctx, store, path)
+	if err != nil {
+		return err
+	}
+	writeDiff(w, cc, existing)
+	return nil
+}
+
+// writeDiff writes to w what putting cc changes in existing, nil if the client is not stored yet.
+func writeDiff(w io.Writer, cc types.ClientConfig, existing *types.ClientConfig) {
+	if existing == nil {
+		_, _ = fmt.Fprintf(w, "client %s does not exist and would be created\n", cc.ClientID)
+		existing = &types.ClientConfig{}
+	}
+	diffs := DiffConfig(*existing, cc)
+	if len(diffs) == 0 {
+		_, _ = fmt.Fprintf(w, "client %s: no changes\n", cc.ClientID)
+		return
+	}
+	for _, d := range diffs {
+		_, _ = fmt.Fprintln(w, d.String())
+	}
+}
+
+// loadForPut loads the config file at path and hashes its keys, reusing the hashes of the stored config, if any.
+// existing is nil if the client is not stored yet. The version of a file without one is that of the stored config.
+func loadForPut(ctx context.Context, store ports.ClientStore, path string) (cc types.ClientConfig, existing *types.ClientConfig, err error) {
+	if cc, err = LoadConfigFile(path); err != nil {
+		return cc, nil, err
+	}
+	stored, err := store.GetClientConfig(ctx, cc.ClientID)
+	if err == nil {
+		existing = &stored
+		if cc.Version == 0 {
+			cc.Version = stored.Version
+		}
+	} else if !errors.Is(err, types.ErrNotFound) {
+		return cc, nil, err
+	}
+	p, err := flow.KeyHashParamsFromEnv()
+	if err != nil {
+		return cc, existing, err
+	}
+	cc, err = flow.HashClientKeys(cc, stored, p)
+	return cc, existing, err
+}
+
+// GetConfig prints the stored client config as YAML.
+func GetConfig(ctx context.Context, store ports.ClientStore, clientID string) error {
+	cc, err := store.GetClientConfig(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(cc)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(b)
+	return err
+}
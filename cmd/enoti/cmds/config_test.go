@@ -0,0 +1,118 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/types"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const testConfigYAML = `client_id: c1
+client_name: client one
+client_key: %s
+client_rpm: %d
+trigger:
+  field: event.type
+  target:
+    sns_arn: arn:aws:sns:us-east-1:123456789012:topic
+`
+
+func (s *UnitTestSuite) writeConfig(key string, rpm int) string {
+	path := filepath.Join(s.T().TempDir(), "c1.yml")
+	s.Require().NoError(os.WriteFile(path, fmt.Appendf(nil, testConfigYAML, key, rpm), 0o600))
+	return path
+}
+
+func (s *UnitTestSuite) TestPutConfigDryRun() {
+	ctx := context.Background()
+	store := newMemClientStore()
+	s.NoError(PutConfig(ctx, store, s.writeConfig("key-0123456789abcdef", 10)))
+	s.Equal(1, store.puts)
+
+	var out bytes.Buffer
+	s.NoError(PutConfigDryRun(ctx, store, s.writeConfig("key-fedcba9876543210", 20), &out))
+	s.Equal("~ client_key_hash: <redacted> -> <redacted>\n~ client_rpm: 10 -> 20\n", out.String())
+	// Nothing written
+	s.Equal(1, store.puts)
+	cc, _ := store.GetClientConfig(ctx, "c1")
+	s.Equal(10, cc.ClientRPM)
+
+	out.Reset()
+	s.NoError(PutConfigDryRun(ctx, store, s.writeConfig("key-0123456789abcdef", 10), &out))
+	s.Equal("client c1: no changes\n", out.String())
+}
+
+func (s *UnitTestSuite) TestPutConfigDryRunInvalid() {
+	var out bytes.Buffer
+	err := PutConfigDryRun(context.Background(), newMemClientStore(), s.writeConfig("short", 10), &out)
+	s.Error(err)
+	s.Empty(out.String())
+}
+
+func (s *UnitTestSuite) TestPutConfigInvalidValueRegex() {
+	path := filepath.Join(s.T().TempDir(), "c1.yml")
+	doc := fmt.Sprintf(testConfigYAML, "key-0123456789abcdef", 10) + "  value_regex: \"(unclosed\"\n"
+	s.Require().NoError(os.WriteFile(path, []byte(doc), 0o600))
+
+	store := newMemClientStore()
+	err := PutConfig(context.Background(), store, path)
+	s.ErrorContains(err, "trigger.value_regex")
+	s.Equal(0, store.puts)
+}
+
+func (s *UnitTestSuite) TestPutConfigInvalidAggregateTemplate() {
+	path := filepath.Join(s.T().TempDir(), "c1.yml")
+	doc := fmt.Sprintf(testConfigYAML, "key-0123456789abcdef", 10) +
+		"  flapping:\n    window_seconds: 60\n    aggregate_template: \"{{.scope\"\n"
+	s.Require().NoError(os.WriteFile(path, []byte(doc), 0o600))
+
+	store := newMemClientStore()
+	err := PutConfig(context.Background(), store, path)
+	s.ErrorContains(err, "flapping.aggregate_template")
+	s.Equal(0, store.puts)
+}
+
+func (s *UnitTestSuite) TestPutConfigInvalidAggregateMinItems() {
+	path := filepath.Join(s.T().TempDir(), "c1.yml")
+	doc := fmt.Sprintf(testConfigYAML, "key-0123456789abcdef", 10) +
+		"  flapping:\n    window_seconds: 60\n    aggregate_at: 3\n    aggregate_min_items: 4\n"
+	s.Require().NoError(os.WriteFile(path, []byte(doc), 0o600))
+
+	store := newMemClientStore()
+	err := PutConfig(context.Background(), store, path)
+	s.ErrorContains(err, "flapping.aggregate_min_items")
+	s.Equal(0, store.puts)
+}
+
+func (s *UnitTestSuite) TestPutConfigInvalidatesCache() {
+	ctx := context.Background()
+	store := newMemClientStore()
+	s.Require().NoError(PutConfig(ctx, store, s.writeConfig("key-0123456789abcdef", 10)))
+	cc, err := flow.LoadCachedClientConfig(ctx, store, "c1")
+	s.Require().NoError(err)
+	s.Equal(10, cc.ClientRPM)
+
+	s.Require().NoError(PutConfig(ctx, store, s.writeConfig("key-0123456789abcdef", 20)))
+	cc, err = flow.LoadCachedClientConfig(ctx, store, "c1")
+	s.Require().NoError(err)
+	s.Equal(20, cc.ClientRPM, "not the cached config")
+}
+
+func (s *UnitTestSuite) TestPutConfigStaleVersion() {
+	ctx := context.Background()
+	store := newMemClientStore()
+	s.Require().NoError(PutConfig(ctx, store, s.writeConfig("key-0123456789abcdef", 10)))
+	s.Require().NoError(PutConfig(ctx, store, s.writeConfig("key-0123456789abcdef", 20)))
+
+	// A file got at version 1, put after the config moved on
+	path := filepath.Join(s.T().TempDir(), "stale.yml")
+	s.Require().NoError(os.WriteFile(path,
+		fmt.Appendf(nil, "version: 1\n"+testConfigYAML, "key-0123456789abcdef", 30), 0o600))
+	s.ErrorIs(PutConfig(ctx, store, path), types.ErrVersionConflict)
+	cc, _ := store.GetClientConfig(ctx, "c1")
+	s.Equal(int64(2), cc.Version)
+	s.Equal(20, cc.ClientRPM)
+}
@@ -0,0 +1,94 @@
+package cmds
+
+import (
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// dirConfig is a config file of a directory, loaded for put.
+type dirConfig struct {
+	path     string
+	cc       types.ClientConfig
+	existing *types.ClientConfig
+}
+
+// PutConfigDir puts the client configs of every *.yml and *.yaml file of dir, as PutConfig does. All of them are
+// validated first, and nothing is written unless they all are valid and name distinct clients. A failed write does
+// not stop the others. The returned error reports every file that failed.
+func PutConfigDir(ctx context.Context, store ports.ClientStore, dir string) error {
+	configs, err := loadDirForPut(ctx, store, dir)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, c := range configs {
+		if err := store.PutClientConfigCAS(ctx, c.cc.ClientID, c.cc.Version, c.cc); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.path, err))
+			continue
+		}
+		flow.InvalidateClientConfig(c.cc.ClientID)
+	}
+	return errors.Join(errs...)
+}
+
+// PutConfigDirDryRun validates the config files of dir as PutConfigDir does and writes to w what it would change,
+// file by file, without writing anything.
+func PutConfigDirDryRun(ctx context.Context, store ports.ClientStore, dir string, w io.Writer) error {
+	configs, err := loadDirForPut(ctx, store, dir)
+	if err != nil {
+		return err
+	}
+	for _, c := range configs {
+		_, _ = fmt.Fprintf(w, "%s:\n", c.path)
+		writeDiff(w, c.cc, c.existing)
+	}
+	return nil
+}
+
+// loadDirForPut loads the config files of dir for put, in file name order. The error reports every file that
+// failed, or a client configured by several files.
+func loadDirForPut(ctx context.Context, store ports.ClientStore, dir string) ([]dirConfig, error) {
+	var paths []string
+	for _, pattern := range []string{"*.yml", "*.yaml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	if len(paths) == 0 {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no *.yml or *.yaml files in %s", dir)
+	}
+	slices.Sort(paths)
+	var configs []dirConfig
+	var errs []error
+	byClient := map[string]string{}
+	for _, path := range paths {
+		cc, existing, err := loadForPut(ctx, store, path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		if other, ok := byClient[cc.ClientID]; ok {
+			errs = append(errs, fmt.Errorf("%s: client %s is configured by %s too", path, cc.ClientID, other))
+			continue
+		}
+		byClient[cc.ClientID] = path
+		configs = append(configs, dirConfig{path: path, cc: cc, existing: existing})
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return configs, nil
+}
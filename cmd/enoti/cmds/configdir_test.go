@@ -0,0 +1,58 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func (s *UnitTestSuite) writeConfigDir(files map[string]string) string {
+	dir := s.T().TempDir()
+	for name, doc := range files {
+		s.Require().NoError(os.WriteFile(filepath.Join(dir, name), []byte(doc), 0o600))
+	}
+	return dir
+}
+
+func (s *UnitTestSuite) TestPutConfigDir() {
+	ctx := context.Background()
+	valid := func(id string) string {
+		return fmt.Sprintf("client_id: %s\nclient_name: %s\nclient_key: key-0123456789abcdef\n", id, id)
+	}
+	dir := s.writeConfigDir(map[string]string{
+		"a.yml":     valid("a"),
+		"b.yaml":    valid("b"),
+		"c.yml":     "client_id: c\nclient_name: c\nclient_key: short\n",
+		"d.yml":     valid("a"),
+		"notes.txt": "not a config",
+	})
+
+	// Invalid files fail the whole directory, in dry runs too
+	store := newMemClientStore()
+	var out bytes.Buffer
+	err := PutConfigDirDryRun(ctx, store, dir, &out)
+	s.ErrorContains(err, "c.yml")
+	s.ErrorContains(err, "d.yml: client a is configured by")
+	s.NotContains(err.Error(), "b.yaml")
+	s.Empty(out.String())
+	s.Error(PutConfigDir(ctx, store, dir))
+	s.Zero(store.puts, "nothing written")
+
+	s.Require().NoError(os.Remove(filepath.Join(dir, "c.yml")))
+	s.Require().NoError(os.Remove(filepath.Join(dir, "d.yml")))
+	s.NoError(PutConfigDirDryRun(ctx, store, dir, &out))
+	s.Contains(out.String(), "a.yml:\nclient a does not exist and would be created\n")
+	s.Contains(out.String(), "b.yaml:\nclient b does not exist and would be created\n")
+	s.Zero(store.puts)
+
+	s.NoError(PutConfigDir(ctx, store, dir))
+	s.Equal(2, store.puts)
+	ids, _ := store.ListClients(ctx)
+	s.Equal([]string{"a", "b"}, ids)
+	s.Empty(store.cfgs["a"].ClientKey, "keys are hashed")
+
+	s.Error(PutConfigDir(ctx, store, s.T().TempDir()), "no config files")
+	s.Error(PutConfigDir(ctx, store, filepath.Join(dir, "missing")))
+}
@@ -0,0 +1,84 @@
+package cmds
+
+import (
+	"enoti/internal/types"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// redactedFields are reported as changed without printing their values.
+var redactedFields = map[string]bool{
+	"client_key": true, "client_keys": true, "client_key_hash": true, "client_key_hashes": true, "signing_secret": true,
+}
+
+// FieldDiff is one changed leaf field of a ClientConfig, named by its dotted JSON path.
+type FieldDiff struct {
+	Path     string
+	Old, New any
+	Redacted bool
+}
+
+func (d FieldDiff) String() string {
+	if d.Redacted {
+		return fmt.Sprintf("~ %s: <redacted> -> <redacted>", d.Path)
+	}
+	return fmt.Sprintf("~ %s: %v -> %v", d.Path, d.Old, d.New)
+}
+
+// DiffConfig compares two client configs field by field, descending into nested structs and pointers to structs.
+// Slices and maps are compared as a whole.
+func DiffConfig(old, new types.ClientConfig) []FieldDiff {
+	var out []FieldDiff
+	diffValue("", reflect.ValueOf(old), reflect.ValueOf(new), &out)
+	return out
+}
+
+func diffValue(path string, a, b reflect.Value, out *[]FieldDiff) {
+	if a.Kind() == reflect.Pointer && a.Type().Elem().Kind() == reflect.Struct {
+		if a.IsNil() && b.IsNil() {
+			return
+		}
+		if a.IsNil() {
+			a = reflect.New(a.Type().Elem())
+		}
+		if b.IsNil() {
+			b = reflect.New(b.Type().Elem())
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+	if a.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*out = append(*out, FieldDiff{Path: path, Old: display(a), New: display(b), Redacted: redactedFields[path]})
+		}
+		return
+	}
+	for i := 0; i < a.NumField(); i++ {
+		f := a.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if path != "" {
+			name = path + "." + name
+		}
+		diffValue(name, a.Field(i), b.Field(i), out)
+	}
+}
+
+// display dereferences pointers so values print instead of addresses.
+func display(v reflect.Value) any {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		return v.Elem().Interface()
+	}
+	return v.Interface()
+}
@@ -0,0 +1,94 @@
+package cmds
+
+import (
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/goccy/go-yaml"
+)
+
+// ExportConfigs writes every client config of the store to w as a stream of YAML documents, in client ID order. Keys
+// are exported as stored, i.e. hashed. A config that cannot be read is left out and reported in the returned error,
+// and the export goes on with the others.
+func ExportConfigs(ctx context.Context, store ports.ClientStore, w io.Writer) error {
+	ids, err := store.ListClients(ctx)
+	if err != nil {
+		return err
+	}
+	slices.Sort(ids)
+	var errs []error
+	first := true
+	for _, id := range ids {
+		cc, err := store.GetClientConfig(ctx, id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("client %s: %w", id, err))
+			continue
+		}
+		b, err := yaml.Marshal(cc)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("client %s: %w", id, err))
+			continue
+		}
+		if !first {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		first = false
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ImportConfigs validates and puts every client config of the YAML document stream r, as written by ExportConfigs,
+// hashing plaintext keys as PutConfig does. A config that fails is reported in the returned error, by its position
+// in the stream and client ID, and the import goes on with the others.
+func ImportConfigs(ctx context.Context, store ports.ClientStore, r io.Reader) error {
+	p, err := flow.KeyHashParamsFromEnv()
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(r)
+	var errs []error
+	for i := 1; ; i++ {
+		var cc types.ClientConfig
+		if err := dec.Decode(&cc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			// The stream cannot be read past a malformed document
+			errs = append(errs, types.Err(types.ErrInvalidClientConfig, err, "parse document %d", i))
+			break
+		}
+		if err := importConfig(ctx, store, cc, p); err != nil {
+			errs = append(errs, fmt.Errorf("document %d (client %s): %w", i, cc.ClientID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// importConfig validates cc and puts it, with its keys hashed, dropping the config cached by the process.
+func importConfig(ctx context.Context, store ports.ClientStore, cc types.ClientConfig, p flow.KeyHashParams) error {
+	if err := cc.Validate(); err != nil {
+		return types.Err(types.ErrInvalidClientConfig, err, "validate")
+	}
+	stored, err := store.GetClientConfig(ctx, cc.ClientID)
+	if err != nil && !errors.Is(err, types.ErrNotFound) {
+		return err
+	}
+	if cc, err = flow.HashClientKeys(cc, stored, p); err != nil {
+		return err
+	}
+	if err := store.PutClientConfig(ctx, cc.ClientID, cc); err != nil {
+		return err
+	}
+	flow.InvalidateClientConfig(cc.ClientID)
+	return nil
+}
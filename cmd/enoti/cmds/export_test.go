@@ -0,0 +1,77 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/types"
+	"errors"
+	"strings"
+)
+
+func (s *UnitTestSuite) TestExportImportConfigs() {
+	ctx := context.Background()
+	src := newMemClientStore()
+	s.NoError(PutConfig(ctx, src, s.writeConfig("key-0123456789abcdef", 10)))
+	s.NoError(src.PutClientConfig(ctx, "c2", types.ClientConfig{ClientID: "c2", ClientName: "client two",
+		ClientKeyHash: src.cfgs["c1"].ClientKeyHash, DailyQuota: 100, IPRPM: 5,
+		Trigger: types.TriggerConfig{FieldExpr: "state", Flapping: &types.FlapConfig{WindowSeconds: 600,
+			AggregateAt: 3, AggregateMaxItems: 2}}}))
+
+	var out bytes.Buffer
+	s.NoError(ExportConfigs(ctx, src, &out))
+	s.Contains(out.String(), "client_key_hash")
+	s.NotContains(out.String(), "key-0123456789abcdef")
+
+	dst := newMemClientStore()
+	s.NoError(ImportConfigs(ctx, dst, bytes.NewReader(out.Bytes())))
+	s.Equal(src.cfgs, dst.cfgs)
+	cc, err := dst.GetClientConfig(ctx, "c1")
+	s.NoError(err)
+	s.NoError(flow.Auth(ctx, cc, "c1", "key-0123456789abcdef"), "hashed keys survive the round trip")
+}
+
+func (s *UnitTestSuite) TestImportConfigsPartialFailure() {
+	ctx := context.Background()
+	stream := strings.Join([]string{
+		"client_id: good-1\nclient_name: one\nclient_key: key-0123456789abcdef\n",
+		"client_id: bad\nclient_name: bad\nclient_key: short\n",
+		"client_id: good-2\nclient_name: two\nclient_key: key-0123456789abcdef\n",
+	}, "---\n")
+	store := newMemClientStore()
+	err := ImportConfigs(ctx, store, strings.NewReader(stream))
+	s.ErrorIs(err, types.ErrInvalidClientConfig)
+	s.ErrorContains(err, "document 2 (client bad)")
+	s.NotContains(err.Error(), "good")
+	ids, _ := store.ListClients(ctx)
+	s.Equal([]string{"good-1", "good-2"}, ids)
+	s.Empty(store.cfgs["good-1"].ClientKey, "plaintext keys are hashed")
+	s.NotEmpty(store.cfgs["good-1"].ClientKeyHash)
+}
+
+func (s *UnitTestSuite) TestExportConfigsPartialFailure() {
+	ctx := context.Background()
+	store := &failingGetStore{memClientStore: newMemClientStore(), fail: "c2"}
+	for _, id := range []string{"c1", "c2", "c3"} {
+		s.NoError(store.PutClientConfig(ctx, id, types.ClientConfig{ClientID: id, ClientName: id}))
+	}
+	var out bytes.Buffer
+	err := ExportConfigs(ctx, store, &out)
+	s.ErrorContains(err, "client c2")
+	s.Contains(out.String(), "client_id: c1")
+	s.Contains(out.String(), "client_id: c3")
+	s.NotContains(out.String(), "client_id: c2")
+}
+
+// failingGetStore fails the reads of one client.
+type failingGetStore struct {
+	*memClientStore
+	fail string
+}
+
+func (f *failingGetStore) GetClientConfig(ctx context.Context, clientID string) (types.ClientConfig, error) {
+	if clientID == f.fail {
+		return types.ClientConfig{}, errors.New("read failed")
+	}
+	return f.memClientStore.GetClientConfig(ctx, clientID)
+}
@@ -0,0 +1,36 @@
+package cmds
+
+import (
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/types"
+)
+
+func (s *UnitTestSuite) TestPutConfigHashesKey() {
+	ctx := context.Background()
+	store := newMemClientStore()
+	s.Require().NoError(PutConfig(ctx, store, s.writeConfig("key-0123456789abcdef", 10)))
+
+	stored, err := store.GetClientConfig(ctx, "c1")
+	s.Require().NoError(err)
+	s.Empty(stored.ClientKey)
+	s.True(flow.IsKeyHash(stored.ClientKeyHash))
+	s.NoError(stored.Validate())
+
+	s.NoError(flow.Auth(ctx, stored, "c1", "key-0123456789abcdef"))
+	s.Error(flow.Auth(ctx, stored, "c1", "key-fedcba9876543210"))
+	s.NoError(TestAuth(ctx, store, "c1", "key-0123456789abcdef"))
+	s.Error(TestAuth(ctx, store, "c1", "key-fedcba9876543210"))
+
+	// Putting the same key again keeps the stored hash
+	s.Require().NoError(PutConfig(ctx, store, s.writeConfig("key-0123456789abcdef", 20)))
+	again, _ := store.GetClientConfig(ctx, "c1")
+	s.Equal(stored.ClientKeyHash, again.ClientKeyHash)
+}
+
+func (s *UnitTestSuite) TestPlaintextKeyStillAuthenticates() {
+	ctx := context.Background()
+	store := newMemClientStore()
+	s.Require().NoError(store.PutClientConfig(ctx, "legacy", types.ClientConfig{ClientID: "legacy", ClientKey: "key-0123456789"}))
+	s.NoError(TestAuth(ctx, store, "legacy", "key-0123456789"))
+}
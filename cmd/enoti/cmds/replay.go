@@ -0,0 +1,145 @@
+package cmds
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"enoti/internal/backends/memory"
+	"enoti/internal/flow"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// ReplayOptions are the flags of `enoti replay`.
+type ReplayOptions struct {
+	ClientID  string
+	ClientKey string
+	// URL is the base URL of a running server to POST the events to; "" runs them in process (see Replay).
+	URL string
+	// Rate paces the events, per second; 0 sends them as fast as possible.
+	Rate float64
+	// Since is the time of the clock of in-process replays as the replay starts; zero is now.
+	Since time.Time
+	// Speed is how many times faster than real time the clock of in-process replays runs; 0 is real time.
+	Speed float64
+}
+
+// Replay sends the events of r, one JSON payload per line, as the client and writes the resulting action of each to
+// w, as "<line>\t<action>", or "<line>\terror: <message>" for events that failed. Blank lines are skipped.
+//
+// With a URL the events are POSTed to its /notify endpoint. Otherwise they run through a flow.Engine with the
+// client's config from store, on edge state of its own, and nothing is published: the replay neither writes to
+// the data store nor notifies anyone. Its clock, which the flow and the state both read, starts at Since and runs
+// Speed times faster than real time, so that e.g. a day of traffic paced at Rate 10 and Speed 600 takes flap
+// windows minutes apart.
+func Replay(ctx context.Context, store ports.ClientStore, r io.Reader, w io.Writer, opts ReplayOptions) error {
+	send := replayHTTP(opts)
+	if opts.URL == "" {
+		clock := replayClock(opts.Since, opts.Speed)
+		flow.SetTimNowFn(clock)
+		defer flow.RestoreTimeNow()
+		engine := flow.NewEngine(store, memory.NewStore(), nil)
+		engine.Clock = clock
+		send = replayEngine(engine, opts)
+	}
+
+	var pace <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	sent := false
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if pace != nil && sent {
+			select {
+			case <-pace:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		sent = true
+		action, err := send(ctx, line)
+		if err != nil {
+			action = "error: " + err.Error()
+		}
+		if _, err := fmt.Fprintf(w, "%d\t%s\n", n, action); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// replayClock returns a clock starting at since, now if zero, and running speed times faster than real time.
+func replayClock(since time.Time, speed float64) func() time.Time {
+	start := time.Now()
+	if since.IsZero() {
+		since = start
+	}
+	if speed <= 0 {
+		speed = 1
+	}
+	return func() time.Time {
+		return since.Add(time.Duration(float64(time.Since(start)) * speed))
+	}
+}
+
+// replayEngine returns the sender of Replay running events through engine.
+func replayEngine(engine *flow.Engine, opts ReplayOptions) func(context.Context, []byte) (string, error) {
+	return func(ctx context.Context, line []byte) (string, error) {
+		var payload map[string]any
+		if err := json.Unmarshal(line, &payload); err != nil {
+			return "", fmt.Errorf("invalid json")
+		}
+		res, err := engine.Process(ctx, flow.ProcessRequest{ClientID: opts.ClientID, ClientKey: opts.ClientKey,
+			ClientIP: "replay", Payload: payload})
+		if err != nil {
+			return "", err
+		}
+		return flow.StatusTextMap[res.Action()], nil
+	}
+}
+
+// replayHTTP returns the sender of Replay POSTing events to the server at opts.URL.
+func replayHTTP(opts ReplayOptions) func(context.Context, []byte) (string, error) {
+	url := strings.TrimSuffix(opts.URL, "/") + "/notify"
+	return func(ctx context.Context, line []byte) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(line))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(types.ClientIDHdrName, opts.ClientID)
+		req.Header.Set(types.ClientKeyHdrName, opts.ClientKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if err != nil {
+			return "", err
+		}
+		var res struct {
+			Status string `json:"status"`
+		}
+		if json.Unmarshal(body, &res) == nil && res.Status != "" {
+			return res.Status, nil
+		}
+		// Errors, rate limits included, are answered in plain text
+		return "", fmt.Errorf("%d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+}
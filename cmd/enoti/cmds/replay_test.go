@@ -0,0 +1,68 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"enoti/internal/api"
+	"enoti/internal/backends/memory"
+	"enoti/internal/pub"
+	"enoti/internal/types"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+const replayEvents = `{"host":"db-1","status":"up"}
+{"host":"db-1","status":"down"}
+
+{"host":"db-1","status":"up"}
+{"host":"db-1","status":"down"}
+not json
+{"host":"db-1","status":"down"}
+{"host":"db-1","status":"up"}
+`
+
+func (s *UnitTestSuite) replayStore(window int) *memClientStore {
+	store := newMemClientStore()
+	s.Require().NoError(store.PutClientConfig(context.Background(), "replay", types.ClientConfig{
+		ClientID: "replay", ClientName: "replay", ClientKey: "client-key-123",
+		Trigger: types.TriggerConfig{FieldExpr: "status", ScopeFields: []string{"host"},
+			Flapping: &types.FlapConfig{WindowSeconds: window, AggregateAt: 2}},
+	}))
+	return store
+}
+
+func (s *UnitTestSuite) TestReplay() {
+	ctx := context.Background()
+	opts := ReplayOptions{ClientID: "replay", ClientKey: "client-key-123"}
+	var out bytes.Buffer
+	s.Require().NoError(Replay(ctx, s.replayStore(3600), strings.NewReader(replayEvents), &out, opts))
+	s.Equal("1\tedge_triggered_forward\n2\tsuppress_flap\n4\taggregate_sent\n5\tsuppress_flap\n"+
+		"6\terror: invalid json\n7\tno_op\n8\taggregate_sent\n", out.String())
+
+	// Events an hour apart on the clock of the replay each fall into a window of their own
+	out.Reset()
+	opts.Rate, opts.Speed, opts.Since = 200, 720_000, time.Now().Add(-24*time.Hour)
+	s.Require().NoError(Replay(ctx, s.replayStore(60), strings.NewReader(replayEvents), &out, opts))
+	s.Equal("1\tedge_triggered_forward\n2\tedge_triggered_forward\n4\tedge_triggered_forward\n"+
+		"5\tedge_triggered_forward\n6\terror: invalid json\n7\tno_op\n8\tedge_triggered_forward\n", out.String())
+
+	out.Reset()
+	opts.Rate = 0
+	opts.ClientKey = "wrong-key-123"
+	s.Require().NoError(Replay(ctx, s.replayStore(60), strings.NewReader(`{"host":"db-1","status":"up"}`), &out, opts))
+	s.Equal("1\terror: invalid credentials\n", out.String())
+}
+
+func (s *UnitTestSuite) TestReplayHTTP() {
+	h := api.NewHandler(s.replayStore(3600), memory.NewStore(), pub.NewStdout(io.Discard))
+	srv := httptest.NewServer(h.Router())
+	defer srv.Close()
+
+	var out bytes.Buffer
+	s.Require().NoError(Replay(context.Background(), nil, strings.NewReader(replayEvents), &out,
+		ReplayOptions{ClientID: "replay", ClientKey: "client-key-123", URL: srv.URL + "/"}))
+	s.Equal("1\tedge_triggered_forward\n2\tsuppress_flap\n4\taggregate_sent\n5\tsuppress_flap\n"+
+		"6\terror: 400 invalid json\n7\tno_op\n8\taggregate_sent\n", out.String())
+}
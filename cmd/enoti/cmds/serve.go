@@ -0,0 +1,75 @@
+package cmds
+
+import (
+	"context"
+	"enoti/internal/api"
+	"enoti/internal/backends"
+	"enoti/internal/ports"
+	"enoti/internal/pub"
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultServePort is the port `enoti serve` listens on without -port.
+const DefaultServePort = 8080
+
+// ServeOptions are the flags of `enoti serve`.
+type ServeOptions struct {
+	Port int
+	// DryRun prints the notifications instead of publishing them to their targets.
+	DryRun bool
+	// LogLevel is the name of a logrus level; "" keeps the current one.
+	LogLevel string
+}
+
+// Serve runs the HTTP server on the client and data backends configured in the environment until ctx is done, then
+// shuts it down gracefully. It is served over TLS if TLS_CERT_FILE and TLS_KEY_FILE are set. With DryRun, the
+// notifications are written to out as JSON lines (see pub.NewStdout) rather than published.
+func Serve(ctx context.Context, opts ServeOptions, out io.Writer) error {
+	if opts.LogLevel != "" {
+		level, err := log.ParseLevel(opts.LogLevel)
+		if err != nil {
+			return err
+		}
+		log.SetLevel(level)
+	}
+	clientStore, err := backends.ClientBackendFromEnv()
+	if err != nil {
+		return fmt.Errorf("init client store: %w", err)
+	}
+	dataStore, err := backends.DataBackendFromEnv()
+	if err != nil {
+		return fmt.Errorf("init data store: %w", err)
+	}
+	var publisher ports.Publisher = pub.NewStdout(out)
+	if !opts.DryRun {
+		if publisher, err = backends.PublisherFromEnv(); err != nil {
+			return err
+		}
+	}
+	if err := backends.SubscribeConfigInvalidationsFromEnv(ctx); err != nil {
+		return fmt.Errorf("subscribe to client config invalidations: %w", err)
+	}
+	files, err := api.TLSFilesFromEnv()
+	if err != nil {
+		return err
+	}
+
+	var stop chan<- struct{}
+	var done <-chan error
+	if files == nil {
+		stop, done = api.RunServerInterruptible(opts.Port, clientStore, dataStore, publisher)
+	} else {
+		stop, done = api.RunServerInterruptibleTLS(opts.Port, files.CertFile, files.KeyFile, files.ClientCAFile,
+			clientStore, dataStore, publisher)
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		close(stop)
+		return <-done
+	}
+}
@@ -0,0 +1,88 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"enoti/internal/api"
+	"enoti/internal/backends"
+	"enoti/internal/types"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// lockedBuffer is a bytes.Buffer written by the server while the test reads it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (s *UnitTestSuite) TestServe() {
+	defer log.SetLevel(log.GetLevel())
+	s.T().Setenv(backends.ClientBackendEnvKey, backends.BackendMemory)
+	s.T().Setenv(backends.DataBackendEnvKey, backends.BackendMemory)
+	s.T().Setenv(api.TLSCertFileKey, "")
+	s.T().Setenv(api.TLSKeyFileKey, "")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	port := l.Addr().(*net.TCPAddr).Port
+	s.Require().NoError(l.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var out lockedBuffer
+	served := make(chan error, 1)
+	go func() { served <- Serve(ctx, ServeOptions{Port: port, DryRun: true, LogLevel: "warn"}, &out) }()
+
+	base := fmt.Sprintf("http://127.0.0.1:%d", port)
+	s.Require().Eventually(func() bool {
+		resp, err := http.Get(base + "/health")
+		if err != nil {
+			return false
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// Dry run: notifications are printed
+	store, err := backends.ClientBackendFromEnv()
+	s.Require().NoError(err)
+	s.Require().NoError(store.PutClientConfig(ctx, "serve", types.ClientConfig{ClientID: "serve",
+		ClientName: "serve", ClientKey: "client-key-123"}))
+	req, err := http.NewRequest(http.MethodPost, base+"/notify", strings.NewReader(`{"status":"up"}`))
+	s.Require().NoError(err)
+	req.Header.Set(types.ClientIDHdrName, "serve")
+	req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	_ = resp.Body.Close()
+	s.Equal(http.StatusAccepted, resp.StatusCode)
+	s.Contains(out.String(), `{"status":"up"}`)
+
+	cancel()
+	select {
+	case err := <-served:
+		s.NoError(err)
+	case <-time.After(5 * time.Second):
+		s.Fail("the server did not stop")
+	}
+
+	s.Error(Serve(context.Background(), ServeOptions{LogLevel: "loud"}, &out))
+}
@@ -0,0 +1,80 @@
+package cmds
+
+import (
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"fmt"
+	"io"
+
+	"github.com/goccy/go-json"
+)
+
+// StateScope names the edge state of a client: by its stored Key, or by the Field of a trigger and the Values of
+// the trigger's scope fields, by scope field (see flow.ResolveScopeKey).
+type StateScope struct {
+	Key    string
+	Field  string
+	Values map[string]string
+}
+
+// resolveScope returns the scope key named by scope, reading the config of the client unless it is given as is.
+func resolveScope(ctx context.Context, store ports.ClientStore, clientID string, scope StateScope) (string, error) {
+	if scope.Key != "" {
+		return scope.Key, nil
+	}
+	cc, err := store.GetClientConfig(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	return flow.ResolveScopeKey(cc, scope.Field, scope.Values)
+}
+
+// loadState returns the scope key named by scope and the edge state stored under it, failing if there is none.
+func loadState(ctx context.Context, cs ports.ClientStore, ds ports.DataStore, clientID string,
+	scope StateScope) (string, *types.Edge, error) {
+	key, err := resolveScope(ctx, cs, clientID, scope)
+	if err != nil {
+		return "", nil, err
+	}
+	edge, _, err := ds.Load(ctx, clientID, key)
+	if err != nil {
+		return "", nil, err
+	}
+	if edge == nil {
+		return "", nil, fmt.Errorf("client %s has no edge state under scope %s", clientID, key)
+	}
+	return key, edge, nil
+}
+
+// GetState writes to w the edge state of the client under scope as JSON.
+func GetState(ctx context.Context, cs ports.ClientStore, ds ports.DataStore, clientID string, scope StateScope,
+	w io.Writer) error {
+	_, edge, err := loadState(ctx, cs, ds, clientID, scope)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(edge, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+// ResetState deletes the edge state of the client under scope, e.g. to release an alert stuck latched: the next
+// event of the scope is handled as its first one. It fails if there is no such state, so that a mistyped scope is
+// not taken for a reset.
+func ResetState(ctx context.Context, cs ports.ClientStore, ds ports.DataStore, clientID string, scope StateScope,
+	w io.Writer) error {
+	key, _, err := loadState(ctx, cs, ds, clientID, scope)
+	if err != nil {
+		return err
+	}
+	if err := ds.DeleteEdge(ctx, clientID, key); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "client %s: edge state %s reset\n", clientID, key)
+	return err
+}
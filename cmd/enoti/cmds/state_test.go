@@ -0,0 +1,53 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"enoti/internal/backends/memory"
+	"enoti/internal/flow"
+	"enoti/internal/types"
+
+	"github.com/goccy/go-json"
+)
+
+func (s *UnitTestSuite) TestState() {
+	ctx := context.Background()
+	cs := newMemClientStore()
+	trig := types.TriggerConfig{FieldExpr: "status", ScopeFields: []string{"host"}}
+	s.Require().NoError(cs.PutClientConfig(ctx, "state", types.ClientConfig{ClientID: "state", Trigger: trig}))
+	ds := memory.NewStore()
+	key := flow.TriggerScopeKey(trig, map[string]any{"status": "down", "host": "db-1"})
+	ok, err := ds.UpsertCAS(ctx, "state", key, 0, types.Edge{LastValue: "down", LastChangeTS: 1700000000})
+	s.Require().NoError(err)
+	s.Require().True(ok)
+
+	// By trigger field and scope field values, or by key
+	byField := StateScope{Field: "status", Values: map[string]string{"host": "db-1"}}
+	var out bytes.Buffer
+	s.Require().NoError(GetState(ctx, cs, ds, "state", byField, &out))
+	var edge types.Edge
+	s.Require().NoError(json.Unmarshal(out.Bytes(), &edge))
+	s.Equal(types.Edge{ScopeKey: key, LastValue: "down", LastChangeTS: 1700000000}, edge)
+	out.Reset()
+	s.Require().NoError(GetState(ctx, cs, ds, "state", StateScope{Key: key}, &out))
+	s.Contains(out.String(), `"last_value": "down"`)
+
+	s.ErrorContains(GetState(ctx, cs, ds, "state", StateScope{Field: "status",
+		Values: map[string]string{"host": "db-2"}}, &out), "no edge state")
+	s.ErrorContains(GetState(ctx, cs, ds, "state", StateScope{Field: "cpu"}, &out), "no trigger")
+	s.Error(GetState(ctx, cs, ds, "missing", byField, &out))
+
+	out.Reset()
+	s.Require().NoError(ResetState(ctx, cs, ds, "state", byField, &out))
+	s.Equal("client state: edge state "+key+" reset\n", out.String())
+	got, _, err := ds.Load(ctx, "state", key)
+	s.NoError(err)
+	s.Nil(got)
+	s.ErrorContains(ResetState(ctx, cs, ds, "state", byField, &out), "no edge state")
+
+	// The next event of the scope is handled as its first one
+	action, _, _, err := flow.Run(ctx, "state", "127.0.0.1", types.ClientConfig{ClientID: "state", Trigger: trig}, ds,
+		map[string]any{"status": "up", "host": "db-1"})
+	s.NoError(err)
+	s.Equal(flow.EdgeTriggeredForward, action)
+}
@@ -0,0 +1,75 @@
+package cmds
+
+import (
+	"context"
+	"enoti/internal/types"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// memClientStore is an in-memory ports.ClientStore for tests.
+type memClientStore struct {
+	mu   sync.Mutex
+	cfgs map[string]types.ClientConfig
+	puts int
+}
+
+func newMemClientStore() *memClientStore {
+	return &memClientStore{cfgs: map[string]types.ClientConfig{}}
+}
+
+func (m *memClientStore) GetClientConfig(_ context.Context, clientID string) (types.ClientConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cc, ok := m.cfgs[clientID]
+	if !ok {
+		return types.ClientConfig{}, types.ErrNotFound
+	}
+	return cc, nil
+}
+
+func (m *memClientStore) ListClients(context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Sorted(maps.Keys(m.cfgs)), nil
+}
+
+func (m *memClientStore) PutClientConfig(_ context.Context, clientID string, cc types.ClientConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfgs[clientID] = cc
+	m.puts++
+	return nil
+}
+
+func (m *memClientStore) PutClientConfigCAS(_ context.Context, clientID string, expectedVersion int64,
+	cc types.ClientConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cfgs[clientID].Version != expectedVersion {
+		return types.VersionConflict(clientID, expectedVersion)
+	}
+	cc.Version = expectedVersion + 1
+	m.cfgs[clientID] = cc
+	m.puts++
+	return nil
+}
+
+func (m *memClientStore) DeleteClientConfig(_ context.Context, clientID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.cfgs, clientID)
+	return nil
+}
+
+func (m *memClientStore) ClearAll(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clear(m.cfgs)
+	return nil
+}
+
+func (m *memClientStore) Ping(context.Context) error {
+	return nil
+}
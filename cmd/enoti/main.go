@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"enoti/cmd/enoti/cmds"
+	"enoti/internal/backends"
+	"enoti/internal/ports"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	log "github.com/sirupsen/logrus"
+)
+
+const usage = `usage: enoti <command> [flags] [args]
+
+commands:
+  serve [-port n] [-dry-run] [-log-level l]
+                                run the HTTP server on the configured backends; -dry-run prints the notifications
+                                instead of publishing them
+  replay -client <id> -key <key> -file <events.jsonl> [-url <server>] [-rate n] [-since t] [-speed x]
+                                send every JSON payload of a file, one per line, as the client and print the
+                                action of each; without -url they run in process and nothing is published or
+                                stored; -file - reads stdin
+  state get|reset -client <id> (-scope <key> | -field <field> [-value <scope field>=<value>]...)
+                                print or delete the edge state of a client under a stored scope key, or that of
+                                the trigger watching a field for the given values of its scope fields
+  put [-dry-run] <config.yml>   validate and store a client config; -dry-run prints the diff instead
+  put [-dry-run] <dir>          validate and store the configs of every *.yml and *.yaml file of a directory,
+                                writing none unless all are valid
+  get <client-id>               print a stored client config
+  test-auth <client-id> <key>   check a client's credentials against the stored config
+  export                        print every stored client config as a YAML stream
+  import <configs.yml>          validate and store every client config of a YAML stream; - reads stdin
+`
+
+func main() {
+	envFile := os.Getenv("ENV_FILE")
+	if envFile == "" {
+		envFile = ".env"
+	}
+	if err := godotenv.Load(envFile); err != nil {
+		log.Debug("The .env file not found.")
+	}
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, os.Args[1], os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, command string, args []string) error {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	switch command {
+	case "serve":
+		return serve(ctx, fs, args)
+	case "replay":
+		return replay(ctx, fs, args)
+	case "state":
+		return state(ctx, fs, args)
+	}
+	dryRun := fs.Bool("dry-run", false, "print what would change without writing")
+	_ = fs.Parse(args)
+	nArgs := 1
+	switch command {
+	case "test-auth":
+		nArgs = 2
+	case "export":
+		nArgs = 0
+	}
+	if fs.NArg() != nArgs {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	store, err := backends.ClientBackendFromEnv()
+	if err != nil {
+		return fmt.Errorf("init client store: %w", err)
+	}
+	switch command {
+	case "put":
+		if fi, err := os.Stat(fs.Arg(0)); err == nil && fi.IsDir() {
+			if *dryRun {
+				return cmds.PutConfigDirDryRun(ctx, store, fs.Arg(0), os.Stdout)
+			}
+			return cmds.PutConfigDir(ctx, store, fs.Arg(0))
+		}
+		if *dryRun {
+			return cmds.PutConfigDryRun(ctx, store, fs.Arg(0), os.Stdout)
+		}
+		return cmds.PutConfig(ctx, store, fs.Arg(0))
+	case "get":
+		return cmds.GetConfig(ctx, store, fs.Arg(0))
+	case "test-auth":
+		return cmds.TestAuth(ctx, store, fs.Arg(0), fs.Arg(1))
+	case "export":
+		return cmds.ExportConfigs(ctx, store, os.Stdout)
+	case "import":
+		if fs.Arg(0) == "-" {
+			return cmds.ImportConfigs(ctx, store, os.Stdin)
+		}
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		return cmds.ImportConfigs(ctx, store, f)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
+
+// serve parses the flags of the serve command and runs the server until ctx is done.
+func serve(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	var opts cmds.ServeOptions
+	fs.IntVar(&opts.Port, "port", cmds.DefaultServePort, "port to listen on")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "print the notifications instead of publishing them")
+	fs.StringVar(&opts.LogLevel, "log-level", "info", "log level: trace, debug, info, warn, error")
+	_ = fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return cmds.Serve(ctx, opts, os.Stdout)
+}
+
+// replay parses the flags of the replay command and replays the events of the file.
+func replay(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	var opts cmds.ReplayOptions
+	var file, since string
+	fs.StringVar(&file, "file", "", "file of the events, one JSON payload per line; - reads stdin")
+	fs.StringVar(&opts.ClientID, "client", "", "client ID to send the events as")
+	fs.StringVar(&opts.ClientKey, "key", "", "client key")
+	fs.StringVar(&opts.URL, "url", "", "base URL of the server to send the events to; none runs them in process")
+	fs.Float64Var(&opts.Rate, "rate", 0, "events per second; 0 sends them as fast as possible")
+	fs.StringVar(&since, "since", "", "RFC 3339 time the clock of in-process replays starts at; default now")
+	fs.Float64Var(&opts.Speed, "speed", 1, "how many times faster than real time the clock of in-process replays runs")
+	_ = fs.Parse(args)
+	if fs.NArg() != 0 || file == "" || opts.ClientID == "" || opts.ClientKey == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return fmt.Errorf("invalid -since: %w", err)
+		}
+		opts.Since = t
+	}
+
+	var store ports.ClientStore
+	if opts.URL == "" {
+		var err error
+		if store, err = backends.ClientBackendFromEnv(); err != nil {
+			return fmt.Errorf("init client store: %w", err)
+		}
+	}
+	in := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		in = f
+	}
+	return cmds.Replay(ctx, store, in, os.Stdout, opts)
+}
+
+// state parses the flags of the state command and prints or resets the edge state they name.
+func state(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	if len(args) == 0 || (args[0] != "get" && args[0] != "reset") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var clientID string
+	scope := cmds.StateScope{Values: map[string]string{}}
+	fs.StringVar(&clientID, "client", "", "client ID")
+	fs.StringVar(&scope.Key, "scope", "", "stored scope key of the edge state")
+	fs.StringVar(&scope.Field, "field", "", "field of the trigger whose edge state to resolve, instead of -scope")
+	fs.Var(scopeValues(scope.Values), "value", "<scope field>=<value> of the edge state to resolve; repeatable")
+	_ = fs.Parse(args[1:])
+	if fs.NArg() != 0 || clientID == "" || (scope.Key == "") == (scope.Field == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cs, err := backends.ClientBackendFromEnv()
+	if err != nil {
+		return fmt.Errorf("init client store: %w", err)
+	}
+	ds, err := backends.DataBackendFromEnv()
+	if err != nil {
+		return fmt.Errorf("init data store: %w", err)
+	}
+	if args[0] == "reset" {
+		return cmds.ResetState(ctx, cs, ds, clientID, scope, os.Stdout)
+	}
+	return cmds.GetState(ctx, cs, ds, clientID, scope, os.Stdout)
+}
+
+// scopeValues collects the <scope field>=<value> pairs of repeated flags.
+type scopeValues map[string]string
+
+func (v scopeValues) String() string {
+	return fmt.Sprint(map[string]string(v))
+}
+
+func (v scopeValues) Set(s string) error {
+	field, value, ok := strings.Cut(s, "=")
+	if !ok || field == "" {
+		return fmt.Errorf("want <scope field>=<value>, got %q", s)
+	}
+	v[field] = value
+	return nil
+}
@@ -0,0 +1,71 @@
+//go:build lambda
+
+package main
+
+import (
+	"context"
+	"enoti/internal/api"
+	"enoti/internal/backends"
+	"enoti/internal/pub"
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/joho/godotenv"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	// Load environment variables
+	envFile := os.Getenv("ENV_FILE")
+	if envFile == "" {
+		envFile = ".env"
+	}
+	err := godotenv.Load(envFile)
+	if err != nil {
+		log.Info("The .env file not found.")
+	}
+
+	// Each target goes to its own transport, the default one from PUBLISHER (SNS unless configured otherwise)
+	publisher, err := backends.PublisherFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize publisher: %v", err)
+	}
+
+	// Records that can never succeed go to the dead-letter target, if any, rather than being retried
+	deadLetters, deadLetterTarget, err := pub.DeadLetterFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize dead-letter publisher: %v", err)
+	}
+
+	// Initialize backend stores
+	clientStore, err := backends.ClientBackendFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize client store: %v", err)
+	}
+
+	dataStore, err := backends.DataBackendFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize data store: %v", err)
+	}
+	if err := backends.SubscribeConfigInvalidationsFromEnv(context.Background()); err != nil {
+		log.Fatalf("Failed to subscribe to client config invalidations: %v", err)
+	}
+
+	// Create handler
+	handler := &api.KinesisHandler{
+		Dispatcher: &api.Dispatcher{
+			ClientStore: clientStore,
+			DataStore:   dataStore,
+			Publisher:   publisher,
+			FailMode:    api.FailModeFromEnv(),
+
+			DeadLetterPublisher:   deadLetters,
+			DeadLetterDestination: deadLetterTarget,
+		},
+		ClientIDField:  os.Getenv(api.KinesisClientIDFieldKey),
+		ClientKeyField: os.Getenv(api.KinesisClientKeyFieldKey),
+	}
+
+	// Start Lambda runtime
+	lambda.Start(handler.HandleKinesisEvent)
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"crypto/subtle"
+	"enoti/internal/flow"
+	"enoti/internal/types"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+// AdminTokenKey holds the bearer token of the admin API. The API is disabled while it is unset.
+const AdminTokenKey = "ADMIN_TOKEN"
+
+// registerAdmin adds the admin API, managing client configs:
+//
+//	GET    /admin/clients        lists the client IDs
+//	GET    /admin/clients/{id}   returns the config of the client
+//	PUT    /admin/clients/{id}   creates or replaces it, hashing its client keys as `enoti put` does
+//	DELETE /admin/clients/{id}   deletes it
+//
+// Requests must carry `Authorization: Bearer <ADMIN_TOKEN>`.
+func (h *Handler) registerAdmin(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/clients", h.admin(h.handleListClients))
+	mux.HandleFunc("GET /admin/clients/{id}", h.admin(h.handleGetClient))
+	mux.HandleFunc("PUT /admin/clients/{id}", h.admin(h.handlePutClient))
+	mux.HandleFunc("DELETE /admin/clients/{id}", h.admin(h.handleDeleteClient))
+}
+
+// admin answers 404 while the admin API is disabled and 401 to requests without the admin token, and serves the
+// others with next.
+func (h *Handler) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.AdminToken)) != 1 {
+			http.Error(w, "invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (h *Handler) handleListClients(w http.ResponseWriter, r *http.Request) {
+	ids, err := h.ClientStore.ListClients(r.Context())
+	if err != nil {
+		requestLogger(r.Context()).WithError(err).Error("failed to list clients")
+		http.Error(w, "failed to list clients", http.StatusInternalServerError)
+		return
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	_ = writeJSON(w, http.StatusOK, map[string]any{"clients": ids})
+}
+
+func (h *Handler) handleGetClient(w http.ResponseWriter, r *http.Request) {
+	cc, err := h.ClientStore.GetClientConfig(r.Context(), r.PathValue("id"))
+	if errors.Is(err, types.ErrNotFound) {
+		http.Error(w, "unknown client", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		requestLogger(r.Context()).WithError(err).Error("failed to get client config")
+		http.Error(w, "failed to get client config", http.StatusInternalServerError)
+		return
+	}
+	_ = writeJSON(w, http.StatusOK, cc)
+}
+
+// handlePutClient stores the config in the body for the client of the path, answering 201 if it was created and
+// 200 if it replaced one, with the config as stored. The client_id of the body may be left out. A body with a version
+// is only stored if the stored config is still at that version, and is answered 409 otherwise.
+func (h *Handler) handlePutClient(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	var cc types.ClientConfig
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.MaxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cc); err != nil {
+		http.Error(w, "invalid client config: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if cc.ClientID == "" {
+		cc.ClientID = id
+	}
+	if cc.ClientID != id {
+		http.Error(w, "client_id does not match the path", http.StatusBadRequest)
+		return
+	}
+	if err := cc.Validate(); err != nil {
+		http.Error(w, "invalid client config: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	existing, err := h.ClientStore.GetClientConfig(ctx, id)
+	created := errors.Is(err, types.ErrNotFound)
+	if err != nil && !created {
+		requestLogger(ctx).WithError(err).Error("failed to get client config")
+		http.Error(w, "failed to get client config", http.StatusInternalServerError)
+		return
+	}
+	p, err := flow.KeyHashParamsFromEnv()
+	if err == nil {
+		cc, err = flow.HashClientKeys(cc, existing, p)
+	}
+	if cc.Version == 0 {
+		cc.Version = existing.Version
+	}
+	if err == nil {
+		err = h.ClientStore.PutClientConfigCAS(ctx, id, cc.Version, cc)
+	}
+	if errors.Is(err, types.ErrVersionConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		requestLogger(ctx).WithError(err).Error("failed to put client config")
+		http.Error(w, "failed to put client config", http.StatusInternalServerError)
+		return
+	}
+	flow.InvalidateClientConfig(id)
+	requestLogger(ctx).WithField("clientID", id).Info("client config put through the admin API")
+	cc.Version++
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	_ = writeJSON(w, status, cc)
+}
+
+func (h *Handler) handleDeleteClient(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	_, err := h.ClientStore.GetClientConfig(ctx, id)
+	if errors.Is(err, types.ErrNotFound) {
+		http.Error(w, "unknown client", http.StatusNotFound)
+		return
+	}
+	if err == nil {
+		err = h.ClientStore.DeleteClientConfig(ctx, id)
+	}
+	if err != nil {
+		requestLogger(ctx).WithError(err).Error("failed to delete client config")
+		http.Error(w, "failed to delete client config", http.StatusInternalServerError)
+		return
+	}
+	flow.InvalidateClientConfig(id)
+	requestLogger(ctx).WithField("clientID", id).Info("client config deleted through the admin API")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminTokenFromEnv returns the admin API token in "ADMIN_TOKEN", "" disabling the API.
+func AdminTokenFromEnv() string {
+	return os.Getenv(AdminTokenKey)
+}
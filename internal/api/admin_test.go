@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/types"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/goccy/go-json"
+)
+
+func (s *UnitTestSuite) adminDo(h *Handler, method, path, token string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.Router().ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *UnitTestSuite) TestAdminClients() {
+	s.T().Setenv(flow.KeyHashMemoryKiBEnvKey, "8192")
+	s.T().Setenv(flow.KeyHashTimeEnvKey, "1")
+	ctx := context.Background()
+	clientStore := newMemClientStore(map[string]types.ClientConfig{})
+	h := NewHandler(clientStore, newMemDataStore(), &recordingPublisher{})
+	h.AdminToken = "admin-token"
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		return s.adminDo(h, method, path, "admin-token", body)
+	}
+
+	// Create
+	rec := do(http.MethodPut, "/admin/clients/admin-c1",
+		`{"client_name":"c1","client_key":"client-key-123","client_rpm":10,"trigger":{"field":"status"}}`)
+	s.Require().Equal(http.StatusCreated, rec.Code, rec.Body.String())
+	var put types.ClientConfig
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &put))
+	s.Equal("admin-c1", put.ClientID)
+	s.Empty(put.ClientKey, "only the hash is stored")
+	s.True(flow.IsKeyHash(put.ClientKeyHash))
+
+	// Fetch
+	rec = do(http.MethodGet, "/admin/clients/admin-c1", "")
+	s.Require().Equal(http.StatusOK, rec.Code)
+	var got types.ClientConfig
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &got))
+	s.Equal(put, got)
+	s.Equal(http.StatusNotFound, do(http.MethodGet, "/admin/clients/missing", "").Code)
+
+	// The client authenticates, caching its config
+	s.Equal(http.StatusAccepted, s.notify(h, "admin-c1", []byte(`{"status":"up"}`), ""),
+		"authenticates with the key")
+
+	// List
+	rec = do(http.MethodGet, "/admin/clients", "")
+	s.Require().Equal(http.StatusOK, rec.Code)
+	s.JSONEq(`{"clients":["admin-c1"]}`, rec.Body.String())
+
+	// Update, visible to the next request despite the cache
+	rec = do(http.MethodPut, "/admin/clients/admin-c1",
+		`{"client_id":"admin-c1","client_name":"c1","client_key":"key-0123456789","trigger":{"field":"status"}}`)
+	s.Require().Equal(http.StatusOK, rec.Code, rec.Body.String())
+	s.Equal(http.StatusUnauthorized, s.notify(h, "admin-c1", []byte(`{"status":"down"}`), ""), "key rotated")
+	stored, err := clientStore.GetClientConfig(ctx, "admin-c1")
+	s.NoError(err)
+	s.Zero(stored.ClientRPM)
+	s.NotEqual(put.ClientKeyHash, stored.ClientKeyHash)
+
+	// Validation failures leave the stored config as is
+	for _, body := range []string{
+		`{"client_name":"c1","client_key":"short","trigger":{"field":"status"}}`,
+		`{"client_id":"other-client","client_name":"c1","client_key":"client-key-123","trigger":{"field":"status"}}`,
+		`{"client_name":"c1","client_key":"client-key-123","trigger":{"field":"status"},"no_such_field":1}`,
+		`not json`,
+	} {
+		s.Equal(http.StatusBadRequest, do(http.MethodPut, "/admin/clients/admin-c1", body).Code, body)
+	}
+	again, _ := clientStore.GetClientConfig(ctx, "admin-c1")
+	s.Equal(stored, again)
+
+	// An edit of a stale copy is refused
+	s.Equal(int64(2), stored.Version)
+	rec = do(http.MethodPut, "/admin/clients/admin-c1",
+		`{"version":1,"client_name":"c1","client_key":"client-key-123","client_rpm":5,"trigger":{"field":"status"}}`)
+	s.Equal(http.StatusConflict, rec.Code)
+	s.Contains(rec.Body.String(), "changed since version 1")
+	again, _ = clientStore.GetClientConfig(ctx, "admin-c1")
+	s.Equal(stored, again)
+	rec = do(http.MethodPut, "/admin/clients/admin-c1",
+		`{"version":2,"client_name":"c1","client_key":"client-key-123","client_rpm":5,"trigger":{"field":"status"}}`)
+	s.Require().Equal(http.StatusOK, rec.Code, rec.Body.String())
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &put))
+	s.Equal(int64(3), put.Version)
+
+	// Delete
+	s.Equal(http.StatusOK, do(http.MethodPut, "/admin/clients/admin-c1",
+		`{"client_name":"c1","client_key":"client-key-123","trigger":{"field":"status"}}`).Code)
+	s.Equal(http.StatusAccepted, s.notify(h, "admin-c1", []byte(`{"status":"up"}`), ""))
+	s.Equal(http.StatusNoContent, do(http.MethodDelete, "/admin/clients/admin-c1", "").Code)
+	s.Equal(http.StatusNotFound, do(http.MethodDelete, "/admin/clients/admin-c1", "").Code)
+	s.Equal(http.StatusNotFound, do(http.MethodGet, "/admin/clients/admin-c1", "").Code)
+	s.Equal(http.StatusUnauthorized, s.notify(h, "admin-c1", []byte(`{"status":"up"}`), ""), "not cached")
+}
+
+func (s *UnitTestSuite) TestAdminAuth() {
+	h := NewHandler(newMemClientStore(map[string]types.ClientConfig{}), newMemDataStore(), &recordingPublisher{})
+	s.Equal(http.StatusNotFound, s.adminDo(h, http.MethodGet, "/admin/clients", "", "").Code, "disabled")
+	s.Equal(http.StatusNotFound, s.adminDo(h, http.MethodGet, "/admin/clients", "guess", "").Code, "disabled")
+
+	h.AdminToken = "admin-token"
+	s.Equal(http.StatusUnauthorized, s.adminDo(h, http.MethodGet, "/admin/clients", "", "").Code)
+	s.Equal(http.StatusUnauthorized, s.adminDo(h, http.MethodGet, "/admin/clients", "admin-tokem", "").Code)
+	s.Equal(http.StatusOK, s.adminDo(h, http.MethodGet, "/admin/clients", "admin-token", "").Code)
+	s.Equal(http.StatusMethodNotAllowed, s.adminDo(h, http.MethodPost, "/admin/clients", "admin-token", "").Code)
+}
@@ -17,46 +17,112 @@ const (
 )
 
 // RunServer runs the HTTP server exposing the `/notify` endpoint. This is a blocking call.
+// The aggregate flusher runs alongside when AggregateFlushIntervalKey is set.
 func RunServer(port int,
 	clientStore ports.ClientStore,
 	dataStore ports.DataStore,
 	publisher ports.Publisher,
 ) {
-	h := NewHandler(
-		clientStore,
-		dataStore,
-		publisher,
-	)
-
-	srv := &http.Server{
-		Addr:              fmt.Sprintf(":%d", port),
-		Handler:           h.Router(),
-		ReadHeaderTimeout: 10 * time.Second,
+	srv := newServer(port, clientStore, dataStore, publisher)
+	if interval := AggregateFlushIntervalFromEnv(); interval > 0 {
+		go RunAggregateFlusher(context.Background(), interval, clientStore, dataStore, publisher)
 	}
 	log.Printf("enoti listening on %s\n", srv.Addr)
 	log.Fatal(srv.ListenAndServe())
 }
 
+// RunServerTLS is RunServer over HTTPS, presenting the certificate in certFile and its key in keyFile. With
+// clientCAFile set, clients must present a certificate issued by one of the CAs it holds (mTLS).
+func RunServerTLS(port int, certFile, keyFile, clientCAFile string,
+	clientStore ports.ClientStore,
+	dataStore ports.DataStore,
+	publisher ports.Publisher,
+) {
+	srv := newServer(port, clientStore, dataStore, publisher)
+	tlsConfig, err := serverTLSConfig(clientCAFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv.TLSConfig = tlsConfig
+	if interval := AggregateFlushIntervalFromEnv(); interval > 0 {
+		go RunAggregateFlusher(context.Background(), interval, clientStore, dataStore, publisher)
+	}
+	log.Printf("enoti listening on %s (TLS)\n", srv.Addr)
+	log.Fatal(srv.ListenAndServeTLS(certFile, keyFile))
+}
+
+// RunServerFromEnv runs RunServerTLS with the files of TLSFilesFromEnv if TLS is configured, RunServer otherwise.
+func RunServerFromEnv(port int,
+	clientStore ports.ClientStore,
+	dataStore ports.DataStore,
+	publisher ports.Publisher,
+) {
+	files, err := TLSFilesFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if files == nil {
+		RunServer(port, clientStore, dataStore, publisher)
+		return
+	}
+	RunServerTLS(port, files.CertFile, files.KeyFile, files.ClientCAFile, clientStore, dataStore, publisher)
+}
+
 // RunServerInterruptible runs the server in the background in a Go routine and immediately returns a chan to
 // the caller. The caller can then send a signal to the chan to gracefully shutdown the server.
 // It's up to the caller to wait for in the main Go routine to keep the server running.
+// The aggregate flusher runs alongside when AggregateFlushIntervalKey is set, and stops with the server.
 func RunServerInterruptible(port int,
 	clientStore ports.ClientStore,
 	dataStore ports.DataStore,
 	publisher ports.Publisher,
 ) (stop chan<- struct{}, done <-chan error) {
+	srv := newServer(port, clientStore, dataStore, publisher)
+	return serveInterruptible(srv, srv.ListenAndServe, clientStore, dataStore, publisher)
+}
+
+// RunServerInterruptibleTLS is RunServerInterruptible over HTTPS, as set up by RunServerTLS. An invalid
+// clientCAFile is reported on done.
+func RunServerInterruptibleTLS(port int, certFile, keyFile, clientCAFile string,
+	clientStore ports.ClientStore,
+	dataStore ports.DataStore,
+	publisher ports.Publisher,
+) (stop chan<- struct{}, done <-chan error) {
+	srv := newServer(port, clientStore, dataStore, publisher)
+	tlsConfig, err := serverTLSConfig(clientCAFile)
+	srv.TLSConfig = tlsConfig
+	return serveInterruptible(srv, func() error {
+		if err != nil {
+			return err
+		}
+		return srv.ListenAndServeTLS(certFile, keyFile)
+	}, clientStore, dataStore, publisher)
+}
+
+// newServer returns the HTTP server of the handler for the stores, on port.
+func newServer(port int,
+	clientStore ports.ClientStore,
+	dataStore ports.DataStore,
+	publisher ports.Publisher,
+) *http.Server {
 	h := NewHandler(
 		clientStore,
 		dataStore,
 		publisher,
 	)
-
-	srv := &http.Server{
+	return &http.Server{
 		Addr:              fmt.Sprintf(":%d", port),
 		Handler:           h.Router(),
 		ReadHeaderTimeout: 10 * time.Second,
 	}
+}
 
+// serveInterruptible runs serve, which listens with srv, in the background, for RunServerInterruptible.
+func serveInterruptible(srv *http.Server, serve func() error,
+	clientStore ports.ClientStore,
+	dataStore ports.DataStore,
+	publisher ports.Publisher,
+) (stop chan<- struct{}, done <-chan error) {
 	// one-shot channels for control & completion
 	stopCh := make(chan struct{})
 	doneCh := make(chan error, 1) // buffered so goroutines can finish without blocking
@@ -64,7 +130,7 @@ func RunServerInterruptible(port int,
 	// server goroutine
 	go func() {
 		log.Printf("enoti listening on %s\n", srv.Addr)
-		err := srv.ListenAndServe()
+		err := serve()
 		// http.ErrServerClosed is returned on Shutdown; treat that as clean exit
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			doneCh <- err
@@ -73,8 +139,14 @@ func RunServerInterruptible(port int,
 		doneCh <- nil
 	}()
 
+	flushCtx, stopFlush := context.WithCancel(context.Background())
+	if interval := AggregateFlushIntervalFromEnv(); interval > 0 {
+		go RunAggregateFlusher(flushCtx, interval, clientStore, dataStore, publisher)
+	}
+
 	go func() {
 		<-stopCh
+		stopFlush()
 		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 		defer cancel()
 		_ = srv.Shutdown(ctx) // graceful; in-flight requests get time to finish
@@ -83,13 +155,30 @@ func RunServerInterruptible(port int,
 }
 
 // RunSNSLambdaEntryPoint is for AWS Lambda entry point. This is for receiving event from SNS notifictation
-// from within an AWS Lambda. SNSInboundEvent is defined in types.go
-// TODO: implement this later
+// from within an AWS Lambda. SNSInboundEvent is defined in types/sns.go.
+// Every record is processed; the returned error joins the failures of all failed records, so Lambda retries the
+// event if any of them failed.
 func RunSNSLambdaEntryPoint(ctx context.Context,
 	event types.SNSInboundEvent,
 	clientStore ports.ClientStore,
 	edgeStore ports.DataStore,
 	publisher ports.Publisher,
 ) error {
-	return nil
+	d := &Dispatcher{ClientStore: clientStore, DataStore: edgeStore, Publisher: publisher,
+		FailMode: FailModeFromEnv()}
+	var errs []error
+	for _, record := range event.Records {
+		sns := record.SNS
+		msg, err := NewInboundMessage(sns.MessageID, sns.Message, func(name string) string {
+			return sns.MessageAttributes[name].Value
+		})
+		if err == nil {
+			err = d.Dispatch(ctx, msg)
+		}
+		if err != nil {
+			log.WithError(err).Errorf("Failed to process message %s", sns.MessageID)
+			errs = append(errs, fmt.Errorf("message %s: %w", sns.MessageID, err))
+		}
+	}
+	return errors.Join(errs...)
 }
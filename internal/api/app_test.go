@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"enoti/internal/types"
+)
+
+func snsRecord(id, clientID, clientKey, message string) types.SNSInboundRecord {
+	attrs := map[string]types.SNSMessageAttribute{}
+	if clientID != "" {
+		attrs[types.ClientIDHdrName] = types.SNSMessageAttribute{Type: "String", Value: clientID}
+	}
+	if clientKey != "" {
+		attrs[types.ClientKeyHdrName] = types.SNSMessageAttribute{Type: "String", Value: clientKey}
+	}
+	return types.SNSInboundRecord{
+		EventSource: "aws:sns",
+		SNS:         types.SNSMessage{MessageID: id, Message: message, MessageAttributes: attrs},
+	}
+}
+
+func (s *UnitTestSuite) TestRunSNSLambdaEntryPoint() {
+	ctx := context.Background()
+	const topic = "arn:aws:sns:us-east-1:000000000000:out"
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"sns-client": {
+			ClientKey: "secret",
+			Trigger: types.TriggerConfig{
+				FieldExpr: "state",
+				Target:    types.TargetConfig{SNSArn: topic, SNSRPM: 100},
+			},
+		},
+	})
+	publisher := &recordingPublisher{}
+
+	event := types.SNSInboundEvent{Records: []types.SNSInboundRecord{
+		snsRecord("m1", "sns-client", "secret", `{"state":"up"}`),
+		// Same value again: no edge, so nothing is published
+		snsRecord("m2", "sns-client", "secret", `{"state":"up"}`),
+		snsRecord("m3", "sns-client", "secret", `{"state":"down"}`),
+	}}
+	err := RunSNSLambdaEntryPoint(ctx, event, clientStore, newMemDataStore(), publisher)
+	s.NoError(err)
+	s.Equal([]publishedMessage{
+		{Destination: topic, Payload: `{"state":"up"}`},
+		{Destination: topic, Payload: `{"state":"down"}`},
+	}, publisher.messages)
+}
+
+func (s *UnitTestSuite) TestRunSNSLambdaEntryPointFailures() {
+	ctx := context.Background()
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"sns-client-2": {ClientKey: "secret"},
+	})
+	publisher := &recordingPublisher{}
+
+	event := types.SNSInboundEvent{Records: []types.SNSInboundRecord{
+		snsRecord("bad-key", "sns-client-2", "wrong", `{}`),
+		snsRecord("no-key", "sns-client-2", "", `{}`),
+		snsRecord("bad-json", "sns-client-2", "secret", `not json`),
+		snsRecord("unknown", "nobody", "secret", `{}`),
+		snsRecord("ok", "sns-client-2", "secret", `{"a":1}`),
+	}}
+	err := RunSNSLambdaEntryPoint(ctx, event, clientStore, newMemDataStore(), publisher)
+	s.Error(err)
+	for _, id := range []string{"bad-key", "no-key", "bad-json", "unknown"} {
+		s.Contains(err.Error(), "message "+id+":")
+	}
+	s.NotContains(err.Error(), "message ok:")
+	// The valid record is still processed
+	s.Len(publisher.messages, 1)
+}
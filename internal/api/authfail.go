@@ -0,0 +1,117 @@
+package api
+
+import (
+	"enoti/internal/flow"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	AuthFailWindowKey     = "AUTH_FAIL_WINDOW_SECONDS"
+	AuthFailAlertAfterKey = "AUTH_FAIL_ALERT_AFTER"
+	AuthFailBlockAfterKey = "AUTH_FAIL_BLOCK_AFTER"
+	AuthFailBlockForKey   = "AUTH_FAIL_BLOCK_SECONDS"
+)
+
+// Defaults of AuthFailPolicyFromEnv.
+const (
+	DefaultAuthFailWindowSeconds = 300
+	DefaultAuthFailAlertAfter    = 20
+	DefaultAuthFailBlockAfter    = 10
+	DefaultAuthFailBlockSeconds  = 900
+)
+
+// AuthFailPolicyFromEnv builds the authentication failure policy from environment variables. By default failures
+// are counted over 5 minutes and alerted on after 20 per client; an IP with more than 10 failures in the window is
+// answered 429 for 15 minutes, whatever credentials it presents. AUTH_FAIL_BLOCK_AFTER=0 turns blocking off.
+func AuthFailPolicyFromEnv() flow.AuthFailPolicy {
+	return flow.AuthFailPolicy{
+		Window:     time.Duration(envInt(AuthFailWindowKey, DefaultAuthFailWindowSeconds)) * time.Second,
+		AlertAfter: envInt(AuthFailAlertAfterKey, DefaultAuthFailAlertAfter),
+		BlockAfter: envInt(AuthFailBlockAfterKey, DefaultAuthFailBlockAfter),
+		BlockFor:   time.Duration(envInt(AuthFailBlockForKey, DefaultAuthFailBlockSeconds)) * time.Second,
+		OnAlert: func(clientID, ip string) {
+			log.WithFields(log.Fields{"clientID": clientID, "ip": ip}).Warn("repeated authentication failures")
+		},
+	}
+}
+
+// TrustedProxiesKey lists the reverse proxies in front of the server, comma separated IPs or CIDR prefixes. Only
+// the requests they forward have the source IP of their authentication failures taken from X-Forwarded-For.
+const TrustedProxiesKey = "TRUSTED_PROXIES"
+
+// TrustedProxiesFromEnv returns the prefixes in "TRUSTED_PROXIES"; invalid entries are skipped.
+func TrustedProxiesFromEnv() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for v := range strings.SplitSeq(os.Getenv(TrustedProxiesKey), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(v)
+			if aerr != nil {
+				log.WithField("value", v).Warnf("invalid entry in %s", TrustedProxiesKey)
+				continue
+			}
+			p = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes
+}
+
+// trustedProxy reports whether ip is one of the trusted proxies.
+func (h *Handler) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range h.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceIP returns the IP the authentication failures of r are counted and blocked under: the peer address, unless
+// it is a trusted proxy, in which case the last address of X-Forwarded-For that is not one. Proxies append the
+// address they got the request from, so anything before it is up to the client. The config of the client plays no
+// part: the IP is needed before the client is authenticated.
+func (h *Handler) sourceIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !h.trustedProxy(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if ip = hop; !h.trustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func envInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || v < 0 {
+		return def
+	}
+	return v
+}
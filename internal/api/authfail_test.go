@@ -0,0 +1,74 @@
+package api
+
+import (
+	"enoti/internal/flow"
+	"enoti/internal/types"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+func (s *UnitTestSuite) TestAuthFailPolicyFromEnv() {
+	p := AuthFailPolicyFromEnv()
+	s.Equal(DefaultAuthFailBlockAfter, p.BlockAfter)
+	s.Equal(5*time.Minute, p.Window)
+	s.Equal(15*time.Minute, p.BlockFor)
+
+	s.T().Setenv(AuthFailBlockAfterKey, "0")
+	s.T().Setenv(AuthFailWindowKey, "60")
+	p = AuthFailPolicyFromEnv()
+	s.Equal(0, p.BlockAfter)
+	s.Equal(time.Minute, p.Window)
+}
+
+func (s *UnitTestSuite) TestSourceIP() {
+	s.T().Setenv(TrustedProxiesKey, "10.0.0.0/8, 192.0.2.1, bogus")
+	h := &Handler{TrustedProxies: TrustedProxiesFromEnv()}
+	s.Len(h.TrustedProxies, 2)
+
+	for _, tc := range []struct {
+		remote, xff, want string
+	}{
+		{remote: "203.0.113.5:1234", want: "203.0.113.5"},
+		// Only trusted proxies forward the source IP
+		{remote: "203.0.113.5:1234", xff: "198.51.100.7", want: "203.0.113.5"},
+		{remote: "10.1.2.3:1234", xff: "198.51.100.7", want: "198.51.100.7"},
+		// Addresses left of the last untrusted hop are up to the client
+		{remote: "10.1.2.3:1234", xff: "6.6.6.6, 198.51.100.7, 192.0.2.1", want: "198.51.100.7"},
+		{remote: "10.1.2.3:1234", xff: "10.9.9.9", want: "10.9.9.9"},
+		{remote: "10.1.2.3:1234", want: "10.1.2.3"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/notify", nil)
+		r.RemoteAddr = tc.remote
+		if tc.xff != "" {
+			r.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		s.Equal(tc.want, h.sourceIP(r), "%s via %s", tc.xff, tc.remote)
+	}
+}
+
+// TestAuthFailureSpoofedIP has a client fail its authentication under forged X-Forwarded-For addresses: the
+// failures all count against its real address, which gets blocked, and the forged ones stay usable.
+func (s *UnitTestSuite) TestAuthFailureSpoofedIP() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{})
+	h := NewHandler(clientStore, newMemDataStore(), &recordingPublisher{})
+	h.AuthFail = flow.AuthFailPolicy{Window: time.Minute, BlockAfter: 2, BlockFor: time.Minute}
+	router := h.Router()
+	notify := func(remote, xff string) int {
+		r := httptest.NewRequest(http.MethodPost, "/notify", strings.NewReader(`{}`))
+		r.RemoteAddr = remote
+		r.Header.Set("X-Forwarded-For", xff)
+		r.Header.Set(types.ClientIDHdrName, "c-spoofed-ip")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for i := range 3 {
+		s.Equal(http.StatusUnauthorized, notify("203.0.113.9:1000", fmt.Sprintf("198.51.100.%d", i)))
+	}
+	s.Equal(http.StatusTooManyRequests, notify("203.0.113.9:1000", "198.51.100.99"))
+	s.Equal(http.StatusUnauthorized, notify("203.0.113.10:1000", "203.0.113.9"))
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"enoti/internal/flow"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/goccy/go-json"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// MaxBatchItems is the number of payloads a /notify/batch request may carry.
+	MaxBatchItems = 100
+	// MaxBatchBodyBytes is the size limit of a /notify/batch body, whatever the limit of the client.
+	MaxBatchBodyBytes = 4 << 20
+)
+
+// BatchItemResult is the result of one payload of a /notify/batch request. Status is the status /notify would
+// answer with for the payload alone, or "invalid", "rate_limited", "quota_exceeded" or "error" if it was refused;
+// HTTPStatus is its status code. Violations lists how an invalid payload fails the client's PayloadSchema.
+type BatchItemResult struct {
+	Index      int      `json:"index"`
+	Status     string   `json:"status"`
+	HTTPStatus int      `json:"http_status"`
+	Error      string   `json:"error,omitempty"`
+	Violations []string `json:"violations,omitempty"`
+}
+
+// traceNotifyBatch serves /notify/batch within the root span of the request.
+func (h *Handler) traceNotifyBatch(w http.ResponseWriter, r *http.Request) {
+	ctx, span := flow.StartSpan(r.Context(), "POST /notify/batch")
+	defer span.End()
+	h.handleNotifyBatch(w, r.WithContext(ctx))
+}
+
+// handleNotifyBatch handles a JSON array of payloads as many /notify requests sharing the client's config: each
+// payload is run through the flow, rate limited and published on its own, so a batch may be partially throttled.
+// The request is answered 200 with the result of every payload, in order, once all have been handled.
+func (h *Handler) handleNotifyBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	clientID, cc, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	body, ok := h.readSignedBody(w, r, clientID, cc, MaxBatchBodyBytes)
+	if !ok {
+		return
+	}
+	// Items are kept as received too, to be published as such
+	var items []json.RawMessage
+	err := json.Unmarshal(body, &items)
+	payloads := make([]map[string]any, len(items))
+	for i := 0; err == nil && i < len(items); i++ {
+		err = json.Unmarshal(items[i], &payloads[i])
+	}
+	if err != nil {
+		http.Error(w, "invalid json: expected an array of objects", http.StatusBadRequest)
+		return
+	}
+	if len(payloads) > MaxBatchItems {
+		http.Error(w, fmt.Sprintf("batch exceeds %d items", MaxBatchItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+	trace.SpanFromContext(ctx).SetAttributes(flow.AttrClientID.String(clientID), attribute.Int("items", len(payloads)))
+
+	ip := clientIP(r, cc.TrustForwardedFor == nil || *cc.TrustForwardedFor)
+	results := make([]BatchItemResult, 0, len(payloads))
+	for i, payload := range payloads {
+		violations, err := flow.ValidatePayload(cc, payload)
+		if err != nil {
+			requestLogger(ctx).WithError(err).WithField("clientID", clientID).Error("failed to compile payload schema")
+			http.Error(w, "invalid payload schema", http.StatusInternalServerError)
+			return
+		}
+		if len(violations) > 0 {
+			results = append(results, BatchItemResult{Index: i, Status: "invalid",
+				HTTPStatus: http.StatusUnprocessableEntity, Error: "payload does not match the schema",
+				Violations: violations})
+			continue
+		}
+		outcomes, statusCode, err := h.notify(ctx, clientID, ip, cc, payload, items[i])
+		res := BatchItemResult{Index: i, HTTPStatus: statusCode}
+		switch {
+		case errors.Is(err, flow.ErrRateLimited):
+			res.Status, res.Error = "rate_limited", err.Error()
+		case errors.Is(err, flow.ErrQuotaExceeded):
+			res.Status, res.Error = "quota_exceeded", err.Error()
+		case err != nil:
+			res.Status, res.Error = "error", err.Error()
+		default:
+			res.Status = flow.StatusTextMap[flow.PrimaryOutcome(outcomes).Action]
+		}
+		results = append(results, res)
+	}
+	if err := writeJSON(w, http.StatusOK, results); err != nil {
+		http.Error(w, "failed to write response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"enoti/internal/types"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// CORSAllowedOriginsKey lists the browser origins allowed to call /notify, comma separated; "*" allows any.
+const CORSAllowedOriginsKey = "CORS_ALLOWED_ORIGINS"
+
+// corsAllowedHeaders are the request headers browsers may send cross-origin.
+var corsAllowedHeaders = strings.Join([]string{
+	"content-type", types.ClientIDHdrName, types.ClientKeyHdrName, types.SignatureHdrName, types.RequestIDHdrName,
+}, ", ")
+
+// corsExposedHeaders are the response headers scripts may read cross-origin.
+var corsExposedHeaders = strings.Join([]string{
+	types.RequestIDHdrName, "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+}, ", ")
+
+// CORSPolicy decides which browser origins may call the notification endpoints. With no AllowedOrigins, the
+// default, no CORS headers are ever sent and browsers block cross-origin calls.
+type CORSPolicy struct {
+	AllowedOrigins []string
+}
+
+// CORSPolicyFromEnv returns the policy allowing the origins in "CORS_ALLOWED_ORIGINS".
+func CORSPolicyFromEnv() CORSPolicy {
+	var p CORSPolicy
+	for o := range strings.SplitSeq(os.Getenv(CORSAllowedOriginsKey), ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			p.AllowedOrigins = append(p.AllowedOrigins, strings.TrimSuffix(o, "/"))
+		}
+	}
+	return p
+}
+
+func (p CORSPolicy) allows(origin string) bool {
+	return origin != "" && (slices.Contains(p.AllowedOrigins, "*") || slices.Contains(p.AllowedOrigins, origin))
+}
+
+// cors answers the preflight requests of allowed origins and sets the CORS headers on their other requests.
+// Requests of other origins get no CORS headers; preflights are answered all the same, and the browser blocks the
+// call. The headers are withdrawn once the client is known if it does not allow the origin (see withdrawCORS).
+func (h *Handler) cors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		w.Header().Add("Vary", "Origin")
+		if h.CORS.allows(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", "600")
+			} else {
+				w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			}
+		}
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// withdrawCORS removes the CORS headers set by cors if the client restricts its origins to others.
+func withdrawCORS(w http.ResponseWriter, r *http.Request, cc types.ClientConfig) {
+	if len(cc.CORSOrigins) == 0 || slices.Contains(cc.CORSOrigins, r.Header.Get("Origin")) {
+		return
+	}
+	w.Header().Del("Access-Control-Allow-Origin")
+	w.Header().Del("Access-Control-Expose-Headers")
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bytes"
+	"enoti/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *UnitTestSuite) TestCORSPreflight() {
+	h := NewHandler(newMemClientStore(map[string]types.ClientConfig{}), newMemDataStore(), &recordingPublisher{})
+	h.CORS = CORSPolicy{AllowedOrigins: []string{"https://app.example.com"}}
+
+	for _, path := range []string{"/notify", "/notify/batch"} {
+		req := httptest.NewRequest(http.MethodOptions, path, nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "content-type,x-client-id,x-client-key")
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, req)
+
+		s.Equal(http.StatusNoContent, rec.Code, path)
+		s.Equal("https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"), path)
+		s.Contains(rec.Header().Get("Access-Control-Allow-Methods"), http.MethodPost, path)
+		allowed := rec.Header().Get("Access-Control-Allow-Headers")
+		s.Contains(allowed, types.ClientIDHdrName, path)
+		s.Contains(allowed, types.ClientKeyHdrName, path)
+	}
+}
+
+func (s *UnitTestSuite) TestCORSDisallowedOrigin() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"any-origin": {ClientKey: "client-key-123"},
+		"own-origin": {ClientKey: "client-key-123", CORSOrigins: []string{"https://own.example.com"}},
+	})
+	h := NewHandler(clientStore, newMemDataStore(), &recordingPublisher{})
+	h.CORS = CORSPolicy{AllowedOrigins: []string{"https://app.example.com", "https://own.example.com"}}
+	do := func(method, origin, clientID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/notify", bytes.NewReader([]byte(`{"state":"up"}`)))
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		req.Header.Set(types.ClientIDHdrName, clientID)
+		req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, req)
+		return rec
+	}
+	noCORS := func(rec *httptest.ResponseRecorder, msg string) {
+		for k := range rec.Header() {
+			s.False(strings.HasPrefix(k, "Access-Control-"), "%s: %s", msg, k)
+		}
+	}
+
+	rec := do(http.MethodOptions, "https://evil.example.com", "")
+	s.Equal(http.StatusNoContent, rec.Code)
+	noCORS(rec, "preflight")
+	rec = do(http.MethodPost, "https://evil.example.com", "any-origin")
+	s.Equal(http.StatusAccepted, rec.Code, "not a browser concern")
+	noCORS(rec, "notify")
+
+	rec = do(http.MethodPost, "https://app.example.com", "any-origin")
+	s.Equal("https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	s.Contains(rec.Header().Get("Access-Control-Expose-Headers"), types.RequestIDHdrName)
+
+	// A client restricting its origins
+	rec = do(http.MethodPost, "https://app.example.com", "own-origin")
+	noCORS(rec, "not an origin of the client")
+	rec = do(http.MethodPost, "https://own.example.com", "own-origin")
+	s.Equal("https://own.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	// No origins, no CORS
+	h.CORS = CORSPolicy{}
+	noCORS(do(http.MethodOptions, "https://app.example.com", ""), "off")
+}
+
+func (s *UnitTestSuite) TestCORSPolicyFromEnv() {
+	s.T().Setenv(CORSAllowedOriginsKey, " https://a.example.com/, https://b.example.com:8443 ,")
+	p := CORSPolicyFromEnv()
+	s.Equal([]string{"https://a.example.com", "https://b.example.com:8443"}, p.AllowedOrigins)
+	s.True(p.allows("https://b.example.com:8443"))
+	s.False(p.allows("https://b.example.com"))
+	s.False(p.allows(""))
+	s.True(CORSPolicy{AllowedOrigins: []string{"*"}}.allows("http://localhost:3000"))
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/ports"
+	"enoti/internal/pub"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DefaultInboundClientIP is used as the source IP of queued messages that carry none.
+const DefaultInboundClientIP = "lambda"
+
+// ClientIPAttrName is the optional message attribute carrying the original source IP.
+const ClientIPAttrName = "ClientIP"
+
+// InboundMessage is a notification received through a queue or topic rather than over HTTP.
+type InboundMessage struct {
+	ID        string
+	ClientID  string
+	ClientKey string
+	ClientIP  string
+	Body      []byte
+}
+
+// NewInboundMessage builds an InboundMessage, reading the client credentials and optional source IP through attr,
+// which returns the named message attribute or "".
+func NewInboundMessage(id, body string, attr func(name string) string) (InboundMessage, error) {
+	msg := InboundMessage{
+		ID:        id,
+		ClientID:  attr(types.ClientIDHdrName),
+		ClientKey: attr(types.ClientKeyHdrName),
+		ClientIP:  attr(ClientIPAttrName),
+		Body:      []byte(body),
+	}
+	if msg.ClientID == "" {
+		return msg, fmt.Errorf("missing required attribute: %s", types.ClientIDHdrName)
+	}
+	if msg.ClientKey == "" {
+		return msg, fmt.Errorf("missing required attribute: %s", types.ClientKeyHdrName)
+	}
+	if msg.ClientIP == "" {
+		msg.ClientIP = DefaultInboundClientIP
+	}
+	return msg, nil
+}
+
+// Dispatcher runs inbound messages through the same steps as the HTTP handler: config load, auth, flow.Run and
+// publishing per the resulting action. It is shared by the Lambda entrypoints.
+type Dispatcher struct {
+	ClientStore ports.ClientStore
+	DataStore   ports.DataStore
+	Publisher   ports.Publisher
+	// FailMode is the fail mode of clients without their own (see ClientConfig.FailMode).
+	FailMode string
+	// DeadLetterPublisher, if set, receives the messages failing permanently (see IsPermanent) at
+	// DeadLetterDestination, as a DeadLetterRecord, rather than them being retried (see DeadLetter).
+	DeadLetterPublisher   ports.Publisher
+	DeadLetterDestination string
+}
+
+// permanentError marks the error of a message that fails however many times it is retried.
+type permanentError struct{ error }
+
+func (e permanentError) Unwrap() error { return e.error }
+
+// permanent marks err as permanent (see IsPermanent).
+func permanent(err error) error {
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err, as returned by Dispatch, is one retrying the message cannot fix: the message is
+// malformed, of an unknown client, fails authentication or does not match the payload schema. Other errors, e.g.
+// those of the stores or of publishing, are transient.
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// DeadLetterRecord is what is published to the dead-letter destination for a message failing permanently. The
+// client key is left out.
+type DeadLetterRecord struct {
+	MessageID string `json:"message_id"`
+	ClientID  string `json:"client_id,omitempty"`
+	Error     string `json:"error"`
+	Body      string `json:"body"`
+	FailedAt  string `json:"failed_at"`
+}
+
+// DeadLetter takes the error of processing msg and returns the error for which the message should be retried, if
+// any: a permanent error is nil once msg is published to the dead-letter destination, and transient errors, as
+// well as all errors without a destination, are returned as they are. A failed publish is returned too, so that
+// the message is not lost.
+func (d *Dispatcher) DeadLetter(ctx context.Context, msg InboundMessage, err error) error {
+	if err == nil || !IsPermanent(err) || d.DeadLetterPublisher == nil {
+		return err
+	}
+	b, merr := json.Marshal(DeadLetterRecord{
+		MessageID: msg.ID,
+		ClientID:  msg.ClientID,
+		Error:     err.Error(),
+		Body:      string(msg.Body),
+		FailedAt:  time.Now().UTC().Format(time.RFC3339),
+	})
+	if merr != nil {
+		return errors.Join(err, merr)
+	}
+	if perr := d.DeadLetterPublisher.PublishRaw(ctx, d.DeadLetterDestination, b); perr != nil {
+		return errors.Join(err, fmt.Errorf("dead-letter: %w", perr))
+	}
+	log.WithError(err).WithFields(log.Fields{
+		"clientID":    msg.ClientID,
+		"messageID":   msg.ID,
+		"destination": d.DeadLetterDestination,
+	}).Warn("Message dead-lettered")
+	return nil
+}
+
+// ProcessRecord dispatches msg, built from a record of a queue or stream, and returns the error for which the
+// record should be retried, if any (see DeadLetter). A non-nil extractErr is the error of building msg, for which
+// the record fails permanently without being dispatched. It is the per-record flow shared by the Lambda handlers.
+func (d *Dispatcher) ProcessRecord(ctx context.Context, msg InboundMessage, extractErr error) error {
+	var err error
+	if extractErr != nil {
+		err = permanent(extractErr)
+	} else {
+		err = d.Dispatch(ctx, msg)
+	}
+	if err = d.DeadLetter(ctx, msg, err); err != nil {
+		log.WithError(err).Errorf("Failed to process message %s", msg.ID)
+	}
+	return err
+}
+
+// Dispatch processes one message. Suppressed messages are not errors; any returned error means the message
+// should be retried, unless IsPermanent.
+func (d *Dispatcher) Dispatch(ctx context.Context, msg InboundMessage) (err error) {
+	ctx, span := flow.StartSpan(ctx, "Dispatch", flow.AttrClientID.String(msg.ClientID),
+		attribute.String("message_id", msg.ID))
+	defer func() { flow.EndSpan(span, err) }()
+	ctx = withRequestID(ctx, msg.ID)
+
+	// Load and cache client config
+	cc, err := flow.LoadCachedClientConfig(ctx, d.ClientStore, msg.ClientID)
+	if errors.Is(err, types.ErrNotFound) {
+		return permanent(fmt.Errorf("load client config: %w", err))
+	}
+	if err != nil {
+		return fmt.Errorf("load client config: %w", err)
+	}
+	received := flow.ReceivedAt(ctx, cc)
+
+	// Authenticate
+	if err := flow.Auth(ctx, cc, msg.ClientID, msg.ClientKey); err != nil {
+		return permanent(fmt.Errorf("authentication failed: %w", err))
+	}
+
+	// Parse message body as JSON payload
+	var payload map[string]any
+	if err := json.Unmarshal(msg.Body, &payload); err != nil {
+		return permanent(fmt.Errorf("parse message body: %w", err))
+	}
+	if violations, err := flow.ValidatePayload(cc, payload); err != nil {
+		return fmt.Errorf("compile payload_schema: %w", err)
+	} else if len(violations) > 0 {
+		return permanent(fmt.Errorf("payload does not match the schema: %s", strings.Join(violations, "; ")))
+	}
+
+	// Run the flow processing (same as HTTP handler)
+	engine := &flow.Engine{DataStore: d.DataStore, FailMode: d.FailMode}
+	outcomes, statusCode, err := engine.RunTriggers(ctx, msg.ClientID, msg.ClientIP, cc, payload)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"clientID":   msg.ClientID,
+			"statusCode": statusCode,
+			"messageID":  msg.ID,
+		}).Error("Flow processing failed")
+		return fmt.Errorf("flow.Run: %w", err)
+	}
+
+	// Handle actions, trigger by trigger
+	var errs []error
+	for _, o := range outcomes {
+		if err := d.publish(ctx, msg, cc, payload, received, o); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// publish publishes the payload of one trigger outcome to the trigger's targets, if the outcome forwards.
+func (d *Dispatcher) publish(ctx context.Context, msg InboundMessage, cc types.ClientConfig, payload map[string]any,
+	received int64, o flow.TriggerOutcome) error {
+	fields := log.Fields{
+		"action":    flow.StatusTextMap[o.Action],
+		"clientID":  msg.ClientID,
+		"messageID": msg.ID,
+	}
+	switch o.Action {
+	case flow.NoOp, flow.SuppressFlapping, flow.SuppressDedup, flow.TargetRateLimited, flow.ClientDisabled,
+		flow.SuppressQuietHours:
+		log.WithFields(fields).Debug("Message suppressed")
+		return nil
+
+	case flow.AggregateSent, flow.EdgeTriggeredForward, flow.ForwardedAsIs:
+		err := flow.PublishOutcome(ctx, d.Publisher, cc, o, payload, received, msg.Body)
+		if errors.Is(err, flow.ErrEncode) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("publish (failed targets %v): %w", pub.FailedTargets(err), err)
+		}
+		fields["target"] = o.Trigger.Target.Destination()
+		if o.Action == flow.AggregateSent {
+			log.WithFields(fields).Info("Aggregate published")
+		} else {
+			log.WithFields(fields).Info("Message forwarded")
+		}
+		return nil
+
+	default:
+		fields["action"] = o.Action
+		log.WithFields(fields).Warn("Unknown action")
+		return nil
+	}
+}
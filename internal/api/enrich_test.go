@@ -0,0 +1,69 @@
+package api
+
+import (
+	"bytes"
+	"enoti/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+func (s *UnitTestSuite) TestNotifyEnrichMetadata() {
+	trig := types.TriggerConfig{FieldExpr: "state", Flapping: &types.FlapConfig{
+		WindowSeconds: 600, AggregateAt: 2, AggregateMaxItems: 10,
+	}}
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"enriched": {ClientID: "enriched", ClientKey: "client-key-123", Trigger: trig, EnrichMetadataKey: "_enoti"},
+		"plain":    {ClientID: "plain", ClientKey: "client-key-123", Trigger: trig},
+	})
+	publisher := &recordingPublisher{}
+	h := NewHandler(clientStore, newMemDataStore(), publisher)
+	send := func(clientID, state string) {
+		req := httptest.NewRequest(http.MethodPost, "/notify", bytes.NewReader([]byte(`{"state":"`+state+`"}`)))
+		req.Header.Set(types.ClientIDHdrName, clientID)
+		req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+		req.Header.Set(types.RequestIDHdrName, "req-"+state)
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, req)
+		s.Equal(http.StatusAccepted, rec.Code)
+	}
+	published := func(i int) map[string]any {
+		var m map[string]any
+		s.Require().NoError(json.Unmarshal([]byte(publisher.messages[i].Payload), &m))
+		return m
+	}
+
+	before := time.Now().Unix()
+	send("enriched", "up")
+	s.Require().Len(publisher.messages, 1)
+	forwarded := published(0)
+	s.Equal("up", forwarded["state"])
+	meta := forwarded["_enoti"].(map[string]any)
+	s.Equal("enriched", meta["client_id"])
+	s.Equal("edge_triggered_forward", meta["action"])
+	s.NotEmpty(meta["scope_key"])
+	s.Equal("req-up", meta["request_id"])
+	s.GreaterOrEqual(int64(meta["received_at"].(float64)), before)
+
+	// Aggregates carry it at the top level
+	send("enriched", "down")
+	send("enriched", "up")
+	s.Require().Len(publisher.messages, 2)
+	agg := published(1)
+	s.Equal("flap_aggregate", agg["type"])
+	meta = agg["_enoti"].(map[string]any)
+	s.Equal("aggregate_sent", meta["action"])
+	s.Equal(agg["scope"], meta["scope_key"])
+	s.Equal(forwarded["_enoti"].(map[string]any)["scope_key"], meta["scope_key"])
+	s.Equal("req-up", meta["request_id"])
+	for _, it := range agg["recent"].([]any) {
+		s.NotContains(it.(map[string]any)["payload"], "_enoti", "the stored payloads are the originals")
+	}
+
+	// Opt-in only
+	send("plain", "up")
+	s.Require().Len(publisher.messages, 3)
+	s.JSONEq(`{"state":"up"}`, publisher.messages[2].Payload)
+}
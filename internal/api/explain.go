@@ -0,0 +1,36 @@
+package api
+
+import (
+	"enoti/internal/flow"
+	"net/http"
+
+	"github.com/goccy/go-json"
+)
+
+// handleExplain answers with how the payload would be handled by /notify (see flow.Explain), without publishing it
+// or changing any state. The explanation is returned with 200 even if the event would be rejected.
+func (h *Handler) handleExplain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	clientID, cc, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	body, ok := h.readSignedBody(w, r, clientID, cc, h.bodyLimit(cc))
+	if !ok {
+		return
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	e := flow.Explain(r.Context(), clientID, clientIP(r, cc.TrustForwardedFor == nil || *cc.TrustForwardedFor), cc,
+		h.DataStore, payload)
+	logAction(r.Context(), e.Action)
+	if err := writeJSON(w, http.StatusOK, e); err != nil {
+		http.Error(w, "failed to write response", http.StatusInternalServerError)
+	}
+}
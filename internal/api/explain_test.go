@@ -0,0 +1,47 @@
+package api
+
+import (
+	"bytes"
+	"enoti/internal/types"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/goccy/go-json"
+)
+
+func (s *UnitTestSuite) TestExplain() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"explained": {ClientKey: "client-key-123", Triggers: []types.TriggerConfig{
+			{FieldExpr: "status", Target: types.TargetConfig{SNSArn: "arn:aws:sns:us-east-1:000000000000:status"}},
+		}},
+	})
+	publisher := &recordingPublisher{}
+	h := NewHandler(clientStore, newMemDataStore(), publisher)
+
+	explain := func(body string) map[string]any {
+		req := httptest.NewRequest(http.MethodPost, "/explain", bytes.NewReader([]byte(body)))
+		req.Header.Set(types.ClientIDHdrName, "explained")
+		req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, req)
+		s.Equal(http.StatusOK, rec.Code)
+		var e map[string]any
+		s.NoError(json.Unmarshal(rec.Body.Bytes(), &e))
+		return e
+	}
+
+	// Explaining neither publishes nor records the value, however often it is asked
+	for range 2 {
+		e := explain(`{"status":"up"}`)
+		s.Equal("edge_triggered_forward", e["action"])
+		s.Empty(publisher.messages)
+	}
+	s.Equal(http.StatusAccepted, s.notify(h, "explained", []byte(`{"status":"up"}`), ""))
+	s.Len(publisher.messages, 1)
+
+	e := explain(`{"status":"up"}`)
+	s.Equal("no_op", e["action"])
+	trigger := e["triggers"].([]any)[0].(map[string]any)
+	s.Equal("up", trigger["value"])
+	s.Equal("up", trigger["edge"].(map[string]any)["last_value"])
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/ports"
+	"enoti/internal/pub"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/goccy/go-json"
+	log "github.com/sirupsen/logrus"
+)
+
+// AggregateFlushIntervalKey sets how often, in seconds, the server flushes pending aggregates; 0 (default) disables
+// the flusher.
+const AggregateFlushIntervalKey = "AGGREGATE_FLUSH_INTERVAL_SECONDS"
+
+// AggregateFlushIntervalFromEnv returns the interval of the aggregate flusher, or 0 if it is disabled.
+func AggregateFlushIntervalFromEnv() time.Duration {
+	return time.Duration(envInt(AggregateFlushIntervalKey, 0)) * time.Second
+}
+
+// RunAggregateFlusher calls FlushPendingAggregates every interval until ctx is done.
+func RunAggregateFlusher(ctx context.Context, interval time.Duration,
+	clientStore ports.ClientStore,
+	dataStore ports.DataStore,
+	publisher ports.Publisher,
+) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			n, err := FlushPendingAggregates(ctx, clientStore, dataStore, publisher)
+			if err != nil {
+				log.WithError(err).Error("failed to flush pending aggregates")
+			}
+			if n > 0 {
+				log.WithField("count", n).Info("Pending aggregates flushed")
+			}
+		}
+	}
+}
+
+// FlushPendingAggregates publishes the aggregates that are due (see flow.AggregateDue), so flips buffered at the
+// end of a flapping window are sent even if no further event arrives. It returns how many were published.
+func FlushPendingAggregates(ctx context.Context,
+	clientStore ports.ClientStore,
+	dataStore ports.DataStore,
+	publisher ports.Publisher,
+) (int, error) {
+	pending, err := dataStore.ScanPendingAggregates(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("scan pending aggregates: %w", err)
+	}
+	now := flow.EpochTime()
+	sent := 0
+	var errs []error
+	for _, pe := range pending {
+		cc, err := flow.LoadCachedClientConfig(ctx, clientStore, pe.ClientID)
+		if err != nil {
+			// The client may have been deleted since
+			log.WithError(err).WithField("clientID", pe.ClientID).Debug("skipping pending aggregate")
+			continue
+		}
+		trig, ok := flow.TriggerForScopeKey(cc, pe.Edge.ScopeKey)
+		if !ok || !flow.AggregateDue(trig, &pe.Edge, now) {
+			continue
+		}
+		agg, err := flow.FlushAggregate(flow.WithRedactFields(ctx, cc.RedactFields), dataStore, pe.ClientID, trig,
+			&pe.Edge, pe.Version)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("flush %s/%s: %w", pe.ClientID, pe.Edge.ScopeKey, err))
+			continue
+		}
+		if agg == nil {
+			continue // an event of the scope got there first
+		}
+		if err := publishAggregate(ctx, publisher, cc, trig, &pe.Edge, agg); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sent++
+	}
+	return sent, errors.Join(errs...)
+}
+
+// handleFlush sends the pending aggregate of the scope given as `{"scope_key": "..."}` right away, whether or not
+// its flapping window is over; the scope key is the "scope" of the aggregates. It answers 204 if there is nothing
+// to send.
+func (h *Handler) handleFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	clientID, cc, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	body, ok := h.readSignedBody(w, r, clientID, cc, h.bodyLimit(cc))
+	if !ok {
+		return
+	}
+	var req struct {
+		ScopeKey string `json:"scope_key"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.ScopeKey == "" {
+		http.Error(w, "scope_key is required", http.StatusBadRequest)
+		return
+	}
+	trig, ok := flow.TriggerForScopeKey(cc, req.ScopeKey)
+	if !ok {
+		http.Error(w, "unknown scope_key", http.StatusBadRequest)
+		return
+	}
+	edge, ver, err := h.DataStore.Load(ctx, clientID, req.ScopeKey)
+	if err != nil {
+		requestLogger(ctx).WithError(err).WithField("clientID", clientID).Error("failed to load edge state")
+		http.Error(w, "failed to load edge state", http.StatusInternalServerError)
+		return
+	}
+	if edge == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	redacted := flow.WithRedactFields(ctx, cc.RedactFields)
+	agg, err := flow.FlushAggregate(redacted, h.DataStore, clientID, trig, edge, ver)
+	if err != nil {
+		requestLogger(ctx).WithError(err).WithField("clientID", clientID).Error("failed to flush aggregate")
+		http.Error(w, "failed to flush aggregate", http.StatusInternalServerError)
+		return
+	}
+	if agg == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := publishAggregate(ctx, h.Pub, cc, trig, edge, agg); err != nil {
+		requestLogger(ctx).WithError(err).WithField("clientID", clientID).Error("publish failed")
+		http.Error(w, "failed to publish", http.StatusInternalServerError)
+		return
+	}
+	logAction(ctx, flow.StatusTextMap[flow.AggregateSent])
+	resp := map[string]any{"status": flow.StatusTextMap[flow.AggregateSent]}
+	if err := writeJSON(w, http.StatusAccepted, resp); err != nil {
+		http.Error(w, "failed to write response", http.StatusInternalServerError)
+	}
+}
+
+// publishAggregate publishes agg, flushed from edge, to the targets of trig of the client.
+func publishAggregate(ctx context.Context, publisher ports.Publisher, cc types.ClientConfig, trig types.TriggerConfig,
+	edge *types.Edge, agg map[string]any) error {
+	agg = flow.Enrich(ctx, cc, flow.AggregateSent, edge.ScopeKey, flow.ReceivedAt(ctx, cc), agg)
+	b, err := flow.EncodeAggregate(trig, agg)
+	if err != nil {
+		return fmt.Errorf("encode aggregate payload: %w", err)
+	}
+	ctx = ports.WithPublishValue(ports.WithPublishKey(ctx, edge.ScopeKey), edge.LastValue)
+	if err := flow.PublishTargets(ctx, publisher, trig.AllTargets(), b); err != nil {
+		return fmt.Errorf("publish aggregate (failed targets %v): %w", pub.FailedTargets(err), err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bytes"
+	"enoti/internal/flow"
+	"enoti/internal/types"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/goccy/go-json"
+)
+
+func (s *UnitTestSuite) TestFlush() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"flapping": {ClientKey: "client-key-123", Trigger: types.TriggerConfig{
+			FieldExpr: "state",
+			Flapping:  &types.FlapConfig{WindowSeconds: 600, AggregateAt: 5, AggregateMaxItems: 10},
+		}},
+	})
+	publisher := &recordingPublisher{}
+	h := NewHandler(clientStore, newMemDataStore(), publisher)
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader([]byte(body)))
+		req.Header.Set(types.ClientIDHdrName, "flapping")
+		req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The first value is forwarded, the next flips stay below aggregate_at
+	for _, state := range []string{"up", "down", "up", "down"} {
+		s.Equal(http.StatusAccepted, post("/notify", `{"state":"`+state+`"}`).Code)
+	}
+	s.Len(publisher.messages, 1)
+
+	scopeKey := flow.ComputeKey("state")
+	rec := post("/flush", `{"scope_key":"`+scopeKey+`"}`)
+	s.Equal(http.StatusAccepted, rec.Code)
+	s.JSONEq(`{"status":"aggregate_sent"}`, rec.Body.String())
+	s.Len(publisher.messages, 2)
+	var agg map[string]any
+	s.NoError(json.Unmarshal([]byte(publisher.messages[1].Payload), &agg))
+	s.Equal("flap_aggregate", agg["type"])
+	s.Equal(scopeKey, agg["scope"])
+	s.Len(agg["recent"], 3)
+
+	// Nothing left to send
+	s.Equal(http.StatusNoContent, post("/flush", `{"scope_key":"`+scopeKey+`"}`).Code)
+	s.Len(publisher.messages, 2)
+
+	s.Equal(http.StatusBadRequest, post("/flush", `{"scope_key":"`+flow.ComputeKey("other")+`"}`).Code)
+	s.Equal(http.StatusBadRequest, post("/flush", `{}`).Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/flush", bytes.NewReader([]byte(`{"scope_key":"`+scopeKey+`"}`)))
+	req.Header.Set(types.ClientIDHdrName, "flapping")
+	req.Header.Set(types.ClientKeyHdrName, "wrong-key-123")
+	rec = httptest.NewRecorder()
+	h.Router().ServeHTTP(rec, req)
+	s.Equal(http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// healthTimeout bounds the pings of /health, so that an unreachable backend fails the check rather than hanging it.
+const healthTimeout = 2 * time.Second
+
+// handleHealth pings the client and data stores and answers 200, or 503 listing the stores that failed. The pings
+// are made for every check; load balancers should use /livez if that is too costly.
+func (h *Handler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+	deps := map[string]func(context.Context) error{
+		"client_store": h.ClientStore.Ping,
+		"data_store":   h.DataStore.Ping,
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed []string
+	)
+	for name, ping := range deps {
+		wg.Go(func() {
+			if err := ping(ctx); err != nil {
+				requestLogger(ctx).WithError(err).WithField("dependency", name).Warn("health check failed")
+				mu.Lock()
+				failed = append(failed, name)
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		slices.Sort(failed)
+		_ = writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "unhealthy", "failed": failed})
+		return
+	}
+	_ = writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+}
+
+// handleLivez answers 200 as long as the process serves requests; it checks no dependency.
+func handleLivez(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+)
+
+// brokenDataStore is a data store whose backend is unreachable.
+type brokenDataStore struct {
+	*memDataStore
+}
+
+func (brokenDataStore) Ping(context.Context) error {
+	return errors.New("connection refused")
+}
+
+func (s *UnitTestSuite) TestHealth() {
+	get := func(h *Handler, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	h := NewHandler(newMemClientStore(nil), newMemDataStore(), &recordingPublisher{})
+	rec := get(h, "/health")
+	s.Equal(http.StatusOK, rec.Code)
+	s.JSONEq(`{"status":"ok"}`, rec.Body.String())
+
+	h = NewHandler(newMemClientStore(nil), brokenDataStore{newMemDataStore()}, &recordingPublisher{})
+	rec = get(h, "/health")
+	s.Equal(http.StatusServiceUnavailable, rec.Code)
+	s.JSONEq(`{"status":"unhealthy","failed":["data_store"]}`, rec.Body.String())
+
+	// Liveness does not depend on the stores
+	s.Equal(http.StatusOK, get(h, "/livez").Code)
+}
@@ -3,20 +3,47 @@ package api
 import (
 	"context"
 	"enoti/internal/flow"
+	"enoti/internal/metrics"
 	"enoti/internal/ports"
+	"enoti/internal/pub"
 	"enoti/internal/types"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/goccy/go-json"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Handler struct {
 	ClientStore ports.ClientStore
 	DataStore   ports.DataStore
 	Pub         ports.Publisher
+	AuthFail    flow.AuthFailPolicy
+	// MaxBodyBytes is the request body size limit of clients without their own (see ClientConfig.MaxBodyBytes).
+	MaxBodyBytes int64
+	CORS         CORSPolicy
+	// AdminToken is the bearer token of the admin API (see registerAdmin); empty disables it.
+	AdminToken string
+	// FailMode is the fail mode of clients without their own (see ClientConfig.FailMode).
+	FailMode string
+	// IdempotencyWindow is how long responses are replayed to retries with the same Idempotency-Key (see
+	// idempotent); 0 ignores the header.
+	IdempotencyWindow time.Duration
+	// Pprof serves the profiling endpoints under /debug/pprof/ (see registerPprof).
+	Pprof bool
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For is trusted for authentication failures (see
+	// sourceIP).
+	TrustedProxies []netip.Prefix
 }
 
 type Publisher interface {
@@ -28,16 +55,38 @@ func NewHandler(cl ports.ClientStore, es ports.DataStore, pub ports.Publisher) *
 		ClientStore: cl,
 		DataStore:   es,
 		Pub:         pub,
+		AuthFail:    AuthFailPolicyFromEnv(),
+
+		MaxBodyBytes: MaxBodyBytesFromEnv(),
+		CORS:         CORSPolicyFromEnv(),
+		AdminToken:   AdminTokenFromEnv(),
+		FailMode:     FailModeFromEnv(),
+
+		IdempotencyWindow: IdempotencyWindowFromEnv(),
+		Pprof:             PprofFromEnv(),
+		TrustedProxies:    TrustedProxiesFromEnv(),
 	}
 }
 
 func (h *Handler) Router() http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/notify", h.handleNotify)
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
-	return mux
+	mux.HandleFunc("/notify", h.cors(h.traceNotify))
+	mux.HandleFunc("/notify/batch", h.cors(h.traceNotifyBatch))
+	mux.HandleFunc("/flush", h.handleFlush)
+	mux.HandleFunc("/explain", h.handleExplain)
+	mux.HandleFunc("/health", h.handleHealth)
+	mux.HandleFunc("/livez", handleLivez)
+	mux.Handle("/metrics", metrics.Handler())
+	h.registerAdmin(mux)
+	h.registerPprof(mux)
+	return logRequests(mux)
+}
+
+// traceNotify serves /notify within the root span of the request; the spans of the flow are its children.
+func (h *Handler) traceNotify(w http.ResponseWriter, r *http.Request) {
+	ctx, span := flow.StartSpan(r.Context(), "POST /notify")
+	defer span.End()
+	h.handleNotify(w, r.WithContext(ctx))
 }
 
 func (h *Handler) handleNotify(w http.ResponseWriter, r *http.Request) {
@@ -45,85 +94,215 @@ func (h *Handler) handleNotify(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	clientID := r.Header.Get(types.ClientIDHdrName)
+	clientID, cc, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	body, ok := h.readSignedBody(w, r, clientID, cc, h.bodyLimit(cc))
+	if !ok {
+		return
+	}
+	h.idempotent(w, r, clientID, body, func(w http.ResponseWriter) {
+		h.serveNotify(w, r, clientID, cc, body)
+	})
+}
+
+// serveNotify answers the /notify request r of the authenticated client with the given body.
+func (h *Handler) serveNotify(w http.ResponseWriter, r *http.Request, clientID string, cc types.ClientConfig,
+	body []byte) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(flow.AttrClientID.String(clientID))
+	var payload map[string]any
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if violations, err := flow.ValidatePayload(cc, payload); err != nil {
+		requestLogger(ctx).WithError(err).WithField("clientID", clientID).Error("failed to compile payload schema")
+		http.Error(w, "invalid payload schema", http.StatusInternalServerError)
+		return
+	} else if len(violations) > 0 {
+		logAction(ctx, "invalid")
+		resp := map[string]any{"error": "payload does not match the schema", "violations": violations}
+		if err := writeJSON(w, http.StatusUnprocessableEntity, resp); err != nil {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var quota ports.Quota
+	outcomes, statusCode, err := h.notify(ports.WithQuota(ctx, &quota), clientID,
+		clientIP(r, cc.TrustForwardedFor == nil || *cc.TrustForwardedFor), cc, payload, body)
+	if len(outcomes) > 0 {
+		logAction(ctx, flow.StatusTextMap[flow.PrimaryOutcome(outcomes).Action])
+	}
+	if errors.Is(err, flow.ErrRateLimited) || statusCode == http.StatusTooManyRequests {
+		setRateLimitHeaders(w.Header(), quota)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	primary := flow.PrimaryOutcome(outcomes)
+	span.SetAttributes(flow.AttrScopeKey.String(primary.ScopeKey), flow.AttrAction.String(flow.StatusTextMap[primary.Action]))
+	resp := map[string]any{"status": flow.StatusTextMap[primary.Action]}
+	if len(cc.AllTriggers()) > 1 {
+		resp["triggers"] = triggerSummary(outcomes)
+	}
+	if err := writeJSON(w, statusCode, resp); err != nil {
+		http.Error(w, "failed to write response", http.StatusInternalServerError)
+	}
+}
+
+// notify runs the flow for one payload, received as body, and publishes the outcomes that forward. It returns the
+// outcomes and the status code to answer with; the error, if any, is meant for the client.
+func (h *Handler) notify(ctx context.Context, clientID, ip string, cc types.ClientConfig,
+	payload map[string]any, body []byte) ([]flow.TriggerOutcome, int, error) {
+	received := flow.ReceivedAt(ctx, cc)
+	engine := &flow.Engine{DataStore: h.DataStore, FailMode: h.FailMode}
+	outcomes, statusCode, err := engine.RunTriggers(ctx, clientID, ip, cc, payload)
+	if err != nil {
+		return outcomes, statusCode, err
+	}
+	for _, o := range outcomes {
+		if !o.Forwards() {
+			continue
+		}
+		err := flow.PublishOutcome(ctx, h.Pub, cc, o, payload, received, body)
+		if errors.Is(err, flow.ErrEncode) {
+			requestLogger(ctx).WithError(err).WithField("clientID", clientID).Error("failed to encode payload")
+			return outcomes, http.StatusInternalServerError, errors.New("failed to marshal payload")
+		}
+		if err != nil {
+			requestLogger(ctx).WithError(err).WithFields(log.Fields{
+				"clientID":      cc.ClientID,
+				"failedTargets": pub.FailedTargets(err),
+			}).Error("publish failed")
+			return outcomes, http.StatusInternalServerError, errors.New("failed to publish")
+		}
+		statusCode = http.StatusAccepted
+	}
+	return outcomes, statusCode, nil
+}
+
+// triggerSummary lists the field and status of every trigger outcome, for the response to clients with several
+// triggers.
+func triggerSummary(outcomes []flow.TriggerOutcome) []map[string]string {
+	summary := make([]map[string]string, 0, len(outcomes))
+	for _, o := range outcomes {
+		summary = append(summary, map[string]string{
+			"field":  o.Trigger.FieldExpr,
+			"status": flow.StatusTextMap[o.Action],
+		})
+	}
+	return summary
+}
+
+// authenticate checks the client credentials of r, recording failures, and returns the client's ID and config. On
+// failure the response is written and ok is false.
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) (clientID string, cc types.ClientConfig, ok bool) {
+	clientID = r.Header.Get(types.ClientIDHdrName)
 	clientKey := r.Header.Get(types.ClientKeyHdrName)
 	// Config (TTL cache → store)
 	ctx := r.Context()
+	logClient(ctx, clientID)
+	ip := h.sourceIP(r)
+	if flow.IPBlocked(ctx, h.DataStore, ip) {
+		http.Error(w, "too many authentication failures", http.StatusTooManyRequests)
+		return clientID, cc, false
+	}
 	cc, err := flow.LoadCachedClientConfig(ctx, h.ClientStore, clientID)
+	withdrawCORS(w, r, cc)
 	if err != nil {
+		flow.RecordAuthFailure(ctx, h.DataStore, h.AuthFail, flow.UnknownClientID, ip)
 		http.Error(w, "unknown client", http.StatusUnauthorized)
-		return
+		return clientID, cc, false
 	}
 	err = flow.Auth(ctx, cc, clientID, clientKey)
 	if err != nil {
+		flow.RecordAuthFailure(ctx, h.DataStore, h.AuthFail, clientID, ip)
 		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
+		return clientID, cc, false
+	}
+	return clientID, cc, true
+}
+
+const (
+	MaxBodyBytesKey = "MAX_BODY_BYTES"
+	// DefaultMaxBodyBytes is the request body size limit of MaxBodyBytesFromEnv.
+	DefaultMaxBodyBytes = 1 << 20
+)
+
+// MaxBodyBytesFromEnv returns the request body size limit in "MAX_BODY_BYTES", DefaultMaxBodyBytes if unset or
+// invalid.
+func MaxBodyBytesFromEnv() int64 {
+	if n := envInt(MaxBodyBytesKey, 0); n > 0 {
+		return int64(n)
+	}
+	return DefaultMaxBodyBytes
+}
+
+// FailModeKey holds the fail mode of clients without their own (see ClientConfig.FailMode).
+const FailModeKey = "FAIL_MODE"
+
+// FailModeFromEnv returns the fail mode in "FAIL_MODE", "" (fail-closed) if unset or invalid.
+func FailModeFromEnv() string {
+	switch v := os.Getenv(FailModeKey); v {
+	case "", types.FailModeOpen, types.FailModeClosed:
+		return v
+	default:
+		log.WithField("value", v).Warnf("invalid %s, failing closed", FailModeKey)
+		return ""
 	}
-	// Read body
-	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+}
+
+// bodyLimit returns the request body size limit of the client.
+func (h *Handler) bodyLimit(cc types.ClientConfig) int64 {
+	if cc.MaxBodyBytes > 0 {
+		return cc.MaxBodyBytes
+	}
+	if h.MaxBodyBytes > 0 {
+		return h.MaxBodyBytes
+	}
+	return DefaultMaxBodyBytes
+}
+
+// readSignedBody reads the non-empty body of r, of at most maxBytes, and verifies its signature (see
+// flow.VerifySignature). On failure the response is written and ok is false.
+func (h *Handler) readSignedBody(w http.ResponseWriter, r *http.Request, clientID string,
+	cc types.ClientConfig, maxBytes int64) (body []byte, ok bool) {
+	// One byte past the limit tells a body over it from one that just fits
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
 	if err != nil {
 		http.Error(w, "read error", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 	defer func() {
 		_ = r.Body.Close()
 	}()
+	if int64(len(body)) > maxBytes {
+		http.Error(w, fmt.Sprintf("body exceeds %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
 	if len(body) == 0 {
 		http.Error(w, "empty body", http.StatusBadRequest)
-		return
-	}
-	var payload map[string]any
-	err = json.Unmarshal(body, &payload)
-	if err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
-		return
-	}
-
-	action, statusCode, newPayload, err := flow.Run(
-		ctx, clientID, clientIP(r), cc,
-		h.DataStore,
-		payload)
-	if err != nil {
-		http.Error(w, err.Error(), statusCode)
-		return
+		return nil, false
 	}
-	switch action {
-	case flow.NoOp, flow.SuppressFlapping, flow.SuppressDedup:
-		if err := writeJSON(w, statusCode, map[string]any{"status": flow.StatusTextMap[action]}); err != nil {
-			http.Error(w, "failed to write response", http.StatusInternalServerError)
-		}
-	case flow.AggregateSent:
-		b, err := json.Marshal(newPayload)
-		if err != nil {
-			http.Error(w, "failed to marshal payload", http.StatusInternalServerError)
-			return
-		}
-		if err := h.Pub.PublishRaw(ctx, cc.Trigger.Target.SNSArn, b); err != nil {
-			http.Error(w, "failed to publish", http.StatusInternalServerError)
-			return
-		}
-		if err := writeJSON(w, http.StatusAccepted, map[string]any{"status": flow.StatusTextMap[action]}); err != nil {
-			http.Error(w, "failed to write response", http.StatusInternalServerError)
-		}
-	case flow.EdgeTriggeredForward, flow.ForwardedAsIs:
-		b, err := json.Marshal(payload)
-		if err != nil {
-			http.Error(w, "failed to marshal payload", http.StatusInternalServerError)
-			return
-		}
-		if err := h.Pub.PublishRaw(ctx, cc.Trigger.Target.SNSArn, b); err != nil {
-			http.Error(w, "failed to publish", http.StatusInternalServerError)
-			return
-		}
-		if err := writeJSON(w, http.StatusAccepted, map[string]any{"status": flow.StatusTextMap[action]}); err != nil {
-			http.Error(w, "failed to write response", http.StatusInternalServerError)
-		}
+	// Verify the signature over the raw bytes, before anything is parsed
+	if err := flow.VerifySignature(cc, body, r.Header.Get(types.SignatureHdrName),
+		r.Header.Get(types.TimestampHdrName)); err != nil {
+		flow.RecordAuthFailure(r.Context(), h.DataStore, h.AuthFail, clientID, h.sourceIP(r))
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
 	}
+	return body, true
 }
 
-// clientIP extracts the real client IP from X-Forwarded-For or RemoteAddr.
-func clientIP(r *http.Request) string {
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+// clientIP extracts the real client IP from X-Forwarded-For (only if trusted) or RemoteAddr.
+func clientIP(r *http.Request, trustForwarded bool) string {
+	if xff := r.Header.Get("X-Forwarded-For"); trustForwarded && xff != "" {
 		return strings.TrimSpace(strings.Split(xff, ",")[0])
 	}
 	host, _, err := net.SplitHostPort(r.RemoteAddr)
@@ -134,6 +313,19 @@ func clientIP(r *http.Request) string {
 	return host
 }
 
+// setRateLimitHeaders announces the quota of the limit that throttled the request. Retry-After and
+// X-RateLimit-Reset are both in seconds from now.
+func setRateLimitHeaders(h http.Header, q ports.Quota) {
+	if q.Limit == 0 {
+		return // the data store did not report it
+	}
+	reset := strconv.FormatInt(int64(math.Ceil(q.Reset.Seconds())), 10)
+	h.Set("Retry-After", reset)
+	h.Set("X-RateLimit-Limit", strconv.Itoa(q.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(q.Remaining))
+	h.Set("X-RateLimit-Reset", reset)
+}
+
 // writeJSON writes a JSON response with the given status code.
 func writeJSON(w http.ResponseWriter, code int, v any) error {
 	w.Header().Set("Content-Type", "application/json")
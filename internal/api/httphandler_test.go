@@ -0,0 +1,272 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+const testSigningSecret = "0123456789abcdef"
+
+func sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(testSigningSecret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *UnitTestSuite) notify(h *Handler, clientID string, body []byte, signature string) int {
+	req := httptest.NewRequest(http.MethodPost, "/notify", bytes.NewReader(body))
+	req.Header.Set(types.ClientIDHdrName, clientID)
+	req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+	if signature != "" {
+		req.Header.Set(types.SignatureHdrName, signature)
+	}
+	rec := httptest.NewRecorder()
+	h.Router().ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func (s *UnitTestSuite) TestNotifySignature() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"signed-optional": {ClientKey: "client-key-123", SigningSecret: testSigningSecret},
+		"signed-required": {ClientKey: "client-key-123", SigningSecret: testSigningSecret, SignatureRequired: true},
+	})
+	publisher := &recordingPublisher{}
+	h := NewHandler(clientStore, newMemDataStore(), publisher)
+	body := []byte(`{"state":"up"}`)
+
+	for _, id := range []string{"signed-optional", "signed-required"} {
+		s.Equal(http.StatusAccepted, s.notify(h, id, body, sign(body)), id)
+		s.Equal(http.StatusUnauthorized, s.notify(h, id, body, sign([]byte(`{"state":"down"}`))), id)
+	}
+	s.Equal(http.StatusAccepted, s.notify(h, "signed-optional", body, ""))
+	s.Equal(http.StatusUnauthorized, s.notify(h, "signed-required", body, ""))
+
+	// A bad signature is rejected before the body is parsed
+	s.Equal(http.StatusUnauthorized, s.notify(h, "signed-required", []byte("not json"), sign(body)))
+	s.Equal(http.StatusBadRequest, s.notify(h, "signed-required", []byte("not json"), sign([]byte("not json"))))
+
+	s.Len(publisher.messages, 3)
+}
+
+func (s *UnitTestSuite) TestNotifySignedTimestamp() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"timestamped": {ClientKey: "client-key-123", SigningSecret: testSigningSecret, SignatureRequired: true,
+			TimestampSkewSeconds: 300},
+	})
+	h := NewHandler(clientStore, newMemDataStore(), &recordingPublisher{})
+	body := []byte(`{"state":"up"}`)
+	send := func(at time.Time) int {
+		ts := fmt.Sprint(at.Unix())
+		req := httptest.NewRequest(http.MethodPost, "/notify", bytes.NewReader(body))
+		req.Header.Set(types.ClientIDHdrName, "timestamped")
+		req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+		req.Header.Set(types.TimestampHdrName, ts)
+		req.Header.Set(types.SignatureHdrName, sign(append([]byte(ts+"."), body...)))
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	s.Equal(http.StatusAccepted, send(time.Now()))
+	s.Equal(http.StatusUnauthorized, send(time.Now().Add(-10*time.Minute)))
+	s.Equal(http.StatusUnauthorized, send(time.Now().Add(10*time.Minute)))
+	s.Equal(http.StatusUnauthorized, s.notify(h, "timestamped", body, sign(body)), "no timestamp")
+}
+
+func (s *UnitTestSuite) TestNotifyBodyLimit() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"default-limit": {ClientKey: "client-key-123"},
+		"own-limit":     {ClientKey: "client-key-123", MaxBodyBytes: 32},
+	})
+	h := NewHandler(clientStore, newMemDataStore(), &recordingPublisher{})
+	h.MaxBodyBytes = 16
+	atLimit := []byte(`{"state":"up","pad":"xxxxxxxxx"}`)
+	s.Len(atLimit, 32)
+
+	s.Equal(http.StatusAccepted, s.notify(h, "own-limit", atLimit, ""))
+	s.Equal(http.StatusRequestEntityTooLarge, s.notify(h, "own-limit", append(atLimit, ' '), ""),
+		"not cut into invalid json")
+	s.Equal(http.StatusRequestEntityTooLarge, s.notify(h, "default-limit", atLimit, ""))
+	s.Equal(http.StatusAccepted, s.notify(h, "default-limit", []byte(`{"state":"up"}`), ""))
+}
+
+func (s *UnitTestSuite) TestNotifyDisabledClient() {
+	disabled := false
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"disabled-client": {ClientKey: "client-key-123", Enabled: &disabled},
+	})
+	publisher := &recordingPublisher{}
+	h := NewHandler(clientStore, newMemDataStore(), publisher)
+
+	req := httptest.NewRequest(http.MethodPost, "/notify", bytes.NewReader([]byte(`{"state":"up"}`)))
+	req.Header.Set(types.ClientIDHdrName, "disabled-client")
+	req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+	rec := httptest.NewRecorder()
+	h.Router().ServeHTTP(rec, req)
+	s.Equal(http.StatusForbidden, rec.Code)
+	s.JSONEq(`{"status":"client_disabled"}`, rec.Body.String())
+	s.Empty(publisher.messages)
+
+	// Bad credentials are still rejected as such
+	req = httptest.NewRequest(http.MethodPost, "/notify", bytes.NewReader([]byte(`{"state":"up"}`)))
+	req.Header.Set(types.ClientIDHdrName, "disabled-client")
+	req.Header.Set(types.ClientKeyHdrName, "wrong-key-123")
+	rec = httptest.NewRecorder()
+	h.Router().ServeHTTP(rec, req)
+	s.Equal(http.StatusUnauthorized, rec.Code)
+}
+
+func (s *UnitTestSuite) TestNotifyRateLimitHeaders() {
+	topic := "arn:aws:sns:us-east-1:000000000000:t"
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"ip-limited":     {ClientKey: "client-key-123", IPRPM: 1},
+		"client-limited": {ClientKey: "client-key-123", ClientRPM: 2, ClientWindowSeconds: 30},
+		"sns-limited": {ClientKey: "client-key-123", Trigger: types.TriggerConfig{
+			FieldExpr: "state",
+			Target:    types.TargetConfig{SNSArn: topic, SNSRPM: 1, SNSWindowSeconds: 20},
+		}},
+	})
+	h := NewHandler(clientStore, newMemDataStore(), &recordingPublisher{})
+
+	cases := []struct {
+		clientID   string
+		bodies     []string
+		statusCode int
+		limit      string
+		reset      string
+	}{
+		{"ip-limited", []string{`{"state":"up"}`, `{"state":"up"}`}, http.StatusAccepted, "1", "60"},
+		{"client-limited", []string{`{"state":"up"}`, `{"state":"up"}`, `{"state":"up"}`}, http.StatusAccepted, "2", "30"},
+		{"sns-limited", []string{`{"state":"up"}`, `{"state":"down"}`}, http.StatusTooManyRequests, "1", "20"},
+	}
+	for _, c := range cases {
+		var rec *httptest.ResponseRecorder
+		for i, body := range c.bodies {
+			req := httptest.NewRequest(http.MethodPost, "/notify", bytes.NewReader([]byte(body)))
+			req.Header.Set(types.ClientIDHdrName, c.clientID)
+			req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+			rec = httptest.NewRecorder()
+			h.Router().ServeHTTP(rec, req)
+			if i < len(c.bodies)-1 {
+				s.Empty(rec.Header().Get("Retry-After"), "%s: not throttled yet", c.clientID)
+			}
+		}
+		s.Equal(c.statusCode, rec.Code, c.clientID)
+		s.Equal(c.reset, rec.Header().Get("Retry-After"), c.clientID)
+		s.Equal(c.limit, rec.Header().Get("X-RateLimit-Limit"), c.clientID)
+		s.Equal("0", rec.Header().Get("X-RateLimit-Remaining"), c.clientID)
+		s.Equal(c.reset, rec.Header().Get("X-RateLimit-Reset"), c.clientID)
+	}
+}
+
+func (s *UnitTestSuite) TestNotifyMultipleTriggers() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"multi": {ClientKey: "client-key-123", Triggers: []types.TriggerConfig{
+			{FieldExpr: "status", Target: types.TargetConfig{SNSArn: "arn:aws:sns:us-east-1:000000000000:status"}},
+			{FieldExpr: "region_health", Target: types.TargetConfig{SNSArn: "arn:aws:sns:us-east-1:000000000000:region"}},
+		}},
+	})
+	publisher := &recordingPublisher{}
+	h := NewHandler(clientStore, newMemDataStore(), publisher)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/notify", bytes.NewReader([]byte(body)))
+		req.Header.Set(types.ClientIDHdrName, "multi")
+		req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(`{"status":"up","region_health":"ok"}`)
+	s.Equal(http.StatusAccepted, rec.Code)
+	s.JSONEq(`{"status":"edge_triggered_forward","triggers":[
+		{"field":"status","status":"edge_triggered_forward"},
+		{"field":"region_health","status":"edge_triggered_forward"}]}`, rec.Body.String())
+	s.Len(publisher.messages, 2)
+
+	rec = post(`{"status":"up","region_health":"degraded"}`)
+	s.Equal(http.StatusAccepted, rec.Code)
+	s.JSONEq(`{"status":"edge_triggered_forward","triggers":[
+		{"field":"status","status":"no_op"},
+		{"field":"region_health","status":"edge_triggered_forward"}]}`, rec.Body.String())
+	s.Len(publisher.messages, 3)
+	s.Equal("arn:aws:sns:us-east-1:000000000000:region", publisher.messages[2].Destination)
+}
+
+// downDataStore is a data store that cannot be reached.
+type downDataStore struct{ ports.DataStore }
+
+func (downDataStore) Load(context.Context, string, string) (*types.Edge, int64, error) {
+	return nil, 0, errors.New("connection refused")
+}
+
+func (s *UnitTestSuite) TestNotifyFailMode() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"failmode-default": {ClientKey: "client-key-123", Trigger: types.TriggerConfig{FieldExpr: "state"}},
+		"failmode-closed": {ClientKey: "client-key-123", Trigger: types.TriggerConfig{FieldExpr: "state"},
+			FailMode: types.FailModeClosed},
+	})
+	publisher := &recordingPublisher{}
+	h := NewHandler(clientStore, downDataStore{newMemDataStore()}, publisher)
+	body := []byte(`{"state":"up"}`)
+
+	s.Equal(http.StatusInternalServerError, s.notify(h, "failmode-default", body, ""), "fail-closed by default")
+	h.FailMode = types.FailModeOpen
+	s.Equal(http.StatusAccepted, s.notify(h, "failmode-default", body, ""))
+	s.Len(publisher.messages, 1, "forwarded as is")
+	s.Equal(http.StatusInternalServerError, s.notify(h, "failmode-closed", body, ""), "the client's own mode wins")
+}
+
+func (s *UnitTestSuite) TestFailModeFromEnv() {
+	s.T().Setenv(FailModeKey, "")
+	s.Empty(FailModeFromEnv())
+	s.T().Setenv(FailModeKey, types.FailModeOpen)
+	s.Equal(types.FailModeOpen, FailModeFromEnv())
+	s.T().Setenv(FailModeKey, "sometimes")
+	s.Empty(FailModeFromEnv(), "invalid modes fail closed")
+}
+
+func (s *UnitTestSuite) TestNotifyOutputTemplate() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"templated": {ClientKey: "client-key-123", Trigger: types.TriggerConfig{FieldExpr: "b"},
+			OutputTemplate: `{"summary": {{json .a}}, "ts": {{now}}}`},
+	})
+	publisher := &recordingPublisher{}
+	h := NewHandler(clientStore, newMemDataStore(), publisher)
+
+	before := time.Now().Unix()
+	s.Equal(http.StatusAccepted, s.notify(h, "templated", []byte(`{"a":"disk \"full\"","b":"up","c":3}`), ""))
+	s.Require().Len(publisher.messages, 1)
+	var published struct {
+		Summary string `json:"summary"`
+		TS      int64  `json:"ts"`
+	}
+	s.Require().NoError(json.Unmarshal([]byte(publisher.messages[0].Payload), &published))
+	s.Equal(fmt.Sprintf(`{"summary": "disk \"full\"", "ts": %d}`, published.TS), publisher.messages[0].Payload)
+	s.GreaterOrEqual(published.TS, before)
+	s.LessOrEqual(published.TS, time.Now().Unix())
+
+	// The edge is evaluated on the original payload, not the published body
+	s.Equal(http.StatusAccepted, s.notify(h, "templated", []byte(`{"a":"x","b":"up"}`), ""))
+	s.Len(publisher.messages, 1, "b did not change")
+
+	// Broken templates are rejected when the config is put
+	cc := types.ClientConfig{ClientID: "templated", ClientName: "templated", ClientKey: "client-key-123",
+		OutputTemplate: `{"summary": {{json .a}`}
+	s.ErrorContains(cc.Validate(), "output_template")
+	cc.OutputTemplate = `{{nope .a}}`
+	s.ErrorContains(cc.Validate(), "output_template", "unknown functions too")
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"enoti/internal/flow"
+	"enoti/internal/types"
+	"net/http"
+	"time"
+)
+
+const (
+	IdempotencyWindowKey = "IDEMPOTENCY_WINDOW_SECONDS"
+	// DefaultIdempotencyWindowSeconds is the idempotency window of IdempotencyWindowFromEnv.
+	DefaultIdempotencyWindowSeconds = 300
+	// MaxIdempotencyKeyLen is the length limit of Idempotency-Key headers.
+	MaxIdempotencyKeyLen = 255
+	// idempotencyClaim is how long an Idempotency-Key is claimed across instances, at most the window: long enough
+	// to cover the request being served.
+	idempotencyClaim = time.Minute
+)
+
+// IdempotencyWindowFromEnv returns how long the responses to /notify requests with an Idempotency-Key are
+// replayed, in "IDEMPOTENCY_WINDOW_SECONDS"; 0 ignores the header.
+func IdempotencyWindowFromEnv() time.Duration {
+	return time.Duration(envInt(IdempotencyWindowKey, DefaultIdempotencyWindowSeconds)) * time.Second
+}
+
+// idempotentResponse is the response to a request with an Idempotency-Key, replayed to its retries.
+type idempotentResponse struct {
+	bodyHash string // of the request
+	code     int
+	header   http.Header
+	body     []byte
+}
+
+// idempotentResponses holds the responses to requests with an Idempotency-Key by client and key. Keys are seldom
+// reused once the window is over, so their responses are swept.
+var idempotentResponses = flow.NewTTLWithJanitor[string, idempotentResponse](time.Minute)
+
+// responseRecorder passes a response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotent serves r with serve, unless it repeats a request of the client with the same Idempotency-Key within
+// the window: the response to that one is then replayed, marked with the Idempotent-Replayed header, without the
+// flow being run again; a key reused with another body is answered 422. Responses are kept in memory, so only the
+// instance that served a request replays it. The key is also claimed with DataStore.Suppress for idempotencyClaim,
+// so that a retry arriving while the request is still served, here or on another instance, is answered 409 rather
+// than processed twice; past the claim, a retry reaching another instance is processed again. Server errors are
+// neither kept nor claimed: the claim is released, so that the retry is processed afresh.
+func (h *Handler) idempotent(w http.ResponseWriter, r *http.Request, clientID string, body []byte,
+	serve func(w http.ResponseWriter)) {
+	key := r.Header.Get(types.IdempotencyKeyHdrName)
+	if key == "" || h.IdempotencyWindow <= 0 {
+		serve(w)
+		return
+	}
+	if len(key) > MaxIdempotencyKeyLen {
+		http.Error(w, "idempotency key too long", http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256(body)
+	bodyHash := hex.EncodeToString(sum[:])
+	hash := idempotencyHash(key)
+	cacheKey := clientID + "\x00" + hash
+	ctx := r.Context()
+	if prev, ok := idempotentResponses.Get(cacheKey); ok {
+		if prev.bodyHash != bodyHash {
+			http.Error(w, "idempotency key reused with another payload", http.StatusUnprocessableEntity)
+			return
+		}
+		logAction(ctx, "replayed")
+		for k, v := range prev.header {
+			w.Header()[k] = v
+		}
+		w.Header().Set(types.IdempotentReplayedHdrName, "true")
+		w.WriteHeader(prev.code)
+		_, _ = w.Write(prev.body)
+		return
+	}
+	seen, err := h.DataStore.Suppress(ctx, clientID, hash, min(idempotencyClaim, h.IdempotencyWindow))
+	if err != nil {
+		requestLogger(ctx).WithError(err).WithField("clientID", clientID).Error("failed to mark idempotency key")
+		http.Error(w, "idempotency check failed", http.StatusInternalServerError)
+		return
+	}
+	if seen {
+		http.Error(w, "idempotency key in use", http.StatusConflict)
+		return
+	}
+	rec := &responseRecorder{ResponseWriter: w}
+	serve(rec)
+	if rec.code >= http.StatusInternalServerError {
+		if err := h.DataStore.Release(ctx, clientID, hash); err != nil {
+			requestLogger(ctx).WithError(err).WithField("clientID", clientID).Error("failed to release idempotency key")
+		}
+		return
+	}
+	idempotentResponses.Set(cacheKey, idempotentResponse{bodyHash: bodyHash, code: rec.code,
+		header: w.Header().Clone(), body: rec.body.Bytes()}, h.IdempotencyWindow)
+}
+
+// idempotencyHash returns the Suppress hash marking the Idempotency-Key, apart from the dedup hashes of payloads.
+func idempotencyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "IDEMPOTENCY:" + hex.EncodeToString(sum[:])
+}
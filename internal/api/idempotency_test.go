@@ -0,0 +1,85 @@
+package api
+
+import (
+	"bytes"
+	"enoti/internal/types"
+	"net/http"
+	"net/http/httptest"
+)
+
+func (s *UnitTestSuite) TestNotifyIdempotencyKey() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"idempotent": {ClientKey: "client-key-123"},
+	})
+	publisher := &recordingPublisher{}
+	store := newMemDataStore()
+	h := NewHandler(clientStore, store, publisher)
+	send := func(h *Handler, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/notify", bytes.NewReader([]byte(body)))
+		req.Header.Set(types.ClientIDHdrName, "idempotent")
+		req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+		if key != "" {
+			req.Header.Set(types.IdempotencyKeyHdrName, key)
+		}
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send(h, "retry-1", `{"state":"up"}`)
+	s.Equal(http.StatusAccepted, first.Code)
+	s.Empty(first.Header().Get(types.IdempotentReplayedHdrName))
+	again := send(h, "retry-1", `{"state":"up"}`)
+	s.Equal(first.Code, again.Code)
+	s.Equal(first.Body.String(), again.Body.String())
+	s.Equal("true", again.Header().Get(types.IdempotentReplayedHdrName))
+	s.Len(publisher.messages, 1, "published once")
+
+	// The same key with another payload, and a key marked without a response here, as by another instance
+	s.Equal(http.StatusUnprocessableEntity, send(h, "retry-1", `{"state":"down"}`).Code)
+	other := NewHandler(clientStore, store, publisher)
+	s.Equal(http.StatusAccepted, send(other, "retry-2", `{"state":"up"}`).Code)
+	idempotentResponses.Delete("idempotent\x00" + idempotencyHash("retry-2"))
+	s.Equal(http.StatusConflict, send(h, "retry-2", `{"state":"up"}`).Code)
+	s.Len(publisher.messages, 2)
+
+	// Requests without a key, or with the window off, are processed every time
+	s.Equal(http.StatusAccepted, send(h, "", `{"state":"up"}`).Code)
+	h.IdempotencyWindow = 0
+	s.Equal(http.StatusAccepted, send(h, "retry-1", `{"state":"up"}`).Code)
+	s.Len(publisher.messages, 4)
+
+	s.Equal(http.StatusBadRequest, send(other, string(bytes.Repeat([]byte("k"), MaxIdempotencyKeyLen+1)),
+		`{"state":"up"}`).Code)
+}
+
+func (s *UnitTestSuite) TestNotifyIdempotencyKeyServerError() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"idempotent-error": {ClientKey: "client-key-123", Trigger: types.TriggerConfig{FieldExpr: "state"}},
+	})
+	publisher := &recordingPublisher{}
+	store := newMemDataStore()
+	h := NewHandler(clientStore, downDataStore{store}, publisher)
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/notify", bytes.NewReader([]byte(`{"state":"up"}`)))
+		req.Header.Set(types.ClientIDHdrName, "idempotent-error")
+		req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+		req.Header.Set(types.IdempotencyKeyHdrName, "retry-1")
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, req)
+		return rec
+	}
+
+	s.Equal(http.StatusInternalServerError, send().Code)
+	again := send()
+	s.Equal(http.StatusInternalServerError, again.Code, "processed again, not answered 409")
+	s.Empty(again.Header().Get(types.IdempotentReplayedHdrName))
+
+	// Once the store is back, the retry goes through and its response is the one replayed
+	h.DataStore = store
+	s.Equal(http.StatusAccepted, send().Code)
+	replay := send()
+	s.Equal(http.StatusAccepted, replay.Code)
+	s.Equal("true", replay.Header().Get(types.IdempotentReplayedHdrName))
+	s.Len(publisher.messages, 1)
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/goccy/go-json"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// KinesisClientIDFieldKey and KinesisClientKeyFieldKey are the environment variables naming the fields of the
+	// Kinesis records holding the client credentials.
+	KinesisClientIDFieldKey  = "KINESIS_CLIENT_ID_FIELD"
+	KinesisClientKeyFieldKey = "KINESIS_CLIENT_KEY_FIELD"
+
+	DefaultKinesisClientIDField  = "client_id"
+	DefaultKinesisClientKeyField = "client_key"
+)
+
+// KinesisHandler processes batches of Kinesis Data Streams records with a Dispatcher. Records carry no attributes:
+// the data of each is a JSON object holding the client credentials in two of its top-level fields, which are
+// removed from the payload before it is dispatched.
+type KinesisHandler struct {
+	*Dispatcher
+	// ClientIDField and ClientKeyField are the fields holding the client credentials; empty means
+	// DefaultKinesisClientIDField and DefaultKinesisClientKeyField.
+	ClientIDField  string
+	ClientKeyField string
+}
+
+// HandleKinesisEvent processes the records of a batch, all of the same shard, in order. The first record failing
+// (see Dispatcher.ProcessRecord) is reported as the batch item failure and the later ones are left unprocessed:
+// Lambda checkpoints the shard before it and retries from there, so records are neither skipped nor processed out
+// of order.
+func (h *KinesisHandler) HandleKinesisEvent(ctx context.Context, kinesisEvent events.KinesisEvent) (
+	events.KinesisEventResponse, error) {
+	log.Infof("Processing batch of %d records", len(kinesisEvent.Records))
+
+	for i, record := range kinesisEvent.Records {
+		msg, err := h.message(record)
+		log.WithFields(log.Fields{
+			"clientID":     msg.ClientID,
+			"messageID":    msg.ID,
+			"partitionKey": record.Kinesis.PartitionKey,
+		}).Debug("Processing record")
+		if err := h.ProcessRecord(ctx, msg, err); err != nil {
+			if rest := len(kinesisEvent.Records) - i - 1; rest > 0 {
+				log.Warnf("Leaving %d records after %s for the retry", rest, msg.ID)
+			}
+			return events.KinesisEventResponse{
+				BatchItemFailures: []events.KinesisBatchItemFailure{{ItemIdentifier: record.Kinesis.SequenceNumber}},
+			}, nil
+		}
+	}
+	return events.KinesisEventResponse{}, nil
+}
+
+// message builds the InboundMessage of a record: the data without the credential fields, as the client they name.
+// The credentials are removed from the body even if the record is invalid, so that they are never dead-lettered.
+func (h *KinesisHandler) message(record events.KinesisEventRecord) (InboundMessage, error) {
+	id := record.EventID
+	if id == "" {
+		id = record.Kinesis.SequenceNumber
+	}
+	msg := InboundMessage{ID: id, Body: record.Kinesis.Data}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(record.Kinesis.Data, &fields); err != nil {
+		return msg, fmt.Errorf("parse record data: %w", err)
+	}
+	var errs []error
+	creds := map[string]string{}
+	for _, c := range []struct{ name, field string }{
+		{types.ClientIDHdrName, cmp.Or(h.ClientIDField, DefaultKinesisClientIDField)},
+		{types.ClientKeyHdrName, cmp.Or(h.ClientKeyField, DefaultKinesisClientKeyField)},
+	} {
+		raw, ok := fields[c.field]
+		delete(fields, c.field)
+		var v string
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("missing required field: %s", c.field))
+		case json.Unmarshal(raw, &v) != nil || v == "":
+			errs = append(errs, fmt.Errorf("field %s is not a non-empty string", c.field))
+		default:
+			creds[c.name] = v
+		}
+	}
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return msg, err
+	}
+	msg.ClientID, msg.Body = creds[types.ClientIDHdrName], body
+	if len(errs) > 0 {
+		return msg, errors.Join(errs...)
+	}
+	return NewInboundMessage(id, string(body), func(name string) string { return creds[name] })
+}
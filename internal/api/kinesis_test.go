@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"enoti/internal/types"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/goccy/go-json"
+)
+
+func kinesisEvent(data ...string) events.KinesisEvent {
+	var ev events.KinesisEvent
+	for i, d := range data {
+		seq := fmt.Sprintf("4959%02d", i)
+		ev.Records = append(ev.Records, events.KinesisEventRecord{
+			EventID:     "shardId-000000000000:" + seq,
+			EventSource: "aws:kinesis",
+			Kinesis:     events.KinesisRecord{Data: []byte(d), PartitionKey: "db-1", SequenceNumber: seq},
+		})
+	}
+	return ev
+}
+
+func (s *UnitTestSuite) TestHandleKinesisEvent() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"kinesis": {ClientID: "kinesis", ClientKey: "client-key-123",
+			Trigger: types.TriggerConfig{FieldExpr: "status"}},
+	})
+	publisher, deadLetters := &recordingPublisher{}, &recordingPublisher{}
+	h := &KinesisHandler{Dispatcher: &Dispatcher{ClientStore: clientStore, DataStore: newMemDataStore(),
+		Publisher: publisher, DeadLetterPublisher: deadLetters, DeadLetterDestination: "arn:aws:sns:us-east-1:0:dlq"}}
+
+	resp, err := h.HandleKinesisEvent(context.Background(), kinesisEvent(
+		`{"client_id":"kinesis","client_key":"client-key-123","status":"down","host":"db-1"}`,
+		`{"client_id":"kinesis","client_key":"client-key-123","status":`,
+		`{"client_id":"kinesis","client_key":"client-key-123","status":"down","host":"db-1"}`,
+		`{"client_key":"client-key-123","status":"up"}`,
+		`{"client_id":"kinesis","client_key":"client-key-123","status":"up","host":"db-1"}`,
+	))
+	s.NoError(err)
+	s.Empty(resp.BatchItemFailures)
+	s.Require().Len(publisher.messages, 2)
+	s.JSONEq(`{"status":"down","host":"db-1"}`, publisher.messages[0].Payload, "credentials are not forwarded")
+	s.JSONEq(`{"status":"up","host":"db-1"}`, publisher.messages[1].Payload)
+	s.Require().Len(deadLetters.messages, 2)
+	var rec DeadLetterRecord
+	s.Require().NoError(json.Unmarshal([]byte(deadLetters.messages[1].Payload), &rec))
+	s.Equal("shardId-000000000000:495903", rec.MessageID)
+	s.Contains(rec.Error, "missing required field: client_id")
+	s.JSONEq(`{"status":"up"}`, rec.Body, "credentials are not dead-lettered")
+
+	// Without a dead-letter destination, the first failure checkpoints the batch: the later records are retried
+	h.DeadLetterPublisher = nil
+	h.ClientIDField, h.ClientKeyField = "tenant", "secret"
+	resp, err = h.HandleKinesisEvent(context.Background(), kinesisEvent(
+		`{"tenant":"kinesis","secret":"client-key-123","status":"down","host":"db-2"}`,
+		`{"tenant":"kinesis","secret":"wrong-key-123","status":"down","host":"db-3"}`,
+		`{"tenant":"kinesis","secret":"client-key-123","status":"down","host":"db-4"}`,
+	))
+	s.NoError(err)
+	s.Equal([]events.KinesisBatchItemFailure{{ItemIdentifier: "495901"}}, resp.BatchItemFailures)
+	s.Require().Len(publisher.messages, 3)
+	s.JSONEq(`{"status":"down","host":"db-2"}`, publisher.messages[2].Payload)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"net/http"
+	"regexp"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// validRequestID matches the inbound request IDs that are reused as is; anything else is replaced, so that the ID
+// is safe to log and echo.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestIDCtx struct{}
+
+// RequestID returns the ID logRequests assigned to the request of ctx, the message ID for queued messages (see
+// Dispatcher), or "" if none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtx{}).(string)
+	return id
+}
+
+// withRequestID sets the request ID of ctx, which is the publish ID (see ports.PublishID) of the events it carries
+// too, so that a request sent again publishes them with the same IDs.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return ports.WithPublishID(context.WithValue(ctx, requestIDCtx{}, id), id)
+}
+
+// requestLogger returns the logger of the request of ctx, carrying its request ID.
+func requestLogger(ctx context.Context) *log.Entry {
+	if id := RequestID(ctx); id != "" {
+		return log.WithField("requestID", id)
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// requestLog collects what the handlers learn about a request, for its log line.
+type requestLog struct {
+	clientID string
+	action   string
+}
+
+type requestLogCtx struct{}
+
+// logClient records the client of the request of ctx for its log line.
+func logClient(ctx context.Context, clientID string) {
+	if rl, ok := ctx.Value(requestLogCtx{}).(*requestLog); ok {
+		rl.clientID = clientID
+	}
+}
+
+// logAction records the resulting action of the request of ctx for its log line.
+func logAction(ctx context.Context, action string) {
+	if rl, ok := ctx.Value(requestLogCtx{}).(*requestLog); ok {
+		rl.action = action
+	}
+}
+
+// statusWriter remembers the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// logRequests assigns every request an ID, the inbound X-Request-Id if usable, which is set on the context and the
+// response, and logs one line per request once it is served. Health checks and scrapes are logged at debug level.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(types.RequestIDHdrName)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(types.RequestIDHdrName, id)
+		rl := &requestLog{}
+		ctx := context.WithValue(withRequestID(r.Context(), id), requestLogCtx{}, rl)
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		entry := requestLogger(ctx).WithFields(log.Fields{
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"statusCode": sw.status,
+			"latencyMs":  time.Since(start).Milliseconds(),
+		})
+		if rl.clientID != "" {
+			entry = entry.WithField("clientID", rl.clientID)
+		}
+		if rl.action != "" {
+			entry = entry.WithField("action", rl.action)
+		}
+		if r.URL.Path == "/health" || r.URL.Path == "/livez" || r.URL.Path == "/metrics" {
+			entry.Debug("request served")
+			return
+		}
+		entry.Info("request served")
+	})
+}
+
+// newRequestID returns a random 16-byte hex ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bytes"
+	"enoti/internal/types"
+	"net/http"
+	"net/http/httptest"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func (s *UnitTestSuite) TestRequestID() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"logged": {ClientKey: "client-key-123", Triggers: []types.TriggerConfig{
+			{FieldExpr: "status", Target: types.TargetConfig{SNSArn: "arn:aws:sns:us-east-1:000000000000:status"}},
+		}},
+	})
+	h := NewHandler(clientStore, newMemDataStore(), &recordingPublisher{})
+	hook := test.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	post := func(requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/notify", bytes.NewReader([]byte(`{"status":"up"}`)))
+		req.Header.Set(types.ClientIDHdrName, "logged")
+		req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+		if requestID != "" {
+			req.Header.Set(types.RequestIDHdrName, requestID)
+		}
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Assigned when absent, fresh for every request
+	first := post("").Header().Get("X-Request-Id")
+	s.Len(first, 32)
+	s.NotEqual(first, post("").Header().Get("X-Request-Id"))
+
+	// A supplied ID is echoed, unless it is unsafe to log
+	s.Equal("req-42", post("req-42").Header().Get("X-Request-Id"))
+	replaced := post("bad id\nforged: line").Header().Get("X-Request-Id")
+	s.Len(replaced, 32)
+
+	// One line per request, with what the handler decided
+	var served []log.Entry
+	for _, e := range hook.AllEntries() {
+		if e.Message == "request served" {
+			served = append(served, *e)
+		}
+	}
+	s.Len(served, 4)
+	entry := served[2]
+	s.Equal("req-42", entry.Data["requestID"])
+	s.Equal(http.MethodPost, entry.Data["method"])
+	s.Equal("/notify", entry.Data["path"])
+	s.Equal(http.StatusAccepted, entry.Data["statusCode"])
+	s.Equal("logged", entry.Data["clientID"])
+	s.Equal("no_op", entry.Data["action"])
+	s.Equal("edge_triggered_forward", served[0].Data["action"])
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strconv"
+)
+
+// EnablePprofKey turns on the profiling endpoints under /debug/pprof/ when true. They are off by default: they
+// are unauthenticated and reveal the internals of the process.
+const EnablePprofKey = "ENABLE_PPROF"
+
+// PprofFromEnv returns whether "ENABLE_PPROF" turns on the profiling endpoints; unset or invalid values do not.
+func PprofFromEnv() bool {
+	b, err := strconv.ParseBool(os.Getenv(EnablePprofKey))
+	return err == nil && b
+}
+
+// registerPprof adds the net/http/pprof handlers under /debug/pprof/ if h.Pprof is set. They are registered on mux
+// rather than on http.DefaultServeMux, which the server does not serve.
+func (h *Handler) registerPprof(mux *http.ServeMux) {
+	if !h.Pprof {
+		return
+	}
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"enoti/internal/types"
+	"net/http"
+	"net/http/httptest"
+)
+
+func (s *UnitTestSuite) TestPprof() {
+	get := func(path string) int {
+		h := NewHandler(newMemClientStore(map[string]types.ClientConfig{}), newMemDataStore(), &recordingPublisher{})
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	s.T().Setenv(EnablePprofKey, "")
+	s.Equal(http.StatusNotFound, get("/debug/pprof/"))
+	s.Equal(http.StatusNotFound, get("/debug/pprof/heap"))
+
+	s.T().Setenv(EnablePprofKey, "not-a-bool")
+	s.Equal(http.StatusNotFound, get("/debug/pprof/"))
+
+	s.T().Setenv(EnablePprofKey, "true")
+	s.Equal(http.StatusOK, get("/debug/pprof/"))
+	s.Equal(http.StatusOK, get("/debug/pprof/heap"))
+	s.Equal(http.StatusOK, get("/debug/pprof/cmdline"))
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/types"
+	"net/http"
+	"net/http/httptest"
+)
+
+func (s *UnitTestSuite) TestPublishBodyAsReceived() {
+	// Out of order fields, a large integer and a float with trailing zeros, none of which survive a JSON round trip
+	const body = `{"status":"down",  "id":9007199254740993,"host":{"name":"db-1","cpu":97.50},"at":"2024-01-01T00:00:00Z"}`
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"raw-as-is": {ClientID: "raw-as-is", ClientKey: "client-key-123"},
+		"raw-edge":  {ClientID: "raw-edge", ClientKey: "client-key-123", Trigger: types.TriggerConfig{FieldExpr: "status"}},
+		"raw-redacted": {ClientID: "raw-redacted", ClientKey: "client-key-123",
+			RedactFields: []string{"host.name"}},
+		"raw-enriched": {ClientID: "raw-enriched", ClientKey: "client-key-123", EnrichMetadataKey: "_enoti"},
+	})
+	publisher := &recordingPublisher{}
+	h := NewHandler(clientStore, newMemDataStore(), publisher)
+	post := func(path, clientID, body string) {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader([]byte(body)))
+		req.Header.Set(types.ClientIDHdrName, clientID)
+		req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, req)
+		s.Require().Less(rec.Code, 300, rec.Body.String())
+	}
+	last := func() string {
+		s.Require().NotEmpty(publisher.messages)
+		return publisher.messages[len(publisher.messages)-1].Payload
+	}
+
+	post("/notify", "raw-as-is", body)
+	s.Equal(body, last())
+	post("/notify", "raw-edge", body)
+	s.Equal(body, last())
+	post("/notify/batch", "raw-as-is", "[ "+body+" ,{\"status\":\"up\"}]")
+	s.Equal(body, publisher.messages[len(publisher.messages)-2].Payload)
+	s.Equal(`{"status":"up"}`, last())
+
+	d := &Dispatcher{ClientStore: clientStore, DataStore: newMemDataStore(), Publisher: publisher}
+	s.Require().NoError(d.Dispatch(context.Background(), InboundMessage{ID: "m1", ClientID: "raw-as-is",
+		ClientKey: "client-key-123", Body: []byte(body)}))
+	s.Equal(body, last())
+
+	// Transformed payloads are marshaled again
+	post("/notify", "raw-redacted", body)
+	s.NotEqual(body, last())
+	s.Contains(last(), flow.RedactMask)
+	post("/notify", "raw-enriched", body)
+	s.NotEqual(body, last())
+	s.Contains(last(), `"_enoti"`)
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"bytes"
+	"enoti/internal/types"
+	"net/http"
+	"net/http/httptest"
+)
+
+func (s *UnitTestSuite) TestNotifyRoutes() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"routed": {ClientID: "routed", ClientKey: "client-key-123",
+			Trigger: types.TriggerConfig{FieldExpr: "id", Target: types.TargetConfig{SNSArn: "arn:default"}},
+			Routes: []types.RouteConfig{
+				{Match: "severity == 'critical'", Target: types.TargetConfig{PagerDutyRoutingKey: "pd-key", SNSRPM: 1}},
+				{Match: "severity == 'warning' || severity == 'info'", Target: types.TargetConfig{
+					SlackWebhookURL: "https://hooks.slack.com/x"}},
+			}},
+	})
+	publisher := &recordingPublisher{}
+	h := NewHandler(clientStore, newMemDataStore(), publisher)
+	send := func(id, severity string) int {
+		body := `{"id":"` + id + `","severity":"` + severity + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/notify", bytes.NewReader([]byte(body)))
+		req.Header.Set(types.ClientIDHdrName, "routed")
+		req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	s.Equal(http.StatusAccepted, send("e1", "critical"))
+	s.Equal(http.StatusAccepted, send("e2", "warning"))
+	s.Equal(http.StatusAccepted, send("e3", "debug"))
+	s.Require().Len(publisher.messages, 3)
+	s.Equal(types.TargetConfig{PagerDutyRoutingKey: "pd-key"}.Destination(), publisher.messages[0].Destination)
+	s.NotContains(publisher.messages[0].Destination, "pd-key", "the routing key is a secret")
+	s.Equal(types.TargetConfig{SlackWebhookURL: "https://hooks.slack.com/x"}.Destination(), publisher.messages[1].Destination)
+	s.NotContains(publisher.messages[1].Destination, "hooks.slack.com", "the webhook URL is a secret")
+	s.Equal("arn:default", publisher.messages[2].Destination, "unmatched events keep the trigger's target")
+
+	// The target rate limit is that of the routed target
+	s.Equal(http.StatusTooManyRequests, send("e4", "critical"))
+	s.Equal(http.StatusAccepted, send("e5", "info"))
+	s.Len(publisher.messages, 4)
+
+	cc := types.ClientConfig{ClientID: "routed", ClientName: "routed", ClientKey: "client-key-123",
+		Routes: []types.RouteConfig{{Match: "a"}}}
+	s.ErrorContains(cc.Validate(), "routes[0].target has no destination")
+	cc.Routes[0].Target = types.TargetConfig{KafkaTopic: "t", FIFO: true}
+	s.ErrorContains(cc.Validate(), "routes[0]: target fifo")
+	cc.Routes[0].Target = types.TargetConfig{KafkaTopic: "t"}
+	s.NoError(cc.Validate())
+}
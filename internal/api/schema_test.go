@@ -0,0 +1,69 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"enoti/internal/types"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/goccy/go-json"
+)
+
+func (s *UnitTestSuite) TestNotifyPayloadSchema() {
+	schema := map[string]any{
+		"type":       "object",
+		"required":   []any{"severity"},
+		"properties": map[string]any{"severity": map[string]any{"enum": []any{"info", "warning", "critical"}}},
+	}
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"schema-checked": {ClientID: "schema-checked", ClientKey: "client-key-123", ClientRPM: 1,
+			PayloadSchema: schema},
+	})
+	publisher := &recordingPublisher{}
+	h := NewHandler(clientStore, newMemDataStore(), publisher)
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader([]byte(body)))
+		req.Header.Set(types.ClientIDHdrName, "schema-checked")
+		req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+		rec := httptest.NewRecorder()
+		h.Router().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Invalid payloads are refused before they count against the client's limit of 1 per minute
+	for range 3 {
+		rec := post("/notify", `{"severity":"fatal"}`)
+		s.Require().Equal(http.StatusUnprocessableEntity, rec.Code)
+		var resp struct {
+			Error      string   `json:"error"`
+			Violations []string `json:"violations"`
+		}
+		s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+		s.Equal("payload does not match the schema", resp.Error)
+		s.Require().Len(resp.Violations, 1)
+		s.Contains(resp.Violations[0], "/severity: ")
+	}
+	s.Empty(publisher.messages)
+
+	rec := post("/notify", `{"severity":"critical","host":"db-1"}`)
+	s.Equal(http.StatusAccepted, rec.Code)
+	s.Len(publisher.messages, 1)
+
+	// Batches refuse the invalid items alone
+	rec = post("/notify/batch", `[{"host":"db-1"},{"severity":"info"}]`)
+	s.Require().Equal(http.StatusOK, rec.Code)
+	var results []BatchItemResult
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &results))
+	s.Require().Len(results, 2)
+	s.Equal("invalid", results[0].Status)
+	s.Equal(http.StatusUnprocessableEntity, results[0].HTTPStatus)
+	s.Len(results[0].Violations, 1)
+	s.Equal("rate_limited", results[1].Status, "the valid item counts against the limit")
+
+	// So do queued messages
+	d := &Dispatcher{ClientStore: clientStore, DataStore: newMemDataStore(), Publisher: publisher}
+	err := d.Dispatch(context.Background(), InboundMessage{ID: "m1", ClientID: "schema-checked",
+		ClientKey: "client-key-123", Body: []byte(`{"severity":1}`)})
+	s.ErrorContains(err, "payload does not match the schema")
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"enoti/internal/flow"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	log "github.com/sirupsen/logrus"
+)
+
+// SQSQueueTypeKey is the environment variable naming the type of the queue read by the SQS Lambda.
+const SQSQueueTypeKey = "SQS_QUEUE_TYPE"
+
+// Types of SQS queues, see SQSHandler.
+const (
+	SQSQueueFIFO     = "fifo"
+	SQSQueueStandard = "standard"
+)
+
+// SQSQueueTypeFromEnv returns the queue type in "SQS_QUEUE_TYPE", SQSQueueFIFO if unset or invalid.
+func SQSQueueTypeFromEnv() string {
+	switch v := strings.ToLower(os.Getenv(SQSQueueTypeKey)); v {
+	case SQSQueueFIFO, SQSQueueStandard:
+		return v
+	case "":
+		return SQSQueueFIFO
+	default:
+		log.WithField("value", v).Warnf("invalid %s, assuming a FIFO queue", SQSQueueTypeKey)
+		return SQSQueueFIFO
+	}
+}
+
+// SQSHandler processes batches of SQS messages with a Dispatcher, reporting the messages to retry as batch item
+// failures.
+type SQSHandler struct {
+	*Dispatcher
+	// QueueType is the type of the queue the batches come from, SQSQueueFIFO unless SQSQueueStandard.
+	QueueType string
+}
+
+// HandleSQSEvent processes the messages of a batch. Those failing permanently are dead-lettered if the Dispatcher
+// has a destination for them (see Dispatcher.DeadLetter); those still failing are reported. From FIFO queues, a
+// failed message is reported along with the later messages of its message group, which are left unprocessed so
+// that they are retried in order. Standard queues order nothing: every message is processed and only those failing
+// are reported, each running the flow at the time it was sent (see flow.WithEventTime), so that one delivered late
+// does not undo a later change.
+func (h *SQSHandler) HandleSQSEvent(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	log.Infof("Processing batch of %d messages", len(sqsEvent.Records))
+
+	var batchItemFailures []events.SQSBatchItemFailure
+	failedGroups := map[string]bool{}
+	for _, record := range sqsEvent.Records {
+		group := record.Attributes["MessageGroupId"]
+		if h.QueueType != SQSQueueStandard && failedGroups[group] {
+			log.Warnf("Skipping message %s after a failure in message group %s", record.MessageId, group)
+			batchItemFailures = append(batchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: record.MessageId,
+			})
+			continue
+		}
+		if err := h.processMessage(ctx, record); err != nil {
+			batchItemFailures = append(batchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: record.MessageId,
+			})
+			failedGroups[group] = true
+		}
+	}
+
+	return events.SQSEventResponse{
+		BatchItemFailures: batchItemFailures,
+	}, nil
+}
+
+// processMessage handles a single SQS message, returning the error for which it should be retried, if any.
+func (h *SQSHandler) processMessage(ctx context.Context, record events.SQSMessage) error {
+	msg, err := NewInboundMessage(record.MessageId, record.Body, func(name string) string {
+		if a, ok := record.MessageAttributes[name]; ok && a.StringValue != nil {
+			return *a.StringValue
+		}
+		return ""
+	})
+	if err != nil {
+		return h.ProcessRecord(ctx, msg, fmt.Errorf("extract attributes: %w", err))
+	}
+
+	fields := log.Fields{"clientID": msg.ClientID, "messageID": record.MessageId}
+	if h.QueueType == SQSQueueStandard {
+		if ms, err := strconv.ParseInt(record.Attributes["SentTimestamp"], 10, 64); err == nil {
+			ctx = flow.WithEventTime(ctx, time.UnixMilli(ms))
+		}
+	} else {
+		fields["groupID"] = record.Attributes["MessageGroupId"]
+	}
+	log.WithFields(fields).Debug("Processing message")
+
+	return h.ProcessRecord(ctx, msg, nil)
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"enoti/internal/types"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/goccy/go-json"
+)
+
+// sqsRecord returns an SQS message of the client, sent at sent, in the given message group (FIFO queues only).
+func sqsRecord(id, clientID, body, group string, sent time.Time) events.SQSMessage {
+	key := "client-key-123"
+	record := events.SQSMessage{
+		MessageId: id,
+		Body:      body,
+		Attributes: map[string]string{
+			"SentTimestamp": strconv.FormatInt(sent.UnixMilli(), 10),
+		},
+		MessageAttributes: map[string]events.SQSMessageAttribute{
+			types.ClientIDHdrName:  {StringValue: &clientID, DataType: "String"},
+			types.ClientKeyHdrName: {StringValue: &key, DataType: "String"},
+		},
+	}
+	if group != "" {
+		record.Attributes["MessageGroupId"] = group
+	}
+	return record
+}
+
+func failedItems(resp events.SQSEventResponse) []string {
+	var ids []string
+	for _, f := range resp.BatchItemFailures {
+		ids = append(ids, f.ItemIdentifier)
+	}
+	return ids
+}
+
+func (s *UnitTestSuite) TestHandleSQSEventStandard() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"sqs-standard": {ClientID: "sqs-standard", ClientKey: "client-key-123",
+			Trigger: types.TriggerConfig{FieldExpr: "status"}},
+	})
+	publisher := &recordingPublisher{}
+	h := &SQSHandler{
+		Dispatcher: &Dispatcher{ClientStore: clientStore, DataStore: newMemDataStore(), Publisher: publisher},
+		QueueType:  SQSQueueStandard,
+	}
+	t0 := time.Now().Add(-time.Minute)
+	noKey := sqsRecord("m3", "sqs-standard", `{"status":"up"}`, "", t0)
+	delete(noKey.MessageAttributes, types.ClientKeyHdrName)
+
+	// Delivered out of order: the message sent first arrives last, and must not undo the later change
+	resp, err := h.HandleSQSEvent(context.Background(), events.SQSEvent{Records: []events.SQSMessage{
+		sqsRecord("m1", "sqs-standard", `{"status":"up"}`, "", t0),
+		sqsRecord("m2", "sqs-standard", `{"status":"down"}`, "", t0.Add(2*time.Second)),
+		noKey,
+		sqsRecord("m4", "sqs-standard", `not json`, "", t0.Add(3*time.Second)),
+		sqsRecord("m5", "sqs-standard", `{"status":"up"}`, "", t0.Add(time.Second)),
+		sqsRecord("m6", "sqs-unknown", `{"status":"up"}`, "", t0),
+	}})
+	s.NoError(err)
+	s.Equal([]string{"m3", "m4", "m6"}, failedItems(resp))
+	s.Require().Len(publisher.messages, 2)
+	s.JSONEq(`{"status":"down"}`, publisher.messages[1].Payload)
+}
+
+func (s *UnitTestSuite) TestHandleSQSEventFIFO() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"sqs-fifo": {ClientID: "sqs-fifo", ClientKey: "client-key-123"},
+	})
+	publisher := &recordingPublisher{}
+	s.T().Setenv(SQSQueueTypeKey, "")
+	h := &SQSHandler{
+		Dispatcher: &Dispatcher{ClientStore: clientStore, DataStore: newMemDataStore(), Publisher: publisher},
+		QueueType:  SQSQueueTypeFromEnv(),
+	}
+	s.Equal(SQSQueueFIFO, h.QueueType)
+	var records []events.SQSMessage
+	for i, group := range []string{"a", "b", "a", "a", "b"} {
+		body := fmt.Sprintf(`{"n":%d}`, i)
+		if i == 2 {
+			body = "not json"
+		}
+		records = append(records, sqsRecord(fmt.Sprint("m", i), "sqs-fifo", body, group, time.Now()))
+	}
+
+	// The messages of group a after the failed one are reported without being processed
+	resp, err := h.HandleSQSEvent(context.Background(), events.SQSEvent{Records: records})
+	s.NoError(err)
+	s.Equal([]string{"m2", "m3"}, failedItems(resp))
+	s.Require().Len(publisher.messages, 3)
+	s.Equal(`{"n":4}`, publisher.messages[2].Payload)
+}
+
+func (s *UnitTestSuite) TestHandleSQSEventDeadLetter() {
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"sqs-dlq": {ClientID: "sqs-dlq", ClientKey: "client-key-123",
+			Trigger: types.TriggerConfig{FieldExpr: "status"}},
+	})
+	deadLetters := &recordingPublisher{}
+	const dlq = "arn:aws:sns:us-east-1:000000000000:enoti-dlq"
+	h := &SQSHandler{
+		Dispatcher: &Dispatcher{ClientStore: clientStore, DataStore: downDataStore{newMemDataStore()},
+			Publisher: &recordingPublisher{}, DeadLetterPublisher: deadLetters, DeadLetterDestination: dlq},
+		QueueType: SQSQueueStandard,
+	}
+	badKey := sqsRecord("m3", "sqs-dlq", `{"status":"up"}`, "", time.Now())
+	wrong := "wrong-key-123"
+	badKey.MessageAttributes[types.ClientKeyHdrName] = events.SQSMessageAttribute{StringValue: &wrong}
+
+	// Bad JSON, an unknown client and a wrong key are dead-lettered; the data store being down is retried
+	resp, err := h.HandleSQSEvent(context.Background(), events.SQSEvent{Records: []events.SQSMessage{
+		sqsRecord("m1", "sqs-dlq", `{"status":`, "", time.Now()),
+		sqsRecord("m2", "sqs-unknown", `{"status":"up"}`, "", time.Now()),
+		badKey,
+		sqsRecord("m4", "sqs-dlq", `{"status":"up"}`, "", time.Now()),
+	}})
+	s.NoError(err)
+	s.Equal([]string{"m4"}, failedItems(resp))
+	s.Require().Len(deadLetters.messages, 3)
+	var rec DeadLetterRecord
+	s.Require().NoError(json.Unmarshal([]byte(deadLetters.messages[0].Payload), &rec))
+	s.Equal(dlq, deadLetters.messages[0].Destination)
+	s.Equal("m1", rec.MessageID)
+	s.Equal("sqs-dlq", rec.ClientID)
+	s.Equal(`{"status":`, rec.Body)
+	s.Contains(rec.Error, "parse message body")
+	s.NotEmpty(rec.FailedAt)
+	s.NotContains(deadLetters.messages[2].Payload, "wrong-key-123", "the client key is left out")
+
+	// Without a destination, permanent failures are reported as before
+	h.DeadLetterPublisher = nil
+	resp, err = h.HandleSQSEvent(context.Background(), events.SQSEvent{Records: []events.SQSMessage{
+		sqsRecord("m5", "sqs-dlq", `not json`, "", time.Now()),
+	}})
+	s.NoError(err)
+	s.Equal([]string{"m5"}, failedItems(resp))
+	s.Len(deadLetters.messages, 3)
+}
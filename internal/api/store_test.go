@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memClientStore is a minimal in-process ports.ClientStore for unit tests.
+type memClientStore struct {
+	mu      sync.Mutex
+	configs map[string]types.ClientConfig
+}
+
+func newMemClientStore(configs map[string]types.ClientConfig) *memClientStore {
+	return &memClientStore{configs: configs}
+}
+
+func (m *memClientStore) GetClientConfig(ctx context.Context, clientID string) (types.ClientConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cc, ok := m.configs[clientID]
+	if !ok {
+		return types.ClientConfig{}, types.Err(types.ErrNotFound, nil, "client %s", clientID)
+	}
+	return cc, nil
+}
+
+func (m *memClientStore) ListClients(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]string, 0, len(m.configs))
+	for id := range m.configs {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (m *memClientStore) PutClientConfig(ctx context.Context, clientID string, config types.ClientConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.configs[clientID] = config
+	return nil
+}
+
+func (m *memClientStore) PutClientConfigCAS(ctx context.Context, clientID string, expectedVersion int64,
+	config types.ClientConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.configs[clientID].Version != expectedVersion {
+		return types.VersionConflict(clientID, expectedVersion)
+	}
+	config.Version = expectedVersion + 1
+	m.configs[clientID] = config
+	return nil
+}
+
+func (m *memClientStore) DeleteClientConfig(ctx context.Context, clientID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.configs, clientID)
+	return nil
+}
+
+func (m *memClientStore) ClearAll(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.configs = map[string]types.ClientConfig{}
+	return nil
+}
+
+// memDataStore is a minimal in-process ports.DataStore for unit tests.
+type memDataStore struct {
+	mu     sync.Mutex
+	edges  map[string]types.Edge
+	counts map[string]int
+	dedup  map[string]time.Time
+}
+
+func newMemDataStore() *memDataStore {
+	return &memDataStore{edges: map[string]types.Edge{}, counts: map[string]int{}, dedup: map[string]time.Time{}}
+}
+
+func (m *memDataStore) Acquire(ctx context.Context, scope string, ratePerWindow int, window time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	granted := m.counts[scope] < ratePerWindow
+	if granted {
+		m.counts[scope]++
+		ports.ReportSlot(ctx, "0")
+	}
+	// Counts never reset, as if the window had just started
+	ports.ReportQuota(ctx, ports.Quota{Limit: ratePerWindow, Remaining: ratePerWindow - m.counts[scope], Reset: window})
+	return granted, nil
+}
+
+func (m *memDataStore) Refund(ctx context.Context, scope, slot string, ratePerWindow int, window time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[scope] = max(0, m.counts[scope]-1)
+	return nil
+}
+
+// CountQuota counts in the rate counts; quota scopes are keyed by period, so they never need to expire.
+func (m *memDataStore) CountQuota(ctx context.Context, scope string, n, limit int, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counts[scope]+max(n, 1) > limit {
+		return false, nil
+	}
+	m.counts[scope] += n
+	return true, nil
+}
+
+func (m *memDataStore) Suppress(ctx context.Context, clientID, hash string, window time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := clientID + "/" + hash
+	now := time.Now()
+	if until, ok := m.dedup[k]; ok && now.Before(until) {
+		return true, nil
+	}
+	m.dedup[k] = now.Add(window)
+	return false, nil
+}
+
+func (m *memDataStore) Release(ctx context.Context, clientID, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.dedup, clientID+"/"+hash)
+	return nil
+}
+
+// Block keeps the expiry of the block with the dedup markers, whose keys all have a slash.
+func (m *memDataStore) Block(ctx context.Context, scope string, d time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dedup["block:"+scope] = time.Now().Add(d)
+	return nil
+}
+
+func (m *memDataStore) Blocked(ctx context.Context, scope string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return time.Now().Before(m.dedup["block:"+scope]), nil
+}
+
+func (m *memDataStore) Load(ctx context.Context, clientID, scopeKey string) (*types.Edge, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.edges[clientID+"/"+scopeKey]
+	if !ok {
+		return nil, 0, nil
+	}
+	return &e, e.Version, nil
+}
+
+func (m *memDataStore) UpsertCAS(ctx context.Context, clientID, scopeKey string, prevVersion int64, next types.Edge) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := clientID + "/" + scopeKey
+	cur, ok := m.edges[k]
+	if (prevVersion == 0 && ok) || (prevVersion != 0 && (!ok || cur.Version != prevVersion)) {
+		return false, nil
+	}
+	next.ScopeKey = scopeKey
+	next.Version = prevVersion + 1
+	m.edges[k] = next
+	return true, nil
+}
+
+func (m *memDataStore) DeleteEdge(ctx context.Context, clientID, scopeKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.edges, clientID+"/"+scopeKey)
+	return nil
+}
+
+func (m *memDataStore) ScanPendingAggregates(ctx context.Context) ([]types.PendingEdge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pending []types.PendingEdge
+	for k, e := range m.edges {
+		if len(e.Recent) > 0 {
+			// Scope keys never contain a slash
+			i := strings.LastIndex(k, "/")
+			pending = append(pending, types.PendingEdge{ClientID: k[:i], Edge: e, Version: e.Version})
+		}
+	}
+	return pending, nil
+}
+
+// recordingPublisher records every published message.
+type recordingPublisher struct {
+	mu       sync.Mutex
+	messages []publishedMessage
+}
+
+type publishedMessage struct {
+	Destination string
+	Payload     string
+}
+
+var _ ports.Publisher = (*recordingPublisher)(nil)
+
+func (r *recordingPublisher) PublishRaw(ctx context.Context, arn string, payload []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, publishedMessage{Destination: arn, Payload: string(payload)})
+	return nil
+}
+
+func (m *memClientStore) Ping(context.Context) error {
+	return nil
+}
+
+func (m *memDataStore) Ping(context.Context) error {
+	return nil
+}
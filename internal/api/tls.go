@@ -0,0 +1,59 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+const (
+	TLSCertFileKey = "TLS_CERT_FILE"
+	TLSKeyFileKey  = "TLS_KEY_FILE"
+	// TLSClientCAFileKey enables mTLS: clients must present a certificate issued by one of the CAs in the file.
+	TLSClientCAFileKey = "TLS_CLIENT_CA_FILE"
+)
+
+// TLSFiles are the PEM files of a TLS server: its certificate and key and, for mTLS, the CAs of its clients.
+type TLSFiles struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+}
+
+// TLSFilesFromEnv returns the files in "TLS_CERT_FILE", "TLS_KEY_FILE" and "TLS_CLIENT_CA_FILE", or nil, serving
+// plain HTTP, if none is set. The certificate and the key go together.
+func TLSFilesFromEnv() (*TLSFiles, error) {
+	files := TLSFiles{
+		CertFile:     os.Getenv(TLSCertFileKey),
+		KeyFile:      os.Getenv(TLSKeyFileKey),
+		ClientCAFile: os.Getenv(TLSClientCAFileKey),
+	}
+	if files == (TLSFiles{}) {
+		return nil, nil
+	}
+	if files.CertFile == "" || files.KeyFile == "" {
+		return nil, fmt.Errorf("%s and %s must be set together", TLSCertFileKey, TLSKeyFileKey)
+	}
+	return &files, nil
+}
+
+// serverTLSConfig returns the TLS config of the server, requiring client certificates issued by the CAs in
+// clientCAFile if it is set.
+func serverTLSConfig(clientCAFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCAFile == "" {
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in client CA file %s", clientCAFile)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	return cfg, nil
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1, usable by servers and clients alike, and its
+// key to dir.
+func (s *UnitTestSuite) writeSelfSignedCert(dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.Require().NoError(err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "enoti-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	s.Require().NoError(err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	s.Require().NoError(err)
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	s.Require().NoError(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	s.Require().NoError(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// notifyTLS posts a notification to the server on port with client, retrying while the server is starting.
+func (s *UnitTestSuite) notifyTLS(client *http.Client, port int) (*http.Response, error) {
+	url := fmt.Sprintf("https://127.0.0.1:%d/notify", port)
+	var resp *http.Response
+	var err error
+	for range 50 {
+		req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader([]byte(`{"state":"up"}`)))
+		req.Header.Set(types.ClientIDHdrName, "tls")
+		req.Header.Set(types.ClientKeyHdrName, "client-key-123")
+		if resp, err = client.Do(req); err == nil {
+			resp.Body.Close()
+			return resp, nil
+		}
+		var opErr *net.OpError
+		if !errors.As(err, &opErr) || opErr.Op != "dial" {
+			return nil, err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return nil, err
+}
+
+func (s *UnitTestSuite) TestRunServerTLS() {
+	certFile, keyFile := s.writeSelfSignedCert(s.T().TempDir())
+	certPEM, err := os.ReadFile(certFile)
+	s.Require().NoError(err)
+	roots := x509.NewCertPool()
+	s.Require().True(roots.AppendCertsFromPEM(certPEM))
+	clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	s.Require().NoError(err)
+
+	clientStore := newMemClientStore(map[string]types.ClientConfig{"tls": {ClientKey: "client-key-123"}})
+	publisher := &recordingPublisher{}
+
+	port, err := freePort()
+	s.Require().NoError(err)
+	stop, done := RunServerInterruptibleTLS(port, certFile, keyFile, "", clientStore, newMemDataStore(), publisher)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	resp, err := s.notifyTLS(client, port)
+	s.Require().NoError(err)
+	s.Equal(http.StatusAccepted, resp.StatusCode)
+	s.Len(publisher.messages, 1)
+	close(stop)
+	s.NoError(<-done)
+
+	// With a client CA, the client must present a certificate it issued
+	port, err = freePort()
+	s.Require().NoError(err)
+	stop, done = RunServerInterruptibleTLS(port, certFile, keyFile, certFile, clientStore, newMemDataStore(), publisher)
+	defer func() {
+		close(stop)
+		s.NoError(<-done)
+	}()
+	_, err = s.notifyTLS(&http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}, port)
+	s.Error(err, "no client certificate")
+	mtlsClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientCert},
+	}}}
+	resp, err = s.notifyTLS(mtlsClient, port)
+	s.Require().NoError(err)
+	s.Equal(http.StatusAccepted, resp.StatusCode)
+	s.Len(publisher.messages, 2)
+}
+
+func (s *UnitTestSuite) TestTLSFilesFromEnv() {
+	s.T().Setenv(TLSCertFileKey, "")
+	s.T().Setenv(TLSKeyFileKey, "")
+	s.T().Setenv(TLSClientCAFileKey, "")
+	files, err := TLSFilesFromEnv()
+	s.NoError(err)
+	s.Nil(files, "plain HTTP")
+
+	s.T().Setenv(TLSCertFileKey, "cert.pem")
+	_, err = TLSFilesFromEnv()
+	s.Error(err, "no key")
+
+	s.T().Setenv(TLSKeyFileKey, "key.pem")
+	files, err = TLSFilesFromEnv()
+	s.NoError(err)
+	s.Equal(&TLSFiles{CertFile: "cert.pem", KeyFile: "key.pem"}, files)
+
+	_, err = serverTLSConfig(filepath.Join(s.T().TempDir(), "missing.pem"))
+	s.Error(err)
+}
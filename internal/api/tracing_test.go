@@ -0,0 +1,64 @@
+package api
+
+import (
+	"enoti/internal/flow"
+	"enoti/internal/types"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func (s *UnitTestSuite) TestNotifyTracing() {
+	exporter := tracetest.NewInMemoryExporter()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(prev)
+
+	clientStore := newMemClientStore(map[string]types.ClientConfig{
+		"traced": {ClientKey: "client-key-123", ClientRPM: 100, Triggers: []types.TriggerConfig{
+			{FieldExpr: "status", Target: types.TargetConfig{SNSArn: "arn:aws:sns:us-east-1:000000000000:status"}},
+		}},
+	})
+	h := NewHandler(clientStore, newMemDataStore(), &recordingPublisher{})
+
+	// actions returns the action of every span with the given name
+	actions := func(name string) []string {
+		var got []string
+		for _, span := range exporter.GetSpans() {
+			if span.Name != name {
+				continue
+			}
+			for _, a := range span.Attributes {
+				if a.Key == flow.AttrAction {
+					got = append(got, a.Value.AsString())
+				}
+			}
+		}
+		return got
+	}
+
+	s.Equal(http.StatusAccepted, s.notify(h, "traced", []byte(`{"status":"up"}`), ""))
+	var names []string
+	for _, span := range exporter.GetSpans() {
+		names = append(names, span.Name)
+	}
+	s.ElementsMatch([]string{"LoadClientConfig", "Auth", "Acquire", "EvaluateEdgeAndFlap", "Publish", "POST /notify"},
+		names)
+	root := exporter.GetSpans()[len(names)-1]
+	s.Equal("POST /notify", root.Name, "the root span ends last")
+	for _, span := range exporter.GetSpans()[:len(names)-1] {
+		s.Equal(root.SpanContext.TraceID(), span.SpanContext.TraceID(), span.Name)
+		s.True(span.Parent.IsValid(), span.Name)
+	}
+	s.Equal([]string{"edge_triggered_forward"}, actions("POST /notify"))
+	s.Equal([]string{"edge_triggered_forward"}, actions("EvaluateEdgeAndFlap"))
+
+	exporter.Reset()
+	s.Equal(http.StatusAccepted, s.notify(h, "traced", []byte(`{"status":"up"}`), ""))
+	s.Equal([]string{"no_op"}, actions("POST /notify"))
+	for _, span := range exporter.GetSpans() {
+		s.NotEqual("Publish", span.Name, "nothing is published for a no-op")
+	}
+}
@@ -2,18 +2,25 @@ package ddb
 
 import (
 	"context"
+	"encoding/base64"
 	"enoti/internal/types"
+	"fmt"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccy/go-json"
 )
 
+// ClientStore keeps client configs in DynamoDB. Config reads are eventually consistent unless
+// WithConsistentRead(true) is set: configs are fronted by an in-process TTL cache anyway, so a read that misses a
+// very recent write only delays its pickup, at half the read capacity cost.
 type ClientStore struct {
-	table string
-	cli   *dynamodb.Client
+	table          string
+	cli            *dynamodb.Client
+	consistentRead bool
 }
 
 func NewClientStore(table string, cli *dynamodb.Client) *ClientStore {
@@ -23,6 +30,17 @@ func NewClientStore(table string, cli *dynamodb.Client) *ClientStore {
 	return &ClientStore{table: table, cli: cli}
 }
 
+// WithConsistentRead sets whether config reads are strongly consistent.
+func (s *ClientStore) WithConsistentRead(consistent bool) *ClientStore {
+	s.consistentRead = consistent
+	return s
+}
+
+// Ping describes the table, which fails if DynamoDB or the table is unreachable.
+func (s *ClientStore) Ping(ctx context.Context) error {
+	return describeTable(ctx, s.cli, s.table)
+}
+
 func (s *ClientStore) GetClientConfig(ctx context.Context, id string) (types.ClientConfig, error) {
 	out, err := s.cli.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: &s.table,
@@ -30,7 +48,7 @@ func (s *ClientStore) GetClientConfig(ctx context.Context, id string) (types.Cli
 			"PK": &ddbTypes.AttributeValueMemberS{Value: pkClient(id)},
 			"SK": &ddbTypes.AttributeValueMemberS{Value: skProfile()},
 		},
-		ConsistentRead: awsBool(true),
+		ConsistentRead: awsBool(s.consistentRead),
 	})
 	if err != nil {
 		return types.ClientConfig{}, err
@@ -45,55 +63,158 @@ func (s *ClientStore) GetClientConfig(ctx context.Context, id string) (types.Cli
 	return cc, nil
 }
 
+// ListClients reads every page of ListClientsPage.
 func (s *ClientStore) ListClients(ctx context.Context) ([]string, error) {
-	// Scans the table with Pk starting with "CLIENT#"
-	// and only project the pk
-	out, err := s.cli.Query(ctx, &dynamodb.QueryInput{
+	var clientIDs []string
+	cursor := ""
+	for {
+		page, next, err := s.ListClientsPage(ctx, cursor, 0)
+		if err != nil {
+			return nil, err
+		}
+		clientIDs = append(clientIDs, page...)
+		if next == "" {
+			return clientIDs, nil
+		}
+		cursor = next
+	}
+}
+
+// ListClientsPage queries the ProfilesIndex, in client ID order. Without a limit, a page ends at 1MB. The cursor
+// is the encoded LastEvaluatedKey.
+func (s *ClientStore) ListClientsPage(ctx context.Context, cursor string, limit int) ([]string, string, error) {
+	start, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	in := &dynamodb.QueryInput{
 		TableName:              &s.table,
-		KeyConditionExpression: awsString("PK = :pk AND begins_with(SK, :sk)"),
+		IndexName:              awsString(ProfilesIndex),
+		KeyConditionExpression: awsString("GSI1PK = :p"),
 		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
-			":pk": &ddbTypes.AttributeValueMemberS{Value: "CLIENT#"},
-			":sk": &ddbTypes.AttributeValueMemberS{Value: "PROFILE#"},
+			":p": &ddbTypes.AttributeValueMemberS{Value: ProfilesPartition},
 		},
-		ProjectionExpression: awsString("PK"),
-	})
+		ExclusiveStartKey: start,
+	}
+	if limit > 0 {
+		in.Limit = aws.Int32(int32(limit))
+	}
+	out, err := s.cli.Query(ctx, in)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	clientIDs := make([]string, 0, len(out.Items))
 	for _, item := range out.Items {
-		var pk struct {
-			PK string `dynamodbav:"PK"`
+		var key struct {
+			ClientID string `dynamodbav:"GSI1SK"`
 		}
-		if err := attributevalue.UnmarshalMap(item, &pk); err != nil {
-			return nil, err
+		if err := attributevalue.UnmarshalMap(item, &key); err != nil {
+			return nil, "", err
 		}
-		id, err := parseClientID(pk.PK)
+		clientIDs = append(clientIDs, key.ClientID)
+	}
+	next, err := encodeCursor(out.LastEvaluatedKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return clientIDs, next, nil
+}
+
+// BackfillProfilesIndex sets the ProfilesIndex keys of the profiles put before the index existed, scanning the
+// whole table. It returns the number of profiles updated. Run it once when migrating a table (see ProfilesIndex).
+func (s *ClientStore) BackfillProfilesIndex(ctx context.Context) (int, error) {
+	paginator := dynamodb.NewScanPaginator(s.cli, &dynamodb.ScanInput{
+		TableName:        &s.table,
+		FilterExpression: awsString("begins_with(PK, :pk) AND SK = :sk AND attribute_not_exists(GSI1PK)"),
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":pk": &ddbTypes.AttributeValueMemberS{Value: pkClient("")},
+			":sk": &ddbTypes.AttributeValueMemberS{Value: skProfile()},
+		},
+		ProjectionExpression: awsString("PK"),
+	})
+	n := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
 		if err != nil {
-			return nil, err
+			return n, err
+		}
+		for _, item := range page.Items {
+			var key struct {
+				PK string `dynamodbav:"PK"`
+			}
+			if err := attributevalue.UnmarshalMap(item, &key); err != nil {
+				return n, err
+			}
+			id, err := parseClientID(key.PK)
+			if err != nil {
+				return n, err
+			}
+			_, err = s.cli.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: &s.table,
+				Key: map[string]ddbTypes.AttributeValue{
+					"PK": &ddbTypes.AttributeValueMemberS{Value: key.PK},
+					"SK": &ddbTypes.AttributeValueMemberS{Value: skProfile()},
+				},
+				UpdateExpression: awsString("SET GSI1PK = :p, GSI1SK = :id"),
+				ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+					":p":  &ddbTypes.AttributeValueMemberS{Value: ProfilesPartition},
+					":id": &ddbTypes.AttributeValueMemberS{Value: id},
+				},
+			})
+			if err != nil {
+				return n, err
+			}
+			n++
 		}
-		if id != "" {
-			clientIDs = append(clientIDs, id)
+	}
+	return n, nil
+}
+
+// encodeCursor encodes the LastEvaluatedKey of a page, of string attributes, as a cursor; "" if there is none.
+func encodeCursor(key map[string]ddbTypes.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+	attrs := make(map[string]string, len(key))
+	for name, v := range key {
+		s, ok := v.(*ddbTypes.AttributeValueMemberS)
+		if !ok {
+			return "", fmt.Errorf("key attribute %s is not a string", name)
 		}
+		attrs[name] = s.Value
 	}
-	return clientIDs, nil
+	b, err := json.Marshal(attrs)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor decodes a cursor of encodeCursor into the ExclusiveStartKey of the next page; nil for "".
+func decodeCursor(cursor string) (map[string]ddbTypes.AttributeValue, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	var attrs map[string]string
+	if err == nil {
+		err = json.Unmarshal(b, &attrs)
+	}
+	if err != nil || len(attrs) == 0 {
+		return nil, fmt.Errorf("invalid cursor %q", cursor)
+	}
+	key := make(map[string]ddbTypes.AttributeValue, len(attrs))
+	for name, v := range attrs {
+		key[name] = &ddbTypes.AttributeValueMemberS{Value: v}
+	}
+	return key, nil
 }
 
 func (s *ClientStore) PutClientConfig(ctx context.Context, clientID string, config types.ClientConfig) error {
-	pk := pkClient(clientID)
-	sk := skProfile()
 	if err := config.Validate(); err != nil {
 		return err
 	}
-	item, err := attributevalue.MarshalMap(struct {
-		PK string `dynamodbav:"PK"`
-		SK string `dynamodbav:"SK"`
-		types.ClientConfig
-	}{
-		PK:           pk,
-		SK:           sk,
-		ClientConfig: config,
-	})
+	item, err := profileItem(clientID, config)
 	if err != nil {
 		return err
 	}
@@ -104,6 +225,55 @@ func (s *ClientStore) PutClientConfig(ctx context.Context, clientID string, conf
 	return err
 }
 
+// PutClientConfigCAS puts the config on the condition that its cfg_ver attribute is the expected version, or
+// missing if it is 0.
+func (s *ClientStore) PutClientConfigCAS(ctx context.Context, clientID string, expectedVersion int64,
+	config types.ClientConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	config.Version = expectedVersion + 1
+	item, err := profileItem(clientID, config)
+	if err != nil {
+		return err
+	}
+	in := &dynamodb.PutItemInput{
+		TableName:                &s.table,
+		Item:                     item,
+		ConditionExpression:      awsString("attribute_not_exists(#ver)"),
+		ExpressionAttributeNames: map[string]string{"#ver": "cfg_ver"},
+	}
+	if expectedVersion != 0 {
+		in.ConditionExpression = awsString("#ver = :ver")
+		in.ExpressionAttributeValues = map[string]ddbTypes.AttributeValue{
+			":ver": &ddbTypes.AttributeValueMemberN{Value: itoa(expectedVersion)},
+		}
+	}
+	_, err = s.cli.PutItem(ctx, in)
+	var cc *ddbTypes.ConditionalCheckFailedException
+	if errorAs(err, &cc) {
+		return types.VersionConflict(clientID, expectedVersion)
+	}
+	return err
+}
+
+// profileItem returns the item of the client's config, with the attributes of the ProfilesIndex.
+func profileItem(clientID string, config types.ClientConfig) (map[string]ddbTypes.AttributeValue, error) {
+	return attributevalue.MarshalMap(struct {
+		PK     string `dynamodbav:"PK"`
+		SK     string `dynamodbav:"SK"`
+		GSI1PK string `dynamodbav:"GSI1PK"`
+		GSI1SK string `dynamodbav:"GSI1SK"`
+		types.ClientConfig
+	}{
+		PK:           pkClient(clientID),
+		SK:           skProfile(),
+		GSI1PK:       ProfilesPartition,
+		GSI1SK:       clientID,
+		ClientConfig: config,
+	})
+}
+
 func (s *ClientStore) DeleteClientConfig(ctx context.Context, clientID string) error {
 	pk := pkClient(clientID)
 	sk := skProfile()
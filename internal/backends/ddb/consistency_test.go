@@ -0,0 +1,100 @@
+package ddb
+
+import (
+	"bytes"
+	"context"
+	"enoti/internal/ports"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/goccy/go-json"
+)
+
+// recordingDoer answers every DynamoDB call with an empty result and records the GetItem requests.
+type recordingDoer struct {
+	mu       sync.Mutex
+	getItems []map[string]any
+}
+
+func (d *recordingDoer) Do(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(req.Header.Get("X-Amz-Target"), ".GetItem") {
+		var in map[string]any
+		if err := json.Unmarshal(body, &in); err != nil {
+			return nil, err
+		}
+		d.mu.Lock()
+		d.getItems = append(d.getItems, in)
+		d.mu.Unlock()
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/x-amz-json-1.0"}},
+		Body:       io.NopCloser(bytes.NewReader([]byte("{}"))),
+		Request:    req,
+	}, nil
+}
+
+// lastConsistentRead returns the ConsistentRead flag of the last GetItem request; false if it was omitted.
+func (d *recordingDoer) lastConsistentRead() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, _ := d.getItems[len(d.getItems)-1]["ConsistentRead"].(bool)
+	return v
+}
+
+func newRecordingClient() (*dynamodb.Client, *recordingDoer) {
+	doer := &recordingDoer{}
+	cli := dynamodb.New(dynamodb.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String("http://ddb.invalid"),
+		Credentials:  credentials.NewStaticCredentialsProvider("x", "x", ""),
+		HTTPClient:   doer,
+	})
+	return cli, doer
+}
+
+func (s *UnitTestSuite) TestConfigReadConsistency() {
+	ctx := context.Background()
+	cli, doer := newRecordingClient()
+
+	cs := NewClientStore("t", cli)
+	_, _ = cs.GetClientConfig(ctx, "client")
+	s.False(doer.lastConsistentRead(), "config reads default to eventually consistent")
+
+	cs.WithConsistentRead(true)
+	_, _ = cs.GetClientConfig(ctx, "client")
+	s.True(doer.lastConsistentRead())
+}
+
+func (s *UnitTestSuite) TestEdgeReadConsistency() {
+	ctx := context.Background()
+	cli, doer := newRecordingClient()
+
+	ds := NewDataStore("t", cli)
+	_, _, err := ds.Load(ctx, "client", "scope")
+	s.NoError(err)
+	s.True(doer.lastConsistentRead(), "edge reads default to consistent")
+
+	// Per-request override wins over the store setting, both ways
+	_, _, err = ds.Load(ports.WithConsistentRead(ctx, false), "client", "scope")
+	s.NoError(err)
+	s.False(doer.lastConsistentRead())
+
+	ds.WithConsistentRead(false)
+	_, _, err = ds.Load(ctx, "client", "scope")
+	s.NoError(err)
+	s.False(doer.lastConsistentRead())
+
+	_, _, err = ds.Load(ports.WithConsistentRead(ctx, true), "client", "scope")
+	s.NoError(err)
+	s.True(doer.lastConsistentRead())
+}
@@ -2,8 +2,11 @@ package ddb
 
 import (
 	"context"
+	"enoti/internal/ports"
+	"enoti/internal/ratelimit"
 	"enoti/internal/types"
 	"errors"
+	"math/rand/v2"
 	"strconv"
 	"time"
 
@@ -13,9 +16,18 @@ import (
 )
 
 // DataStore implements ports.DedupStore using a TTL item per key.
+// Edge state is read strongly consistent by default. UpsertCAS stays correct either way, as its condition is
+// checked against the latest version, but an eventually consistent Load may return a stale version: the write then
+// fails the CAS and is retried, or, right after a write, the edge is decided against the previous value.
+// Clients may override the default per request with ports.WithConsistentRead.
+// With WithEdgeTTL, edge rows carry the same ttl attribute as dedup and rate limit rows; DynamoDB only deletes them
+// once TTL is enabled on the table for the attribute "ttl", and then lazily, but they count as absent as soon as
+// their ttl has passed.
 type DataStore struct {
-	table string
-	cli   *dynamodb.Client
+	table          string
+	cli            *dynamodb.Client
+	consistentRead bool
+	edgeTTL        time.Duration
 }
 
 type dedupItem struct {
@@ -26,38 +38,165 @@ type dedupItem struct {
 
 func NewDataStore(table string, cli *dynamodb.Client) *DataStore {
 	createTableIfNotExists(cli, table)
-	return &DataStore{table: table, cli: cli}
+	return &DataStore{table: table, cli: cli, consistentRead: true}
+}
+
+// WithConsistentRead sets whether edge state reads are strongly consistent when the context carries no override.
+func (s *DataStore) WithConsistentRead(consistent bool) *DataStore {
+	s.consistentRead = consistent
+	return s
+}
+
+// WithEdgeTTL sets how long edge rows are kept after their last write (see ports.EdgeTTL); 0, the default, keeps
+// them forever.
+func (s *DataStore) WithEdgeTTL(ttl time.Duration) *DataStore {
+	s.edgeTTL = ttl
+	return s
+}
+
+// Ping describes the table, which fails if DynamoDB or the table is unreachable.
+func (s *DataStore) Ping(ctx context.Context) error {
+	return describeTable(ctx, s.cli, s.table)
 }
 
 // Suppress tries to create a TTL row; if it already exists, we suppress.
+// DynamoDB deletes expired items only eventually, so a row whose ttl has passed counts as absent and is replaced.
 func (s *DataStore) Suppress(ctx context.Context, clientID, hash string, window time.Duration) (bool, error) {
+	now := time.Now()
 	item := dedupItem{
 		PK:        pkClient(clientID),
 		SK:        skDedup(hash),
-		ExpiresAt: time.Now().Add(window).Unix(),
+		ExpiresAt: now.Add(window).Unix(),
 	}
 	av, err := attributevalue.MarshalMap(item)
 	if err != nil {
 		return false, err
 	}
 	_, err = s.cli.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName:           &s.table,
-		Item:                av,
-		ConditionExpression: awsString("attribute_not_exists(PK) AND attribute_not_exists(SK)"),
+		TableName:                &s.table,
+		Item:                     av,
+		ConditionExpression:      awsString("(attribute_not_exists(PK) AND attribute_not_exists(SK)) OR #ttl <= :now"),
+		ExpressionAttributeNames: map[string]string{"#ttl": "ttl"},
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":now": &ddbTypes.AttributeValueMemberN{Value: itoa(now.Unix())},
+		},
 	})
 	if err != nil {
 		var cc *ddbTypes.ConditionalCheckFailedException
 		if ok := errorAs(err, &cc); ok {
 			return true, nil // key exists within window
 		}
+		if isThrottling(err) {
+			return false, types.Err(types.ErrThrottled, err, "suppress %s", hash)
+		}
 		return false, err
 	}
 	return false, nil
 }
+
+func (s *DataStore) Release(ctx context.Context, clientID, hash string) error {
+	_, err := s.cli.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: &s.table,
+		Key: map[string]ddbTypes.AttributeValue{
+			"PK": &ddbTypes.AttributeValueMemberS{Value: pkClient(clientID)},
+			"SK": &ddbTypes.AttributeValueMemberS{Value: skDedup(hash)},
+		},
+	})
+	return err
+}
+
+// Block puts a row expiring with the block, or deletes it if d <= 0. As for dedup rows, a row whose ttl has passed
+// counts as absent.
+func (s *DataStore) Block(ctx context.Context, scope string, d time.Duration) error {
+	key := map[string]ddbTypes.AttributeValue{
+		"PK": &ddbTypes.AttributeValueMemberS{Value: pkRate(scope)},
+		"SK": &ddbTypes.AttributeValueMemberS{Value: skBlock()},
+	}
+	if d <= 0 {
+		_, err := s.cli.DeleteItem(ctx, &dynamodb.DeleteItemInput{TableName: &s.table, Key: key})
+		return err
+	}
+	av, err := attributevalue.MarshalMap(dedupItem{
+		PK:        pkRate(scope),
+		SK:        skBlock(),
+		ExpiresAt: time.Now().Add(d).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.cli.PutItem(ctx, &dynamodb.PutItemInput{TableName: &s.table, Item: av})
+	return err
+}
+
+func (s *DataStore) Blocked(ctx context.Context, scope string) (bool, error) {
+	out, err := s.cli.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &s.table,
+		Key: map[string]ddbTypes.AttributeValue{
+			"PK": &ddbTypes.AttributeValueMemberS{Value: pkRate(scope)},
+			"SK": &ddbTypes.AttributeValueMemberS{Value: skBlock()},
+		},
+		ConsistentRead: awsBool(true),
+	})
+	if err != nil {
+		return false, err
+	}
+	var item dedupItem
+	if err := attributevalue.UnmarshalMap(out.Item, &item); err != nil {
+		return false, err
+	}
+	return item.ExpiresAt > time.Now().Unix(), nil
+}
+
+// ScanPendingAggregates scans the table for edge rows with flips in Recent. This reads the whole table, so it is
+// meant for an infrequent background sweep.
+func (s *DataStore) ScanPendingAggregates(ctx context.Context) ([]types.PendingEdge, error) {
+	p := dynamodb.NewScanPaginator(s.cli, &dynamodb.ScanInput{
+		TableName:        &s.table,
+		FilterExpression: awsString("begins_with(SK, :edge)"),
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":edge": &ddbTypes.AttributeValueMemberS{Value: SEdge + "#"},
+		},
+	})
+	var pending []types.PendingEdge
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range out.Items {
+			var st types.Edge
+			if err := attributevalue.UnmarshalMap(item, &st); err != nil {
+				return nil, err
+			}
+			if expired, err := edgeExpired(item); err != nil {
+				return nil, err
+			} else if len(st.Recent) == 0 || expired {
+				continue
+			}
+			var key struct {
+				PK string `dynamodbav:"PK"`
+			}
+			if err := attributevalue.UnmarshalMap(item, &key); err != nil {
+				return nil, err
+			}
+			clientID, err := parseClientID(key.PK)
+			if err != nil {
+				return nil, err
+			}
+			pending = append(pending, types.PendingEdge{ClientID: clientID, Edge: st, Version: st.Version})
+		}
+	}
+	return pending, nil
+}
+
 func (s *DataStore) Load(ctx context.Context, clientID, scopeKey string) (*types.Edge, int64, error) {
+	consistent := s.consistentRead
+	if v, ok := ports.ConsistentRead(ctx); ok {
+		consistent = v
+	}
 	out, err := s.cli.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName:      &s.table,
-		ConsistentRead: awsBool(true),
+		ConsistentRead: awsBool(consistent),
 		Key: map[string]ddbTypes.AttributeValue{
 			"PK": &ddbTypes.AttributeValueMemberS{Value: pkClient(clientID)},
 			"SK": &ddbTypes.AttributeValueMemberS{Value: skEdge(scopeKey)},
@@ -69,6 +208,9 @@ func (s *DataStore) Load(ctx context.Context, clientID, scopeKey string) (*types
 	if out.Item == nil {
 		return nil, 0, nil
 	}
+	if expired, err := edgeExpired(out.Item); err != nil || expired {
+		return nil, 0, err
+	}
 	var st types.Edge
 	if err := attributevalue.UnmarshalMap(out.Item, &st); err != nil {
 		return nil, 0, err
@@ -76,13 +218,25 @@ func (s *DataStore) Load(ctx context.Context, clientID, scopeKey string) (*types
 	return &st, st.Version, nil
 }
 
+// edgeExpired reports whether the edge row item is past its ttl. DynamoDB deletes expired items only eventually, so
+// such a row counts as absent, as it does on Redis once its TTL is up: Load does not return it, and UpsertCAS
+// replaces it as if there were none.
+func edgeExpired(item map[string]ddbTypes.AttributeValue) (bool, error) {
+	var row dedupItem
+	if err := attributevalue.UnmarshalMap(item, &row); err != nil {
+		return false, err
+	}
+	return row.ExpiresAt > 0 && row.ExpiresAt <= time.Now().Unix(), nil
+}
+
 // UpsertCAS creates or updates the row only if ver matches prevVersion.
-// On create (prevVersion==0), the row must not exist (attribute_not_exists).
+// On create (prevVersion==0), the row must not exist (attribute_not_exists) or be past its ttl (see edgeExpired).
 func (s *DataStore) UpsertCAS(ctx context.Context, clientID, scopeKey string, prevVersion int64, next types.Edge) (bool, error) {
 	next.ScopeKey = scopeKey // safety
+	ttl := ports.EdgeTTL(ctx, s.edgeTTL)
 	if prevVersion == 0 {
 		next.Version = 1
-		av, err := attributevalue.MarshalMap(map[string]any{
+		item := map[string]any{
 			"PK":             pkClient(clientID),
 			"SK":             skEdge(scopeKey),
 			"scope_key":      next.ScopeKey,
@@ -92,15 +246,26 @@ func (s *DataStore) UpsertCAS(ctx context.Context, clientID, scopeKey string, pr
 			"flip_count":     next.FlipCount,
 			"recent":         next.Recent,
 			"agg_until_ts":   next.AggUntilTS,
+			"last_agg_fp":    next.LastAggFingerprint,
+			"last_agg_ts":    next.LastAggTS,
+			"last_forwarded": next.LastForwarded,
 			"ver":            next.Version,
-		})
+		}
+		if ttl > 0 {
+			item["ttl"] = time.Now().Add(ttl).Unix()
+		}
+		av, err := attributevalue.MarshalMap(item)
 		if err != nil {
 			return false, err
 		}
 		_, err = s.cli.PutItem(ctx, &dynamodb.PutItemInput{
-			TableName:           &s.table,
-			Item:                av,
-			ConditionExpression: awsString("attribute_not_exists(PK) AND attribute_not_exists(SK)"),
+			TableName:                &s.table,
+			Item:                     av,
+			ConditionExpression:      awsString("(attribute_not_exists(PK) AND attribute_not_exists(SK)) OR #ttl <= :now"),
+			ExpressionAttributeNames: map[string]string{"#ttl": "ttl"},
+			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+				":now": &ddbTypes.AttributeValueMemberN{Value: itoa(time.Now().Unix())},
+			},
 		})
 		if err != nil {
 			var cc *ddbTypes.ConditionalCheckFailedException
@@ -113,6 +278,37 @@ func (s *DataStore) UpsertCAS(ctx context.Context, clientID, scopeKey string, pr
 	}
 
 	recentMarshaled := mustMarshalAttr(next.Recent)
+	update := "SET #lv=:lv, #lcts=:lcts, #ws=:ws, #fc=:fc, #rc=:rc, #aut=:aut, #lafp=:lafp, #lats=:lats, #lf=:lf, #ver=:newver"
+	names := map[string]string{
+		"#lv":   "last_value",
+		"#lcts": "last_change_ts",
+		"#ws":   "window_start",
+		"#fc":   "flip_count",
+		"#rc":   "recent",
+		"#aut":  "agg_until_ts",
+		"#lafp": "last_agg_fp",
+		"#lats": "last_agg_ts",
+		"#lf":   "last_forwarded",
+		"#ver":  "ver",
+	}
+	values := map[string]ddbTypes.AttributeValue{
+		":lv":     &ddbTypes.AttributeValueMemberS{Value: next.LastValue},
+		":lcts":   &ddbTypes.AttributeValueMemberN{Value: itoa(next.LastChangeTS)},
+		":ws":     &ddbTypes.AttributeValueMemberN{Value: itoa(next.WindowStart)},
+		":fc":     &ddbTypes.AttributeValueMemberN{Value: itoa(int64(next.FlipCount))},
+		":rc":     recentMarshaled,
+		":aut":    &ddbTypes.AttributeValueMemberN{Value: itoa(next.AggUntilTS)},
+		":lafp":   &ddbTypes.AttributeValueMemberS{Value: next.LastAggFingerprint},
+		":lats":   &ddbTypes.AttributeValueMemberN{Value: itoa(next.LastAggTS)},
+		":lf":     &ddbTypes.AttributeValueMemberS{Value: next.LastForwarded},
+		":newver": &ddbTypes.AttributeValueMemberN{Value: itoa(prevVersion + 1)},
+		":prev":   &ddbTypes.AttributeValueMemberN{Value: itoa(prevVersion)},
+	}
+	if ttl > 0 {
+		update += ", #ttl=:ttl"
+		names["#ttl"] = "ttl"
+		values[":ttl"] = &ddbTypes.AttributeValueMemberN{Value: itoa(time.Now().Add(ttl).Unix())}
+	}
 	// Update with version bump under condition ver == prevVersion
 	_, err := s.cli.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: &s.table,
@@ -120,29 +316,10 @@ func (s *DataStore) UpsertCAS(ctx context.Context, clientID, scopeKey string, pr
 			"PK": &ddbTypes.AttributeValueMemberS{Value: pkClient(clientID)},
 			"SK": &ddbTypes.AttributeValueMemberS{Value: skEdge(scopeKey)},
 		},
-		UpdateExpression: awsString(
-			"SET #lv=:lv, #lcts=:lcts, #ws=:ws, #fc=:fc, #rc=:rc, #aut=:aut, #ver=:newver",
-		),
-		ExpressionAttributeNames: map[string]string{
-			"#lv":   "last_value",
-			"#lcts": "last_change_ts",
-			"#ws":   "window_start",
-			"#fc":   "flip_count",
-			"#rc":   "recent",
-			"#aut":  "agg_until_ts",
-			"#ver":  "ver",
-		},
-		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
-			":lv":     &ddbTypes.AttributeValueMemberS{Value: next.LastValue},
-			":lcts":   &ddbTypes.AttributeValueMemberN{Value: itoa(next.LastChangeTS)},
-			":ws":     &ddbTypes.AttributeValueMemberN{Value: itoa(next.WindowStart)},
-			":fc":     &ddbTypes.AttributeValueMemberN{Value: itoa(int64(next.FlipCount))},
-			":rc":     recentMarshaled,
-			":aut":    &ddbTypes.AttributeValueMemberN{Value: itoa(next.AggUntilTS)},
-			":newver": &ddbTypes.AttributeValueMemberN{Value: itoa(prevVersion + 1)},
-			":prev":   &ddbTypes.AttributeValueMemberN{Value: itoa(prevVersion)},
-		},
-		ConditionExpression: awsString("#ver = :prev"),
+		UpdateExpression:          awsString(update),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ConditionExpression:       awsString("#ver = :prev"),
 	})
 	if err != nil {
 		var cc *ddbTypes.ConditionalCheckFailedException
@@ -154,23 +331,52 @@ func (s *DataStore) UpsertCAS(ctx context.Context, clientID, scopeKey string, pr
 	return true, nil
 }
 
+// DeleteEdge deletes the edge row, if any.
+func (s *DataStore) DeleteEdge(ctx context.Context, clientID, scopeKey string) error {
+	_, err := s.cli.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: &s.table,
+		Key: map[string]ddbTypes.AttributeValue{
+			"PK": &ddbTypes.AttributeValueMemberS{Value: pkClient(clientID)},
+			"SK": &ddbTypes.AttributeValueMemberS{Value: skEdge(scopeKey)},
+		},
+	})
+	return err
+}
+
 func (s *DataStore) Acquire(ctx context.Context, scope string, ratePerWindow int, window time.Duration) (bool, error) {
 	if ratePerWindow <= 0 {
 		return false, nil
 	}
-	// Window bucketing by integer minutes only (simple, predictable).
-	// We use the minimum of (window, 60s) when deriving TTL — avoid long-lived keys.
-	epochMin := time.Now().Unix() / 60
-	ttl := time.Now().Add(window + 2*time.Minute).Unix() // grace to ensure cleanup
+	if capacity, ok := ports.TokenBucket(ctx); ok {
+		return s.acquireToken(ctx, scope, capacity, ratePerWindow, window)
+	}
+	// Sliding window counter: the current window-aligned bucket may hold what the weighted previous bucket leaves
+	// of the limit, so bursts across a bucket boundary still count against the trailing window.
+	now := time.Now()
+	idx, elapsed := ratelimit.WindowIndex(now.UnixMilli(), window)
+	prev, err := s.windowCount(ctx, scope, idx-1)
+	if err != nil {
+		return false, s.acquireErr(err, scope)
+	}
+	limit := ratelimit.SlidingLimit(prev, ratePerWindow, elapsed)
+	// Room comes back gradually as the previous bucket slides out; the end of the current bucket is an upper bound
+	quota := ports.Quota{Limit: ratePerWindow, Reset: time.Duration((1 - elapsed) * float64(window))}
+	if limit <= 0 {
+		ports.ReportQuota(ctx, quota)
+		return false, nil
+	}
+	// The bucket is read as the previous one during the next window
+	ttl := now.Add(2*window + 2*time.Minute).Unix() // grace to ensure cleanup
 
 	// Atomic: ADD count 1, set ttl if absent, condition count < capacity
 	// If item does not exist: Initialize count=0 then add 1 -> becomes 1.
-	_, err := s.cli.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+	out, err := s.cli.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: &s.table,
 		Key: map[string]ddbTypes.AttributeValue{
 			"PK": &ddbTypes.AttributeValueMemberS{Value: pkRate(scope)},
-			"SK": &ddbTypes.AttributeValueMemberS{Value: skRateWin(epochMin)},
+			"SK": &ddbTypes.AttributeValueMemberS{Value: skRateWin(idx)},
 		},
+		ReturnValues: ddbTypes.ReturnValueUpdatedNew,
 		UpdateExpression: awsString(
 			"SET #ttl = if_not_exists(#ttl, :ttl) " +
 				"ADD #count :one",
@@ -182,20 +388,250 @@ func (s *DataStore) Acquire(ctx context.Context, scope string, ratePerWindow int
 		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
 			":one": &ddbTypes.AttributeValueMemberN{Value: "1"},
 			":ttl": &ddbTypes.AttributeValueMemberN{Value: itoa(ttl)},
-			":cap": &ddbTypes.AttributeValueMemberN{Value: itoa(int64(ratePerWindow))},
+			":cap": &ddbTypes.AttributeValueMemberN{Value: itoa(int64(limit))},
 		},
 		ConditionExpression: awsString("attribute_not_exists(#count) OR #count < :cap"),
 	})
 	if err != nil {
 		var cc *ddbTypes.ConditionalCheckFailedException
 		if errorAs(err, &cc) {
+			ports.ReportQuota(ctx, quota)
 			return false, nil // limited
 		}
-		return false, err
+		return false, s.acquireErr(err, scope)
+	}
+	var w struct {
+		Count int `dynamodbav:"count"`
+	}
+	if err := attributevalue.UnmarshalMap(out.Attributes, &w); err == nil {
+		quota.Remaining = max(0, limit-w.Count)
 	}
+	ports.ReportQuota(ctx, quota)
+	ports.ReportSlot(ctx, ratelimit.WindowSlot(idx))
 	return true, nil
 }
 
+// Refund decrements the count of the window of the slot, or puts a token back in the bucket and bumps its version,
+// so that a concurrent acquireToken retries on the refunded bucket. A bucket missing less than a token, or a window
+// that has expired since, is left as is.
+func (s *DataStore) Refund(ctx context.Context, scope, slot string, ratePerWindow int, window time.Duration) error {
+	in := &dynamodb.UpdateItemInput{
+		TableName: &s.table,
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":one": &ddbTypes.AttributeValueMemberN{Value: "1"},
+		},
+	}
+	if capacity, ok := ports.TokenBucket(ctx); ok {
+		in.Key = map[string]ddbTypes.AttributeValue{
+			"PK": &ddbTypes.AttributeValueMemberS{Value: pkRate(scope)},
+			"SK": &ddbTypes.AttributeValueMemberS{Value: skRateBucket()},
+		}
+		in.UpdateExpression = awsString("SET tokens = tokens + :one, ver = ver + :one")
+		in.ConditionExpression = awsString("tokens <= :max")
+		in.ExpressionAttributeValues[":max"] = &ddbTypes.AttributeValueMemberN{Value: itoa(int64(capacity - 1))}
+	} else {
+		idx, err := ratelimit.ParseWindowSlot(slot)
+		if err != nil {
+			return err
+		}
+		in.Key = map[string]ddbTypes.AttributeValue{
+			"PK": &ddbTypes.AttributeValueMemberS{Value: pkRate(scope)},
+			"SK": &ddbTypes.AttributeValueMemberS{Value: skRateWin(idx)},
+		}
+		in.UpdateExpression = awsString("ADD #count :minus")
+		in.ConditionExpression = awsString("#count >= :one")
+		in.ExpressionAttributeNames = map[string]string{"#count": "count"}
+		in.ExpressionAttributeValues[":minus"] = &ddbTypes.AttributeValueMemberN{Value: "-1"}
+	}
+	_, err := s.cli.UpdateItem(ctx, in)
+	var cc *ddbTypes.ConditionalCheckFailedException
+	if errorAs(err, &cc) {
+		return nil // nothing to give back
+	}
+	return err
+}
+
+// CountQuota adds n to the count of the quota row of the scope with an update conditioned on the limit, so
+// concurrent counts never exceed it. Rows past their ttl that DynamoDB has not deleted yet are of past periods, as
+// the ttl outlasts the period of the scope.
+func (s *DataStore) CountQuota(ctx context.Context, scope string, n, limit int, ttl time.Duration) (bool, error) {
+	key := map[string]ddbTypes.AttributeValue{
+		"PK": &ddbTypes.AttributeValueMemberS{Value: pkRate(scope)},
+		"SK": &ddbTypes.AttributeValueMemberS{Value: skQuota()},
+	}
+	if n == 0 {
+		out, err := s.cli.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:                &s.table,
+			Key:                      key,
+			ProjectionExpression:     awsString("#count"),
+			ExpressionAttributeNames: map[string]string{"#count": "count"},
+		})
+		if err != nil {
+			return false, s.acquireErr(err, scope)
+		}
+		var q struct {
+			Count int `dynamodbav:"count"`
+		}
+		if err := attributevalue.UnmarshalMap(out.Item, &q); err != nil {
+			return false, err
+		}
+		return q.Count < limit, nil
+	}
+	if n > limit {
+		return false, nil
+	}
+	_, err := s.cli.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        &s.table,
+		Key:              key,
+		UpdateExpression: awsString("SET #ttl = :ttl ADD #count :n"),
+		ExpressionAttributeNames: map[string]string{
+			"#count": "count",
+			"#ttl":   "ttl",
+		},
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":n":   &ddbTypes.AttributeValueMemberN{Value: itoa(int64(n))},
+			":ttl": &ddbTypes.AttributeValueMemberN{Value: itoa(time.Now().Add(ttl).Unix())},
+			":max": &ddbTypes.AttributeValueMemberN{Value: itoa(int64(limit - n))},
+		},
+		ConditionExpression: awsString("attribute_not_exists(#count) OR #count <= :max"),
+	})
+	if err != nil {
+		var cc *ddbTypes.ConditionalCheckFailedException
+		if errorAs(err, &cc) {
+			return false, nil // used up
+		}
+		return false, s.acquireErr(err, scope)
+	}
+	return true, nil
+}
+
+// windowCount returns the number of requests counted in the scope's bucket idx; 0 if there is none.
+func (s *DataStore) windowCount(ctx context.Context, scope string, idx int64) (int, error) {
+	out, err := s.cli.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &s.table,
+		Key: map[string]ddbTypes.AttributeValue{
+			"PK": &ddbTypes.AttributeValueMemberS{Value: pkRate(scope)},
+			"SK": &ddbTypes.AttributeValueMemberS{Value: skRateWin(idx)},
+		},
+		ProjectionExpression:     awsString("#count"),
+		ExpressionAttributeNames: map[string]string{"#count": "count"},
+	})
+	if err != nil || out.Item == nil {
+		return 0, err
+	}
+	var w struct {
+		Count int `dynamodbav:"count"`
+	}
+	if err := attributevalue.UnmarshalMap(out.Item, &w); err != nil {
+		return 0, err
+	}
+	return w.Count, nil
+}
+
+// bucketItem is the token bucket state of a rate limit scope.
+type bucketItem struct {
+	PK        string  `dynamodbav:"PK"`
+	SK        string  `dynamodbav:"SK"`
+	Tokens    float64 `dynamodbav:"tokens"`
+	LastMS    int64   `dynamodbav:"last_ms"`
+	Ver       int64   `dynamodbav:"ver"`
+	ExpiresAt int64   `dynamodbav:"ttl"`
+}
+
+// bucketBackoff and maxBucketBackoff bound the jittered delay between the retries of acquireToken, doubling from the
+// first to the last.
+const (
+	bucketBackoff    = 2 * time.Millisecond
+	maxBucketBackoff = 50 * time.Millisecond
+)
+
+// acquireToken takes a token from the scope's bucket. The bucket is read, refilled and written back conditionally
+// on its version being unchanged, so concurrent takes cannot both spend the same token. A take losing the race
+// backs off and tries again, until it gets a token or finds the bucket empty: every lost race is a token taken by
+// another, so a burst is only refused once it has used up the bucket.
+func (s *DataStore) acquireToken(ctx context.Context, scope string, capacity, rate int, window time.Duration) (bool, error) {
+	key := map[string]ddbTypes.AttributeValue{
+		"PK": &ddbTypes.AttributeValueMemberS{Value: pkRate(scope)},
+		"SK": &ddbTypes.AttributeValueMemberS{Value: skRateBucket()},
+	}
+	for backoff := bucketBackoff; ; backoff = min(2*backoff, maxBucketBackoff) {
+		out, err := s.cli.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      &s.table,
+			Key:            key,
+			ConsistentRead: awsBool(true),
+		})
+		if err != nil {
+			return false, s.acquireErr(err, scope)
+		}
+		var cur bucketItem
+		if out.Item != nil {
+			if err := attributevalue.UnmarshalMap(out.Item, &cur); err != nil {
+				return false, err
+			}
+		}
+		now := time.Now()
+		next, ok := ratelimit.TokenBucket{Tokens: cur.Tokens, LastMS: cur.LastMS}.Take(now.UnixMilli(), capacity, rate, window)
+		quota := ports.Quota{Limit: capacity, Remaining: int(next.Tokens), Reset: next.NextTokenIn(rate, window)}
+		if !ok {
+			ports.ReportQuota(ctx, quota)
+			return false, nil
+		}
+		av, err := attributevalue.MarshalMap(bucketItem{
+			PK:        pkRate(scope),
+			SK:        skRateBucket(),
+			Tokens:    next.Tokens,
+			LastMS:    next.LastMS,
+			Ver:       cur.Ver + 1,
+			ExpiresAt: now.Add(ratelimit.FullAfter(capacity, rate, window) + 2*time.Minute).Unix(),
+		})
+		if err != nil {
+			return false, err
+		}
+		in := &dynamodb.PutItemInput{TableName: &s.table, Item: av}
+		if out.Item == nil {
+			in.ConditionExpression = awsString("attribute_not_exists(PK)")
+		} else {
+			in.ConditionExpression = awsString("ver = :ver")
+			in.ExpressionAttributeValues = map[string]ddbTypes.AttributeValue{
+				":ver": &ddbTypes.AttributeValueMemberN{Value: itoa(cur.Ver)},
+			}
+		}
+		if _, err = s.cli.PutItem(ctx, in); err == nil {
+			ports.ReportQuota(ctx, quota)
+			ports.ReportSlot(ctx, ports.TokenSlot)
+			return true, nil
+		}
+		var cc *ddbTypes.ConditionalCheckFailedException
+		if !errorAs(err, &cc) {
+			return false, s.acquireErr(err, scope)
+		}
+		t := time.NewTimer(rand.N(backoff) + 1)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return false, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// acquireErr wraps throttling errors of Acquire in types.ErrThrottled, so the caller can apply its fail mode.
+func (s *DataStore) acquireErr(err error, scope string) error {
+	if isThrottling(err) {
+		// The SDK retryer has already backed off
+		return types.Err(types.ErrThrottled, err, "acquire %s", scope)
+	}
+	return err
+}
+
+// isThrottling reports whether err is a DynamoDB capacity/throttling error rather than a hard failure.
+func isThrottling(err error) bool {
+	var pte *ddbTypes.ProvisionedThroughputExceededException
+	var rle *ddbTypes.RequestLimitExceeded
+	var te *ddbTypes.ThrottlingException
+	return errorAs(err, &pte) || errorAs(err, &rle) || errorAs(err, &te)
+}
+
 func itoa(i int64) string { return strconv.FormatInt(i, 10) }
 
 func mustMarshalAttr(v any) ddbTypes.AttributeValue {
@@ -0,0 +1,132 @@
+package ddb
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func (s *UnitTestSuite) TestEdgeRoundTrip() {
+	ctx := context.Background()
+	cli, _ := newFakeClient()
+	ds := NewDataStore("t", cli)
+
+	created := types.Edge{LastValue: "down", LastChangeTS: 10, WindowStart: 10, Recent: []types.Flip{}, AggUntilTS: 20,
+		LastAggFingerprint: "fp", LastAggTS: 5, LastForwarded: `{"v":"down"}`}
+	ok, err := ds.UpsertCAS(ctx, "client", "scope", 0, created)
+	s.Require().NoError(err)
+	s.Require().True(ok)
+	edge, ver, err := ds.Load(ctx, "client", "scope")
+	s.Require().NoError(err)
+	s.Require().NotNil(edge)
+	s.Equal(int64(1), ver)
+	created.ScopeKey, created.Version = "scope", 1
+	s.Equal(created, *edge)
+
+	updated := types.Edge{LastValue: "up", LastChangeTS: 30, WindowStart: 10, FlipCount: 1,
+		Recent: []types.Flip{{At: 30, From: "down", To: "up"}}, LastAggFingerprint: "fp2", LastAggTS: 25,
+		LastForwarded: `{"v":"up"}`}
+	ok, err = ds.UpsertCAS(ctx, "client", "scope", 1, updated)
+	s.Require().NoError(err)
+	s.Require().True(ok)
+	edge, ver, err = ds.Load(ctx, "client", "scope")
+	s.Require().NoError(err)
+	s.Equal(int64(2), ver)
+	updated.ScopeKey, updated.Version = "scope", 2
+	s.Equal(updated, *edge)
+
+	ok, err = ds.UpsertCAS(ctx, "client", "scope", 1, updated)
+	s.NoError(err)
+	s.False(ok, "stale version")
+}
+
+// TestEdgeExpired reads and replaces an edge row past its ttl that DynamoDB has not deleted yet as if it were gone,
+// as on Redis.
+func (s *UnitTestSuite) TestEdgeExpired() {
+	ctx := context.Background()
+	cli, fake := newFakeClient()
+	ds := NewDataStore("t", cli).WithEdgeTTL(time.Hour)
+
+	stale := types.Edge{LastValue: "down", LastChangeTS: 10, Recent: []types.Flip{{At: 10, From: "up", To: "down"}}}
+	ok, err := ds.UpsertCAS(ctx, "client", "scope", 0, stale)
+	s.Require().NoError(err)
+	s.Require().True(ok)
+	_, ver, err := ds.Load(ctx, "client", "scope")
+	s.NoError(err)
+	s.Equal(int64(1), ver)
+	ok, err = ds.UpsertCAS(ctx, "client", "scope", 0, stale)
+	s.NoError(err)
+	s.False(ok, "the row exists")
+
+	for _, item := range fake.items {
+		item["ttl"] = map[string]any{"N": strconv.FormatInt(time.Now().Unix()-1, 10)}
+	}
+	edge, ver, err := ds.Load(ctx, "client", "scope")
+	s.NoError(err)
+	s.Nil(edge, "expired")
+	s.Zero(ver)
+	pending, err := ds.ScanPendingAggregates(ctx)
+	s.NoError(err)
+	s.Empty(pending)
+
+	ok, err = ds.UpsertCAS(ctx, "client", "scope", 0, types.Edge{LastValue: "up", LastChangeTS: 20})
+	s.NoError(err)
+	s.True(ok, "the expired row is replaced")
+	edge, ver, err = ds.Load(ctx, "client", "scope")
+	s.NoError(err)
+	s.Require().NotNil(edge)
+	s.Equal(int64(1), ver)
+	s.Equal("up", edge.LastValue)
+	s.Empty(edge.Recent)
+}
+
+func (s *UnitTestSuite) TestBlock() {
+	ctx := context.Background()
+	cli, fake := newFakeClient()
+	ds := NewDataStore("t", cli)
+	s.NoError(ds.Block(ctx, "AUTHFAIL:BLOCK:10.0.0.1", time.Minute))
+	blocked, err := ds.Blocked(ctx, "AUTHFAIL:BLOCK:10.0.0.1")
+	s.NoError(err)
+	s.True(blocked)
+	blocked, err = ds.Blocked(ctx, "AUTHFAIL:BLOCK:10.0.0.2")
+	s.NoError(err)
+	s.False(blocked)
+
+	// Rows past their ttl that DynamoDB has not deleted yet
+	for _, item := range fake.items {
+		item["ttl"] = map[string]any{"N": strconv.FormatInt(time.Now().Unix()-1, 10)}
+	}
+	blocked, err = ds.Blocked(ctx, "AUTHFAIL:BLOCK:10.0.0.1")
+	s.NoError(err)
+	s.False(blocked, "expired")
+
+	s.NoError(ds.Block(ctx, "AUTHFAIL:BLOCK:10.0.0.1", time.Minute))
+	s.NoError(ds.Block(ctx, "AUTHFAIL:BLOCK:10.0.0.1", 0))
+	s.Empty(fake.items, "lifted")
+}
+
+// TestAcquireTokenBurst takes a full bucket with concurrent acquires: the takes losing the race to the conditional
+// write must retry rather than be refused while tokens are left.
+func (s *UnitTestSuite) TestAcquireTokenBurst() {
+	cli, fake := newFakeClient()
+	fake.readDelay = time.Millisecond
+	ds := NewDataStore("t", cli)
+	ctx := ports.WithTokenBucket(context.Background(), 20)
+	var granted atomic.Int32
+	var wg sync.WaitGroup
+	for range 30 {
+		wg.Go(func() {
+			ok, err := ds.Acquire(ctx, "CLIENT:burst", 1, time.Hour)
+			s.NoError(err)
+			if ok {
+				granted.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	s.Equal(int32(20), granted.Load())
+}
@@ -0,0 +1,185 @@
+package ddb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/goccy/go-json"
+)
+
+// fakeDDB is an in-memory DynamoDB table answering the CreateTable (as a no-op), GetItem, PutItem, UpdateItem, DeleteItem and Scan calls of the
+// data store: updates are "SET" lists of plain assignments, conditions those the store writes, and scans return a
+// single page filtered by a begins_with of SK.
+type fakeDDB struct {
+	mu    sync.Mutex
+	items map[string]map[string]any // by PK and SK
+
+	// readDelay, when set, holds every GetItem response, so that concurrent read-modify-writes interleave.
+	readDelay time.Duration
+}
+
+func newFakeClient() (*dynamodb.Client, *fakeDDB) {
+	fake := &fakeDDB{items: map[string]map[string]any{}}
+	cli := dynamodb.New(dynamodb.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String("http://ddb.invalid"),
+		Credentials:  credentials.NewStaticCredentialsProvider("x", "x", ""),
+		HTTPClient:   fake,
+	})
+	return cli, fake
+}
+
+type fakeRequest struct {
+	Key                       map[string]any
+	Item                      map[string]any
+	UpdateExpression          string
+	ConditionExpression       string
+	FilterExpression          string
+	ExpressionAttributeNames  map[string]string
+	ExpressionAttributeValues map[string]any
+}
+
+func (f *fakeDDB) Do(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	var in fakeRequest
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	op := req.Header.Get("X-Amz-Target")
+	op = op[strings.LastIndex(op, ".")+1:]
+	if op == "GetItem" {
+		defer time.Sleep(f.readDelay)
+	}
+	keyOf := func(item map[string]any) string { return fmt.Sprint(item["PK"], "/", item["SK"]) }
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out any = map[string]any{}
+	switch op {
+	case "CreateTable":
+	case "Scan":
+		var items []map[string]any
+		for _, item := range f.items {
+			if f.filterHolds(in, item) {
+				items = append(items, item)
+			}
+		}
+		out = map[string]any{"Items": items, "Count": len(items)}
+	case "GetItem":
+		if item, ok := f.items[keyOf(in.Key)]; ok {
+			out = map[string]any{"Item": item}
+		}
+	case "PutItem", "UpdateItem", "DeleteItem":
+		key := in.Key
+		if op == "PutItem" {
+			key = in.Item
+		}
+		cur, exists := f.items[keyOf(key)]
+		if !f.conditionHolds(in, cur, exists) {
+			return f.respond(http.StatusBadRequest, map[string]any{
+				"__type":  "com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException",
+				"message": "The conditional request failed",
+			})
+		}
+		switch op {
+		case "PutItem":
+			f.items[keyOf(key)] = in.Item
+		case "DeleteItem":
+			delete(f.items, keyOf(key))
+		default:
+			next := map[string]any{"PK": key["PK"], "SK": key["SK"]}
+			for k, v := range cur {
+				next[k] = v
+			}
+			for _, set := range strings.Split(strings.TrimPrefix(in.UpdateExpression, "SET "), ",") {
+				name, value, _ := strings.Cut(strings.TrimSpace(set), "=")
+				next[in.name(name)] = in.ExpressionAttributeValues[value]
+			}
+			f.items[keyOf(key)] = next
+		}
+	default:
+		return nil, fmt.Errorf("fakeDDB: unsupported operation %s", op)
+	}
+	return f.respond(http.StatusOK, out)
+}
+
+// name resolves an attribute name of an expression.
+func (in fakeRequest) name(s string) string {
+	if n, ok := in.ExpressionAttributeNames[s]; ok {
+		return n
+	}
+	return s
+}
+
+// conditionHolds evaluates the condition of in against cur, the item it writes if exists: attribute_not_exists
+// terms, joined by AND, or a single equality, either optionally OR'ed with a "<=" comparison of numbers.
+func (f *fakeDDB) conditionHolds(in fakeRequest, cur map[string]any, exists bool) bool {
+	cond := in.ConditionExpression
+	if left, right, ok := strings.Cut(cond, " OR "); ok {
+		in.ConditionExpression = strings.TrimSuffix(strings.TrimPrefix(left, "("), ")")
+		name, value, _ := strings.Cut(right, "<=")
+		attr, _ := cur[in.name(strings.TrimSpace(name))].(map[string]any)
+		n, isNum := attr["N"].(string)
+		limit, _ := in.ExpressionAttributeValues[strings.TrimSpace(value)].(map[string]any)
+		return f.conditionHolds(in, cur, exists) || (exists && isNum && atoi(n) <= atoi(limit["N"].(string)))
+	}
+	switch {
+	case cond == "":
+		return true
+	case strings.HasPrefix(cond, "attribute_not_exists("):
+		return !exists
+	default:
+		name, value, ok := strings.Cut(cond, "=")
+		if !ok {
+			panic("fakeDDB: unsupported condition " + cond)
+		}
+		return exists && reflect.DeepEqual(cur[in.name(strings.TrimSpace(name))],
+			in.ExpressionAttributeValues[strings.TrimSpace(value)])
+	}
+}
+
+// filterHolds evaluates the filter of a scan, a single begins_with(SK, value), against item.
+func (f *fakeDDB) filterHolds(in fakeRequest, item map[string]any) bool {
+	if in.FilterExpression == "" {
+		return true
+	}
+	args, ok := strings.CutPrefix(in.FilterExpression, "begins_with(")
+	if !ok {
+		panic("fakeDDB: unsupported filter " + in.FilterExpression)
+	}
+	name, value, _ := strings.Cut(strings.TrimSuffix(args, ")"), ",")
+	attr, _ := item[in.name(strings.TrimSpace(name))].(map[string]any)
+	prefix, _ := in.ExpressionAttributeValues[strings.TrimSpace(value)].(map[string]any)
+	sk, _ := attr["S"].(string)
+	return strings.HasPrefix(sk, prefix["S"].(string))
+}
+
+func atoi(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+func (f *fakeDDB) respond(status int, v any) (*http.Response, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/x-amz-json-1.0"}},
+		Body:       io.NopCloser(bytes.NewReader(b)),
+	}, nil
+}
@@ -9,6 +9,24 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Profiles are listed through the ProfilesIndex GSI: every profile item carries GSI1PK = ProfilesPartition and
+// GSI1SK = its client ID, so a Query on the index reads the profiles alone, in client ID order.
+//
+// Tables created before the index must be migrated, as ListClients fails on a table without it:
+//
+//  1. Add the index, e.g. with aws dynamodb update-table --table-name <table>
+//     --attribute-definitions AttributeName=GSI1PK,AttributeType=S AttributeName=GSI1SK,AttributeType=S
+//     --global-secondary-index-updates '[{"Create":{"IndexName":"ProfilesIndex","KeySchema":[
+//     {"AttributeName":"GSI1PK","KeyType":"HASH"},{"AttributeName":"GSI1SK","KeyType":"RANGE"}],
+//     "Projection":{"ProjectionType":"KEYS_ONLY"}}}]'
+//     and wait for it to become ACTIVE. On-demand tables need no throughput settings.
+//  2. Backfill the index keys of the existing profiles with ClientStore.BackfillProfilesIndex, or by putting every
+//     config again.
+const (
+	ProfilesIndex     = "ProfilesIndex"
+	ProfilesPartition = "PROFILES"
+)
+
 const (
 	SClient = "CLIENT"
 	SRate   = "RATE"
@@ -17,12 +35,15 @@ const (
 	SWin    = "WIN"
 )
 
-func pkClient(id string) string       { return fmt.Sprintf("%s#%s", SClient, id) }
-func skProfile() string               { return "PROFILE" }
-func skDedup(hash string) string      { return fmt.Sprintf("%s#%s", SDedup, hash) }
-func pkRate(scope string) string      { return fmt.Sprintf("%s#%s", SRate, scope) }
-func skRateWin(epochMin int64) string { return fmt.Sprintf("%s#%d", SWin, epochMin) }
-func skEdge(scopeKey string) string   { return fmt.Sprintf("%s#%s", SEdge, scopeKey) }
+func pkClient(id string) string     { return fmt.Sprintf("%s#%s", SClient, id) }
+func skProfile() string             { return "PROFILE" }
+func skDedup(hash string) string    { return fmt.Sprintf("%s#%s", SDedup, hash) }
+func pkRate(scope string) string    { return fmt.Sprintf("%s#%s", SRate, scope) }
+func skRateWin(idx int64) string    { return fmt.Sprintf("%s#%d", SWin, idx) }
+func skEdge(scopeKey string) string { return fmt.Sprintf("%s#%s", SEdge, scopeKey) }
+func skRateBucket() string          { return "BUCKET" }
+func skQuota() string               { return "QUOTA" }
+func skBlock() string               { return "BLOCK" }
 
 func parseClientID(pk string) (string, error) {
 	var id string
@@ -39,11 +60,21 @@ func createTableIfNotExists(client *dynamodb.Client, table string) {
 		AttributeDefinitions: []ddbTypes.AttributeDefinition{
 			{AttributeName: awsString("PK"), AttributeType: ddbTypes.ScalarAttributeTypeS},
 			{AttributeName: awsString("SK"), AttributeType: ddbTypes.ScalarAttributeTypeS},
+			{AttributeName: awsString("GSI1PK"), AttributeType: ddbTypes.ScalarAttributeTypeS},
+			{AttributeName: awsString("GSI1SK"), AttributeType: ddbTypes.ScalarAttributeTypeS},
 		},
 		KeySchema: []ddbTypes.KeySchemaElement{
 			{AttributeName: awsString("PK"), KeyType: ddbTypes.KeyTypeHash},
 			{AttributeName: awsString("SK"), KeyType: ddbTypes.KeyTypeRange},
 		},
+		GlobalSecondaryIndexes: []ddbTypes.GlobalSecondaryIndex{{
+			IndexName: awsString(ProfilesIndex),
+			KeySchema: []ddbTypes.KeySchemaElement{
+				{AttributeName: awsString("GSI1PK"), KeyType: ddbTypes.KeyTypeHash},
+				{AttributeName: awsString("GSI1SK"), KeyType: ddbTypes.KeyTypeRange},
+			},
+			Projection: &ddbTypes.Projection{ProjectionType: ddbTypes.ProjectionTypeKeysOnly},
+		}},
 		BillingMode: ddbTypes.BillingModePayPerRequest,
 	})
 	var re *ddbTypes.ResourceInUseException
@@ -51,3 +82,9 @@ func createTableIfNotExists(client *dynamodb.Client, table string) {
 		log.Fatalf("Failed to create table %s: %v", table, err)
 	}
 }
+
+// describeTable checks that table exists and is reachable. DescribeTable consumes no read capacity.
+func describeTable(ctx context.Context, client *dynamodb.Client, table string) error {
+	_, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &table})
+	return err
+}
@@ -4,17 +4,28 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"database/sql"
 	"enoti/internal/backends/ddb"
+	"enoti/internal/backends/memory"
+	"enoti/internal/backends/postgres"
+	"enoti/internal/backends/sqlite"
 	"enoti/internal/ports"
+	"enoti/internal/pub"
+	"enoti/internal/types"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
+	"github.com/segmentio/kafka-go"
 
 	redisbackend "enoti/internal/backends/redis"
 )
@@ -24,16 +35,40 @@ const (
 	DataBackendEnvKey   = "DATA_BACKEND"
 	BackendDDB          = "ddb"
 	BackendRedis        = "redis"
+	// BackendMemory keeps everything in process memory (see memory.Store); both backends then share one store.
+	BackendMemory = "memory"
+	// BackendPostgres keeps configs and data in PostgreSQL, at the DSN in "POSTGRES_DSN".
+	BackendPostgres = "postgres"
+	// BackendSQLite keeps configs and data in the SQLite file at "SQLITE_PATH"; both backends then share one handle.
+	BackendSQLite = "sqlite"
 
 	DDBEndpointKey = "DDB_ENDPOINT"
 	DDBTableKey    = "DDB_TABLE"
 
+	// DDBConsistentConfigReads makes client config reads strongly consistent (default false, as they are cached).
+	DDBConsistentConfigReads = "DDB_CONSISTENT_CONFIG_READS"
+	// DDBConsistentEdgeReads sets the default read consistency for edge state (default true); clients may override
+	// it with consistent_edge_reads.
+	DDBConsistentEdgeReads = "DDB_CONSISTENT_EDGE_READS"
+
+	// EdgeTTLSeconds expires edge state not written for that long, for the DynamoDB and Redis backends (default 0,
+	// never). States are kept for at least four flapping windows of their trigger. As states are only written on
+	// changes, the state of a scope that stays stable expires too, and its next event counts as a first observation.
+	// DynamoDB deletes expired rows only once TTL is enabled on the table for the attribute "ttl".
+	EdgeTTLSeconds = "EDGE_TTL_SECONDS"
+
 	RedisHost  = "REDIS_HOST"
 	RedisPort  = "REDIS_PORT"
 	RedisUser  = "REDIS_USER"
 	RedisPass  = "REDIS_PASS"
 	RedisTLS   = "REDIS_SSL"
 	RedisDBNum = "REDIS_DB_NUM"
+
+	PostgresDSN = "POSTGRES_DSN"
+
+	SQLitePath = "SQLITE_PATH"
+
+	KafkaBrokers = "KAFKA_BROKERS"
 )
 const AmazonRootCA1PEM = `-----BEGIN CERTIFICATE-----
 MIIDQTCCAimgAwIBAgITBmyfz5m/jAo54vB4ikPmljZbyjANBgkqhkiG9w0BAQsF
@@ -56,11 +91,19 @@ o/ufQJVtMVT8QtPHRh8jrdkPSHCa2XV4cdFyQzR1bldZwgJcJmApzyMZFo6IQ6XU
 rqXRfboQnoZsG4q5WTP468SQvvG5
 -----END CERTIFICATE-----`
 
+// memoryStore is the store of BackendMemory, shared by the client and data backends.
+var memoryStore = sync.OnceValue(memory.NewStore)
+
+// sqliteDB is the database of BackendSQLite, shared by the client and data backends: SQLite allows one writer.
+var sqliteDB = sync.OnceValues(SQLiteBackendFromEnv)
+
 // ClientBackendFromEnv constructs a ClientStore based on environment variables.
-// Supported backends are "ddb" (DynamoDB) and "redis" (Redis).
+// Supported backends are "ddb" (DynamoDB), "redis" (Redis), "postgres" (PostgreSQL),
+// "sqlite" (SQLite file) and "memory" (in process).
 // If no backend is specified, defaults to "ddb". It first checks the "CLIENT_BACKEND" env var,
 // to determine which backend to use. Depending on the backend, it reads additional env vars.
 // Default to BackendDDB if unspecified or unrecognized.
+// With "CONFIG_INVALIDATION_REDIS" set, the writes of the store are announced to the other processes.
 func ClientBackendFromEnv() (clientStore ports.ClientStore, err error) {
 	backend := os.Getenv(ClientBackendEnvKey)
 	switch backend {
@@ -72,6 +115,25 @@ func ClientBackendFromEnv() (clientStore ports.ClientStore, err error) {
 		}
 		clientStore = redisbackend.NewClientStore(redisClient)
 
+	case BackendPostgres:
+		var pool *pgxpool.Pool
+		pool, err = PostgresBackendFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		clientStore = postgres.NewClientStore(pool)
+
+	case BackendSQLite:
+		var db *sql.DB
+		db, err = sqliteDB()
+		if err != nil {
+			return nil, err
+		}
+		clientStore = sqlite.NewClientStore(db)
+
+	case BackendMemory:
+		clientStore = memoryStore()
+
 	case BackendDDB:
 		fallthrough
 	case "":
@@ -83,13 +145,15 @@ func ClientBackendFromEnv() (clientStore ports.ClientStore, err error) {
 			return nil, err
 		}
 		table := getenv("DDB_TABLE", "notify_guard")
-		clientStore = ddb.NewClientStore(table, ddbClient)
+		clientStore = ddb.NewClientStore(table, ddbClient).
+			WithConsistentRead(parseBoolean(getenv(DDBConsistentConfigReads, "false")))
 	}
-	return
+	return withConfigInvalidation(clientStore)
 }
 
 // DataBackendFromEnv constructs a DataStore based on environment variables.
-// Supported backends are "ddb" (DynamoDB) and "redis" (Redis).
+// Supported backends are "ddb" (DynamoDB), "redis" (Redis), "postgres" (PostgreSQL),
+// "sqlite" (SQLite file) and "memory" (in process).
 // If no backend is specified, defaults to "ddb". It first checks the "DATA_BACKEND" env var,
 // to determine which backend to use. Depending on the backend, it reads additional env vars.
 // Default to BackendDDB if unspecified or unrecognized.
@@ -102,7 +166,26 @@ func DataBackendFromEnv() (dataStore ports.DataStore, err error) {
 		if err != nil {
 			return nil, err
 		}
-		dataStore = redisbackend.NewDataStore(redisClient)
+		dataStore = redisbackend.NewDataStore(redisClient).WithEdgeTTL(edgeTTLFromEnv())
+
+	case BackendPostgres:
+		var pool *pgxpool.Pool
+		pool, err = PostgresBackendFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		dataStore = postgres.NewDataStore(pool)
+
+	case BackendSQLite:
+		var db *sql.DB
+		db, err = sqliteDB()
+		if err != nil {
+			return nil, err
+		}
+		dataStore = sqlite.NewDataStore(db)
+
+	case BackendMemory:
+		dataStore = memoryStore()
 
 	case BackendDDB:
 		fallthrough
@@ -115,11 +198,67 @@ func DataBackendFromEnv() (dataStore ports.DataStore, err error) {
 			return nil, err
 		}
 		table := getenv(DDBTableKey, "notify_guard")
-		dataStore = ddb.NewDataStore(table, ddbClient)
+		dataStore = ddb.NewDataStore(table, ddbClient).
+			WithConsistentRead(parseBoolean(getenv(DDBConsistentEdgeReads, "true"))).
+			WithEdgeTTL(edgeTTLFromEnv())
 	}
 	return
 }
 
+// PublisherFromEnv constructs the publisher of the targets: those configured with a webhook_url, slack_webhook_url,
+// pagerduty_routing_key, event_bus_name or kafka_topic go to their own transport, everything else to the default
+// publisher of pub.PublisherFromEnv (SNS unless configured otherwise). Kafka targets need KAFKA_BROKERS to be set.
+func PublisherFromEnv() (ports.Publisher, error) {
+	defaultPub, err := pub.PublisherFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("init publisher: %w", err)
+	}
+	publisher := pub.NewMux(defaultPub).
+		Handle(types.WebhookDestinationPrefix, pub.NewHTTP("", nil)).
+		Handle(types.SlackDestinationPrefix, pub.NewSlack("", nil)).
+		Handle(types.PagerDutyDestinationPrefix, pub.NewPagerDuty("", nil))
+
+	eventBridgePub, err := pub.EventBridgeFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("init EventBridge publisher: %w", err)
+	}
+	publisher.Handle(types.EventBridgeDestinationPrefix, eventBridgePub)
+
+	kafkaPub, err := KafkaPublisherFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("init Kafka publisher: %w", err)
+	}
+	if kafkaPub != nil {
+		publisher.Handle(types.KafkaDestinationPrefix, kafkaPub)
+	}
+	return publisher, nil
+}
+
+// KafkaPublisherFromEnv constructs a Kafka publisher from the comma-separated broker list in "KAFKA_BROKERS".
+// It returns (nil, nil) when the variable is unset, i.e. Kafka targets are not in use.
+func KafkaPublisherFromEnv() (ports.Publisher, error) {
+	brokersStr := os.Getenv(KafkaBrokers)
+	if brokersStr == "" {
+		return nil, nil
+	}
+	var brokers []string
+	for _, b := range strings.Split(brokersStr, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			brokers = append(brokers, b)
+		}
+	}
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("invalid %s: %q", KafkaBrokers, brokersStr)
+	}
+	w := &kafka.Writer{
+		Addr: kafka.TCP(brokers...),
+		// Hash keeps messages with the same key (edge scope) on the same partition.
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+	return pub.NewKafka(w), nil
+}
+
 // ddbClientFromEnv creates a DynamoDB client from environment variables, if any.
 func ddbClientFromEnv() (*dynamodb.Client, error) {
 	var ddbEndpoint *string
@@ -191,6 +330,46 @@ func redisClientFromEnv() (*redis.Client, error) {
 	return redisClient, nil
 }
 
+// PostgresBackendFromEnv connects to PostgreSQL at the DSN in "POSTGRES_DSN" (a URL or key=value string, see
+// pgxpool.ParseConfig), which is required.
+func PostgresBackendFromEnv() (*pgxpool.Pool, error) {
+	dsn := os.Getenv(PostgresDSN)
+	if dsn == "" {
+		return nil, fmt.Errorf("%s is required for the %s backend", PostgresDSN, BackendPostgres)
+	}
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", PostgresDSN, err)
+	}
+	if err := pool.Ping(context.Background()); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ping PostgreSQL: %w", err)
+	}
+	return pool, nil
+}
+
+// SQLiteBackendFromEnv opens the SQLite file at "SQLITE_PATH", which is required. The file is created if needed.
+func SQLiteBackendFromEnv() (*sql.DB, error) {
+	path := os.Getenv(SQLitePath)
+	if path == "" {
+		return nil, fmt.Errorf("%s is required for the %s backend", SQLitePath, BackendSQLite)
+	}
+	db, err := sqlite.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// edgeTTLFromEnv returns the edge TTL in "EDGE_TTL_SECONDS"; 0 if unset or invalid.
+func edgeTTLFromEnv() time.Duration {
+	secs, err := strconv.Atoi(os.Getenv(EdgeTTLSeconds))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
 // getenv retrieves the value of the environment variable named by the key.
 func getenv(key, def string) string {
 	v := os.Getenv(key)
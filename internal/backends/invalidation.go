@@ -0,0 +1,84 @@
+package backends
+
+import (
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"os"
+
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+
+	redisbackend "enoti/internal/backends/redis"
+)
+
+// ConfigInvalidationRedis, when true, announces client config writes on a Redis pub/sub channel (at REDIS_HOST
+// etc., whatever the client backend), and SubscribeConfigInvalidationsFromEnv drops the cached configs announced. A
+// config written by `enoti put` or another instance then takes effect everywhere at once rather than within the
+// five minutes of the config cache.
+const ConfigInvalidationRedis = "CONFIG_INVALIDATION_REDIS"
+
+// invalidatingClientStore announces the configs written through it on the invalidation channel.
+type invalidatingClientStore struct {
+	ports.ClientStore
+	cli *redis.Client
+}
+
+func (s invalidatingClientStore) PutClientConfig(ctx context.Context, clientID string, config types.ClientConfig) error {
+	if err := s.ClientStore.PutClientConfig(ctx, clientID, config); err != nil {
+		return err
+	}
+	s.announce(ctx, clientID)
+	return nil
+}
+
+func (s invalidatingClientStore) PutClientConfigCAS(ctx context.Context, clientID string, expectedVersion int64,
+	config types.ClientConfig) error {
+	if err := s.ClientStore.PutClientConfigCAS(ctx, clientID, expectedVersion, config); err != nil {
+		return err
+	}
+	s.announce(ctx, clientID)
+	return nil
+}
+
+func (s invalidatingClientStore) DeleteClientConfig(ctx context.Context, clientID string) error {
+	if err := s.ClientStore.DeleteClientConfig(ctx, clientID); err != nil {
+		return err
+	}
+	s.announce(ctx, clientID)
+	return nil
+}
+
+// announce publishes the invalidation of the config of clientID. Failures are only logged: the config is written,
+// and the cache TTL still bounds how long it goes unnoticed.
+func (s invalidatingClientStore) announce(ctx context.Context, clientID string) {
+	if err := redisbackend.PublishConfigInvalidation(ctx, s.cli, clientID); err != nil {
+		log.WithError(err).WithField("clientID", clientID).Warn("failed to announce the client config change")
+	}
+}
+
+// SubscribeConfigInvalidationsFromEnv drops the cached client configs announced on the invalidation channel until
+// ctx is done, if "CONFIG_INVALIDATION_REDIS" is set. Servers call it once at startup.
+func SubscribeConfigInvalidationsFromEnv(ctx context.Context) error {
+	if !parseBoolean(os.Getenv(ConfigInvalidationRedis)) {
+		return nil
+	}
+	cli, err := redisClientFromEnv()
+	if err != nil {
+		return err
+	}
+	return redisbackend.SubscribeConfigInvalidations(ctx, cli, flow.InvalidateClientConfig)
+}
+
+// withConfigInvalidation wraps store to announce its writes if "CONFIG_INVALIDATION_REDIS" is set.
+func withConfigInvalidation(store ports.ClientStore) (ports.ClientStore, error) {
+	if !parseBoolean(os.Getenv(ConfigInvalidationRedis)) {
+		return store, nil
+	}
+	cli, err := redisClientFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return invalidatingClientStore{ClientStore: store, cli: cli}, nil
+}
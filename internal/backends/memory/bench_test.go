@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/types"
+	"fmt"
+	"testing"
+)
+
+// The benchmarks of the hot path of the flow live here rather than in flow, which this package imports, so that they
+// run against a real DataStore without external services: go test -bench . ./internal/backends/memory
+
+// benchPayload returns the i-th event of a host flipping between up and down. Every 16 events move to another
+// host, so that flip histories, and the cost of an event, do not grow with b.N.
+func benchPayload(i int) map[string]any {
+	status := "up"
+	if i%2 == 1 {
+		status = "down"
+	}
+	return map[string]any{
+		"host":   fmt.Sprintf("db-%d", i/16),
+		"status": status,
+		"event":  map[string]any{"type": "health", "region": "eu-west-1", "latency_ms": 12.5},
+	}
+}
+
+// benchScenarios are the paths an event takes through Run, each with the action of most of its events.
+var benchScenarios = []struct {
+	name string
+	cc   types.ClientConfig
+	// same sends the same event over and over rather than flips
+	same bool
+}{
+	{"forward", types.ClientConfig{ClientRPM: 1 << 30}, false},
+	{"edge_forward", types.ClientConfig{ClientRPM: 1 << 30,
+		Trigger: types.TriggerConfig{FieldExpr: "status", ScopeFields: []string{"host"}}}, false},
+	{"suppress", types.ClientConfig{ClientRPM: 1 << 30,
+		Dedup:   &types.DedupConfig{Fields: []string{"host", "status"}, WindowSeconds: 3600},
+		Trigger: types.TriggerConfig{FieldExpr: "status", ScopeFields: []string{"host"}}}, true},
+	{"aggregate", types.ClientConfig{ClientRPM: 1 << 30,
+		Trigger: types.TriggerConfig{FieldExpr: "status", ScopeFields: []string{"host"},
+			Flapping: &types.FlapConfig{WindowSeconds: 3600, AggregateAt: 2}}}, false},
+}
+
+func BenchmarkRun(b *testing.B) {
+	for _, sc := range benchScenarios {
+		b.Run(sc.name, func(b *testing.B) {
+			ctx := context.Background()
+			store := NewStore()
+			b.ReportAllocs()
+			i := 0
+			for b.Loop() {
+				n := i
+				if sc.same {
+					n = 0
+				}
+				_, _, _, _ = flow.Run(ctx, "bench", "127.0.0.1", sc.cc, store, benchPayload(n))
+				i++
+			}
+		})
+	}
+}
+
+func BenchmarkEvaluateEdgeAndFlap(b *testing.B) {
+	for _, sc := range benchScenarios[1:] {
+		b.Run(sc.name, func(b *testing.B) {
+			ctx := context.Background()
+			store := NewStore()
+			b.ReportAllocs()
+			i := 0
+			for b.Loop() {
+				n := i
+				if sc.same {
+					n = 0
+				}
+				payload := benchPayload(n)
+				scope := payload["host"].(string)
+				_, _, _ = flow.EvaluateEdgeAndFlap(ctx, store, "bench", scope, payload["status"].(string),
+					sc.cc.Trigger, payload)
+				i++
+			}
+		})
+	}
+}
+
+func BenchmarkEncodePayload(b *testing.B) {
+	payload := benchPayload(0)
+	b.ReportAllocs()
+	for b.Loop() {
+		_, _ = flow.EncodePayload(payload)
+	}
+}
+
+// BenchmarkEvalAnyCompiled measures the JMESPath evaluations of an event, with the expressions cached compiled.
+func BenchmarkEvalAnyCompiled(b *testing.B) {
+	payload := benchPayload(0)
+	for _, expr := range []string{"status", "event.type == 'health' && status != 'down'", "[host, status]"} {
+		b.Run(expr, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				_, _ = flow.EvalAnyCompiled(expr, payload)
+			}
+		})
+	}
+}
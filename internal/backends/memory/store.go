@@ -0,0 +1,300 @@
+// Package memory keeps client configs and edge state in process memory, for tests and single-node use. Nothing
+// survives a restart, and state is not shared between processes.
+package memory
+
+import (
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/ports"
+	"enoti/internal/ratelimit"
+	"enoti/internal/types"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store implements both ports.ClientStore and ports.DataStore. Its clock is flow.Now, so that flow.SetTimNowFn
+// applies to rate limit windows and dedup expiry as well.
+type Store struct {
+	mu      sync.Mutex
+	configs map[string]types.ClientConfig
+	edges   map[string]types.Edge // by edgeKey
+	windows map[string]int        // rate limit counts by scope and window index
+	buckets map[string]ratelimit.TokenBucket
+	dedup   map[string]time.Time // expiry by client and hash
+	quotas  map[string]quotaCount
+	blocks  map[string]time.Time // expiry by scope
+}
+
+// quotaCount is the counter of a quota scope.
+type quotaCount struct {
+	count     int
+	expiresAt time.Time
+}
+
+func NewStore() *Store {
+	return &Store{
+		configs: map[string]types.ClientConfig{},
+		edges:   map[string]types.Edge{},
+		windows: map[string]int{},
+		buckets: map[string]ratelimit.TokenBucket{},
+		dedup:   map[string]time.Time{},
+		quotas:  map[string]quotaCount{},
+		blocks:  map[string]time.Time{},
+	}
+}
+
+var (
+	_ ports.ClientStore = (*Store)(nil)
+	_ ports.DataStore   = (*Store)(nil)
+)
+
+// edgeKey is the key of the edge state of a scope. Scope keys never contain a slash.
+func edgeKey(clientID, scopeKey string) string {
+	return clientID + "/" + scopeKey
+}
+
+// Ping always succeeds.
+func (s *Store) Ping(context.Context) error {
+	return nil
+}
+
+func (s *Store) GetClientConfig(_ context.Context, clientID string) (types.ClientConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cc, ok := s.configs[clientID]
+	if !ok {
+		return types.ClientConfig{}, types.ErrNotFound
+	}
+	return cc, nil
+}
+
+func (s *Store) ListClients(context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Sorted(maps.Keys(s.configs)), nil
+}
+
+func (s *Store) PutClientConfig(_ context.Context, clientID string, config types.ClientConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configs[clientID] = config
+	return nil
+}
+
+func (s *Store) PutClientConfigCAS(_ context.Context, clientID string, expectedVersion int64,
+	config types.ClientConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.configs[clientID].Version != expectedVersion {
+		return types.VersionConflict(clientID, expectedVersion)
+	}
+	config.Version = expectedVersion + 1
+	s.configs[clientID] = config
+	return nil
+}
+
+func (s *Store) DeleteClientConfig(_ context.Context, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.configs, clientID)
+	return nil
+}
+
+// ClearAll drops all client configs and all data.
+func (s *Store) ClearAll(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.configs)
+	clear(s.edges)
+	clear(s.windows)
+	clear(s.buckets)
+	clear(s.dedup)
+	clear(s.quotas)
+	return nil
+}
+
+// Acquire counts acquires in window-aligned buckets, with the sliding window approximation of the DynamoDB
+// backend, or takes from a token bucket (see ports.WithTokenBucket).
+func (s *Store) Acquire(ctx context.Context, scope string, ratePerWindow int, window time.Duration) (bool, error) {
+	if ratePerWindow <= 0 {
+		return false, nil
+	}
+	nowMS := flow.Now().UnixMilli()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if capacity, ok := ports.TokenBucket(ctx); ok {
+		next, ok := s.buckets[scope].Take(nowMS, capacity, ratePerWindow, window)
+		s.buckets[scope] = next
+		quota := ports.Quota{Limit: capacity, Remaining: int(next.Tokens)}
+		if !ok {
+			quota.Reset = next.NextTokenIn(ratePerWindow, window)
+		}
+		ports.ReportQuota(ctx, quota)
+		if ok {
+			ports.ReportSlot(ctx, ports.TokenSlot)
+		}
+		return ok, nil
+	}
+
+	idx, elapsed := ratelimit.WindowIndex(nowMS, window)
+	key := func(idx int64) string { return scope + "#" + window.String() + "#" + strconv.FormatInt(idx, 10) }
+	limit := ratelimit.SlidingLimit(s.windows[key(idx-1)], ratePerWindow, elapsed)
+	quota := ports.Quota{Limit: ratePerWindow, Reset: time.Duration((1 - elapsed) * float64(window))}
+	count := s.windows[key(idx)]
+	if count >= limit {
+		ports.ReportQuota(ctx, quota)
+		return false, nil
+	}
+	s.windows[key(idx)] = count + 1
+	// Buckets older than the previous one are never read again
+	delete(s.windows, key(idx-2))
+	quota.Remaining = max(0, limit-count-1)
+	ports.ReportQuota(ctx, quota)
+	ports.ReportSlot(ctx, ratelimit.WindowSlot(idx))
+	return true, nil
+}
+
+// Refund decrements the count of the window of the slot, unless it has been dropped since, or puts a token back in
+// the bucket.
+func (s *Store) Refund(ctx context.Context, scope, slot string, ratePerWindow int, window time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if capacity, ok := ports.TokenBucket(ctx); ok {
+		if b, ok := s.buckets[scope]; ok {
+			b.Tokens = min(float64(capacity), b.Tokens+1)
+			s.buckets[scope] = b
+		}
+		return nil
+	}
+	idx, err := ratelimit.ParseWindowSlot(slot)
+	if err != nil {
+		return err
+	}
+	key := scope + "#" + window.String() + "#" + strconv.FormatInt(idx, 10)
+	if s.windows[key] > 0 {
+		s.windows[key]--
+	}
+	return nil
+}
+
+// CountQuota counts in a map entry per scope. Expired entries are dropped whenever a scope starts counting.
+func (s *Store) CountQuota(_ context.Context, scope string, n, limit int, ttl time.Duration) (bool, error) {
+	now := flow.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.quotas[scope]
+	if !ok || !now.Before(q.expiresAt) {
+		q = quotaCount{}
+	}
+	if q.count+max(n, 1) > limit {
+		return false, nil
+	}
+	if n == 0 {
+		return true, nil
+	}
+	if q.count == 0 {
+		maps.DeleteFunc(s.quotas, func(_ string, q quotaCount) bool { return !now.Before(q.expiresAt) })
+	}
+	s.quotas[scope] = quotaCount{count: q.count + n, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *Store) Suppress(_ context.Context, clientID, hash string, window time.Duration) (bool, error) {
+	now := flow.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := clientID + "/" + hash
+	if until, ok := s.dedup[k]; ok && now.Before(until) {
+		return true, nil
+	}
+	s.dedup[k] = now.Add(window)
+	return false, nil
+}
+
+func (s *Store) Release(_ context.Context, clientID, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.dedup, clientID+"/"+hash)
+	return nil
+}
+
+// Block keeps the expiry of the block of scope. Expired blocks are dropped whenever a scope is blocked.
+func (s *Store) Block(_ context.Context, scope string, d time.Duration) error {
+	now := flow.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maps.DeleteFunc(s.blocks, func(_ string, until time.Time) bool { return !now.Before(until) })
+	if d <= 0 {
+		delete(s.blocks, scope)
+		return nil
+	}
+	s.blocks[scope] = now.Add(d)
+	return nil
+}
+
+func (s *Store) Blocked(_ context.Context, scope string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until, ok := s.blocks[scope]
+	return ok && flow.Now().Before(until), nil
+}
+
+func (s *Store) Load(_ context.Context, clientID, scopeKey string) (*types.Edge, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.edges[edgeKey(clientID, scopeKey)]
+	if !ok {
+		return nil, 0, nil
+	}
+	e.Recent = slices.Clone(e.Recent)
+	return &e, e.Version, nil
+}
+
+// UpsertCAS stores next if the stored version is still prevVersion, 0 meaning that there must be no state yet.
+func (s *Store) UpsertCAS(_ context.Context, clientID, scopeKey string, prevVersion int64,
+	next types.Edge) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := edgeKey(clientID, scopeKey)
+	cur, ok := s.edges[k]
+	if ok != (prevVersion != 0) || cur.Version != prevVersion {
+		return false, nil
+	}
+	next.ScopeKey = scopeKey
+	next.Version = prevVersion + 1
+	next.Recent = slices.Clone(next.Recent)
+	s.edges[k] = next
+	return true, nil
+}
+
+func (s *Store) DeleteEdge(_ context.Context, clientID, scopeKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.edges, edgeKey(clientID, scopeKey))
+	return nil
+}
+
+func (s *Store) ScanPendingAggregates(context.Context) ([]types.PendingEdge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pending []types.PendingEdge
+	for k, e := range s.edges {
+		if len(e.Recent) == 0 {
+			continue
+		}
+		clientID := k[:strings.LastIndex(k, "/")]
+		e.Recent = slices.Clone(e.Recent)
+		pending = append(pending, types.PendingEdge{ClientID: clientID, Edge: e, Version: e.Version})
+	}
+	return pending, nil
+}
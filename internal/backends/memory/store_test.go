@@ -0,0 +1,81 @@
+package memory
+
+import (
+	"context"
+	"enoti/internal/flow"
+	"enoti/internal/types"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func (s *UnitTestSuite) TestUpsertCASRace() {
+	ctx := context.Background()
+	store := NewStore()
+	ok, err := store.UpsertCAS(ctx, "c", "k", 0, types.Edge{LastValue: "a"})
+	s.NoError(err)
+	s.True(ok)
+	ok, err = store.UpsertCAS(ctx, "c", "k", 0, types.Edge{LastValue: "a"})
+	s.NoError(err)
+	s.False(ok, "already exists")
+
+	// Of concurrent writers having loaded the same version, exactly one commits
+	var committed atomic.Int32
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Go(func() {
+			_, ver, err := store.Load(ctx, "c", "k")
+			s.NoError(err)
+			if ok, _ := store.UpsertCAS(ctx, "c", "k", ver, types.Edge{LastValue: "b"}); ok {
+				committed.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	edge, ver, err := store.Load(ctx, "c", "k")
+	s.NoError(err)
+	s.Equal(int64(1)+int64(committed.Load()), ver)
+	s.Equal("k", edge.ScopeKey)
+
+	// Callers own what they load
+	edge.Recent = append(edge.Recent, types.Flip{To: "x"})
+	again, _, _ := store.Load(ctx, "c", "k")
+	s.Empty(again.Recent)
+}
+
+func (s *UnitTestSuite) TestAcquireFollowsFlowClock() {
+	ctx := context.Background()
+	store := NewStore()
+	now := time.Unix(1_700_000_000, 0)
+	flow.SetTimNowFn(func() time.Time { return now })
+	defer flow.RestoreTimeNow()
+
+	for i := range 3 {
+		ok, err := store.Acquire(ctx, "IP:1.2.3.4", 2, 10*time.Second)
+		s.NoError(err)
+		s.Equal(i < 2, ok, "request %d", i)
+	}
+	// The previous window still weighs right after the boundary, not two windows later
+	now = now.Add(10 * time.Second)
+	ok, _ := store.Acquire(ctx, "IP:1.2.3.4", 2, 10*time.Second)
+	s.False(ok)
+	now = now.Add(10 * time.Second)
+	ok, _ = store.Acquire(ctx, "IP:1.2.3.4", 2, 10*time.Second)
+	s.True(ok)
+
+	dup, _ := store.Suppress(ctx, "c", "h", time.Minute)
+	s.False(dup)
+	dup, _ = store.Suppress(ctx, "c", "h", time.Minute)
+	s.True(dup)
+	now = now.Add(time.Minute)
+	dup, _ = store.Suppress(ctx, "c", "h", time.Minute)
+	s.False(dup, "expired")
+}
+
+func (s *UnitTestSuite) TestClientStore() {
+	ctx := context.Background()
+	store := NewStore()
+	_, err := store.GetClientConfig(ctx, "client-1")
+	s.ErrorIs(err, types.ErrNotFound)
+	s.Error(store.PutClientConfig(ctx, "client-1", types.ClientConfig{}), "validated")
+}
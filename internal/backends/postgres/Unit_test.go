@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+// UnitTestSuite runs the stores against a mock of the pool, checking the statements they issue and how they read
+// the results; the statements themselves run against PostgreSQL in the integration tests.
+type UnitTestSuite struct {
+	suite.Suite
+	mock pgxmock.PgxPoolIface
+}
+
+func (s *UnitTestSuite) SetupTest() {
+	mock, err := pgxmock.NewPool()
+	s.Require().NoError(err)
+	s.mock = mock
+}
+
+func (s *UnitTestSuite) TearDownTest() {
+	s.NoError(s.mock.ExpectationsWereMet())
+	s.mock.Close()
+}
+
+// dataStore returns a DataStore on the mock, at the time now.
+func (s *UnitTestSuite) dataStore(now time.Time) *DataStore {
+	return &DataStore{pool: s.mock, now: func() time.Time { return now }}
+}
+
+// captured matches any argument, keeping the last one it matched.
+type captured struct{ v any }
+
+func (c *captured) Match(v any) bool {
+	c.v = v
+	return true
+}
+
+func TestUnitTestSuite(t *testing.T) {
+	suite.Run(t, new(UnitTestSuite))
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"enoti/internal/types"
+	"errors"
+
+	"github.com/goccy/go-json"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ClientStore struct {
+	pool conn
+}
+
+func NewClientStore(pool *pgxpool.Pool) *ClientStore {
+	createSchemaIfNotExists(pool)
+	return &ClientStore{pool: pool}
+}
+
+// Ping checks that the database is reachable.
+func (s *ClientStore) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
+func (s *ClientStore) GetClientConfig(ctx context.Context, clientID string) (types.ClientConfig, error) {
+	var b []byte
+	err := s.pool.QueryRow(ctx, `SELECT config FROM enoti_clients WHERE client_id = $1`, clientID).Scan(&b)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.ClientConfig{}, types.ErrNotFound
+	}
+	if err != nil {
+		return types.ClientConfig{}, err
+	}
+	var cc types.ClientConfig
+	if err := json.Unmarshal(b, &cc); err != nil {
+		return types.ClientConfig{}, err
+	}
+	return cc, nil
+}
+
+func (s *ClientStore) ListClients(ctx context.Context) ([]string, error) {
+	rows, err := s.pool.Query(ctx, `SELECT client_id FROM enoti_clients ORDER BY client_id`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (s *ClientStore) PutClientConfig(ctx context.Context, clientID string, config types.ClientConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx, `
+		INSERT INTO enoti_clients (client_id, config) VALUES ($1, $2)
+		ON CONFLICT (client_id) DO UPDATE SET config = EXCLUDED.config`, clientID, b)
+	return err
+}
+
+// PutClientConfigCAS compares the version within the stored config, in the statement that writes it.
+func (s *ClientStore) PutClientConfigCAS(ctx context.Context, clientID string, expectedVersion int64,
+	config types.ClientConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	config.Version = expectedVersion + 1
+	b, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	query, args := `
+		UPDATE enoti_clients SET config = $2
+		WHERE client_id = $1 AND COALESCE((config->>'version')::BIGINT, 0) = $3`, []any{clientID, b, expectedVersion}
+	if expectedVersion == 0 {
+		query, args = `
+		INSERT INTO enoti_clients (client_id, config) VALUES ($1, $2)
+		ON CONFLICT (client_id) DO UPDATE SET config = EXCLUDED.config
+		WHERE COALESCE((enoti_clients.config->>'version')::BIGINT, 0) = 0`, []any{clientID, b}
+	}
+	tag, err := s.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return types.VersionConflict(clientID, expectedVersion)
+	}
+	return nil
+}
+
+func (s *ClientStore) DeleteClientConfig(ctx context.Context, clientID string) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM enoti_clients WHERE client_id = $1`, clientID)
+	return err
+}
+
+// ClearAll empties all tables, client configs and data alike.
+func (s *ClientStore) ClearAll(ctx context.Context) error {
+	_, err := s.pool.Exec(ctx,
+		`TRUNCATE enoti_clients, enoti_edges, enoti_rate_windows, enoti_rate_buckets, enoti_dedup`)
+	return err
+}
@@ -0,0 +1,280 @@
+package postgres
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/ratelimit"
+	"enoti/internal/types"
+	"errors"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DataStore keeps edge states, rate limit counters and dedup markers in PostgreSQL.
+type DataStore struct {
+	pool conn
+	now  func() time.Time // rate limiter and dedup clock, replaced in tests
+}
+
+func NewDataStore(pool *pgxpool.Pool) *DataStore {
+	createSchemaIfNotExists(pool)
+	return &DataStore{pool: pool, now: time.Now}
+}
+
+// Ping checks that the database is reachable.
+func (s *DataStore) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
+// Acquire counts acquires in window-aligned buckets with the sliding window approximation of the DynamoDB backend,
+// or takes from a token bucket (see ports.WithTokenBucket). The count is incremented by an upsert that only applies
+// below the limit, so concurrent acquires never exceed it.
+func (s *DataStore) Acquire(ctx context.Context, scope string, ratePerWindow int, window time.Duration) (bool, error) {
+	if ratePerWindow <= 0 {
+		return false, nil
+	}
+	if capacity, ok := ports.TokenBucket(ctx); ok {
+		return s.acquireToken(ctx, scope, capacity, ratePerWindow, window)
+	}
+	idx, elapsed := ratelimit.WindowIndex(s.now().UnixMilli(), window)
+	var prev int
+	err := s.pool.QueryRow(ctx, `SELECT count FROM enoti_rate_windows WHERE scope = $1 AND win = $2`,
+		scope, idx-1).Scan(&prev)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return false, err
+	}
+	limit := ratelimit.SlidingLimit(prev, ratePerWindow, elapsed)
+	quota := ports.Quota{Limit: ratePerWindow, Reset: time.Duration((1 - elapsed) * float64(window))}
+	if limit <= 0 {
+		ports.ReportQuota(ctx, quota)
+		return false, nil
+	}
+	var count int
+	err = s.pool.QueryRow(ctx, `
+		INSERT INTO enoti_rate_windows (scope, win, count) VALUES ($1, $2, 1)
+		ON CONFLICT (scope, win) DO UPDATE SET count = enoti_rate_windows.count + 1
+		WHERE enoti_rate_windows.count < $3
+		RETURNING count`, scope, idx, limit).Scan(&count)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ports.ReportQuota(ctx, quota)
+		return false, nil // limited
+	}
+	if err != nil {
+		return false, err
+	}
+	if count == 1 {
+		// First acquire of the window; the windows before the previous one are never read again
+		if _, err := s.pool.Exec(ctx, `DELETE FROM enoti_rate_windows WHERE scope = $1 AND win < $2`,
+			scope, idx-1); err != nil {
+			return false, err
+		}
+	}
+	quota.Remaining = max(0, limit-count)
+	ports.ReportQuota(ctx, quota)
+	ports.ReportSlot(ctx, ratelimit.WindowSlot(idx))
+	return true, nil
+}
+
+// Refund decrements the count of the window of the slot, or puts a token back in the bucket.
+func (s *DataStore) Refund(ctx context.Context, scope, slot string, ratePerWindow int, window time.Duration) error {
+	if capacity, ok := ports.TokenBucket(ctx); ok {
+		_, err := s.pool.Exec(ctx, `UPDATE enoti_rate_buckets SET tokens = LEAST(tokens + 1, $2) WHERE scope = $1`,
+			scope, capacity)
+		return err
+	}
+	idx, err := ratelimit.ParseWindowSlot(slot)
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx, `
+		UPDATE enoti_rate_windows SET count = count - 1 WHERE scope = $1 AND win = $2 AND count > 0`, scope, idx)
+	return err
+}
+
+// CountQuota adds n to the count of the scope with an upsert that only applies within the limit, so concurrent
+// counts never exceed it.
+func (s *DataStore) CountQuota(ctx context.Context, scope string, n, limit int, ttl time.Duration) (bool, error) {
+	now := s.now()
+	if n == 0 {
+		var count int
+		err := s.pool.QueryRow(ctx, `SELECT count FROM enoti_quotas WHERE scope = $1 AND expires_at > $2`,
+			scope, now).Scan(&count)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return false, err
+		}
+		return count < limit, nil
+	}
+	if n > limit {
+		return false, nil
+	}
+	var count int
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO enoti_quotas (scope, count, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (scope) DO UPDATE
+		SET count = CASE WHEN enoti_quotas.expires_at <= $4 THEN $2 ELSE enoti_quotas.count + $2 END, expires_at = $3
+		WHERE CASE WHEN enoti_quotas.expires_at <= $4 THEN 0 ELSE enoti_quotas.count END + $2 <= $5
+		RETURNING count`, scope, n, now.Add(ttl), now, limit).Scan(&count)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil // used up
+	}
+	if err != nil {
+		return false, err
+	}
+	if count == n {
+		// The scope starts counting: drop the quotas of past periods
+		if _, err := s.pool.Exec(ctx, `DELETE FROM enoti_quotas WHERE expires_at <= $1`, now); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// acquireToken takes a token from the bucket of the scope, locking its row for the read-modify-write.
+func (s *DataStore) acquireToken(ctx context.Context, scope string, capacity, rate int,
+	window time.Duration) (bool, error) {
+	var ok bool
+	var next ratelimit.TokenBucket
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		// A bucket never used starts full (see ratelimit.TokenBucket)
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO enoti_rate_buckets (scope, tokens, last_ms) VALUES ($1, 0, 0)
+			ON CONFLICT (scope) DO NOTHING`, scope); err != nil {
+			return err
+		}
+		var b ratelimit.TokenBucket
+		if err := tx.QueryRow(ctx, `SELECT tokens, last_ms FROM enoti_rate_buckets WHERE scope = $1 FOR UPDATE`,
+			scope).Scan(&b.Tokens, &b.LastMS); err != nil {
+			return err
+		}
+		next, ok = b.Take(s.now().UnixMilli(), capacity, rate, window)
+		_, err := tx.Exec(ctx, `UPDATE enoti_rate_buckets SET tokens = $2, last_ms = $3 WHERE scope = $1`,
+			scope, next.Tokens, next.LastMS)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	quota := ports.Quota{Limit: capacity, Remaining: int(next.Tokens)}
+	if !ok {
+		quota.Reset = next.NextTokenIn(rate, window)
+	}
+	ports.ReportQuota(ctx, quota)
+	if ok {
+		ports.ReportSlot(ctx, ports.TokenSlot)
+	}
+	return ok, nil
+}
+
+// Suppress inserts the dedup marker, or replaces it if it has expired; the event is a duplicate if neither applied.
+func (s *DataStore) Suppress(ctx context.Context, clientID, hash string, window time.Duration) (bool, error) {
+	now := s.now()
+	tag, err := s.pool.Exec(ctx, `
+		INSERT INTO enoti_dedup (client_id, hash, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (client_id, hash) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		WHERE enoti_dedup.expires_at <= $4`, clientID, hash, now.Add(window), now)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 0, nil
+}
+
+func (s *DataStore) Release(ctx context.Context, clientID, hash string) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM enoti_dedup WHERE client_id = $1 AND hash = $2`, clientID, hash)
+	return err
+}
+
+// Block inserts or replaces a row expiring with the block, or deletes it if d <= 0.
+func (s *DataStore) Block(ctx context.Context, scope string, d time.Duration) error {
+	if d <= 0 {
+		_, err := s.pool.Exec(ctx, `DELETE FROM enoti_blocks WHERE scope = $1`, scope)
+		return err
+	}
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO enoti_blocks (scope, expires_at) VALUES ($1, $2)
+		ON CONFLICT (scope) DO UPDATE SET expires_at = EXCLUDED.expires_at`, scope, s.now().Add(d))
+	return err
+}
+
+func (s *DataStore) Blocked(ctx context.Context, scope string) (bool, error) {
+	var blocked bool
+	err := s.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM enoti_blocks WHERE scope = $1 AND expires_at > $2)`,
+		scope, s.now()).Scan(&blocked)
+	return blocked, err
+}
+
+// Load returns the edge state and a monotonic version suitable for CAS.
+// If no state exists, (nil,0,nil) MUST be returned.
+func (s *DataStore) Load(ctx context.Context, clientID, scopeKey string) (*types.Edge, int64, error) {
+	var ver int64
+	var b []byte
+	err := s.pool.QueryRow(ctx, `SELECT ver, state FROM enoti_edges WHERE client_id = $1 AND scope_key = $2`,
+		clientID, scopeKey).Scan(&ver, &b)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	var edge types.Edge
+	if err := json.Unmarshal(b, &edge); err != nil {
+		return nil, 0, err
+	}
+	edge.ScopeKey, edge.Version = scopeKey, ver
+	return &edge, ver, nil
+}
+
+// UpsertCAS inserts the state if prevVersion is 0 and there is none yet, or updates it if its version is still
+// prevVersion, bumping the version.
+func (s *DataStore) UpsertCAS(ctx context.Context, clientID, scopeKey string, prevVersion int64,
+	next types.Edge) (bool, error) {
+	next.ScopeKey = scopeKey // safety
+	b, err := json.Marshal(next)
+	if err != nil {
+		return false, err
+	}
+	query := `
+		UPDATE enoti_edges SET ver = ver + 1, state = $4
+		WHERE client_id = $1 AND scope_key = $2 AND ver = $3`
+	if prevVersion == 0 {
+		query = `
+			INSERT INTO enoti_edges (client_id, scope_key, ver, state) VALUES ($1, $2, $3 + 1, $4)
+			ON CONFLICT (client_id, scope_key) DO NOTHING`
+	}
+	tag, err := s.pool.Exec(ctx, query, clientID, scopeKey, prevVersion, b)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// DeleteEdge removes the edge state, if any.
+func (s *DataStore) DeleteEdge(ctx context.Context, clientID, scopeKey string) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM enoti_edges WHERE client_id = $1 AND scope_key = $2`, clientID, scopeKey)
+	return err
+}
+
+// ScanPendingAggregates returns the edge states of all clients with flips in Recent.
+func (s *DataStore) ScanPendingAggregates(ctx context.Context) ([]types.PendingEdge, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT client_id, scope_key, ver, state FROM enoti_edges
+		WHERE state->'recent' NOT IN ('null'::jsonb, '[]'::jsonb)`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (types.PendingEdge, error) {
+		var p types.PendingEdge
+		var scopeKey string
+		var b []byte
+		if err := row.Scan(&p.ClientID, &scopeKey, &p.Version, &b); err != nil {
+			return p, err
+		}
+		if err := json.Unmarshal(b, &p.Edge); err != nil {
+			return p, err
+		}
+		p.Edge.ScopeKey, p.Edge.Version = scopeKey, p.Version
+		return p, nil
+	})
+}
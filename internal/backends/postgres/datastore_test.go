@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"regexp"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pashagolub/pgxmock/v4"
+)
+
+func (s *UnitTestSuite) TestSchema() {
+	s.mock.ExpectExec(regexp.QuoteMeta(schema)).WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	createSchemaIfNotExists(s.mock)
+	for _, table := range []string{"enoti_clients", "enoti_edges", "enoti_rate_windows", "enoti_rate_buckets",
+		"enoti_quotas", "enoti_dedup", "enoti_blocks"} {
+		s.Contains(schema, "CREATE TABLE IF NOT EXISTS "+table+" (")
+	}
+}
+
+func (s *UnitTestSuite) TestUpsertCAS() {
+	ctx := context.Background()
+	ds := s.dataStore(time.Now())
+	state := func(e types.Edge) []byte {
+		e.ScopeKey = "k"
+		b, err := json.Marshal(e)
+		s.Require().NoError(err)
+		return b
+	}
+
+	// Creating inserts at version 1, unless another writer created the state first
+	insert := `INSERT INTO enoti_edges (client_id, scope_key, ver, state) VALUES ($1, $2, $3 + 1, $4)
+			ON CONFLICT (client_id, scope_key) DO NOTHING`
+	s.mock.ExpectExec(regexp.QuoteMeta(insert)).WithArgs("c", "k", int64(0), state(types.Edge{LastValue: "a"})).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	s.mock.ExpectExec(regexp.QuoteMeta(insert)).WithArgs("c", "k", int64(0), state(types.Edge{LastValue: "b"})).
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+	ok, err := ds.UpsertCAS(ctx, "c", "k", 0, types.Edge{LastValue: "a"})
+	s.NoError(err)
+	s.True(ok)
+	ok, err = ds.UpsertCAS(ctx, "c", "k", 0, types.Edge{LastValue: "b"})
+	s.NoError(err)
+	s.False(ok, "already exists")
+
+	// Updating applies at the loaded version only, and bumps it
+	update := `UPDATE enoti_edges SET ver = ver + 1, state = $4
+		WHERE client_id = $1 AND scope_key = $2 AND ver = $3`
+	s.mock.ExpectExec(regexp.QuoteMeta(update)).WithArgs("c", "k", int64(1), state(types.Edge{LastValue: "b"})).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	s.mock.ExpectExec(regexp.QuoteMeta(update)).WithArgs("c", "k", int64(1), state(types.Edge{LastValue: "c"})).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	ok, err = ds.UpsertCAS(ctx, "c", "k", 1, types.Edge{LastValue: "b"})
+	s.NoError(err)
+	s.True(ok)
+	ok, err = ds.UpsertCAS(ctx, "c", "k", 1, types.Edge{LastValue: "c"})
+	s.NoError(err)
+	s.False(ok, "stale version")
+
+	load := `SELECT ver, state FROM enoti_edges WHERE client_id = $1 AND scope_key = $2`
+	s.mock.ExpectQuery(regexp.QuoteMeta(load)).WithArgs("c", "k").
+		WillReturnRows(pgxmock.NewRows([]string{"ver", "state"}).AddRow(int64(2), state(types.Edge{LastValue: "b"})))
+	s.mock.ExpectQuery(regexp.QuoteMeta(load)).WithArgs("c", "other").
+		WillReturnRows(pgxmock.NewRows([]string{"ver", "state"}))
+	edge, ver, err := ds.Load(ctx, "c", "k")
+	s.NoError(err)
+	s.Equal(int64(2), ver)
+	s.Equal(types.Edge{ScopeKey: "k", LastValue: "b", Version: 2}, *edge)
+	edge, ver, err = ds.Load(ctx, "c", "other")
+	s.NoError(err)
+	s.Nil(edge)
+	s.Zero(ver)
+}
+
+func (s *UnitTestSuite) TestAcquireWindow() {
+	now := time.Unix(1_700_000_000, 0)
+	idx := now.Unix() / 10
+	var quota ports.Quota
+	ctx := ports.WithQuota(context.Background(), &quota)
+	ds := s.dataStore(now)
+	prev := `SELECT count FROM enoti_rate_windows WHERE scope = $1 AND win = $2`
+	upsert := `INSERT INTO enoti_rate_windows (scope, win, count) VALUES ($1, $2, 1)`
+
+	// The first acquire of a window drops the windows before the previous one
+	s.mock.ExpectQuery(regexp.QuoteMeta(prev)).WithArgs("IP:1", idx-1).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}))
+	s.mock.ExpectQuery(regexp.QuoteMeta(upsert)).WithArgs("IP:1", idx, 2).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(1))
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM enoti_rate_windows WHERE scope = $1 AND win < $2`)).
+		WithArgs("IP:1", idx-1).WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	var slot string
+	ok, err := ds.Acquire(ports.WithSlot(ctx, &slot), "IP:1", 2, 10*time.Second)
+	s.NoError(err)
+	s.True(ok)
+	s.Equal(ports.Quota{Limit: 2, Remaining: 1, Reset: 10 * time.Second}, quota)
+	s.Equal("170000000", slot)
+
+	// At capacity, the upsert does not apply and returns no row
+	s.mock.ExpectQuery(regexp.QuoteMeta(prev)).WithArgs("IP:1", idx-1).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(1))
+	s.mock.ExpectQuery(regexp.QuoteMeta(upsert)).WithArgs("IP:1", idx, 1).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}))
+	ok, err = ds.Acquire(ctx, "IP:1", 2, 10*time.Second)
+	s.NoError(err)
+	s.False(ok)
+	s.Equal(ports.Quota{Limit: 2, Reset: 10 * time.Second}, quota)
+
+	// A full previous window leaves no room right after the boundary, without a write
+	s.mock.ExpectQuery(regexp.QuoteMeta(prev)).WithArgs("IP:1", idx-1).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(2))
+	ok, err = ds.Acquire(ctx, "IP:1", 2, 10*time.Second)
+	s.NoError(err)
+	s.False(ok)
+}
+
+func (s *UnitTestSuite) TestRefund() {
+	now := time.Unix(1_700_000_000, 0)
+	ds := s.dataStore(now)
+
+	// The window of the slot is decremented, even if another one is current by now
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE enoti_rate_windows SET count = count - 1`)).
+		WithArgs("IP:1", int64(169_999_999)).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	s.NoError(ds.Refund(context.Background(), "IP:1", "169999999", 2, 10*time.Second))
+
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE enoti_rate_buckets SET tokens = LEAST(tokens + 1, $2)`)).
+		WithArgs("IP:1", 5).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	s.NoError(ds.Refund(ports.WithTokenBucket(context.Background(), 5), "IP:1", ports.TokenSlot, 2, 10*time.Second))
+}
+
+func (s *UnitTestSuite) TestAcquireTokenBucket() {
+	now := time.Unix(1_700_000_000, 0)
+	ctx := ports.WithTokenBucket(context.Background(), 5)
+	ds := s.dataStore(now)
+
+	// An empty bucket refilled last now is locked, read and written back within a transaction
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO enoti_rate_buckets (scope, tokens, last_ms) VALUES ($1, 0, 0)`)).
+		WithArgs("CLIENT:c").WillReturnResult(pgxmock.NewResult("INSERT", 0))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT tokens, last_ms FROM enoti_rate_buckets WHERE scope = $1 FOR UPDATE`)).
+		WithArgs("CLIENT:c").WillReturnRows(pgxmock.NewRows([]string{"tokens", "last_ms"}).
+		AddRow(float64(0), now.UnixMilli()))
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE enoti_rate_buckets SET tokens = $2, last_ms = $3 WHERE scope = $1`)).
+		WithArgs("CLIENT:c", float64(0), now.UnixMilli()).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	s.mock.ExpectCommit()
+	s.mock.ExpectRollback() // deferred by pgx.BeginFunc, a no-op once committed
+	ok, err := ds.Acquire(ctx, "CLIENT:c", 1, time.Second)
+	s.NoError(err)
+	s.False(ok)
+}
+
+func (s *UnitTestSuite) TestClientStore() {
+	ctx := context.Background()
+	cs := &ClientStore{pool: s.mock}
+	get := `SELECT config FROM enoti_clients WHERE client_id = $1`
+	s.mock.ExpectQuery(regexp.QuoteMeta(get)).WithArgs("c").WillReturnRows(pgxmock.NewRows([]string{"config"}))
+	_, err := cs.GetClientConfig(ctx, "c")
+	s.ErrorIs(err, types.ErrNotFound)
+
+	// The config is stored as a JSON document and read back as is
+	cc := types.ClientConfig{ClientID: "c", ClientName: "C", ClientKeyHash: "x",
+		Trigger: types.TriggerConfig{FieldExpr: "status"}}
+	var stored captured
+	s.mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO enoti_clients (client_id, config) VALUES ($1, $2)`)).
+		WithArgs("c", &stored).WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	s.NoError(cs.PutClientConfig(ctx, "c", cc))
+	s.mock.ExpectQuery(regexp.QuoteMeta(get)).WithArgs("c").
+		WillReturnRows(pgxmock.NewRows([]string{"config"}).AddRow(stored.v))
+	got, err := cs.GetClientConfig(ctx, "c")
+	s.NoError(err)
+	s.Equal(cc, got)
+
+	// A conditional write to a config at another version applies to no row
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE enoti_clients SET config = $2`)).
+		WithArgs("c", pgxmock.AnyArg(), int64(3)).WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	s.ErrorIs(cs.PutClientConfigCAS(ctx, "c", 3, cc), types.ErrVersionConflict)
+}
@@ -0,0 +1,69 @@
+// Package postgres keeps client configs and edge state in PostgreSQL. Configs and edge states are stored as JSON
+// documents; edge CAS is an UPDATE conditioned on the version.
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	log "github.com/sirupsen/logrus"
+)
+
+// conn is the part of *pgxpool.Pool the stores use, which a mock can stand in for in tests.
+type conn interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Ping(ctx context.Context) error
+}
+
+// schema creates the tables on first use. PostgreSQL has no TTL: expired dedup markers and blocks are replaced in
+// place, old rate limit windows are dropped when their scope opens a new one, and expired quotas when a quota starts
+// counting.
+const schema = `
+CREATE TABLE IF NOT EXISTS enoti_clients (
+	client_id TEXT PRIMARY KEY,
+	config    JSONB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS enoti_edges (
+	client_id TEXT NOT NULL,
+	scope_key TEXT NOT NULL,
+	ver       BIGINT NOT NULL,
+	state     JSONB NOT NULL,
+	PRIMARY KEY (client_id, scope_key)
+);
+CREATE TABLE IF NOT EXISTS enoti_rate_windows (
+	scope TEXT NOT NULL,
+	win   BIGINT NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (scope, win)
+);
+CREATE TABLE IF NOT EXISTS enoti_rate_buckets (
+	scope   TEXT PRIMARY KEY,
+	tokens  DOUBLE PRECISION NOT NULL,
+	last_ms BIGINT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS enoti_quotas (
+	scope      TEXT PRIMARY KEY,
+	count      INTEGER NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE IF NOT EXISTS enoti_dedup (
+	client_id  TEXT NOT NULL,
+	hash       TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (client_id, hash)
+);
+CREATE TABLE IF NOT EXISTS enoti_blocks (
+	scope      TEXT PRIMARY KEY,
+	expires_at TIMESTAMPTZ NOT NULL
+);`
+
+// createSchemaIfNotExists creates the tables of both stores if they do not exist yet.
+func createSchemaIfNotExists(pool conn) {
+	if _, err := pool.Exec(context.Background(), schema); err != nil {
+		log.Fatalf("Failed to create the enoti tables: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/suite"
+)
+
+type UnitTestSuite struct {
+	suite.Suite
+	server *miniredis.Miniredis
+	cli    *redis.Client
+}
+
+func (s *UnitTestSuite) SetupTest() {
+	s.server = miniredis.RunT(s.T())
+	s.cli = redis.NewClient(&redis.Options{Addr: s.server.Addr()})
+}
+
+func (s *UnitTestSuite) TearDownTest() {
+	_ = s.cli.Close()
+}
+
+func TestUnitTestSuite(t *testing.T) {
+	suite.Run(t, new(UnitTestSuite))
+}
@@ -3,7 +3,9 @@ package redis
 import (
 	"context"
 	"enoti/internal/types"
+	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/goccy/go-json"
 	"github.com/redis/go-redis/v9"
@@ -22,8 +24,16 @@ func NewClientStore(cli *redis.Client) *ClientStore {
 	return &ClientStore{cli: cli}
 }
 
+// Ping sends a PING to the server.
+func (s *ClientStore) Ping(ctx context.Context) error {
+	return s.cli.Ping(ctx).Err()
+}
+
 func (s *ClientStore) GetClientConfig(ctx context.Context, clientID string) (types.ClientConfig, error) {
 	out := s.cli.Get(ctx, getClientKey(clientID))
+	if errors.Is(out.Err(), redis.Nil) {
+		return types.ClientConfig{}, types.ErrNotFound
+	}
 	if out.Err() != nil {
 		return types.ClientConfig{}, out.Err()
 	}
@@ -34,12 +44,37 @@ func (s *ClientStore) GetClientConfig(ctx context.Context, clientID string) (typ
 	return cfg, nil
 }
 
+// ListClients walks the configs with SCAN, which unlike KEYS does not block the server on large keyspaces.
 func (s *ClientStore) ListClients(ctx context.Context) ([]string, error) {
-	out := s.cli.Keys(ctx, getClientKey(""))
-	if out.Err() != nil {
-		return nil, out.Err()
+	var clients []string
+	cursor := ""
+	for {
+		page, next, err := s.ListClientsPage(ctx, cursor, 0)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, page...)
+		if next == "" {
+			return clients, nil
+		}
+		cursor = next
+	}
+}
+
+// ListClientsPage scans the configs from cursor, a SCAN cursor. limit is the COUNT hint of SCAN, so pages may hold
+// somewhat more or fewer IDs.
+func (s *ClientStore) ListClientsPage(ctx context.Context, cursor string, limit int) ([]string, string, error) {
+	var from uint64
+	if cursor != "" {
+		var err error
+		if from, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", fmt.Errorf("invalid cursor %q", cursor)
+		}
+	}
+	keys, next, err := s.cli.Scan(ctx, from, getClientKey("*"), int64(limit)).Result()
+	if err != nil {
+		return nil, "", err
 	}
-	keys := out.Val()
 	clients := make([]string, 0, len(keys))
 	prefixLen := len(fmt.Sprintf(configKeyNameTemplate, ""))
 	for _, k := range keys {
@@ -47,7 +82,10 @@ func (s *ClientStore) ListClients(ctx context.Context) ([]string, error) {
 			clients = append(clients, k[prefixLen:])
 		}
 	}
-	return clients, nil
+	if next == 0 {
+		return clients, "", nil
+	}
+	return clients, strconv.FormatUint(next, 10), nil
 }
 
 func (s *ClientStore) PutClientConfig(ctx context.Context, clientID string, config types.ClientConfig) error {
@@ -70,6 +108,47 @@ func (s *ClientStore) PutClientConfig(ctx context.Context, clientID string, conf
 	return outS.Err()
 }
 
+// PutClientConfigCAS WATCHes the config while comparing its version, so that the write fails if it changes before
+// the write is executed.
+func (s *ClientStore) PutClientConfigCAS(ctx context.Context, clientID string, expectedVersion int64,
+	config types.ClientConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	config.Version = expectedVersion + 1
+	out, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	key := getClientKey(clientID)
+	err = s.cli.Watch(ctx, func(tx *redis.Tx) error {
+		var stored struct {
+			Version int64 `json:"version"`
+		}
+		b, err := tx.Get(ctx, key).Bytes()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if err == nil {
+			if err := json.Unmarshal(b, &stored); err != nil {
+				return err
+			}
+		}
+		if stored.Version != expectedVersion {
+			return types.VersionConflict(clientID, expectedVersion)
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Set(ctx, key, string(out), 0)
+			return nil
+		})
+		return err
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) {
+		return types.VersionConflict(clientID, expectedVersion)
+	}
+	return err
+}
+
 func (s *ClientStore) DeleteClientConfig(ctx context.Context, clientID string) error {
 	out := s.cli.Del(ctx, getClientKey(clientID))
 	return out.Err()
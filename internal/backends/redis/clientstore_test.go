@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"context"
+	"enoti/internal/types"
+	"fmt"
+)
+
+func (s *UnitTestSuite) TestListClientsPaged() {
+	ctx := context.Background()
+	cs := NewClientStore(s.cli)
+	var want []string
+	for i := range 25 {
+		id := fmt.Sprintf("client-%02d", i)
+		want = append(want, id)
+		s.Require().NoError(cs.PutClientConfig(ctx, id, types.ClientConfig{ClientID: id, ClientName: id,
+			ClientKey: "client-key-123"}))
+	}
+	s.Require().NoError(s.cli.Set(ctx, "_enoti_other", "x", 0).Err())
+
+	// miniredis answers a SCAN at once whatever its COUNT, so this only checks the walk over the cursor
+	var paged []string
+	cursor := ""
+	for {
+		ids, next, err := cs.ListClientsPage(ctx, cursor, 10)
+		s.Require().NoError(err)
+		paged = append(paged, ids...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	s.ElementsMatch(want, paged)
+
+	all, err := cs.ListClients(ctx)
+	s.NoError(err)
+	s.ElementsMatch(want, all)
+
+	_, _, err = cs.ListClientsPage(ctx, "not-a-cursor", 10)
+	s.Error(err)
+}
+
+func (s *UnitTestSuite) TestPutClientConfigCAS() {
+	ctx := context.Background()
+	cs := NewClientStore(s.cli)
+	cc := types.ClientConfig{ClientID: "cas", ClientName: "cas", ClientKey: "client-key-123"}
+	s.Require().NoError(cs.PutClientConfigCAS(ctx, "cas", 0, cc))
+	s.ErrorIs(cs.PutClientConfigCAS(ctx, "cas", 0, cc), types.ErrVersionConflict)
+
+	// Two editors at version 1: the second one is stale once the first wrote
+	s.Require().NoError(cs.PutClientConfigCAS(ctx, "cas", 1, cc))
+	s.ErrorIs(cs.PutClientConfigCAS(ctx, "cas", 1, cc), types.ErrVersionConflict)
+	got, err := cs.GetClientConfig(ctx, "cas")
+	s.Require().NoError(err)
+	s.Equal(int64(2), got.Version)
+}
@@ -2,10 +2,14 @@ package redis
 
 import (
 	"context"
+	"enoti/internal/ports"
+	"enoti/internal/ratelimit"
 	"enoti/internal/types"
 	"errors"
 	"fmt"
+	"math/rand/v2"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/goccy/go-json"
@@ -13,17 +17,142 @@ import (
 )
 
 const (
-	dataKeyNameTemplate   = "_enoti_data_%s_s%s"
-	windowKeyNameTemplate = "_enoti_rwin_%s_%d" // for rate limiting
+	dataKeyPrefix         = "_enoti_data_"
+	dataKeyNameTemplate   = dataKeyPrefix + "%s_s%s"
+	logKeyNameTemplate    = "_enoti_rlog_%s" // for rate limiting
+	bucketKeyNameTemplate = "_enoti_rbkt_%s" // for token bucket rate limiting
+	dedupKeyNameTemplate  = "_enoti_dedup_%s_%s"
+	quotaKeyNameTemplate  = "_enoti_quota_%s"
+	blockKeyNameTemplate  = "_enoti_block_%s"
 )
 
+// slidingWindowScript grants a request if fewer than the limit were granted in the trailing window, atomically.
+// ARGV: now in unix ms, window in ms, limit, a unique member for this request.
+// Returns {granted (1 or 0), requests in the window, time in unix ms of the oldest of them}.
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local granted = 0
+if redis.call("ZCARD", KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	redis.call("PEXPIRE", KEYS[1], window)
+	granted = 1
+end
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+return {granted, redis.call("ZCARD", KEYS[1]), oldest[2] or ARGV[1]}
+`)
+
+// takeTokenScript refills and takes one token from the bucket hash in KEYS[1], atomically.
+// ARGV: capacity, refill rate in tokens per ms, now in unix ms, ttl in ms.
+// Returns {taken (1 or 0), tokens left}. Mirrors ratelimit.TokenBucket.Take.
+var takeTokenScript = redis.NewScript(`
+local state = redis.call("HMGET", KEYS[1], "tokens", "last_ms")
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local tokens = capacity
+if state[1] and state[2] then
+	local elapsed = math.max(0, now - tonumber(state[2]))
+	tokens = math.min(capacity, tonumber(state[1]) + elapsed * rate)
+end
+if tokens < 1 then
+	return {0, tostring(tokens)}
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens - 1), "last_ms", ARGV[3])
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return {1, tostring(tokens - 1)}
+`)
+
+// refundTokenScript puts a token back in the bucket hash in KEYS[1], if it exists, up to the capacity in ARGV[1].
+var refundTokenScript = redis.NewScript(`
+local tokens = redis.call("HGET", KEYS[1], "tokens")
+if tokens then
+	redis.call("HSET", KEYS[1], "tokens", tostring(math.min(tonumber(ARGV[1]), tonumber(tokens) + 1)))
+end
+return 1
+`)
+
+// upsertEdgeScript sets the fields of the edge hash in KEYS[1] if its version is ARGV[1], 0 meaning that the hash
+// must not exist, atomically, and sets its expiry to ARGV[2] ms unless that is 0 (see ports.EdgeTTL).
+// ARGV[3..] are the field names and values. Returns 1 if written, 0 otherwise.
+var upsertEdgeScript = redis.NewScript(`
+if tonumber(redis.call("HGET", KEYS[1], "ver") or "0") ~= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("HSET", KEYS[1], unpack(ARGV, 3))
+if tonumber(ARGV[2]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// countQuotaScript adds ARGV[1] to the counter in KEYS[1] unless that takes it past the limit ARGV[2], atomically,
+// and sets its expiry to ARGV[3] ms. With ARGV[1] 0, it only checks that the counter is below the limit.
+// Returns 1 if granted, 0 otherwise.
+var countQuotaScript = redis.NewScript(`
+local n = tonumber(ARGV[1])
+local count = tonumber(redis.call("GET", KEYS[1]) or "0")
+if count + math.max(n, 1) > tonumber(ARGV[2]) then
+	return 0
+end
+if n > 0 then
+	redis.call("INCRBY", KEYS[1], n)
+	redis.call("PEXPIRE", KEYS[1], ARGV[3])
+end
+return 1
+`)
+
 // DataStore implements ports.DedupStore using a TTL item per key.
 type DataStore struct {
-	cli *redis.Client
+	cli     *redis.Client
+	now     func() time.Time // rate limiter clock, replaced in tests
+	edgeTTL time.Duration
 }
 
 func NewDataStore(cli *redis.Client) *DataStore {
-	return &DataStore{cli: cli}
+	return &DataStore{cli: cli, now: time.Now}
+}
+
+// WithEdgeTTL sets how long edge keys are kept after their last write (see ports.EdgeTTL); 0, the default, keeps
+// them forever.
+func (s *DataStore) WithEdgeTTL(ttl time.Duration) *DataStore {
+	s.edgeTTL = ttl
+	return s
+}
+
+// Ping sends a PING to the server.
+func (s *DataStore) Ping(ctx context.Context) error {
+	return s.cli.Ping(ctx).Err()
+}
+
+// Suppress sets the dedup key with NX and the window as expiry; the event is a duplicate if the key was already set.
+func (s *DataStore) Suppress(ctx context.Context, clientID, hash string, window time.Duration) (bool, error) {
+	set, err := s.cli.SetNX(ctx, getDedupKeyName(clientID, hash), 1, window).Result()
+	if err != nil {
+		return false, err
+	}
+	return !set, nil
+}
+
+func (s *DataStore) Release(ctx context.Context, clientID, hash string) error {
+	return s.cli.Del(ctx, getDedupKeyName(clientID, hash)).Err()
+}
+
+// Block sets a key expiring with the block, or deletes it if d <= 0.
+func (s *DataStore) Block(ctx context.Context, scope string, d time.Duration) error {
+	if d <= 0 {
+		return s.cli.Del(ctx, getBlockKeyName(scope)).Err()
+	}
+	return s.cli.Set(ctx, getBlockKeyName(scope), 1, d).Err()
+}
+
+func (s *DataStore) Blocked(ctx context.Context, scope string) (bool, error) {
+	n, err := s.cli.Exists(ctx, getBlockKeyName(scope)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
 }
 
 // Load returns the edge state and a monotonic version suitable for CAS.
@@ -65,6 +194,13 @@ func (s *DataStore) Load(ctx context.Context, clientID, scopeKey string) (*types
 	if err := json.Unmarshal([]byte(m["recent"]), &recent); err != nil {
 		return nil, 0, fmt.Errorf("invalid recent: %w", err)
 	}
+	// Absent from the keys written before aggregates were fingerprinted
+	var lastAggTS int64
+	if v, ok := m["last_agg_ts"]; ok {
+		if lastAggTS, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, 0, fmt.Errorf("invalid last_agg_ts: %w", err)
+		}
+	}
 
 	edge := &types.Edge{
 		ScopeKey:     scopeKey,
@@ -74,124 +210,157 @@ func (s *DataStore) Load(ctx context.Context, clientID, scopeKey string) (*types
 		FlipCount:    flipCount,
 		Recent:       recent,
 		AggUntilTS:   aggUntilTS,
+
+		LastAggFingerprint: m["last_agg_fp"],
+		LastAggTS:          lastAggTS,
+		LastForwarded:      m["last_forwarded"],
 	}
 	return edge, ver, nil
 }
 
-// UpsertCAS creates or updates the row only if ver matches prevVersion.
-// On create (prevVersion==0), the row must not exist (attribute_not_exists).
-func (s *DataStore) UpsertCAS(ctx context.Context, clientID, scopeKey string, prevVersion int64, next types.Edge) (bool, error) {
-	next.ScopeKey = scopeKey // safety
-	if prevVersion == 0 {
-		next.Version = 1
-		recentMarshaled, err := json.Marshal(next.Recent)
-		if err != nil {
-			return false, err
+// ScanPendingAggregates walks the edge keys of all clients with SCAN and returns those with flips in Recent.
+func (s *DataStore) ScanPendingAggregates(ctx context.Context) ([]types.PendingEdge, error) {
+	var pending []types.PendingEdge
+	iter := s.cli.Scan(ctx, 0, getDataKeyName("*", "*"), 0).Iterator()
+	for iter.Next(ctx) {
+		// Scope keys never contain "_s", so the last one separates the client ID from the scope key
+		rest := strings.TrimPrefix(iter.Val(), dataKeyPrefix)
+		i := strings.LastIndex(rest, "_s")
+		if i < 0 {
+			continue
 		}
-		av := map[string]any{
-			"scope_key":      next.ScopeKey,
-			"last_value":     next.LastValue,
-			"last_change_ts": next.LastChangeTS,
-			"window_start":   next.WindowStart,
-			"flip_count":     next.FlipCount,
-			"recent":         recentMarshaled,
-			"agg_until_ts":   next.AggUntilTS,
-			"ver":            next.Version,
+		clientID, scopeKey := rest[:i], rest[i+2:]
+		edge, ver, err := s.Load(ctx, clientID, scopeKey)
+		if err != nil {
+			return nil, err
 		}
-		// Set all fields
-		out := s.cli.HMSet(ctx, getDataKeyName(clientID, scopeKey), av)
-		if out.Err() != nil {
-			return false, out.Err()
+		if edge == nil || len(edge.Recent) == 0 {
+			continue
 		}
-		return true, nil
+		pending = append(pending, types.PendingEdge{ClientID: clientID, Edge: *edge, Version: ver})
 	}
+	return pending, iter.Err()
+}
 
-	// Update with version bump under condition ver == prevVersion
-	// with Redis
-	currentVerObj, err := s.cli.HMGet(ctx, getDataKeyName(clientID, scopeKey), "ver").Result()
+// UpsertCAS writes the edge hash with upsertEdgeScript, so that the version check and the write are atomic.
+// On create (prevVersion==0), the hash must not exist.
+func (s *DataStore) UpsertCAS(ctx context.Context, clientID, scopeKey string, prevVersion int64, next types.Edge) (bool, error) {
+	next.ScopeKey = scopeKey // safety
+	recentMarshaled, err := json.Marshal(next.Recent)
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return false, nil // key does not exist
-		}
 		return false, err
 	}
-
-	currentVerStr, ok := currentVerObj[0].(string)
-	if !ok || currentVerStr == "" {
-		return false, nil // key does not exist
-	}
-	currenVersion, err := strconv.ParseInt(currentVerStr, 10, 64)
-	if err != nil {
-		return false, fmt.Errorf("invalid ver: %w", err)
-	}
-	if currenVersion != prevVersion {
-		return false, nil // version mismatch
-	}
-
-	recentMarshaled, err := json.Marshal(next.Recent)
+	written, err := upsertEdgeScript.Run(ctx, s.cli, []string{getDataKeyName(clientID, scopeKey)},
+		prevVersion, ports.EdgeTTL(ctx, s.edgeTTL).Milliseconds(),
+		"scope_key", next.ScopeKey,
+		"last_value", next.LastValue,
+		"last_change_ts", next.LastChangeTS,
+		"window_start", next.WindowStart,
+		"flip_count", next.FlipCount,
+		"recent", string(recentMarshaled),
+		"agg_until_ts", next.AggUntilTS,
+		"last_agg_fp", next.LastAggFingerprint,
+		"last_agg_ts", next.LastAggTS,
+		"last_forwarded", next.LastForwarded,
+		"ver", prevVersion+1,
+	).Int()
 	if err != nil {
 		return false, err
 	}
+	return written == 1, nil
+}
 
-	outN := s.cli.HMSet(ctx, getDataKeyName(clientID, scopeKey), map[string]interface{}{
-		"last_value":     next.LastValue,
-		"last_change_ts": next.LastChangeTS,
-		"window_start":   next.WindowStart,
-		"flip_count":     next.FlipCount,
-		"recent":         string(recentMarshaled),
-		"agg_until_ts":   next.AggUntilTS,
-		"ver":            currenVersion + 1,
-	})
-	return true, outN.Err()
+// DeleteEdge deletes the edge key, if any.
+func (s *DataStore) DeleteEdge(ctx context.Context, clientID, scopeKey string) error {
+	return s.cli.Del(ctx, getDataKeyName(clientID, scopeKey)).Err()
 }
 
 func (s *DataStore) Acquire(ctx context.Context, key string, ratePerWindow int, window time.Duration) (bool, error) {
 	if ratePerWindow <= 0 {
 		return false, nil
 	}
-	// Window bucketing by integer minutes only (simple, predictable).
-	// We use the minimum of (window, 60s) when deriving TTL — avoid long-lived keys.
-	epochMin := time.Now().Unix() / 60
-
-	// Atomic: ADD count 1, set ttl if absent, condition count < capacity
-	// Check capacity first
-	cacheKey := getWindowKeyName(key, epochMin)
-	outC := s.cli.HGet(ctx, cacheKey, "count")
-	if outC.Err() != nil {
-		if errors.Is(outC.Err(), redis.Nil) {
-			// does not exist yet, proceed
-			out := s.cli.HIncrBy(ctx, cacheKey, "count", 1)
-			e1 := out.Err()
-			if e1 != nil {
-				return false, e1
-			}
-			outb := s.cli.Expire(ctx, cacheKey, 2*window)
-			e2 := outb.Err()
-			return e2 == nil, e2
-		}
-		return false, outC.Err()
+	if capacity, ok := ports.TokenBucket(ctx); ok {
+		return s.acquireToken(ctx, key, capacity, ratePerWindow, window)
 	}
-	if outC.Val() != "" {
-		count, err := strconv.Atoi(outC.Val())
-		if err != nil {
-			return false, fmt.Errorf("invalid count: %w", err)
-		}
-		if count >= ratePerWindow {
-			return false, nil // at capacity
-		}
+	// Sliding window log: one sorted set member per granted request, scored by its time
+	now := s.now()
+	member := fmt.Sprintf("%d-%d", now.UnixNano(), rand.Uint32())
+	res, err := slidingWindowScript.Run(ctx, s.cli, []string{getLogKeyName(key)},
+		now.UnixMilli(), window.Milliseconds(), ratePerWindow, member).Slice()
+	if err != nil {
+		return false, err
 	}
-	// Item exits path
-	out := s.cli.HIncrBy(ctx, cacheKey, "count", 1)
-	if out.Err() != nil {
-		return false, out.Err()
+	granted, count := res[0].(int64), res[1].(int64)
+	oldest, err := strconv.ParseFloat(res[2].(string), 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid oldest score: %w", err)
 	}
+	ports.ReportQuota(ctx, ports.Quota{
+		Limit:     ratePerWindow,
+		Remaining: max(0, ratePerWindow-int(count)),
+		Reset:     time.Duration(int64(oldest)+window.Milliseconds()-now.UnixMilli()) * time.Millisecond,
+	})
+	if granted == 1 {
+		// The slot is the member logging the request
+		ports.ReportSlot(ctx, member)
+	}
+	return granted == 1, nil
+}
 
+// Refund removes the request of the slot from the sliding window log, or puts a token back with refundTokenScript.
+func (s *DataStore) Refund(ctx context.Context, key, slot string, ratePerWindow int, window time.Duration) error {
+	if capacity, ok := ports.TokenBucket(ctx); ok {
+		return refundTokenScript.Run(ctx, s.cli, []string{getBucketKeyName(key)}, capacity).Err()
+	}
+	return s.cli.ZRem(ctx, getLogKeyName(key), slot).Err()
+}
+
+// CountQuota counts in a key per scope with countQuotaScript.
+func (s *DataStore) CountQuota(ctx context.Context, scope string, n, limit int, ttl time.Duration) (bool, error) {
+	granted, err := countQuotaScript.Run(ctx, s.cli, []string{getQuotaKeyName(scope)},
+		n, limit, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return granted == 1, nil
+}
+
+// acquireToken takes a token from the scope's bucket with takeTokenScript.
+func (s *DataStore) acquireToken(ctx context.Context, key string, capacity, rate int, window time.Duration) (bool, error) {
+	ttl := ratelimit.FullAfter(capacity, rate, window) + 2*time.Minute
+	res, err := takeTokenScript.Run(ctx, s.cli, []string{getBucketKeyName(key)},
+		capacity, ratelimit.RefillPerMS(rate, window), s.now().UnixMilli(), ttl.Milliseconds()).Slice()
+	if err != nil {
+		return false, err
+	}
+	tokens, err := strconv.ParseFloat(res[1].(string), 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid tokens: %w", err)
+	}
+	b := ratelimit.TokenBucket{Tokens: tokens}
+	ports.ReportQuota(ctx, ports.Quota{Limit: capacity, Remaining: int(tokens), Reset: b.NextTokenIn(rate, window)})
+	if res[0].(int64) != 1 {
+		return false, nil
+	}
+	ports.ReportSlot(ctx, ports.TokenSlot)
 	return true, nil
 }
 
 func getDataKeyName(clientID, scopeKey string) string {
 	return fmt.Sprintf(dataKeyNameTemplate, clientID, scopeKey)
 }
-func getWindowKeyName(key string, epochMin int64) string {
-	return fmt.Sprintf(windowKeyNameTemplate, key, epochMin)
+func getLogKeyName(key string) string {
+	return fmt.Sprintf(logKeyNameTemplate, key)
+}
+func getDedupKeyName(clientID, hash string) string {
+	return fmt.Sprintf(dedupKeyNameTemplate, clientID, hash)
+}
+func getQuotaKeyName(scope string) string {
+	return fmt.Sprintf(quotaKeyNameTemplate, scope)
+}
+func getBlockKeyName(scope string) string {
+	return fmt.Sprintf(blockKeyNameTemplate, scope)
+}
+func getBucketKeyName(key string) string {
+	return fmt.Sprintf(bucketKeyNameTemplate, key)
 }
@@ -0,0 +1,269 @@
+package redis
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// acquireConcurrently fires n concurrent Acquire calls and returns how many were granted.
+func (s *UnitTestSuite) acquireConcurrently(ctx context.Context, n, rate int) int {
+	ds := NewDataStore(s.cli)
+	var granted atomic.Int32
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := ds.Acquire(ctx, "CLIENT:c", rate, time.Minute)
+			s.NoError(err)
+			if ok {
+				granted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	return int(granted.Load())
+}
+
+func (s *UnitTestSuite) TestAcquireConcurrent() {
+	s.Equal(1, s.acquireConcurrently(context.Background(), 50, 1))
+}
+
+func (s *UnitTestSuite) TestAcquireTokenBucketConcurrent() {
+	ctx := ports.WithTokenBucket(context.Background(), 3)
+	s.Equal(3, s.acquireConcurrently(ctx, 50, 1))
+}
+
+func (s *UnitTestSuite) TestAcquireWindow() {
+	ctx := context.Background()
+	now := time.Now()
+	ds := NewDataStore(s.cli)
+	ds.now = func() time.Time { return now }
+
+	for i := range 3 {
+		ok, err := ds.Acquire(ctx, "IP:1.2.3.4", 2, 10*time.Second)
+		s.NoError(err)
+		s.Equal(i < 2, ok, "request %d", i)
+	}
+
+	// The limit is back after the 10 seconds window, not a minute
+	now = now.Add(10 * time.Second)
+	ok, err := ds.Acquire(ctx, "IP:1.2.3.4", 2, 10*time.Second)
+	s.NoError(err)
+	s.True(ok)
+}
+
+func (s *UnitTestSuite) TestAcquireQuota() {
+	now := time.Now()
+	ds := NewDataStore(s.cli)
+	ds.now = func() time.Time { return now }
+
+	var q ports.Quota
+	ctx := ports.WithQuota(context.Background(), &q)
+	ok, err := ds.Acquire(ctx, "CLIENT:c", 2, time.Minute)
+	s.NoError(err)
+	s.True(ok)
+	s.Equal(ports.Quota{Limit: 2, Remaining: 1, Reset: time.Minute}, q)
+
+	now = now.Add(20 * time.Second)
+	_, _ = ds.Acquire(ctx, "CLIENT:c", 2, time.Minute)
+	ok, err = ds.Acquire(ctx, "CLIENT:c", 2, time.Minute)
+	s.NoError(err)
+	s.False(ok)
+	// The first request leaves the window 40 seconds later
+	s.Equal(ports.Quota{Limit: 2, Remaining: 0, Reset: 40 * time.Second}, q)
+
+	// Token bucket of 2 refilled at 2 per minute: a token every 30 seconds
+	ctx = ports.WithTokenBucket(ctx, 2)
+	for range 2 {
+		ok, err = ds.Acquire(ctx, "IP:1.2.3.4", 2, time.Minute)
+		s.NoError(err)
+		s.True(ok)
+	}
+	s.Equal(ports.Quota{Limit: 2, Remaining: 0, Reset: 30 * time.Second}, q)
+	now = now.Add(10 * time.Second)
+	ok, err = ds.Acquire(ctx, "IP:1.2.3.4", 2, time.Minute)
+	s.NoError(err)
+	s.False(ok)
+	s.Equal(ports.Quota{Limit: 2, Remaining: 0, Reset: 20 * time.Second}, q)
+}
+
+func (s *UnitTestSuite) TestRefund() {
+	ds := NewDataStore(s.cli)
+	var slot string
+	for _, ctx := range []context.Context{context.Background(), ports.WithTokenBucket(context.Background(), 1)} {
+		ctx = ports.WithSlot(ctx, &slot)
+		ok, _ := ds.Acquire(ctx, "CLIENT:c", 1, time.Minute)
+		s.True(ok)
+		ok, _ = ds.Acquire(ctx, "CLIENT:c", 1, time.Minute)
+		s.False(ok)
+		s.NoError(ds.Refund(ctx, "CLIENT:c", slot, 1, time.Minute))
+		ok, _ = ds.Acquire(ctx, "CLIENT:c", 1, time.Minute)
+		s.True(ok, "refunded")
+		s.NoError(ds.Refund(ctx, "CLIENT:missing", slot, 1, time.Minute))
+	}
+
+	// The request logged by the refunded acquire is removed, not the latest one
+	now := time.Now()
+	ds.now = func() time.Time { return now }
+	var first string
+	ok, _ := ds.Acquire(ports.WithSlot(context.Background(), &first), "IP:1.2.3.4", 2, time.Minute)
+	s.True(ok)
+	now = now.Add(time.Second)
+	ok, _ = ds.Acquire(context.Background(), "IP:1.2.3.4", 2, time.Minute)
+	s.True(ok)
+	s.NoError(ds.Refund(context.Background(), "IP:1.2.3.4", first, 2, time.Minute))
+	logged, err := s.cli.ZRange(context.Background(), getLogKeyName("IP:1.2.3.4"), 0, -1).Result()
+	s.NoError(err)
+	s.Len(logged, 1)
+	s.NotEqual(first, logged[0])
+}
+
+func (s *UnitTestSuite) TestScanPendingAggregates() {
+	ctx := context.Background()
+	ds := NewDataStore(s.cli)
+	flips := []types.Flip{{At: 1, From: "a", To: "b"}}
+	s.upsert(ds, "client_s1", "e123_9f_t2", types.Edge{LastValue: "b", Recent: flips})
+	s.upsert(ds, "client_s1", "e456", types.Edge{LastValue: "a"})
+	s.upsert(ds, "other", "e123", types.Edge{LastValue: "b", Recent: flips})
+
+	pending, err := ds.ScanPendingAggregates(ctx)
+	s.NoError(err)
+	var got []string
+	for _, p := range pending {
+		s.Equal(int64(1), p.Version)
+		s.Equal(flips, p.Edge.Recent)
+		got = append(got, p.ClientID+"/"+p.Edge.ScopeKey)
+	}
+	s.ElementsMatch([]string{"client_s1/e123_9f_t2", "other/e123"}, got)
+}
+
+func (s *UnitTestSuite) TestEdgeTTL() {
+	ctx := context.Background()
+	key := getDataKeyName("c", "k")
+	s.upsert(NewDataStore(s.cli), "c", "k", types.Edge{LastValue: "a"})
+	s.Zero(s.server.TTL(key), "no expiry by default")
+
+	ds := NewDataStore(s.cli).WithEdgeTTL(time.Hour)
+	ok, err := ds.UpsertCAS(ctx, "c", "k", 1, types.Edge{LastValue: "b"})
+	s.NoError(err)
+	s.True(ok)
+	s.Equal(time.Hour, s.server.TTL(key))
+
+	// Kept for at least four flapping windows
+	ok, err = ds.UpsertCAS(ports.WithFlapWindow(ctx, 30*time.Minute), "c", "k", 2, types.Edge{LastValue: "a"})
+	s.NoError(err)
+	s.True(ok)
+	s.Equal(2*time.Hour, s.server.TTL(key))
+
+	s.server.FastForward(2 * time.Hour)
+	edge, _, err := ds.Load(ctx, "c", "k")
+	s.NoError(err)
+	s.Nil(edge, "expired")
+}
+
+func (s *UnitTestSuite) TestEdgeRoundTrip() {
+	ctx := context.Background()
+	ds := NewDataStore(s.cli)
+
+	created := types.Edge{LastValue: "down", LastChangeTS: 10, WindowStart: 10, AggUntilTS: 20,
+		LastAggFingerprint: "fp", LastAggTS: 5, LastForwarded: `{"v":"down"}`}
+	s.upsert(ds, "c", "k", created)
+	edge, ver, err := ds.Load(ctx, "c", "k")
+	s.Require().NoError(err)
+	s.Require().NotNil(edge)
+	s.Equal(int64(1), ver)
+	created.ScopeKey = "k"
+	s.Equal(created, *edge)
+
+	updated := types.Edge{LastValue: "up", LastChangeTS: 30, WindowStart: 10, FlipCount: 1,
+		Recent: []types.Flip{{At: 30, From: "down", To: "up"}}, LastAggFingerprint: "fp2", LastAggTS: 25,
+		LastForwarded: `{"v":"up"}`}
+	ok, err := ds.UpsertCAS(ctx, "c", "k", 1, updated)
+	s.Require().NoError(err)
+	s.Require().True(ok)
+	edge, ver, err = ds.Load(ctx, "c", "k")
+	s.Require().NoError(err)
+	s.Equal(int64(2), ver)
+	updated.ScopeKey = "k"
+	s.Equal(updated, *edge)
+}
+
+// TestUpsertCASRace has concurrent writers create the same edge, then update it from the same version: exactly one
+// of them must win each time.
+func (s *UnitTestSuite) TestUpsertCASRace() {
+	ctx := context.Background()
+	ds := NewDataStore(s.cli)
+	for _, prev := range []int64{0, 1} {
+		var committed atomic.Int32
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Go(func() {
+				ok, err := ds.UpsertCAS(ctx, "c", "k", prev, types.Edge{LastValue: fmt.Sprint(i)})
+				s.NoError(err)
+				if ok {
+					committed.Add(1)
+				}
+			})
+		}
+		wg.Wait()
+		s.Equal(int32(1), committed.Load(), "from version %d", prev)
+		_, ver, err := ds.Load(ctx, "c", "k")
+		s.NoError(err)
+		s.Equal(prev+1, ver)
+	}
+}
+
+func (s *UnitTestSuite) TestDeleteEdge() {
+	ctx := context.Background()
+	ds := NewDataStore(s.cli)
+	s.upsert(ds, "c", "k", types.Edge{LastValue: "a"})
+	s.upsert(ds, "c", "k2", types.Edge{LastValue: "a"})
+
+	s.NoError(ds.DeleteEdge(ctx, "c", "k"))
+	s.False(s.server.Exists(getDataKeyName("c", "k")))
+	s.True(s.server.Exists(getDataKeyName("c", "k2")))
+	s.upsert(ds, "c", "k", types.Edge{LastValue: "b"})
+	s.NoError(ds.DeleteEdge(ctx, "c", "missing"))
+}
+
+func (s *UnitTestSuite) TestBlock() {
+	ctx := context.Background()
+	ds := NewDataStore(s.cli)
+	s.NoError(ds.Block(ctx, "AUTHFAIL:BLOCK:10.0.0.1", time.Minute))
+	blocked, err := ds.Blocked(ctx, "AUTHFAIL:BLOCK:10.0.0.1")
+	s.NoError(err)
+	s.True(blocked)
+	blocked, err = ds.Blocked(ctx, "AUTHFAIL:BLOCK:10.0.0.2")
+	s.NoError(err)
+	s.False(blocked)
+
+	s.server.FastForward(time.Minute)
+	blocked, err = ds.Blocked(ctx, "AUTHFAIL:BLOCK:10.0.0.1")
+	s.NoError(err)
+	s.False(blocked, "expired")
+
+	s.NoError(ds.Block(ctx, "AUTHFAIL:BLOCK:10.0.0.1", time.Minute))
+	s.NoError(ds.Block(ctx, "AUTHFAIL:BLOCK:10.0.0.1", 0))
+	s.False(s.server.Exists(getBlockKeyName("AUTHFAIL:BLOCK:10.0.0.1")), "lifted")
+}
+
+func (s *UnitTestSuite) TestPing() {
+	ctx := context.Background()
+	s.NoError(NewDataStore(s.cli).Ping(ctx))
+	s.NoError(NewClientStore(s.cli).Ping(ctx))
+	s.server.Close()
+	s.Error(NewDataStore(s.cli).Ping(ctx))
+	s.Error(NewClientStore(s.cli).Ping(ctx))
+}
+
+func (s *UnitTestSuite) upsert(ds *DataStore, clientID, scopeKey string, edge types.Edge) {
+	ok, err := ds.UpsertCAS(context.Background(), clientID, scopeKey, 0, edge)
+	s.NoError(err)
+	s.True(ok)
+}
@@ -0,0 +1,43 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ConfigInvalidationChannel is the pub/sub channel announcing client config changes; messages are client IDs.
+const ConfigInvalidationChannel = "_enoti_cfg_invalidate"
+
+// PublishConfigInvalidation announces that the config of the client changed, so that the processes subscribed with
+// SubscribeConfigInvalidations drop their cached copy.
+func PublishConfigInvalidation(ctx context.Context, cli *redis.Client, clientID string) error {
+	return cli.Publish(ctx, ConfigInvalidationChannel, clientID).Err()
+}
+
+// SubscribeConfigInvalidations calls invalidate with the client ID of every announcement until ctx is done. It
+// returns once subscribed. Announcements made while the connection is down are lost; the cache TTL then bounds how
+// long a changed config goes unnoticed.
+func SubscribeConfigInvalidations(ctx context.Context, cli *redis.Client, invalidate func(clientID string)) error {
+	sub := cli.Subscribe(ctx, ConfigInvalidationChannel)
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return err
+	}
+	go func() {
+		defer sub.Close()
+		ch := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				invalidate(msg.Payload)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,21 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+func (s *UnitTestSuite) TestConfigInvalidation() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	invalidated := make(chan string, 1)
+	s.Require().NoError(SubscribeConfigInvalidations(ctx, s.cli, func(id string) { invalidated <- id }))
+
+	s.NoError(PublishConfigInvalidation(ctx, s.cli, "c1"))
+	select {
+	case id := <-invalidated:
+		s.Equal("c1", id)
+	case <-time.After(2 * time.Second):
+		s.Fail("no invalidation received")
+	}
+}
@@ -0,0 +1,28 @@
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type UnitTestSuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (s *UnitTestSuite) SetupTest() {
+	db, err := Open(filepath.Join(s.T().TempDir(), "enoti.db"))
+	s.Require().NoError(err)
+	s.db = db
+}
+
+func (s *UnitTestSuite) TearDownTest() {
+	_ = s.db.Close()
+}
+
+func TestUnitTestSuite(t *testing.T) {
+	suite.Run(t, new(UnitTestSuite))
+}
@@ -0,0 +1,118 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"enoti/internal/types"
+	"errors"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+type ClientStore struct {
+	db *sql.DB
+}
+
+func NewClientStore(db *sql.DB) *ClientStore {
+	createTableIfNotExists(db)
+	return &ClientStore{db: db}
+}
+
+// Ping checks that the database file is usable.
+func (s *ClientStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *ClientStore) GetClientConfig(ctx context.Context, clientID string) (types.ClientConfig, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM enoti WHERE pk = ? AND sk = ?`,
+		pkClient(clientID), skProfile()).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.ClientConfig{}, types.ErrNotFound
+	}
+	if err != nil {
+		return types.ClientConfig{}, err
+	}
+	var cc types.ClientConfig
+	if err := json.Unmarshal([]byte(data), &cc); err != nil {
+		return types.ClientConfig{}, err
+	}
+	return cc, nil
+}
+
+func (s *ClientStore) ListClients(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT pk FROM enoti WHERE sk = ? ORDER BY pk`, skProfile())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var clients []string
+	for rows.Next() {
+		var pk string
+		if err := rows.Scan(&pk); err != nil {
+			return nil, err
+		}
+		clients = append(clients, strings.TrimPrefix(pk, sClient+"#"))
+	}
+	return clients, rows.Err()
+}
+
+func (s *ClientStore) PutClientConfig(ctx context.Context, clientID string, config types.ClientConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO enoti (pk, sk, data) VALUES (?, ?, ?)
+		ON CONFLICT (pk, sk) DO UPDATE SET data = excluded.data`, pkClient(clientID), skProfile(), string(b))
+	return err
+}
+
+// PutClientConfigCAS compares the version within the JSON of the stored config, in the statement that writes it.
+func (s *ClientStore) PutClientConfigCAS(ctx context.Context, clientID string, expectedVersion int64,
+	config types.ClientConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	config.Version = expectedVersion + 1
+	b, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	var res sql.Result
+	if expectedVersion == 0 {
+		res, err = s.db.ExecContext(ctx, `
+			INSERT INTO enoti (pk, sk, data) VALUES (?1, ?2, ?3)
+			ON CONFLICT (pk, sk) DO UPDATE SET data = excluded.data
+			WHERE COALESCE(json_extract(enoti.data, '$.version'), 0) = 0`, pkClient(clientID), skProfile(), string(b))
+	} else {
+		res, err = s.db.ExecContext(ctx, `
+			UPDATE enoti SET data = ?3
+			WHERE pk = ?1 AND sk = ?2 AND COALESCE(json_extract(data, '$.version'), 0) = ?4`,
+			pkClient(clientID), skProfile(), string(b), expectedVersion)
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return types.VersionConflict(clientID, expectedVersion)
+	}
+	return nil
+}
+
+func (s *ClientStore) DeleteClientConfig(ctx context.Context, clientID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM enoti WHERE pk = ? AND sk = ?`, pkClient(clientID), skProfile())
+	return err
+}
+
+// ClearAll empties the table, client configs and data alike.
+func (s *ClientStore) ClearAll(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM enoti`)
+	return err
+}
@@ -0,0 +1,329 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"enoti/internal/ports"
+	"enoti/internal/ratelimit"
+	"enoti/internal/types"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// DataStore keeps edge states, rate limit counters and dedup markers in the table.
+type DataStore struct {
+	db  *sql.DB
+	now func() time.Time // rate limiter and dedup clock, replaced in tests
+}
+
+func NewDataStore(db *sql.DB) *DataStore {
+	createTableIfNotExists(db)
+	return &DataStore{db: db, now: time.Now}
+}
+
+// Ping checks that the database file is usable.
+func (s *DataStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Acquire counts acquires in window-aligned buckets with the sliding window approximation of the DynamoDB backend,
+// or takes from a token bucket (see ports.WithTokenBucket).
+func (s *DataStore) Acquire(ctx context.Context, scope string, ratePerWindow int, window time.Duration) (bool, error) {
+	if ratePerWindow <= 0 {
+		return false, nil
+	}
+	if capacity, ok := ports.TokenBucket(ctx); ok {
+		return s.acquireToken(ctx, scope, capacity, ratePerWindow, window)
+	}
+	now := s.now()
+	idx, elapsed := ratelimit.WindowIndex(now.UnixMilli(), window)
+	var prev int
+	err := s.db.QueryRowContext(ctx, `SELECT count FROM enoti WHERE pk = ? AND sk = ? AND expires_at > ?`,
+		pkRate(scope), skRateWin(idx-1), now.Unix()).Scan(&prev)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	limit := ratelimit.SlidingLimit(prev, ratePerWindow, elapsed)
+	quota := ports.Quota{Limit: ratePerWindow, Reset: time.Duration((1 - elapsed) * float64(window))}
+	if limit <= 0 {
+		ports.ReportQuota(ctx, quota)
+		return false, nil
+	}
+	// The bucket is read as the previous one during the next window
+	ttl := now.Add(2 * window).Unix()
+	var count int
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO enoti (pk, sk, count, expires_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT (pk, sk) DO UPDATE SET count = count + 1 WHERE count < ?
+		RETURNING count`, pkRate(scope), skRateWin(idx), ttl, limit).Scan(&count)
+	if errors.Is(err, sql.ErrNoRows) {
+		ports.ReportQuota(ctx, quota)
+		return false, nil // limited
+	}
+	if err != nil {
+		return false, err
+	}
+	if count == 1 {
+		// First acquire of the window: drop the expired windows of the scope
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM enoti WHERE pk = ? AND expires_at > 0 AND expires_at <= ?`,
+			pkRate(scope), now.Unix()); err != nil {
+			return false, err
+		}
+	}
+	quota.Remaining = max(0, limit-count)
+	ports.ReportQuota(ctx, quota)
+	ports.ReportSlot(ctx, ratelimit.WindowSlot(idx))
+	return true, nil
+}
+
+// Refund decrements the count of the window of the slot, or puts a token back in the bucket as acquireToken takes
+// one.
+func (s *DataStore) Refund(ctx context.Context, scope, slot string, ratePerWindow int, window time.Duration) error {
+	if capacity, ok := ports.TokenBucket(ctx); ok {
+		return s.refundToken(ctx, scope, capacity)
+	}
+	idx, err := ratelimit.ParseWindowSlot(slot)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `UPDATE enoti SET count = count - 1 WHERE pk = ? AND sk = ? AND count > 0`,
+		pkRate(scope), skRateWin(idx))
+	return err
+}
+
+// CountQuota adds n to the count of the quota row of the scope with an upsert that only applies within the limit.
+func (s *DataStore) CountQuota(ctx context.Context, scope string, n, limit int, ttl time.Duration) (bool, error) {
+	now := s.now()
+	if n == 0 {
+		var count int
+		err := s.db.QueryRowContext(ctx, `SELECT count FROM enoti WHERE pk = ? AND sk = ? AND expires_at > ?`,
+			pkRate(scope), skQuota(), now.Unix()).Scan(&count)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return false, err
+		}
+		return count < limit, nil
+	}
+	if n > limit {
+		return false, nil
+	}
+	var count int
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO enoti (pk, sk, count, expires_at) VALUES (?1, ?2, ?3, ?4)
+		ON CONFLICT (pk, sk) DO UPDATE
+		SET count = CASE WHEN expires_at <= ?5 THEN ?3 ELSE count + ?3 END, expires_at = ?4
+		WHERE CASE WHEN expires_at <= ?5 THEN 0 ELSE count END + ?3 <= ?6
+		RETURNING count`, pkRate(scope), skQuota(), n, now.Add(ttl).Unix(), now.Unix(), limit).Scan(&count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil // used up
+	}
+	if err != nil {
+		return false, err
+	}
+	if count == n {
+		// The scope starts counting: drop the quota rows of past periods
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM enoti WHERE sk = ? AND expires_at > 0 AND expires_at <= ?`,
+			skQuota(), now.Unix()); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// refundToken puts a token back in the bucket of the scope, if it has one, up to capacity.
+func (s *DataStore) refundToken(ctx context.Context, scope string, capacity int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	var b ratelimit.TokenBucket
+	var data string
+	err = tx.QueryRowContext(ctx, `SELECT data FROM enoti WHERE pk = ? AND sk = ?`,
+		pkRate(scope), skRateBucket()).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err == nil {
+		err = json.Unmarshal([]byte(data), &b)
+	}
+	if err != nil {
+		return err
+	}
+	b.Tokens = min(float64(capacity), b.Tokens+1)
+	out, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE enoti SET data = ? WHERE pk = ? AND sk = ?`,
+		string(out), pkRate(scope), skRateBucket()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// acquireToken takes a token from the bucket of the scope. The transaction holds the only connection (see Open),
+// so the read-modify-write is not interleaved with other acquires.
+func (s *DataStore) acquireToken(ctx context.Context, scope string, capacity, rate int,
+	window time.Duration) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	// A bucket never used starts full (see ratelimit.TokenBucket)
+	var b ratelimit.TokenBucket
+	var data string
+	err = tx.QueryRowContext(ctx, `SELECT data FROM enoti WHERE pk = ? AND sk = ?`,
+		pkRate(scope), skRateBucket()).Scan(&data)
+	if err == nil {
+		err = json.Unmarshal([]byte(data), &b)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	now := s.now()
+	next, ok := b.Take(now.UnixMilli(), capacity, rate, window)
+	out, err := json.Marshal(next)
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO enoti (pk, sk, data) VALUES (?, ?, ?)
+		ON CONFLICT (pk, sk) DO UPDATE SET data = excluded.data`, pkRate(scope), skRateBucket(), string(out)); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	quota := ports.Quota{Limit: capacity, Remaining: int(next.Tokens)}
+	if !ok {
+		quota.Reset = next.NextTokenIn(rate, window)
+	}
+	ports.ReportQuota(ctx, quota)
+	if ok {
+		ports.ReportSlot(ctx, ports.TokenSlot)
+	}
+	return ok, nil
+}
+
+// Suppress inserts the dedup marker, or replaces it if it has expired; the event is a duplicate if neither applied.
+func (s *DataStore) Suppress(ctx context.Context, clientID, hash string, window time.Duration) (bool, error) {
+	now := s.now()
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO enoti (pk, sk, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (pk, sk) DO UPDATE SET expires_at = excluded.expires_at WHERE expires_at <= ?`,
+		pkClient(clientID), skDedup(hash), now.Add(window).Unix(), now.Unix())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 0, nil
+}
+
+func (s *DataStore) Release(ctx context.Context, clientID, hash string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM enoti WHERE pk = ? AND sk = ?`, pkClient(clientID), skDedup(hash))
+	return err
+}
+
+// Block inserts or replaces a row expiring with the block, or deletes it if d <= 0.
+func (s *DataStore) Block(ctx context.Context, scope string, d time.Duration) error {
+	if d <= 0 {
+		_, err := s.db.ExecContext(ctx, `DELETE FROM enoti WHERE pk = ? AND sk = ?`, pkRate(scope), skBlock())
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO enoti (pk, sk, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (pk, sk) DO UPDATE SET expires_at = excluded.expires_at`,
+		pkRate(scope), skBlock(), s.now().Add(d).Unix())
+	return err
+}
+
+func (s *DataStore) Blocked(ctx context.Context, scope string) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM enoti WHERE pk = ? AND sk = ? AND expires_at > ?`,
+		pkRate(scope), skBlock(), s.now().Unix()).Scan(&n)
+	return n > 0, err
+}
+
+// Load returns the edge state and a monotonic version suitable for CAS.
+// If no state exists, (nil,0,nil) MUST be returned.
+func (s *DataStore) Load(ctx context.Context, clientID, scopeKey string) (*types.Edge, int64, error) {
+	var ver int64
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT ver, data FROM enoti WHERE pk = ? AND sk = ?`,
+		pkClient(clientID), skEdge(scopeKey)).Scan(&ver, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	var edge types.Edge
+	if err := json.Unmarshal([]byte(data), &edge); err != nil {
+		return nil, 0, err
+	}
+	edge.ScopeKey, edge.Version = scopeKey, ver
+	return &edge, ver, nil
+}
+
+// UpsertCAS inserts the state if prevVersion is 0 and there is none yet, or updates it if its version is still
+// prevVersion, bumping the version.
+func (s *DataStore) UpsertCAS(ctx context.Context, clientID, scopeKey string, prevVersion int64,
+	next types.Edge) (bool, error) {
+	next.ScopeKey = scopeKey // safety
+	b, err := json.Marshal(next)
+	if err != nil {
+		return false, err
+	}
+	query := `UPDATE enoti SET ver = ver + 1, data = ? WHERE pk = ? AND sk = ? AND ver = ?`
+	if prevVersion == 0 {
+		query = `INSERT INTO enoti (data, pk, sk, ver) VALUES (?, ?, ?, ? + 1) ON CONFLICT (pk, sk) DO NOTHING`
+	}
+	res, err := s.db.ExecContext(ctx, query, string(b), pkClient(clientID), skEdge(scopeKey), prevVersion)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// DeleteEdge removes the edge state, if any.
+func (s *DataStore) DeleteEdge(ctx context.Context, clientID, scopeKey string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM enoti WHERE pk = ? AND sk = ?`, pkClient(clientID), skEdge(scopeKey))
+	return err
+}
+
+// ScanPendingAggregates returns the edge states of all clients with flips in Recent.
+func (s *DataStore) ScanPendingAggregates(ctx context.Context) ([]types.PendingEdge, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT pk, ver, data FROM enoti
+		WHERE sk LIKE ? AND json_array_length(data, '$.recent') > 0`, sEdge+"#%")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var pending []types.PendingEdge
+	for rows.Next() {
+		var pk, data string
+		var p types.PendingEdge
+		if err := rows.Scan(&pk, &p.Version, &data); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &p.Edge); err != nil {
+			return nil, err
+		}
+		p.ClientID = strings.TrimPrefix(pk, sClient+"#")
+		p.Edge.Version = p.Version
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
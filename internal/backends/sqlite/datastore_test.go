@@ -0,0 +1,176 @@
+package sqlite
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func (s *UnitTestSuite) TestUpsertCASCollision() {
+	ctx := context.Background()
+	ds := NewDataStore(s.db)
+	ok, err := ds.UpsertCAS(ctx, "c", "k", 0, types.Edge{LastValue: "a"})
+	s.NoError(err)
+	s.True(ok)
+	ok, err = ds.UpsertCAS(ctx, "c", "k", 0, types.Edge{LastValue: "b"})
+	s.NoError(err)
+	s.False(ok, "already exists")
+
+	// Of concurrent writers having loaded the same version, exactly one commits
+	_, ver, err := ds.Load(ctx, "c", "k")
+	s.NoError(err)
+	var committed atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			ok, err := ds.UpsertCAS(ctx, "c", "k", ver, types.Edge{LastValue: "b"})
+			s.NoError(err)
+			if ok {
+				committed.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	s.Equal(int32(1), committed.Load())
+	edge, next, err := ds.Load(ctx, "c", "k")
+	s.NoError(err)
+	s.Equal(ver+1, next)
+	s.Equal("b", edge.LastValue)
+	s.Equal("k", edge.ScopeKey)
+
+	edge, ver, err = ds.Load(ctx, "c", "other")
+	s.NoError(err)
+	s.Nil(edge)
+	s.Zero(ver)
+}
+
+func (s *UnitTestSuite) TestAcquireWindow() {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	ds := NewDataStore(s.db)
+	ds.now = func() time.Time { return now }
+
+	for i := range 3 {
+		ok, err := ds.Acquire(ctx, "IP:1.2.3.4", 2, 10*time.Second)
+		s.NoError(err)
+		s.Equal(i < 2, ok, "request %d", i)
+	}
+	// The previous window still weighs right after the boundary
+	now = now.Add(10 * time.Second)
+	ok, _ := ds.Acquire(ctx, "IP:1.2.3.4", 2, 10*time.Second)
+	s.False(ok)
+	// Two windows later it has expired, and is dropped when the scope opens a new window
+	now = now.Add(20 * time.Second)
+	ok, _ = ds.Acquire(ctx, "IP:1.2.3.4", 2, 10*time.Second)
+	s.True(ok)
+	var rows int
+	s.NoError(s.db.QueryRow(`SELECT COUNT(*) FROM enoti WHERE pk = ?`, pkRate("IP:1.2.3.4")).Scan(&rows))
+	s.Equal(1, rows)
+}
+
+func (s *UnitTestSuite) TestAcquireConcurrent() {
+	ds := NewDataStore(s.db)
+	for _, ctx := range []context.Context{
+		context.Background(),
+		ports.WithTokenBucket(context.Background(), 3),
+	} {
+		var granted atomic.Int32
+		var wg sync.WaitGroup
+		for range 30 {
+			wg.Go(func() {
+				ok, err := ds.Acquire(ctx, "CLIENT:c", 3, time.Minute)
+				s.NoError(err)
+				if ok {
+					granted.Add(1)
+				}
+			})
+		}
+		wg.Wait()
+		s.Equal(int32(3), granted.Load())
+		s.NoError(NewClientStore(s.db).ClearAll(ctx))
+	}
+}
+
+func (s *UnitTestSuite) TestSuppress() {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	ds := NewDataStore(s.db)
+	ds.now = func() time.Time { return now }
+
+	for i, want := range []bool{false, true, true} {
+		suppressed, err := ds.Suppress(ctx, "c", "h", time.Minute)
+		s.NoError(err)
+		s.Equal(want, suppressed, "#%d", i)
+	}
+	now = now.Add(time.Minute)
+	suppressed, _ := ds.Suppress(ctx, "c", "h", time.Minute)
+	s.False(suppressed, "expired")
+
+	s.NoError(ds.Release(ctx, "c", "h"))
+	suppressed, _ = ds.Suppress(ctx, "c", "h", time.Minute)
+	s.False(suppressed, "released")
+}
+
+// TestRefundAfterRollover refunds a slot once its window has rolled over: the count of that window goes down, not
+// that of the current one.
+func (s *UnitTestSuite) TestRefundAfterRollover() {
+	now := time.Unix(1_700_000_009, 0)
+	ds := NewDataStore(s.db)
+	ds.now = func() time.Time { return now }
+	count := func(idx int64) (n int) {
+		_ = s.db.QueryRow(`SELECT count FROM enoti WHERE pk = ? AND sk = ?`, pkRate("CLIENT:c"), skRateWin(idx)).Scan(&n)
+		return n
+	}
+
+	var slot string
+	ok, err := ds.Acquire(ports.WithSlot(context.Background(), &slot), "CLIENT:c", 4, 10*time.Second)
+	s.NoError(err)
+	s.True(ok)
+	now = now.Add(2 * time.Second)
+	ok, err = ds.Acquire(context.Background(), "CLIENT:c", 4, 10*time.Second)
+	s.NoError(err)
+	s.True(ok)
+
+	s.NoError(ds.Refund(context.Background(), "CLIENT:c", slot, 4, 10*time.Second))
+	s.Equal(0, count(170_000_000))
+	s.Equal(1, count(170_000_001))
+	s.Error(ds.Refund(context.Background(), "CLIENT:c", "token", 4, 10*time.Second), "not a window slot")
+}
+
+func (s *UnitTestSuite) TestScanPendingAggregates() {
+	ctx := context.Background()
+	ds := NewDataStore(s.db)
+	_, _ = ds.UpsertCAS(ctx, "c1", "k", 0, types.Edge{Recent: []types.Flip{{To: "a"}}})
+	_, _ = ds.UpsertCAS(ctx, "c2", "k", 0, types.Edge{LastValue: "a"})
+
+	pending, err := ds.ScanPendingAggregates(ctx)
+	s.NoError(err)
+	s.Len(pending, 1)
+	s.Equal("c1", pending[0].ClientID)
+	s.Equal("k", pending[0].Edge.ScopeKey)
+	s.Equal(int64(1), pending[0].Version)
+}
+
+func (s *UnitTestSuite) TestClientStore() {
+	ctx := context.Background()
+	cs := NewClientStore(s.db)
+	_, err := cs.GetClientConfig(ctx, "c")
+	s.ErrorIs(err, types.ErrNotFound)
+
+	cc := types.ClientConfig{ClientID: "c", ClientName: "C", ClientKeyHash: "x",
+		Trigger: types.TriggerConfig{FieldExpr: "status"}}
+	s.NoError(cs.PutClientConfig(ctx, "c", cc))
+	got, err := cs.GetClientConfig(ctx, "c")
+	s.NoError(err)
+	s.Equal("status", got.Trigger.FieldExpr)
+	clients, err := cs.ListClients(ctx)
+	s.NoError(err)
+	s.Equal([]string{"c"}, clients)
+
+	s.NoError(cs.DeleteClientConfig(ctx, "c"))
+	clients, _ = cs.ListClients(ctx)
+	s.Empty(clients)
+}
@@ -0,0 +1,42 @@
+package flow
+
+import (
+	"enoti/internal/types"
+	"strconv"
+)
+
+// MessageAttributes returns the values of the AttributeFields of the trigger's targets in payload, by expression,
+// for ports.WithPublishAttributes: strings and numbers as they are, booleans as "true" or "false". Fields that are
+// missing, of another type or fail to evaluate are left out; nil is returned if there are none.
+func MessageAttributes(trig types.TriggerConfig, payload map[string]any) map[string]any {
+	var attrs map[string]any
+	for _, t := range trig.AllTargets() {
+		for _, expr := range t.AttributeFields {
+			if _, done := attrs[expr]; done {
+				continue
+			}
+			v, err := EvalAnyCompiled(expr, payload)
+			if err != nil {
+				continue
+			}
+			var value any
+			switch x := v.(type) {
+			case string:
+				value = x
+			case bool:
+				value = strconv.FormatBool(x)
+			default:
+				f, ok := toFloat(v)
+				if !ok {
+					continue
+				}
+				value = f
+			}
+			if attrs == nil {
+				attrs = map[string]any{}
+			}
+			attrs[expr] = value
+		}
+	}
+	return attrs
+}
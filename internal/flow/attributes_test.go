@@ -0,0 +1,40 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+)
+
+func (s *UnitTestSuite) TestMessageAttributes() {
+	trig := types.TriggerConfig{FieldExpr: "state", Targets: []types.TargetConfig{
+		{SNSArn: "arn:aws:sns:us-east-1:000000000000:a", AttributeFields: map[string]string{
+			"severity": "severity", "cpu": "metrics.cpu", "paged": "paged", "tags": "tags", "gone": "missing",
+		}},
+		{SNSArn: "arn:aws:sns:us-east-1:000000000000:b", AttributeFields: map[string]string{"email": "user.email"}},
+	}}
+	payload := map[string]any{
+		"state":    "down",
+		"severity": "critical",
+		"metrics":  map[string]any{"cpu": float64(97.5)},
+		"paged":    true,
+		"tags":     []any{"a"},
+		"user":     map[string]any{"email": "a@example.com"},
+	}
+	s.Equal(map[string]any{
+		"severity":    "critical",
+		"metrics.cpu": 97.5,
+		"paged":       "true",
+		"user.email":  "a@example.com",
+	}, MessageAttributes(trig, payload))
+	s.Nil(MessageAttributes(types.TriggerConfig{FieldExpr: "state"}, payload))
+
+	// RunTriggers computes them on the redacted payload, for PublishContext to attach
+	cc := types.ClientConfig{Trigger: trig, RedactFields: []string{"user.email"}}
+	outcomes, _, err := RunTriggers(context.Background(), "c", "127.0.0.1", cc, newMemDataStore(), payload)
+	s.Require().NoError(err)
+	s.Require().Len(outcomes, 1)
+	s.Equal(EdgeTriggeredForward, outcomes[0].Action)
+	s.Equal(RedactMask, outcomes[0].Attributes["user.email"])
+	s.Equal("critical", ports.PublishAttributes(PublishContext(context.Background(), outcomes[0], payload))["severity"])
+}
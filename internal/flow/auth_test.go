@@ -0,0 +1,140 @@
+package flow
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"enoti/internal/types"
+	"strconv"
+	"time"
+)
+
+func (s *UnitTestSuite) TestAuth() {
+	ctx := context.Background()
+	cc := types.ClientConfig{ClientKey: "s3cret-key"}
+
+	s.NoError(Auth(ctx, cc, "client", "s3cret-key"))
+	s.Error(Auth(ctx, cc, "client", "s3cret-kez"), "wrong key of equal length")
+	s.Error(Auth(ctx, cc, "client", "s3cret"), "shorter key")
+	s.Error(Auth(ctx, cc, "client", "s3cret-key-and-more"), "longer key")
+	s.Error(Auth(ctx, cc, "client", ""), "missing key")
+	s.Error(Auth(ctx, cc, "", "s3cret-key"), "missing client id")
+
+	// A client stored without a key never authenticates
+	s.Error(Auth(ctx, types.ClientConfig{}, "client", "anything"))
+}
+
+func (s *UnitTestSuite) TestVerifySignature() {
+	body := []byte(`{"state":"up"}`)
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	cc := types.ClientConfig{SigningSecret: "0123456789abcdef"}
+
+	s.NoError(VerifySignature(cc, body, sign("0123456789abcdef"), ""))
+	s.Error(VerifySignature(cc, body, sign("fedcba9876543210"), ""), "wrong secret")
+	s.Error(VerifySignature(cc, []byte(`{"state":"down"}`), sign("0123456789abcdef"), ""), "tampered body")
+	s.Error(VerifySignature(cc, body, "not-hex", ""))
+	s.NoError(VerifySignature(cc, body, "", ""), "signing optional")
+
+	cc.SignatureRequired = true
+	s.Error(VerifySignature(cc, body, "", ""), "signing required")
+	s.NoError(VerifySignature(cc, body, sign("0123456789abcdef"), ""))
+
+	// Without a secret, signatures are not checked
+	s.NoError(VerifySignature(types.ClientConfig{}, body, "anything", ""))
+}
+
+func (s *UnitTestSuite) TestVerifySignatureTimestamp() {
+	now := time.Unix(1_700_000_000, 0)
+	SetTimNowFn(func() time.Time { return now })
+	defer RestoreTimeNow()
+	body := []byte(`{"state":"up"}`)
+	cc := types.ClientConfig{SigningSecret: "0123456789abcdef", SignatureRequired: true, TimestampSkewSeconds: 300}
+	sign := func(ts int64) (string, string) {
+		t := strconv.FormatInt(ts, 10)
+		mac := hmac.New(sha256.New, []byte(cc.SigningSecret))
+		mac.Write([]byte(t + "."))
+		mac.Write(body)
+		return hex.EncodeToString(mac.Sum(nil)), t
+	}
+
+	for _, ts := range []int64{now.Unix(), now.Unix() - 300, now.Unix() + 300} {
+		sig, t := sign(ts)
+		s.NoError(VerifySignature(cc, body, sig, t), t)
+	}
+	sig, t := sign(now.Unix() - 301)
+	s.ErrorContains(VerifySignature(cc, body, sig, t), "outside", "too old")
+	sig, t = sign(now.Unix() + 301)
+	s.ErrorContains(VerifySignature(cc, body, sig, t), "outside", "too far in the future")
+	sig, _ = sign(now.Unix())
+	s.ErrorContains(VerifySignature(cc, body, sig, ""), "missing timestamp")
+	s.Error(VerifySignature(cc, body, sig, "yesterday"))
+	s.Error(VerifySignature(cc, body, sig, strconv.FormatInt(now.Unix()+1, 10)), "the timestamp is signed")
+
+	bad := types.ClientConfig{ClientID: "client", ClientName: "client", ClientKey: "client-key-123",
+		SigningSecret: "0123456789abcdef", TimestampSkewSeconds: 300}
+	s.ErrorContains(bad.Validate(), "signature_required")
+	bad.SignatureRequired = true
+	s.NoError(bad.Validate())
+}
+
+func (s *UnitTestSuite) TestAuthMultipleKeys() {
+	ctx := context.Background()
+	cc := types.ClientConfig{ClientKey: "old-key-0000", ClientKeys: []string{"new-key-1111", "new-key-2222"}}
+
+	for _, k := range []string{"old-key-0000", "new-key-1111", "new-key-2222"} {
+		s.NoError(Auth(ctx, cc, "client", k), k)
+	}
+	s.Error(Auth(ctx, cc, "client", "new-key-3333"))
+	s.Error(Auth(ctx, cc, "client", "new-key"))
+
+	// Old key removed after migration
+	cc.ClientKey = ""
+	s.Error(Auth(ctx, cc, "client", "old-key-0000"))
+	s.NoError(Auth(ctx, cc, "client", "new-key-1111"))
+}
+
+func (s *UnitTestSuite) TestKeyHash() {
+	p := KeyHashParams{MemoryKiB: 8 * 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+	h, err := HashKey("key-0123456789", p)
+	s.Require().NoError(err)
+	s.True(IsKeyHash(h))
+	s.Contains(h, "$argon2id$v=19$m=8192,t=1,p=1$")
+
+	s.True(VerifyKeyHash("key-0123456789", h))
+	s.True(VerifyKeyHash("key-0123456789", h), "cached")
+	s.False(VerifyKeyHash("key-9876543210", h))
+	s.False(VerifyKeyHash("key-0123456789", "key-0123456789"))
+	s.False(IsKeyHash("$argon2id$v=19$m=8192,t=0,p=1$c2FsdA$aGFzaA"))
+
+	// Salted: the same key hashes differently
+	h2, err := HashKey("key-0123456789", p)
+	s.Require().NoError(err)
+	s.NotEqual(h, h2)
+
+	ctx := context.Background()
+	cc := types.ClientConfig{ClientKeyHash: h, ClientKeyHashes: []string{h2}}
+	s.NoError(Auth(ctx, cc, "client", "key-0123456789"))
+	s.Error(Auth(ctx, cc, "client", "key-9876543210"))
+}
+
+func (s *UnitTestSuite) TestKeyHashParamsFromEnv() {
+	p, err := KeyHashParamsFromEnv()
+	s.NoError(err)
+	s.Equal(DefaultKeyHashParams, p)
+
+	s.T().Setenv(KeyHashTimeEnvKey, "3")
+	s.T().Setenv(KeyHashMemoryKiBEnvKey, "65536")
+	p, err = KeyHashParamsFromEnv()
+	s.NoError(err)
+	s.Equal(uint32(3), p.Time)
+	s.Equal(uint32(65536), p.MemoryKiB)
+
+	s.T().Setenv(KeyHashThreadsEnvKey, "0")
+	_, err = KeyHashParamsFromEnv()
+	s.Error(err)
+}
@@ -0,0 +1,92 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/metrics"
+	"enoti/internal/ports"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// UnknownClientID is the metrics key for authentication failures of clients without a config.
+const UnknownClientID = "unknown"
+
+// AuthFailPolicy configures how authentication failures are tracked. Failures are counted in the data store
+// under "AUTHFAIL:" scopes, per client and per source IP, over Window.
+// AlertAfter failures of one client in a window fire OnAlert once per window; 0 disables alerting.
+// BlockAfter failures from one IP in a window block the IP for BlockFor; the failure that exceeds BlockAfter is the
+// one that blocks. 0 disables blocking. Successful authentications never count.
+type AuthFailPolicy struct {
+	Window     time.Duration
+	AlertAfter int
+	BlockAfter int
+	BlockFor   time.Duration
+	OnAlert    func(clientID, ip string)
+}
+
+// alerted is per-process, so each instance may alert once per window; the failure counts and the IP blocks are
+// shared through the data store.
+var alerted = NewTTLWithJanitor[string, struct{}](time.Minute)
+
+// authBlockScope is the data store scope of the block of ip (see ports.DataStore.Block).
+func authBlockScope(ip string) string {
+	return "AUTHFAIL:BLOCK:" + ip
+}
+
+// IPBlocked reports whether ip is currently blocked by RecordAuthFailure. If the data store fails, the IP is taken
+// as not blocked: its credentials are checked all the same.
+func IPBlocked(ctx context.Context, dataStore ports.DataStore, ip string) bool {
+	blocked, err := dataStore.Blocked(ctx, authBlockScope(ip))
+	if err != nil {
+		log.WithError(err).Error("failed to check IP block")
+		return false
+	}
+	if blocked {
+		metrics.AuthBlockedRequests.Add(1)
+	}
+	return blocked
+}
+
+// UnblockIP lifts the block of ip set by RecordAuthFailure, if any. The failures counted so far are kept.
+func UnblockIP(ctx context.Context, dataStore ports.DataStore, ip string) error {
+	return dataStore.Block(ctx, authBlockScope(ip), 0)
+}
+
+// RecordAuthFailure counts a failed authentication of clientID from ip, firing the alert hook and blocking the
+// IP as configured. It returns true if the IP got blocked.
+func RecordAuthFailure(ctx context.Context, dataStore ports.DataStore, p AuthFailPolicy, clientID, ip string) bool {
+	metrics.AuthFailures.Add(clientID, 1)
+	if p.Window <= 0 {
+		return false
+	}
+	if p.AlertAfter > 0 {
+		// Acquire refuses once the window holds AlertAfter failures
+		ok, err := dataStore.Acquire(ctx, "AUTHFAIL:CLIENT:"+clientID, p.AlertAfter, p.Window)
+		if err != nil {
+			log.WithError(err).Error("failed to count auth failure")
+		} else if _, done := alerted.Get(clientID); !ok && !done {
+			alerted.Set(clientID, struct{}{}, p.Window)
+			if p.OnAlert != nil {
+				p.OnAlert(clientID, ip)
+			}
+		}
+	}
+	if p.BlockAfter > 0 && p.BlockFor > 0 {
+		ok, err := dataStore.Acquire(ctx, "AUTHFAIL:IP:"+ip, p.BlockAfter, p.Window)
+		if err != nil {
+			log.WithError(err).Error("failed to count auth failure")
+			return false
+		}
+		if !ok {
+			if err := dataStore.Block(ctx, authBlockScope(ip), p.BlockFor); err != nil {
+				log.WithError(err).Error("failed to block IP")
+				return false
+			}
+			metrics.AuthIPBlocks.Add(1)
+			log.WithFields(log.Fields{"clientID": clientID, "ip": ip}).Warn("blocking IP after repeated auth failures")
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/metrics"
+	"time"
+)
+
+func (s *UnitTestSuite) TestRecordAuthFailure() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	var alerts []string
+	p := AuthFailPolicy{
+		Window:     time.Minute,
+		AlertAfter: 2,
+		BlockAfter: 3,
+		BlockFor:   time.Minute,
+		OnAlert:    func(clientID, ip string) { alerts = append(alerts, clientID+"@"+ip) },
+	}
+	before := metrics.AuthFailures.Get("c-authfail")
+
+	for range 3 {
+		s.False(RecordAuthFailure(ctx, store, p, "c-authfail", "10.0.0.1"))
+	}
+	s.False(IPBlocked(ctx, store, "10.0.0.1"))
+	s.Equal([]string{"c-authfail@10.0.0.1"}, alerts)
+
+	s.True(RecordAuthFailure(ctx, store, p, "c-authfail", "10.0.0.1"))
+	s.True(IPBlocked(ctx, store, "10.0.0.1"))
+	s.False(IPBlocked(ctx, store, "10.0.0.2"))
+	s.False(IPBlocked(ctx, newMemDataStore(), "10.0.0.1"), "blocks are kept in the data store")
+	// Alert fires once per window
+	s.Len(alerts, 1)
+
+	s.NoError(UnblockIP(ctx, store, "10.0.0.1"))
+	s.False(IPBlocked(ctx, store, "10.0.0.1"))
+
+	s.NotNil(metrics.AuthFailures.Get("c-authfail"))
+	s.Nil(before)
+}
+
+func (s *UnitTestSuite) TestRecordAuthFailureBlockingOff() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	p := AuthFailPolicy{Window: time.Minute}
+	for range 10 {
+		s.False(RecordAuthFailure(ctx, store, p, "c", "10.0.0.3"))
+	}
+	s.False(IPBlocked(ctx, store, "10.0.0.3"))
+}
@@ -1,14 +1,24 @@
 package flow
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrRateLimited is wrapped by the errors Run returns when the IP or client rate limit is exhausted.
+var ErrRateLimited = errors.New("rate limit")
 
 const (
 	NoOp Action = iota // NoOp means do nothing. The request is good and accepted but it won't be forwarded due to the logic.
 	SuppressFlapping
 	SuppressDedup
 	EdgeTriggeredForward
-	ForwardedAsIs // No Edge trigger logic applied. Just forward as is.
-	AggregateSent // Send aggregated notification, this is different from EdgeTriggeredForward.
+	ForwardedAsIs     // No Edge trigger logic applied. Just forward as is.
+	AggregateSent     // Send aggregated notification, this is different from EdgeTriggeredForward.
+	TargetRateLimited // Would be forwarded, but the target's rate limit is exhausted. Comes with 429.
+	ClientDisabled    // The client is disabled; nothing was evaluated. Comes with 403.
+	SuppressQuietHours
 )
 
 var StatusTextMap = map[Action]string{
@@ -18,10 +28,18 @@ var StatusTextMap = map[Action]string{
 	EdgeTriggeredForward: "edge_triggered_forward",
 	ForwardedAsIs:        "forwarded_as_is",
 	AggregateSent:        "aggregate_sent",
+	TargetRateLimited:    "target_rate_limited",
+	ClientDisabled:       "client_disabled",
+	SuppressQuietHours:   "suppress_quiet_hours",
 }
 
 var timeNow = time.Now
 
+// Now returns the current time, as replaced by SetTimNowFn in tests.
+func Now() time.Time {
+	return timeNow()
+}
+
 func EpochTime() int64 {
 	return timeNow().Unix()
 }
@@ -33,3 +51,35 @@ func SetTimNowFn(f func() time.Time) {
 func RestoreTimeNow() {
 	timeNow = time.Now
 }
+
+type clockCtx struct{}
+
+// WithClock makes the flow run with the returned context read the time from now instead of the package clock (see
+// SetTimNowFn), as Engine does with its Clock.
+func WithClock(ctx context.Context, now func() time.Time) context.Context {
+	return context.WithValue(ctx, clockCtx{}, now)
+}
+
+type eventTimeCtx struct{}
+
+// WithEventTime makes the flow run with the returned context at t, the time the event happened (e.g. was sent),
+// rather than when it is processed, for sources that may deliver events out of order: an event older than the last
+// change of its edge state is then stale, and leaves the state untouched rather than undoing the later change.
+func WithEventTime(ctx context.Context, t time.Time) context.Context {
+	ctx = WithClock(ctx, func() time.Time { return t })
+	return context.WithValue(ctx, eventTimeCtx{}, true)
+}
+
+// hasEventTime reports whether ctx was made by WithEventTime.
+func hasEventTime(ctx context.Context) bool {
+	ok, _ := ctx.Value(eventTimeCtx{}).(bool)
+	return ok
+}
+
+// clockNow returns the current time of the clock of ctx (see WithClock), of the package clock without one.
+func clockNow(ctx context.Context) time.Time {
+	if now, ok := ctx.Value(clockCtx{}).(func() time.Time); ok && now != nil {
+		return now()
+	}
+	return timeNow()
+}
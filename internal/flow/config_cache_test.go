@@ -0,0 +1,67 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/types"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// countingClientStore counts the config reads, holding each until release is closed.
+type countingClientStore struct {
+	reads   atomic.Int32
+	release chan struct{}
+}
+
+func (c *countingClientStore) GetClientConfig(_ context.Context, clientID string) (types.ClientConfig, error) {
+	c.reads.Add(1)
+	<-c.release
+	return types.ClientConfig{ClientID: clientID, ClientRPM: 10}, nil
+}
+
+func (c *countingClientStore) ListClients(context.Context) ([]string, error) { return nil, nil }
+func (c *countingClientStore) PutClientConfig(context.Context, string, types.ClientConfig) error {
+	return nil
+}
+func (c *countingClientStore) PutClientConfigCAS(context.Context, string, int64, types.ClientConfig) error {
+	return nil
+}
+func (c *countingClientStore) DeleteClientConfig(context.Context, string) error { return nil }
+func (c *countingClientStore) ClearAll(context.Context) error                   { return nil }
+func (c *countingClientStore) Ping(context.Context) error                       { return nil }
+
+func (s *UnitTestSuite) TestLoadCachedClientConfigSingleflight() {
+	const n = 50
+	store := &countingClientStore{release: make(chan struct{})}
+	InvalidateClientConfig("singleflight")
+	defer InvalidateClientConfig("singleflight")
+
+	var wg, started sync.WaitGroup
+	started.Add(n)
+	results := make([]types.ClientConfig, n)
+	for i := range n {
+		wg.Go(func() {
+			started.Done()
+			cc, err := LoadCachedClientConfig(context.Background(), store, "singleflight")
+			s.NoError(err)
+			results[i] = cc
+		})
+	}
+	started.Wait()
+	// The first load reaches the store; the others wait for it
+	for store.reads.Load() == 0 {
+		runtime.Gosched()
+	}
+	close(store.release)
+	wg.Wait()
+
+	s.Equal(int32(1), store.reads.Load())
+	for _, cc := range results {
+		s.Equal(10, cc.ClientRPM)
+	}
+	// Cached afterwards
+	_, err := LoadCachedClientConfig(context.Background(), store, "singleflight")
+	s.NoError(err)
+	s.Equal(int32(1), store.reads.Load())
+}
@@ -0,0 +1,148 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+
+	json "github.com/goccy/go-json"
+)
+
+// CanonicalHash hashes the values of fields (JMESPath expressions) in payload, or the whole payload if fields is
+// empty. Values are canonicalized first: map keys are sorted at every level, whitespace is dropped and numbers are
+// compared by value, so 1, 1.0 and 1e0 hash the same. Array order is kept.
+// It returns "" when none of the fields is present, as such events carry nothing to tell duplicates apart.
+func CanonicalHash(payload map[string]any, fields []string) (string, error) {
+	var values any = payload
+	if len(fields) > 0 {
+		selected := make([]any, len(fields))
+		present := false
+		for i, f := range fields {
+			v, err := EvalAnyCompiled(f, payload)
+			if err != nil {
+				return "", err
+			}
+			selected[i] = v
+			present = present || v != nil
+		}
+		if !present {
+			return "", nil
+		}
+		values = selected
+	}
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, values); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// writeCanonical writes v as JSON with sorted map keys and numbers in their shortest float64 form.
+func writeCanonical(buf *bytes.Buffer, v any) error {
+	switch t := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(t))
+	case string:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	case float64:
+		writeNumber(buf, t)
+	case float32:
+		writeNumber(buf, float64(t))
+	case int:
+		writeNumber(buf, float64(t))
+	case int64:
+		writeNumber(buf, float64(t))
+	case int32:
+		writeNumber(buf, float64(t))
+	case uint:
+		writeNumber(buf, float64(t))
+	case uint64:
+		writeNumber(buf, float64(t))
+	case uint32:
+		writeNumber(buf, float64(t))
+	case json.Number:
+		f, err := t.Float64()
+		if err != nil {
+			return fmt.Errorf("invalid number %q: %w", t, err)
+		}
+		writeNumber(buf, f)
+	case map[string]any:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, k); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, t[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []any:
+		buf.WriteByte('[')
+		for i, e := range t {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		// Other types (structs, typed maps and slices) go through their JSON form
+		b, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		var generic any
+		if err := json.Unmarshal(b, &generic); err != nil {
+			return err
+		}
+		return writeCanonical(buf, generic)
+	}
+	return nil
+}
+
+func writeNumber(buf *bytes.Buffer, f float64) {
+	if f == 0 {
+		f = 0 // -0 equals 0
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		buf.WriteString(strconv.Quote(strconv.FormatFloat(f, 'g', -1, 64)))
+		return
+	}
+	buf.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// isDuplicate reports whether the payload repeats an event accepted within the client's dedup window.
+func isDuplicate(ctx context.Context, dataStore ports.DataStore, clientID string, d types.DedupConfig,
+	payload map[string]any) (bool, error) {
+	hash, err := CanonicalHash(payload, d.Fields)
+	if err != nil || hash == "" {
+		return false, err
+	}
+	return dataStore.Suppress(ctx, clientID, hash, d.Window())
+}
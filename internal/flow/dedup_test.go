@@ -0,0 +1,43 @@
+package flow
+
+import (
+	json "github.com/goccy/go-json"
+)
+
+func (s *UnitTestSuite) TestCanonicalHash() {
+	decode := func(doc string) map[string]any {
+		var m map[string]any
+		s.Require().NoError(json.Unmarshal([]byte(doc), &m))
+		return m
+	}
+	hash := func(payload map[string]any, fields ...string) string {
+		h, err := CanonicalHash(payload, fields)
+		s.NoError(err)
+		return h
+	}
+
+	// Key order and whitespace
+	a := hash(decode(`{"a":1,"b":{"x":[1,{"p":1,"q":2}],"y":"z"}}`))
+	s.NotEmpty(a)
+	s.Equal(a, hash(decode(`{ "b": { "y": "z", "x": [1, {"q": 2, "p": 1}] }, "a": 1 }`)))
+	// Array order matters
+	s.NotEqual(a, hash(decode(`{"a":1,"b":{"x":[{"p":1,"q":2},1],"y":"z"}}`)))
+
+	// Equivalent numeric encodings
+	s.Equal(hash(decode(`{"n":1}`)), hash(decode(`{"n":1.0}`)))
+	s.Equal(hash(decode(`{"n":1}`)), hash(decode(`{"n":1e0}`)))
+	s.Equal(hash(decode(`{"n":1}`)), hash(map[string]any{"n": 1}))
+	s.Equal(hash(decode(`{"n":1}`)), hash(map[string]any{"n": json.Number("1.00")}))
+	s.NotEqual(hash(decode(`{"n":1}`)), hash(decode(`{"n":"1"}`)))
+
+	// Only the selected fields count
+	s.Equal(
+		hash(decode(`{"id":"1","meta":{"b":2,"a":1},"ts":1}`), "id", "meta"),
+		hash(decode(`{"ts":2,"meta":{"a":1.0,"b":2},"id":"1"}`), "id", "meta"),
+	)
+	s.NotEqual(hash(decode(`{"id":"1","x":null}`), "id", "x"), hash(decode(`{"x":"1"}`), "id", "x"))
+	s.Empty(hash(decode(`{"other":1}`), "id"))
+
+	_, err := CanonicalHash(decode(`{}`), []string{"[invalid"})
+	s.Error(err)
+}
@@ -0,0 +1,34 @@
+package flow
+
+import "reflect"
+
+// MergePatch computes the JSON merge patch (RFC 7386) turning prev into next: only changed or added members are
+// kept, nested objects are diffed recursively, removed members are set to nil (JSON null) and arrays are replaced
+// as a whole.
+func MergePatch(prev, next map[string]any) map[string]any {
+	patch := map[string]any{}
+	for k, nv := range next {
+		pv, ok := prev[k]
+		if !ok {
+			patch[k] = nv
+			continue
+		}
+		pm, pIsMap := pv.(map[string]any)
+		nm, nIsMap := nv.(map[string]any)
+		if pIsMap && nIsMap {
+			if sub := MergePatch(pm, nm); len(sub) > 0 {
+				patch[k] = sub
+			}
+			continue
+		}
+		if !reflect.DeepEqual(pv, nv) {
+			patch[k] = nv
+		}
+	}
+	for k := range prev {
+		if _, ok := next[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
@@ -0,0 +1,107 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/types"
+)
+
+func (s *UnitTestSuite) TestMergePatch() {
+	prev := map[string]any{
+		"status": "up",
+		"host":   map[string]any{"name": "h1", "cpu": 0.5, "tags": []any{"a"}},
+		"gone":   1.0,
+	}
+	next := map[string]any{
+		"status": "down",
+		"host":   map[string]any{"name": "h1", "cpu": 0.9, "tags": []any{"a"}},
+		"new":    true,
+	}
+	s.Equal(map[string]any{
+		"status": "down",
+		"host":   map[string]any{"cpu": 0.9},
+		"gone":   nil,
+		"new":    true,
+	}, MergePatch(prev, next))
+	s.Empty(MergePatch(next, next))
+}
+
+func (s *UnitTestSuite) TestForwardDiff() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	cc := types.ClientConfig{Trigger: types.TriggerConfig{FieldExpr: "status", ForwardDiff: true}}
+	run := func(payload map[string]any) (Action, map[string]any) {
+		action, _, out, err := Run(ctx, "c", "127.0.0.1", cc, store, payload)
+		s.NoError(err)
+		return action, out
+	}
+
+	first := map[string]any{"status": "up", "detail": map[string]any{"region": "eu", "load": 1.0}}
+	action, out := run(first)
+	s.Equal(EdgeTriggeredForward, action)
+	s.Equal(first, out)
+
+	// Same status: not forwarded, does not move the baseline
+	action, _ = run(map[string]any{"status": "up", "detail": map[string]any{"region": "eu", "load": 2.0}})
+	s.Equal(NoOp, action)
+
+	action, out = run(map[string]any{"status": "down", "detail": map[string]any{"region": "eu", "load": 3.0}})
+	s.Equal(EdgeTriggeredForward, action)
+	s.Equal(map[string]any{"status": "down", "detail": map[string]any{"load": 3.0}}, out)
+
+	action, out = run(map[string]any{"status": "up", "detail": map[string]any{"region": "us", "load": 3.0}})
+	s.Equal(EdgeTriggeredForward, action)
+	s.Equal(map[string]any{"status": "up", "detail": map[string]any{"region": "us"}}, out)
+
+	// Off by default: the full payload is forwarded
+	cc.Trigger.ForwardDiff = false
+	full := map[string]any{"status": "down", "detail": map[string]any{"region": "us", "load": 3.0}}
+	_, out = run(full)
+	s.Equal(full, out)
+}
+
+// TestForwardDiffTargetRateLimited has the target limit trip between two forwards: the event it holds back is not
+// taken for the last forwarded one.
+func (s *UnitTestSuite) TestForwardDiffTargetRateLimited() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	cc := types.ClientConfig{Trigger: types.TriggerConfig{FieldExpr: "status", ForwardDiff: true,
+		Target: types.TargetConfig{SNSArn: "arn:aws:sns:us-east-1:000000000000:t", SNSRPM: 1}}}
+	run := func(payload map[string]any) (Action, map[string]any) {
+		action, _, out, err := Run(ctx, "c", "127.0.0.1", cc, store, payload)
+		s.NoError(err)
+		return action, out
+	}
+
+	action, _ := run(map[string]any{"status": "up", "region": "eu"})
+	s.Equal(EdgeTriggeredForward, action)
+	action, _ = run(map[string]any{"status": "down", "region": "eu"})
+	s.Equal(TargetRateLimited, action)
+
+	// The target window is over: the diff is against the last payload actually forwarded
+	store.counts = map[string]int{}
+	action, out := run(map[string]any{"status": "up", "region": "us"})
+	s.Equal(EdgeTriggeredForward, action)
+	s.Equal(map[string]any{"region": "us"}, out)
+}
+
+func (s *UnitTestSuite) TestEncodeOutputBody() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	cc := types.ClientConfig{Trigger: types.TriggerConfig{FieldExpr: "status", ForwardDiff: true}}
+	encode := func(body string, payload map[string]any) string {
+		outcomes, _, err := RunTriggers(ctx, "c", "127.0.0.1", cc, store, payload)
+		s.Require().NoError(err)
+		b, err := EncodeOutputBody(cc, outcomes[0], []byte(body))
+		s.Require().NoError(err)
+		return string(b)
+	}
+
+	// Forwarded in full, then as a diff
+	s.Equal(`{"status":"up", "load":1, "region":"eu"}`, encode(`{"status":"up", "load":1, "region":"eu"}`,
+		map[string]any{"status": "up", "load": 1.0, "region": "eu"}))
+	s.JSONEq(`{"status":"down","load":2}`, encode(`{"status":"down", "load":2, "region":"eu"}`,
+		map[string]any{"status": "down", "load": 2.0, "region": "eu"}))
+
+	cc.OutputTemplate = `{{.status}}`
+	s.Equal("up", encode(`{"status":"up"}`, map[string]any{"status": "up"}))
+}
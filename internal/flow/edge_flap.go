@@ -1,8 +1,17 @@
 package flow
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
 
 	"enoti/internal/ports"
 	"enoti/internal/types"
@@ -10,40 +19,126 @@ import (
 	json "github.com/goccy/go-json"
 	"github.com/klauspost/compress/zstd"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Action indicates what to do after evaluating the new value against state.
 type Action int
 
+// zstd encoders and decoders are pooled rather than shared, so that concurrent requests never use the same one.
+// Each runs synchronously (concurrency 1): they hold no goroutines, and a pooled one can be dropped by the GC.
 var (
-	enc *zstd.Encoder
-	dec *zstd.Decoder
+	encoders = sync.Pool{New: func() any {
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			panic("failed to create zstd encoder: " + err.Error())
+		}
+		return enc
+	}}
+	decoders = sync.Pool{New: func() any {
+		dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			panic("failed to create zstd decoder: " + err.Error())
+		}
+		return dec
+	}}
 )
 
-func init() {
-	var err error
-	enc, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
-	if err != nil {
-		panic("failed to create zstd encoder: " + err.Error())
+// ErrCASRaced is returned by EvaluateEdgeAndFlap when the edge state changed between its load and its write. The
+// event was not accounted for; evaluating it again reads the new state.
+var ErrCASRaced = errors.New("edge state changed concurrently")
+
+// EvaluateEdgeAndFlap applies edge detection + flapping logic and persists state via CAS.
+// On CAS collision it returns ErrCASRaced, and callers SHOULD evaluate again (see runTrigger).
+// If the trigger has a dependency that is not met, the state is still updated but forwards turn into NoOp.
+// For threshold triggers, newVal is the state from ThresholdState; recoveries are only forwarded with ForwardRecovery.
+// With a dry run context (see WithDryRun) the state is not persisted.
+func EvaluateEdgeAndFlap(
+	ctx context.Context,
+	store ports.DataStore,
+	clientID,
+	scopeKey string,
+	newVal string,
+	trig types.TriggerConfig,
+	payload map[string]any,
+) (action Action, agg map[string]any, err error) {
+	ctx, span := StartSpan(ctx, "EvaluateEdgeAndFlap", AttrClientID.String(clientID), AttrScopeKey.String(scopeKey))
+	defer func() {
+		span.SetAttributes(AttrAction.String(StatusTextMap[action]))
+		EndSpan(span, err)
+	}()
+	store = dryRunData(ctx, store)
+	ctx = withFlapWindow(ctx, trig)
+	action, agg, err = evaluateEdgeAndFlap(ctx, store, clientID, scopeKey, newVal, trig, payload)
+	if action == EdgeTriggeredForward && trig.Type == types.TriggerTypeThreshold && newVal == types.ThresholdOK &&
+		!trig.ForwardRecovery {
+		return NoOp, nil, err
 	}
-	dec, err = zstd.NewReader(nil)
+	if err != nil || trig.DependsOn == nil || (action != EdgeTriggeredForward && action != AggregateSent) {
+		return action, agg, err
+	}
+	met, err := dependencyMet(ctx, store, clientID, trig, payload)
 	if err != nil {
-		panic("failed to create zstd decoder: " + err.Error())
+		return NoOp, nil, err
+	}
+	if !met {
+		return NoOp, nil, nil
 	}
+	return action, agg, nil
 }
 
-// EvaluateEdgeAndFlap applies edge detection + flapping logic and persists state via CAS.
-// Callers SHOULD retry once on CAS collision (see handler below).
-func EvaluateEdgeAndFlap(
+// withFlapWindow passes the flapping window of trig, if any, on to UpsertCAS (see ports.WithFlapWindow).
+func withFlapWindow(ctx context.Context, trig types.TriggerConfig) context.Context {
+	if f := trig.Flapping; f != nil && f.WindowSeconds > 0 {
+		return ports.WithFlapWindow(ctx, time.Duration(f.WindowSeconds)*time.Second)
+	}
+	return ctx
+}
+
+type triggersCtx struct{}
+
+// WithTriggers sets all the triggers of the client (see ClientConfig.AllTriggers), among which EvaluateEdgeAndFlap
+// calls made with the returned context look up the triggers that others depend on.
+func WithTriggers(ctx context.Context, triggers []types.TriggerConfig) context.Context {
+	return context.WithValue(ctx, triggersCtx{}, triggers)
+}
+
+// dependencyMet reports whether the last value of the trigger watching trig.DependsOn.Field is one of its Values,
+// for the same entity: both triggers share their ScopeFields. The trigger is the first of those set by WithTriggers
+// watching the field, whose edge state is under its own scope key; without them, it is taken to be alone on its
+// field. A dependency that has never been observed is not met.
+func dependencyMet(ctx context.Context, store ports.DataStore, clientID string, trig types.TriggerConfig,
+	payload map[string]any) (bool, error) {
+	dep := trig.DependsOn
+	all, _ := ctx.Value(triggersCtx{}).([]types.TriggerConfig)
+	i := slices.IndexFunc(all, func(t types.TriggerConfig) bool { return t.FieldExpr == dep.Field })
+	if i < 0 {
+		all, i = []types.TriggerConfig{{FieldExpr: dep.Field, ScopeFields: trig.ScopeFields}}, 0
+	}
+	edge, _, err := store.Load(ctx, clientID, triggerScopeKey(all, i, payload))
+	if err != nil || edge == nil {
+		return false, err
+	}
+	return slices.Contains(dep.Values, edge.LastValue), nil
+}
+
+func evaluateEdgeAndFlap(
 	ctx context.Context,
 	store ports.DataStore,
 	clientID,
 	scopeKey string,
 	newVal string,
-	f *types.FlapConfig,
+	trig types.TriggerConfig,
 	payload map[string]any,
 ) (Action, map[string]any, error) {
-	now := EpochTime()
+	// Values are compared as rounded, so the lists apply to rounded values too. Noise values never count as edges,
+	// and leave the state untouched
+	newVal = RoundNumeric(newVal, trig.Numeric)
+	if trig.Ignores(newVal) {
+		return NoOp, nil, nil
+	}
+	now := clockNow(ctx).Unix()
+	f := trig.Flapping
 
 	edgeInfo, ver, err := store.Load(ctx, clientID, scopeKey)
 	if err != nil {
@@ -61,18 +156,27 @@ func EvaluateEdgeAndFlap(
 			return NoOp, nil, err
 		}
 		if ok {
+			if trig.Type == types.TriggerTypeThreshold && newVal == types.ThresholdOK {
+				return NoOp, nil, nil // nothing has recovered
+			}
 			return EdgeTriggeredForward, nil, nil // first observation counts as an "edge"
 		}
-		// CAS raced — ask caller to retry whole evaluation path once.
-		return SuppressFlapping, nil, nil
+		// CAS raced: another event made the first observation
+		return NoOp, nil, ErrCASRaced
+	}
+
+	// Out of order: the state already reflects a later event (see WithEventTime)
+	if hasEventTime(ctx) && now < edgeInfo.LastChangeTS {
+		return NoOp, nil, nil
 	}
 
 	// Stable -- no change
-	if edgeInfo.LastValue == newVal {
+	if edgeInfo.LastValue == newVal || WithinTolerance(edgeInfo.LastValue, newVal, trig.Numeric) {
 		return NoOp, nil, nil
 	}
 
 	// Flip observed
+	defer func() { trace.SpanFromContext(ctx).SetAttributes(AttrFlipCount.Int(edgeInfo.FlipCount)) }()
 	encoded, err := EncodePayload(payload)
 	if err != nil {
 		return NoOp, nil, err
@@ -93,7 +197,7 @@ func EvaluateEdgeAndFlap(
 	if f != nil {
 		// Check the window
 		newWindow := false
-		if f.WindowSeconds > 0 && now-edgeInfo.WindowStart > int64(f.WindowSeconds) {
+		if f.WindowClosed(edgeInfo.WindowStart, now) {
 			// At this point, we know we saw a new Value that is different from LastValue already.
 			// So the first flip in the new window is this one.
 			edgeInfo.WindowStart = now
@@ -110,8 +214,10 @@ func EvaluateEdgeAndFlap(
 
 		// Suppress initial flips under tolerance
 		if edgeInfo.FlipCount <= f.SuppressBelow {
-			if _, err := store.UpsertCAS(ctx, clientID, scopeKey, ver, *edgeInfo); err != nil {
+			if ok, err := store.UpsertCAS(ctx, clientID, scopeKey, ver, *edgeInfo); err != nil {
 				log.WithError(err).Error("failed to upsert CAS for suppressed flip")
+			} else if !ok {
+				return NoOp, nil, ErrCASRaced
 			}
 			return SuppressFlapping, nil, nil
 		}
@@ -120,39 +226,96 @@ func EvaluateEdgeAndFlap(
 		if f.AggregateAt > 0 && !newWindow {
 			var agg map[string]any
 			action := SuppressFlapping
-			if edgeInfo.FlipCount%f.AggregateAt == 0 && now >= edgeInfo.AggUntilTS && len(edgeInfo.Recent) >= f.AggregateAt {
-				edgeInfo.AggUntilTS = now + int64(f.AggregateCooldownSeconds)
-				agg = BuildAggregate(edgeInfo, f.AggregateMaxItems)
+			if edgeInfo.FlipCount%f.AggregateAt == 0 && now >= edgeInfo.AggUntilTS &&
+				len(edgeInfo.Recent) >= max(f.AggregateAt, f.AggregateMinItems) {
+				fp := AggregateFingerprint(edgeInfo.Recent)
+				if f.SuppressIdenticalSeconds > 0 && fp == edgeInfo.LastAggFingerprint &&
+					now-edgeInfo.LastAggTS < int64(f.SuppressIdenticalSeconds) {
+					// Same pattern as the last aggregate; drop it but keep the original send time as the anchor
+					action = NoOp
+				} else {
+					edgeInfo.AggUntilTS = now + int64(f.AggregateCooldownSeconds)
+					edgeInfo.LastAggFingerprint = fp
+					edgeInfo.LastAggTS = now
+					agg = BuildAggregate(edgeInfo, f.AggregateMaxItems, redactFields(ctx)...)
+					action = AggregateSent
+				}
 				// Trim the edgeInfo.Recent
 				edgeInfo.Recent = nil
-				action = AggregateSent
 			}
 			if ok, err := store.UpsertCAS(ctx, clientID, scopeKey, ver, *edgeInfo); err != nil {
 				return SuppressFlapping, nil, err
 			} else if ok {
 				return action, agg, nil
 			} else {
-				return NoOp, nil, nil // CAS raced, suppress this time
+				return NoOp, nil, ErrCASRaced
 			}
 		}
 	}
+	var diff map[string]any
+	if trig.ForwardDiff {
+		diff = lastForwardedDiff(edgeInfo.LastForwarded, payload)
+	}
 	if ok, err := store.UpsertCAS(ctx, clientID, scopeKey, ver, *edgeInfo); err != nil {
 		return NoOp, nil, err
 	} else if ok {
-		return EdgeTriggeredForward, nil, nil
+		return EdgeTriggeredForward, diff, nil
 	} else {
-		return NoOp, nil, nil // CAS raced, suppress this time
+		return NoOp, nil, ErrCASRaced
 	}
 
 }
 
+// recordForwarded stores payload as the last forwarded payload of the edge state of the scope, which ForwardDiff
+// triggers diff the next forward against. It is only called once the event is certain to be forwarded, past the
+// dependency and the target rate limit, so that a payload that was never sent is not taken for the last one.
+func recordForwarded(ctx context.Context, store ports.DataStore, clientID, scopeKey string,
+	payload map[string]any) error {
+	encoded, err := EncodePayload(payload)
+	if err != nil {
+		return err
+	}
+	for range maxCASAttempts {
+		edge, ver, err := store.Load(ctx, clientID, scopeKey)
+		if err != nil || edge == nil {
+			return err
+		}
+		edge.LastForwarded = encoded
+		if ok, err := store.UpsertCAS(ctx, clientID, scopeKey, ver, *edge); err != nil || ok {
+			return err
+		}
+	}
+	return ErrCASRaced
+}
+
+// lastForwardedDiff returns the merge patch from the encoded last forwarded payload to payload, or nil (forward in
+// full) if there is no usable previous payload.
+func lastForwardedDiff(lastForwarded string, payload map[string]any) map[string]any {
+	if lastForwarded == "" {
+		return nil
+	}
+	b, err := DecodePayload(lastForwarded)
+	if err != nil {
+		log.WithError(err).Error("failed to decode last forwarded payload")
+		return nil
+	}
+	var prev map[string]any
+	if err := json.Unmarshal(b, &prev); err != nil {
+		log.WithError(err).Error("failed to unmarshal last forwarded payload")
+		return nil
+	}
+	return MergePatch(prev, payload)
+}
+
 // EncodePayload encodes the payload as JSON, compresses and base64-url encodes it.
 func EncodePayload(d map[string]any) (string, error) {
 	s, err := json.Marshal(d)
 	if err != nil {
 		return "", err
 	}
+	enc := encoders.Get().(*zstd.Encoder)
 	b := enc.EncodeAll(s, make([]byte, 0, len(s)))
+	encoders.Put(enc)
 	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
@@ -162,15 +325,83 @@ func DecodePayload(in string) ([]byte, error) {
 	if err != nil {
 		return []byte{}, err
 	}
+	dec := decoders.Get().(*zstd.Decoder)
 	out, err := dec.DecodeAll(b, nil)
+	decoders.Put(dec)
 	if err != nil {
 		return []byte{}, err
 	}
 	return out, nil
 }
 
-// BuildAggregate builds the aggregate payload to send.
-func BuildAggregate(edgeInfo *types.Edge, k int) map[string]any {
+// AggregateFingerprint summarizes the shape of a run of flips: the sorted distinct values seen and the number of flips.
+func AggregateFingerprint(recent []types.Flip) string {
+	seen := map[string]struct{}{}
+	for _, it := range recent {
+		seen[it.From] = struct{}{}
+		seen[it.To] = struct{}{}
+	}
+	values := slices.Sorted(maps.Keys(seen))
+	h := fnv.New64a()
+	for _, v := range values {
+		_, _ = h.Write([]byte(v))
+		_, _ = h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x:%d", h.Sum64(), len(recent))
+}
+
+// EncodeAggregate renders the aggregate built for trig into the published body: the AggregateTemplate of its
+// flapping config executed against agg, or agg as JSON if there is no template.
+func EncodeAggregate(trig types.TriggerConfig, agg map[string]any) ([]byte, error) {
+	var tmpl *template.Template
+	if trig.Flapping != nil {
+		var err error
+		if tmpl, err = trig.Flapping.Template(); err != nil {
+			return nil, fmt.Errorf("parse aggregate_template: %w", err)
+		}
+	}
+	if tmpl == nil {
+		return json.Marshal(agg)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, agg); err != nil {
+		return nil, fmt.Errorf("render aggregate_template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeOutput renders the payload to publish for the client into the published body: the client's OutputTemplate
+// executed against payload, or payload as JSON if there is no template.
+func EncodeOutput(cc types.ClientConfig, payload map[string]any) ([]byte, error) {
+	tmpl, err := cc.Output()
+	if err != nil {
+		return nil, fmt.Errorf("parse output_template: %w", err)
+	}
+	if tmpl == nil {
+		return json.Marshal(payload)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, payload); err != nil {
+		return nil, fmt.Errorf("render output_template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeOutputBody is EncodeOutput for the outcome o of an event received as the JSON body. Unless the client has an
+// OutputTemplate, an untransformed payload (see TriggerOutcome.Untransformed) is published as body itself rather
+// than marshaled again, keeping the order of its fields and its numbers as sent.
+func EncodeOutputBody(cc types.ClientConfig, o TriggerOutcome, body []byte) ([]byte, error) {
+	if body != nil && cc.OutputTemplate == "" && o.Untransformed() {
+		return body, nil
+	}
+	return EncodeOutput(cc, o.Payload)
+}
+
+// BuildAggregate builds the aggregate payload to send: the k most recent flips with their payloads,
+// along with summary stats over all of Recent: how many flips went to each value (value_counts), the number of
+// distinct values flipped to, and the times of the first and last flip. The given fields are redacted from each
+// payload (see Redact).
+func BuildAggregate(edgeInfo *types.Edge, k int, redact ...string) map[string]any {
 	items := make([]map[string]any, 0, len(edgeInfo.Recent))
 	num := len(edgeInfo.Recent)
 	if k > 0 && num > 0 {
@@ -186,6 +417,7 @@ func BuildAggregate(edgeInfo *types.Edge, k int) map[string]any {
 					if err := json.Unmarshal(b, &pl); err != nil {
 						log.WithError(err).Error("failed to unmarshal payload in aggregate")
 					}
+					pl = Redact(pl, redact)
 				}
 			}
 			items = append(items, map[string]any{
@@ -196,12 +428,26 @@ func BuildAggregate(edgeInfo *types.Edge, k int) map[string]any {
 			})
 		}
 	}
+	// Stats cover all of Recent, not only the items included, and need no payload decoding
+	counts := map[string]int{}
+	var firstAt, lastAt int64
+	for i, it := range edgeInfo.Recent {
+		counts[it.To]++
+		if i == 0 || it.At < firstAt {
+			firstAt = it.At
+		}
+		lastAt = max(lastAt, it.At)
+	}
 	return map[string]any{
-		"type":         "flap_aggregate",
-		"scope":        edgeInfo.ScopeKey,
-		"last_value":   edgeInfo.LastValue,
-		"window_start": edgeInfo.WindowStart,
-		"flip_count":   edgeInfo.FlipCount,
-		"recent":       items,
+		"type":            "flap_aggregate",
+		"scope":           edgeInfo.ScopeKey,
+		"last_value":      edgeInfo.LastValue,
+		"window_start":    edgeInfo.WindowStart,
+		"flip_count":      edgeInfo.FlipCount,
+		"recent":          items,
+		"value_counts":    counts,
+		"distinct_values": len(counts),
+		"first_at":        firstAt,
+		"last_at":         lastAt,
 	}
 }
@@ -0,0 +1,350 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/types"
+	"strings"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+)
+
+func (s *UnitTestSuite) TestSuppressIdenticalAggregates() {
+	ctx := context.Background()
+	flap := &types.FlapConfig{WindowSeconds: 600, AggregateAt: 2}
+	trig := types.TriggerConfig{FieldExpr: "v", Flapping: flap}
+
+	run := func(store *memDataStore) (sent int) {
+		for _, v := range []string{"a", "b", "a", "b", "a", "b", "a"} {
+			action, _, err := EvaluateEdgeAndFlap(ctx, store, "c", "k", v, trig, map[string]any{"v": v})
+			s.NoError(err)
+			if action == AggregateSent {
+				sent++
+			}
+		}
+		return sent
+	}
+
+	// Off by default: every a/b/a pattern yields an aggregate
+	s.Equal(3, run(newMemDataStore()))
+
+	flap.SuppressIdenticalSeconds = 60
+	s.Equal(1, run(newMemDataStore()))
+
+	// A different set of values is not identical
+	store := newMemDataStore()
+	s.Equal(1, run(store))
+	for _, v := range []string{"c", "a"} {
+		action, _, err := EvaluateEdgeAndFlap(ctx, store, "c", "k", v, trig, map[string]any{"v": v})
+		s.NoError(err)
+		if v == "a" {
+			s.Equal(AggregateSent, action)
+		}
+	}
+}
+
+func (s *UnitTestSuite) TestAggregateFingerprint() {
+	ab := []types.Flip{{From: "a", To: "b"}, {From: "b", To: "a"}}
+	ba := []types.Flip{{From: "b", To: "a"}, {From: "a", To: "b"}}
+	s.Equal(AggregateFingerprint(ab), AggregateFingerprint(ba))
+	s.NotEqual(AggregateFingerprint(ab), AggregateFingerprint(ab[:1]))
+	s.NotEqual(AggregateFingerprint(ab), AggregateFingerprint([]types.Flip{{From: "a", To: "c"}, {From: "c", To: "a"}}))
+}
+
+func (s *UnitTestSuite) TestDependentTrigger() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	cc := types.ClientConfig{
+		Trigger: types.TriggerConfig{FieldExpr: "health"},
+		Triggers: []types.TriggerConfig{{
+			FieldExpr: "latency",
+			DependsOn: &types.TriggerDependency{Field: "health", Values: []string{"unhealthy"}},
+		}},
+	}
+	run := func(payload map[string]any) Action {
+		action, _, _, err := Run(ctx, "c", "127.0.0.1", cc, store, payload)
+		s.NoError(err)
+		return action
+	}
+
+	// Dependency never observed: recorded, not forwarded
+	s.Equal(NoOp, run(map[string]any{"latency": "high"}))
+	edge, _, _ := store.Load(ctx, "c", ComputeKey("latency"))
+	s.Equal("high", edge.LastValue)
+
+	s.Equal(EdgeTriggeredForward, run(map[string]any{"health": "unhealthy"}))
+	s.Equal(EdgeTriggeredForward, run(map[string]any{"latency": "low"}))
+	s.Equal(EdgeTriggeredForward, run(map[string]any{"latency": "high"}))
+
+	// Back to healthy gates the dependent trigger again
+	s.Equal(EdgeTriggeredForward, run(map[string]any{"health": "healthy"}))
+	s.Equal(NoOp, run(map[string]any{"latency": "low"}))
+	edge, _, _ = store.Load(ctx, "c", ComputeKey("latency"))
+	s.Equal("low", edge.LastValue)
+}
+
+// TestDependentTriggerPositioned has the dependency field watched by two triggers: the dependency is on the first,
+// under its own scope key for the entity of the event.
+func (s *UnitTestSuite) TestDependentTriggerPositioned() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	host := []string{"host"}
+	cc := types.ClientConfig{
+		Trigger: types.TriggerConfig{FieldExpr: "health", ScopeFields: host},
+		Triggers: []types.TriggerConfig{
+			{FieldExpr: "health", ScopeFields: host, IgnoreValues: []string{"unhealthy"}},
+			{FieldExpr: "latency", ScopeFields: host,
+				DependsOn: &types.TriggerDependency{Field: "health", Values: []string{"unhealthy"}}},
+		},
+	}
+	run := func(payload map[string]any) Action {
+		outcomes, _, err := RunTriggers(ctx, "c", "127.0.0.1", cc, store, payload)
+		s.Require().NoError(err)
+		return outcomes[len(outcomes)-1].Action
+	}
+
+	run(map[string]any{"host": "h1", "health": "healthy"})
+	run(map[string]any{"host": "h1", "health": "unhealthy"})
+	s.Equal(EdgeTriggeredForward, run(map[string]any{"host": "h1", "latency": "high"}))
+	s.Equal(NoOp, run(map[string]any{"host": "h2", "latency": "high"}), "other hosts are not unhealthy")
+}
+
+func (s *UnitTestSuite) TestSelectTrigger() {
+	cc := types.ClientConfig{
+		Trigger:  types.TriggerConfig{FieldExpr: "health"},
+		Triggers: []types.TriggerConfig{{FieldExpr: "latency"}},
+	}
+	s.Equal("health", SelectTrigger(cc, map[string]any{"health": "ok", "latency": "high"}).FieldExpr)
+	s.Equal("latency", SelectTrigger(cc, map[string]any{"latency": "high"}).FieldExpr)
+	s.Equal("health", SelectTrigger(cc, map[string]any{}).FieldExpr)
+	s.Equal(ComputeKey("latency"), ScopeKey(cc, map[string]any{"latency": "high"}))
+}
+
+func (s *UnitTestSuite) TestIgnoredValues() {
+	ctx := context.Background()
+	flap := &types.FlapConfig{WindowSeconds: 600}
+	cases := []struct {
+		name string
+		trig types.TriggerConfig
+	}{
+		{"ignore_values", types.TriggerConfig{FieldExpr: "v", Flapping: flap, IgnoreValues: []string{"unknown", ""}}},
+		{"only_values", types.TriggerConfig{FieldExpr: "v", Flapping: flap, OnlyValues: []string{"up", "down"}}},
+	}
+	for _, c := range cases {
+		store := newMemDataStore()
+		var actions []Action
+		for _, v := range []string{"up", "unknown", "up", "", "down", "unknown", "down"} {
+			action, _, err := EvaluateEdgeAndFlap(ctx, store, "c", "k", v, c.trig, map[string]any{"v": v})
+			s.NoError(err, c.name)
+			actions = append(actions, action)
+		}
+		s.Equal([]Action{EdgeTriggeredForward, NoOp, NoOp, NoOp, EdgeTriggeredForward, NoOp, NoOp}, actions, c.name)
+		edge, _, _ := store.Load(ctx, "c", "k")
+		s.Equal("down", edge.LastValue, c.name)
+		s.Equal(1, edge.FlipCount, c.name)
+		s.Len(edge.Recent, 1, c.name)
+	}
+}
+
+func (s *UnitTestSuite) TestIgnoredValuesRounded() {
+	ctx := context.Background()
+	precision := 0
+	numeric := &types.NumericConfig{Precision: &precision}
+	cases := []struct {
+		name string
+		trig types.TriggerConfig
+	}{
+		{"ignore_values", types.TriggerConfig{FieldExpr: "v", Numeric: numeric, IgnoreValues: []string{"0"}}},
+		{"only_values", types.TriggerConfig{FieldExpr: "v", Numeric: numeric, OnlyValues: []string{"1", "2"}}},
+	}
+	for _, c := range cases {
+		store := newMemDataStore()
+		var actions []Action
+		// 0.2 rounds to the ignored 0, 1.4 and 2.1 to the listed 1 and 2
+		for _, v := range []string{"1.4", "0.2", "2.1"} {
+			action, _, err := EvaluateEdgeAndFlap(ctx, store, "c", "k", v, c.trig, map[string]any{"v": v})
+			s.NoError(err, c.name)
+			actions = append(actions, action)
+		}
+		s.Equal([]Action{EdgeTriggeredForward, NoOp, EdgeTriggeredForward}, actions, c.name)
+		edge, _, _ := store.Load(ctx, "c", "k")
+		s.Equal("2", edge.LastValue, c.name)
+	}
+}
+
+func (s *UnitTestSuite) TestEncodeAggregate() {
+	edge := &types.Edge{
+		ScopeKey:    "k",
+		LastValue:   "down",
+		WindowStart: 100,
+		FlipCount:   2,
+		Recent:      []types.Flip{{At: 101, From: "up", To: "down"}, {At: 102, From: "down", To: "up"}},
+	}
+	agg := BuildAggregate(edge, 1)
+
+	trig := types.TriggerConfig{FieldExpr: "v", Flapping: &types.FlapConfig{WindowSeconds: 60}}
+	b, err := EncodeAggregate(trig, agg)
+	s.NoError(err)
+	s.JSONEq(`{"type":"flap_aggregate","scope":"k","last_value":"down","window_start":100,"flip_count":2,
+		"recent":[{"at":102,"from":"down","to":"up","payload":null}],
+		"value_counts":{"down":1,"up":1},"distinct_values":2,"first_at":101,"last_at":102}`, string(b))
+
+	trig.Flapping.AggregateTemplate = `{{.scope}} flapped {{.flip_count}} times, now {{.last_value}}`
+	b, err = EncodeAggregate(trig, agg)
+	s.NoError(err)
+	s.Equal("k flapped 2 times, now down", string(b))
+}
+
+func (s *UnitTestSuite) TestBuildAggregateStats() {
+	edge := &types.Edge{Recent: []types.Flip{
+		{At: 10, From: "ok", To: "warn"},
+		{At: 12, From: "warn", To: "crit"},
+		{At: 15, From: "crit", To: "warn"},
+		{At: 19, From: "warn", To: "ok"},
+		{At: 20, From: "ok", To: "warn"},
+	}}
+	agg := BuildAggregate(edge, 2)
+	s.Len(agg["recent"], 2)
+	s.Equal(map[string]int{"warn": 3, "crit": 1, "ok": 1}, agg["value_counts"])
+	s.Equal(3, agg["distinct_values"])
+	s.Equal(int64(10), agg["first_at"])
+	s.Equal(int64(20), agg["last_at"])
+
+	agg = BuildAggregate(&types.Edge{}, 2)
+	s.Empty(agg["value_counts"])
+	s.Equal(0, agg["distinct_values"])
+	s.Equal(int64(0), agg["first_at"])
+}
+
+// TestPayloadCodecConcurrent round-trips distinct payloads from many goroutines at once; run with -race.
+func (s *UnitTestSuite) TestPayloadCodecConcurrent() {
+	var wg sync.WaitGroup
+	for g := range 32 {
+		wg.Go(func() {
+			for i := range 50 {
+				payload := map[string]any{"g": g, "i": i, "pad": strings.Repeat(string(rune('a'+g%26)), 100+i)}
+				encoded, err := EncodePayload(payload)
+				if !s.NoError(err) {
+					return
+				}
+				decoded, err := DecodePayload(encoded)
+				if !s.NoError(err) {
+					return
+				}
+				want, _ := json.Marshal(payload)
+				s.JSONEq(string(want), string(decoded))
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// racingStore writes the edge state of another event between the first Load and UpsertCAS of a scope.
+type racingStore struct {
+	*memDataStore
+	raced bool
+	other types.Edge
+}
+
+func (r *racingStore) UpsertCAS(ctx context.Context, clientID, scopeKey string, prevVersion int64,
+	next types.Edge) (bool, error) {
+	if !r.raced {
+		r.raced = true
+		if ok, err := r.memDataStore.UpsertCAS(ctx, clientID, scopeKey, prevVersion, r.other); !ok || err != nil {
+			panic("racingStore: the racing write failed")
+		}
+	}
+	return r.memDataStore.UpsertCAS(ctx, clientID, scopeKey, prevVersion, next)
+}
+
+func (s *UnitTestSuite) TestRunRetriesCASRace() {
+	ctx := context.Background()
+	store := &racingStore{memDataStore: newMemDataStore(), other: types.Edge{LastValue: "up", LastChangeTS: 1}}
+	cc := types.ClientConfig{Trigger: types.TriggerConfig{FieldExpr: "v"}}
+
+	action, _, _, err := Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{"v": "down"})
+	s.NoError(err)
+	s.Equal(EdgeTriggeredForward, action, "an edge against the state written meanwhile")
+	s.Equal(2, store.loads)
+	s.Equal("down", store.edges["c/"+ComputeKey("v")].LastValue)
+
+	// The direct caller sees the race
+	store = &racingStore{memDataStore: newMemDataStore(), other: types.Edge{LastValue: "up", LastChangeTS: 1}}
+	action, _, err = EvaluateEdgeAndFlap(ctx, store, "c", "k", "down", cc.Trigger, map[string]any{"v": "down"})
+	s.ErrorIs(err, ErrCASRaced)
+	s.Equal(NoOp, action)
+}
+
+func (s *UnitTestSuite) TestRunConcurrentFirstObservation() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	cc := types.ClientConfig{Trigger: types.TriggerConfig{FieldExpr: "v"}}
+
+	const n = 64
+	actions := make([]Action, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Go(func() {
+			action, _, _, err := Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{"v": "up"})
+			s.NoError(err)
+			actions[i] = action
+		})
+	}
+	wg.Wait()
+
+	forwards := 0
+	for _, a := range actions {
+		if a == EdgeTriggeredForward {
+			forwards++
+		} else {
+			s.Equal(NoOp, a, "the others see the state as stable")
+		}
+	}
+	s.Equal(1, forwards)
+}
+
+func (s *UnitTestSuite) TestFlapWindowBoundary() {
+	ctx := context.Background()
+	t0 := time.Unix(1_700_000_000, 0)
+	trig := types.TriggerConfig{FieldExpr: "v", Flapping: &types.FlapConfig{WindowSeconds: 60, AggregateAt: 3}}
+	flip := func(store *memDataStore, at int, v string) (Action, types.Edge) {
+		SetTimNowFn(func() time.Time { return t0.Add(time.Duration(at) * time.Second) })
+		action, _, err := EvaluateEdgeAndFlap(ctx, store, "c", "k", v, trig, map[string]any{"v": v})
+		s.Require().NoError(err)
+		return action, store.edges["c/k"]
+	}
+	defer RestoreTimeNow()
+
+	for _, c := range []struct {
+		name  string
+		at    int
+		check func(Action, types.Edge)
+	}{
+		{"exactly at the boundary", 60, func(action Action, e types.Edge) {
+			s.Equal(AggregateSent, action, "the third flip of the window")
+			s.Equal(t0.Unix(), e.WindowStart)
+			s.Equal(3, e.FlipCount)
+		}},
+		{"one second past the boundary", 61, func(action Action, e types.Edge) {
+			s.Equal(EdgeTriggeredForward, action, "the flip opening a window")
+			s.Equal(t0.Unix()+61, e.WindowStart)
+			s.Equal(1, e.FlipCount)
+			s.Len(e.Recent, 1)
+		}},
+	} {
+		store := newMemDataStore()
+		action, _ := flip(store, 0, "a")
+		s.Equal(EdgeTriggeredForward, action, c.name)
+		action, _ = flip(store, 10, "b")
+		s.Equal(SuppressFlapping, action, c.name)
+		action, _ = flip(store, 20, "a")
+		s.Equal(SuppressFlapping, action, c.name)
+		c.check(flip(store, c.at, "b"))
+	}
+
+	// The flusher agrees on when the window is over
+	e := types.Edge{WindowStart: t0.Unix(), FlipCount: 2, Recent: []types.Flip{{At: t0.Unix() + 10}, {At: t0.Unix() + 20}}}
+	s.False(AggregateDue(trig, &e, t0.Unix()+60))
+	s.True(AggregateDue(trig, &e, t0.Unix()+61))
+}
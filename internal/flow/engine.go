@@ -0,0 +1,151 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/pub"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// Engine processes notifications with explicit dependencies, for embedding enoti as a library: unlike Run and
+// LoadCachedClientConfig, it reads neither the package clock nor the package config cache, so engines with their
+// own clocks and caches can run side by side.
+type Engine struct {
+	ClientStore ports.ClientStore
+	DataStore   ports.DataStore
+	// Publisher delivers the payloads that forward to the targets of their trigger; nil publishes nothing.
+	Publisher ports.Publisher
+	// Clock is the time of the engine; nil is time.Now.
+	Clock func() time.Time
+	// Cache holds the client configs read from ClientStore; nil reads them on every event.
+	Cache *TTL[string, types.ClientConfig]
+	// FailMode is the fail mode of clients without their own (see ClientConfig.FailMode).
+	FailMode string
+	// AuthFail is the policy for authentication failures; the zero policy only counts them in metrics.
+	AuthFail AuthFailPolicy
+
+	loads singleflight.Group
+}
+
+// NewEngine returns an engine on the given stores and publisher, with the system clock and a cache of its own.
+func NewEngine(cs ports.ClientStore, ds ports.DataStore, publisher ports.Publisher) *Engine {
+	return &Engine{
+		ClientStore: cs,
+		DataStore:   ds,
+		Publisher:   publisher,
+		Clock:       time.Now,
+		Cache:       NewTTLWithMaxEntries[string, types.ClientConfig](ConfigCacheMaxEntries),
+	}
+}
+
+// ProcessRequest is a notification to process, as sent to /notify.
+type ProcessRequest struct {
+	ClientID  string
+	ClientKey string
+	// ClientIP is the address the IP rate limit and the authentication failures apply to.
+	ClientIP string
+	Payload  map[string]any
+	// Body is the payload as received, published as is when nothing transforms it (see EncodeOutputBody); nil
+	// marshals the payload.
+	Body []byte
+}
+
+// ProcessResult is the outcome of processing a notification. StatusCode is the status /notify would answer with,
+// on errors too.
+type ProcessResult struct {
+	Outcomes   []TriggerOutcome
+	StatusCode int
+	// Violations lists how a payload fails the client's PayloadSchema, if it does.
+	Violations []string
+}
+
+// Action returns the action of the PrimaryOutcome, NoOp without outcomes.
+func (r ProcessResult) Action() Action {
+	if len(r.Outcomes) == 0 {
+		return NoOp
+	}
+	return PrimaryOutcome(r.Outcomes).Action
+}
+
+// Process authenticates the client of req, runs the flow for its payload (see RunTriggers) and publishes the
+// outcomes that forward (see PublishOutcome). Authentication failures are recorded per the AuthFail policy, and
+// IPs it blocks are refused. The error, if any, is meant for the client.
+func (e *Engine) Process(ctx context.Context, req ProcessRequest) (ProcessResult, error) {
+	if e.Clock != nil {
+		ctx = WithClock(ctx, e.Clock)
+	}
+	if IPBlocked(ctx, e.DataStore, req.ClientIP) {
+		return ProcessResult{StatusCode: http.StatusTooManyRequests}, errors.New("too many authentication failures")
+	}
+	cc, err := loadClientConfig(ctx, e.ClientStore, req.ClientID, e.Cache, &e.loads)
+	if err != nil {
+		RecordAuthFailure(ctx, e.DataStore, e.AuthFail, UnknownClientID, req.ClientIP)
+		return ProcessResult{StatusCode: http.StatusUnauthorized}, errors.New("unknown client")
+	}
+	if err := Auth(ctx, cc, req.ClientID, req.ClientKey); err != nil {
+		RecordAuthFailure(ctx, e.DataStore, e.AuthFail, req.ClientID, req.ClientIP)
+		return ProcessResult{StatusCode: http.StatusUnauthorized}, err
+	}
+	violations, err := ValidatePayload(cc, req.Payload)
+	if err != nil {
+		return ProcessResult{StatusCode: http.StatusInternalServerError}, errors.New("invalid payload schema")
+	}
+	if len(violations) > 0 {
+		return ProcessResult{StatusCode: http.StatusUnprocessableEntity, Violations: violations},
+			fmt.Errorf("payload does not match the schema")
+	}
+	received := ReceivedAt(ctx, cc)
+	outcomes, statusCode, err := e.RunTriggers(ctx, req.ClientID, req.ClientIP, cc, req.Payload)
+	res := ProcessResult{Outcomes: outcomes, StatusCode: statusCode}
+	if err != nil || e.Publisher == nil {
+		return res, err
+	}
+	for _, o := range outcomes {
+		if !o.Forwards() {
+			continue
+		}
+		err := PublishOutcome(ctx, e.Publisher, cc, o, req.Payload, received, req.Body)
+		if errors.Is(err, ErrEncode) {
+			log.WithError(err).WithField("clientID", req.ClientID).Error("failed to encode payload")
+			res.StatusCode = http.StatusInternalServerError
+			return res, errors.New("failed to marshal payload")
+		}
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"clientID":      req.ClientID,
+				"failedTargets": pub.FailedTargets(err),
+			}).Error("publish failed")
+			res.StatusCode = http.StatusInternalServerError
+			return res, errors.New("failed to publish")
+		}
+		res.StatusCode = http.StatusAccepted
+	}
+	return res, nil
+}
+
+// RunTriggers runs the flow of the package-level RunTriggers for an authenticated client, by the clock of the
+// engine and with its FailMode for clients without their own. Nothing is published.
+func (e *Engine) RunTriggers(ctx context.Context, clientID, clientIP string, cc types.ClientConfig,
+	payload map[string]any) ([]TriggerOutcome, int, error) {
+	if e.Clock != nil {
+		ctx = WithClock(ctx, e.Clock)
+	}
+	if cc.FailMode == "" {
+		cc.FailMode = e.FailMode
+	}
+	return RunTriggers(ctx, clientID, clientIP, cc, e.DataStore, payload)
+}
+
+// InvalidateClientConfig drops the cached config of the client, so that the next event reads it from ClientStore.
+func (e *Engine) InvalidateClientConfig(id string) {
+	if e.Cache != nil {
+		e.Cache.Delete(id)
+	}
+}
@@ -0,0 +1,179 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// engineClientStore serves fixed client configs, counting the reads.
+type engineClientStore struct {
+	mu      sync.Mutex
+	configs map[string]types.ClientConfig
+	reads   int
+}
+
+func (c *engineClientStore) GetClientConfig(_ context.Context, id string) (types.ClientConfig, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reads++
+	cc, ok := c.configs[id]
+	if !ok {
+		return cc, fmt.Errorf("client %q not found", id)
+	}
+	return cc, nil
+}
+
+func (c *engineClientStore) ListClients(context.Context) ([]string, error) { return nil, nil }
+func (c *engineClientStore) PutClientConfig(context.Context, string, types.ClientConfig) error {
+	return nil
+}
+func (c *engineClientStore) PutClientConfigCAS(context.Context, string, int64, types.ClientConfig) error {
+	return nil
+}
+func (c *engineClientStore) DeleteClientConfig(context.Context, string) error { return nil }
+func (c *engineClientStore) ClearAll(context.Context) error                   { return nil }
+func (c *engineClientStore) Ping(context.Context) error                       { return nil }
+
+// enginePublisher counts the payloads published, keeping the last one.
+type enginePublisher struct {
+	mu        sync.Mutex
+	published int
+	last      []byte
+}
+
+func (p *enginePublisher) PublishRaw(_ context.Context, _ string, payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published++
+	p.last = payload
+	return nil
+}
+
+func (s *UnitTestSuite) TestEngineProcess() {
+	ctx := context.Background()
+	cs := &engineClientStore{configs: map[string]types.ClientConfig{
+		"c": {ClientKey: "client-key-123", Trigger: types.TriggerConfig{FieldExpr: "state",
+			Target: types.TargetConfig{SNSArn: "arn:aws:sns:us-east-1:000000000000:t"}}},
+	}}
+	publisher := &enginePublisher{}
+	e := NewEngine(cs, newMemDataStore(), publisher)
+	req := ProcessRequest{ClientID: "c", ClientKey: "client-key-123", ClientIP: "127.0.0.1",
+		Payload: map[string]any{"state": "up"}}
+
+	res, err := e.Process(ctx, req)
+	s.NoError(err)
+	s.Equal(EdgeTriggeredForward, res.Action())
+	s.Equal(http.StatusAccepted, res.StatusCode)
+	res, err = e.Process(ctx, req)
+	s.NoError(err)
+	s.Equal(NoOp, res.Action())
+	s.Equal(1, publisher.published)
+	s.Equal(1, cs.reads, "the config is cached by the engine")
+	e.InvalidateClientConfig("c")
+	_, err = e.Process(ctx, req)
+	s.NoError(err)
+	s.Equal(2, cs.reads)
+
+	req.ClientKey = "wrong-key-123"
+	res, err = e.Process(ctx, req)
+	s.Error(err)
+	s.Equal(http.StatusUnauthorized, res.StatusCode)
+	req.ClientID = "missing"
+	res, err = e.Process(ctx, req)
+	s.ErrorContains(err, "unknown client")
+	s.Equal(http.StatusUnauthorized, res.StatusCode)
+}
+
+// TestEngineProcessPublishing checks that Process publishes as the HTTP handler does: enriched payloads, bodies
+// as received, the engine's fail mode and the authentication failure policy.
+func (s *UnitTestSuite) TestEngineProcessPublishing() {
+	ctx := ports.WithPublishID(context.Background(), "req-1")
+	trig := types.TriggerConfig{FieldExpr: "state"}
+	cs := &engineClientStore{configs: map[string]types.ClientConfig{
+		"enriched": {ClientID: "enriched", ClientKey: "client-key-123", Trigger: trig, EnrichMetadataKey: "_enoti"},
+		"plain":    {ClientID: "plain", ClientKey: "client-key-123", Trigger: trig},
+	}}
+	publisher := &enginePublisher{}
+	store := newMemDataStore()
+	e := NewEngine(cs, store, publisher)
+	e.Clock = func() time.Time { return time.Unix(1_000_000, 0) }
+	req := func(clientID, body string) ProcessRequest {
+		var payload map[string]any
+		s.Require().NoError(json.Unmarshal([]byte(body), &payload))
+		return ProcessRequest{ClientID: clientID, ClientKey: "client-key-123", ClientIP: "10.0.0.1",
+			Payload: payload, Body: []byte(body)}
+	}
+
+	res, err := e.Process(ctx, req("enriched", `{"state":"up"}`))
+	s.NoError(err)
+	s.JSONEq(fmt.Sprintf(`{"state":"up","_enoti":{"client_id":"enriched","action":"edge_triggered_forward",
+		"scope_key":%q,"received_at":1000000,"request_id":"req-1"}}`, res.Outcomes[0].ScopeKey), string(publisher.last))
+	_, err = e.Process(ctx, req("plain", `{ "state": "up", "n": 1.50 }`))
+	s.NoError(err)
+	s.Equal(`{ "state": "up", "n": 1.50 }`, string(publisher.last), "published as received")
+
+	// Clients without a fail mode of their own take the engine's
+	store.dataErr = errors.New("connection refused")
+	res, err = e.Process(ctx, req("plain", `{"state":"down"}`))
+	s.Error(err)
+	s.Equal(http.StatusInternalServerError, res.StatusCode)
+	e.FailMode = types.FailModeOpen
+	res, err = e.Process(ctx, req("plain", `{"state":"down"}`))
+	s.NoError(err)
+	s.Equal(ForwardedAsIs, res.Action())
+	store.dataErr = nil
+
+	// Authentication failures are recorded, and the IPs they block refused
+	e.AuthFail = AuthFailPolicy{Window: time.Minute, BlockAfter: 1, BlockFor: time.Minute}
+	bad := req("plain", `{"state":"up"}`)
+	bad.ClientKey = "wrong-key-123"
+	for range 2 {
+		res, _ = e.Process(ctx, bad)
+		s.Equal(http.StatusUnauthorized, res.StatusCode)
+	}
+	res, err = e.Process(ctx, req("plain", `{"state":"up"}`))
+	s.ErrorContains(err, "too many authentication failures")
+	s.Equal(http.StatusTooManyRequests, res.StatusCode)
+}
+
+func (s *UnitTestSuite) TestEngineClocks() {
+	ctx := context.Background()
+	cs := &engineClientStore{configs: map[string]types.ClientConfig{
+		"c": {ClientKey: "client-key-123", Trigger: types.TriggerConfig{FieldExpr: "state"}},
+	}}
+	clocks := []time.Time{time.Unix(1_000_000, 0), time.Unix(2_000_000, 0)}
+	var engines []*Engine
+	var stores []*memDataStore
+	for _, at := range clocks {
+		store := newMemDataStore()
+		e := NewEngine(cs, store, nil)
+		e.Clock = func() time.Time { return at }
+		engines, stores = append(engines, e), append(stores, store)
+	}
+
+	var wg sync.WaitGroup
+	for i, e := range engines {
+		for n := range 20 {
+			wg.Go(func() {
+				_, err := e.Process(ctx, ProcessRequest{ClientID: "c", ClientKey: "client-key-123",
+					ClientIP: "127.0.0.1", Payload: map[string]any{"state": "up", "host": fmt.Sprint(i, "-", n)}})
+				s.NoError(err)
+			})
+		}
+	}
+	wg.Wait()
+	for i, store := range stores {
+		s.Len(store.edges, 1)
+		for _, edge := range store.edges {
+			s.Equal(clocks[i].Unix(), edge.LastChangeTS, "engine %d", i)
+		}
+	}
+}
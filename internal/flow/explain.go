@@ -0,0 +1,173 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"sync"
+	"time"
+)
+
+type dryRunCtx struct{}
+
+// WithDryRun marks the flow run with the returned context as a dry run: edge states are read but never written, and
+// neither rate limits, quotas nor dedup markers are checked, as that would consume them. The run otherwise decides as usual.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunCtx{}, true)
+}
+
+// IsDryRun reports whether ctx was marked with WithDryRun.
+func IsDryRun(ctx context.Context) bool {
+	v, _ := ctx.Value(dryRunCtx{}).(bool)
+	return v
+}
+
+// dryRunStore wraps a DataStore for dry runs. Reads go through to it; writes are recorded instead, as if they had
+// committed, and later reads of the same scope see them.
+type dryRunStore struct {
+	ports.DataStore
+	mu      sync.Mutex
+	loaded  map[string]*types.Edge // first state read per scope
+	written map[string]types.Edge  // last state written per scope
+}
+
+func newDryRunStore(store ports.DataStore) *dryRunStore {
+	return &dryRunStore{DataStore: store, loaded: map[string]*types.Edge{}, written: map[string]types.Edge{}}
+}
+
+// dryRunData returns the store to use with ctx: store itself, unless ctx is a dry run.
+func dryRunData(ctx context.Context, store ports.DataStore) ports.DataStore {
+	if _, ok := store.(*dryRunStore); ok || !IsDryRun(ctx) {
+		return store
+	}
+	return newDryRunStore(store)
+}
+
+func (s *dryRunStore) Acquire(context.Context, string, int, time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (s *dryRunStore) Refund(context.Context, string, string, int, time.Duration) error {
+	return nil
+}
+
+func (s *dryRunStore) CountQuota(context.Context, string, int, int, time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (s *dryRunStore) Suppress(context.Context, string, string, time.Duration) (bool, error) {
+	return false, nil
+}
+
+func (s *dryRunStore) Release(context.Context, string, string) error {
+	return nil
+}
+
+func (s *dryRunStore) Load(ctx context.Context, clientID, scopeKey string) (*types.Edge, int64, error) {
+	k := clientID + "/" + scopeKey
+	s.mu.Lock()
+	if e, ok := s.written[k]; ok {
+		s.mu.Unlock()
+		return &e, e.Version, nil
+	}
+	s.mu.Unlock()
+	e, ver, err := s.DataStore.Load(ctx, clientID, scopeKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.loaded[k]; !ok {
+		var cp *types.Edge
+		if e != nil {
+			c := *e
+			cp = &c
+		}
+		s.loaded[k] = cp
+	}
+	return e, ver, nil
+}
+
+func (s *dryRunStore) UpsertCAS(_ context.Context, clientID, scopeKey string, prevVersion int64,
+	next types.Edge) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next.ScopeKey = scopeKey
+	next.Version = prevVersion + 1
+	s.written[clientID+"/"+scopeKey] = next
+	return true, nil
+}
+
+// Explanation describes how a payload would be handled, as computed by Explain.
+type Explanation struct {
+	// Action is the status of the primary outcome (see PrimaryOutcome), as in the response to /notify.
+	Action     string `json:"action"`
+	StatusCode int    `json:"status_code"`
+	// Error is the error the run would fail with, if any; Triggers is then empty.
+	Error       string               `json:"error,omitempty"`
+	Passthrough bool                 `json:"passthrough"`
+	Triggers    []TriggerExplanation `json:"triggers"`
+}
+
+// TriggerExplanation describes the evaluation of one trigger.
+type TriggerExplanation struct {
+	Field    string `json:"field"`
+	ScopeKey string `json:"scope_key"`
+	// Value is the evaluated trigger value (the threshold state for threshold triggers), nil if the field is absent.
+	Value *string `json:"value"`
+	// Edge is the current edge state of the scope, nil if it was never observed or not read.
+	Edge *types.Edge `json:"edge"`
+	// FlipCount and WindowStart are those of the edge state after the event.
+	FlipCount   int   `json:"flip_count"`
+	WindowStart int64 `json:"window_start,omitempty"`
+	// WindowElapsedSeconds is how far into its flapping window the event falls, for flapping triggers.
+	WindowElapsedSeconds int64  `json:"window_elapsed_seconds,omitempty"`
+	WindowSeconds        int    `json:"window_seconds,omitempty"`
+	Action               string `json:"action"`
+}
+
+// Explain runs the flow for payload as a dry run (see WithDryRun) and describes what it would do, trigger by
+// trigger. Nothing is written to dataStore. As rate limits, quotas and dedup are not checked, an event that would be
+// throttled or dropped as a duplicate is explained as if it were not.
+func Explain(ctx context.Context, clientID, clientIP string,
+	cc types.ClientConfig,
+	dataStore ports.DataStore,
+	payload map[string]any) Explanation {
+	store := newDryRunStore(dataStore)
+	outcomes, statusCode, err := RunTriggers(WithDryRun(ctx), clientID, clientIP, cc, store, payload)
+	e := Explanation{
+		StatusCode:  statusCode,
+		Passthrough: CheckPassthrough(cc.Passthrough, payload),
+		Triggers:    []TriggerExplanation{},
+	}
+	if err != nil {
+		e.Error = err.Error()
+		return e
+	}
+	e.Action = StatusTextMap[PrimaryOutcome(outcomes).Action]
+	now := clockNow(ctx).Unix()
+	for _, o := range outcomes {
+		k := clientID + "/" + o.ScopeKey
+		te := TriggerExplanation{
+			Field:    o.Trigger.FieldExpr,
+			ScopeKey: o.ScopeKey,
+			Edge:     store.loaded[k],
+			Action:   StatusTextMap[o.Action],
+		}
+		if o.Trigger.FieldExpr != "" {
+			te.Value, _ = evalTriggerValue(o.Trigger, payload)
+		}
+		state := te.Edge
+		if next, ok := store.written[k]; ok {
+			state = &next
+		}
+		if state != nil {
+			te.FlipCount, te.WindowStart = state.FlipCount, state.WindowStart
+			if f := o.Trigger.Flapping; f != nil && f.WindowSeconds > 0 {
+				te.WindowElapsedSeconds, te.WindowSeconds = now-state.WindowStart, f.WindowSeconds
+			}
+		}
+		e.Triggers = append(e.Triggers, te)
+	}
+	return e
+}
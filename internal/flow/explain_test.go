@@ -0,0 +1,115 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/types"
+	"maps"
+	"net/http"
+	"time"
+)
+
+func (s *UnitTestSuite) TestExplainMatchesRun() {
+	ctx := context.Background()
+	t := time.Unix(1_700_000_000, 0)
+	SetTimNowFn(func() time.Time { return t })
+	defer RestoreTimeNow()
+
+	cases := []struct {
+		name     string
+		cc       types.ClientConfig
+		payloads []map[string]any
+	}{
+		{"edge", types.ClientConfig{Trigger: types.TriggerConfig{FieldExpr: "status"}}, []map[string]any{
+			{"status": "up"}, {"status": "up"}, {"status": "down"},
+		}},
+		{"flapping", types.ClientConfig{Trigger: types.TriggerConfig{FieldExpr: "status", Flapping: &types.FlapConfig{
+			WindowSeconds: 60, SuppressBelow: 1, AggregateAt: 3, AggregateMaxItems: 10,
+		}}}, []map[string]any{
+			{"status": "a"}, {"status": "b"}, {"status": "a"}, {"status": "b"}, {"status": "a"}, {"status": "b"},
+		}},
+		{"threshold", types.ClientConfig{Trigger: types.TriggerConfig{
+			FieldExpr: "cpu", Type: types.TriggerTypeThreshold, Operator: "gt", Threshold: 90, ForwardRecovery: true,
+		}}, []map[string]any{
+			{"cpu": 50}, {"cpu": 95}, {"cpu": 97}, {"cpu": 20},
+		}},
+		{"passthrough", types.ClientConfig{
+			Passthrough: types.Passthrough{FieldExpr: "pass"},
+			Trigger:     types.TriggerConfig{FieldExpr: "status"},
+		}, []map[string]any{
+			{"status": "up"}, {"status": "up", "pass": true}, {"status": "up"},
+		}},
+		{"multiple triggers", types.ClientConfig{Triggers: []types.TriggerConfig{
+			{FieldExpr: "status"}, {FieldExpr: "region"},
+		}}, []map[string]any{
+			{"status": "up", "region": "ok"}, {"status": "up", "region": "degraded"},
+		}},
+	}
+	for _, c := range cases {
+		store := newMemDataStore()
+		for i, payload := range c.payloads {
+			t = t.Add(time.Second)
+			before, upserts := maps.Clone(store.edges), store.upserts
+
+			e := Explain(ctx, "c", "127.0.0.1", c.cc, store, payload)
+			s.Equal(before, store.edges, "%s #%d: explain leaves the state as is", c.name, i)
+			s.Equal(upserts, store.upserts, "%s #%d", c.name, i)
+
+			outcomes, statusCode, err := RunTriggers(ctx, "c", "127.0.0.1", c.cc, store, payload)
+			s.NoError(err)
+			s.Equal(StatusTextMap[PrimaryOutcome(outcomes).Action], e.Action, "%s #%d", c.name, i)
+			s.Equal(statusCode, e.StatusCode, "%s #%d", c.name, i)
+			s.Equal(CheckPassthrough(c.cc.Passthrough, payload), e.Passthrough, "%s #%d", c.name, i)
+			s.Len(e.Triggers, len(outcomes))
+			for j, o := range outcomes {
+				te := e.Triggers[j]
+				s.Equal(StatusTextMap[o.Action], te.Action, "%s #%d", c.name, i)
+				if e.Passthrough {
+					continue // the edge state is not looked at
+				}
+				if edge, ok := store.edges["c/"+o.ScopeKey]; ok {
+					s.Equal(edge.FlipCount, te.FlipCount, "%s #%d", c.name, i)
+					s.Equal(edge.WindowStart, te.WindowStart, "%s #%d", c.name, i)
+				}
+				if prev, ok := before["c/"+o.ScopeKey]; ok {
+					s.Equal(&prev, te.Edge, "%s #%d: the current state", c.name, i)
+				}
+			}
+		}
+	}
+}
+
+func (s *UnitTestSuite) TestExplain() {
+	ctx := context.Background()
+	t := time.Unix(1_700_000_000, 0)
+	SetTimNowFn(func() time.Time { return t })
+	defer RestoreTimeNow()
+	cc := types.ClientConfig{ClientRPM: 1, Trigger: types.TriggerConfig{
+		FieldExpr: "status", Flapping: &types.FlapConfig{WindowSeconds: 60},
+	}}
+	store := newMemDataStore()
+
+	e := Explain(ctx, "c", "127.0.0.1", cc, store, map[string]any{"status": "up"})
+	s.Equal("edge_triggered_forward", e.Action)
+	s.Nil(e.Triggers[0].Edge, "never observed")
+	s.Equal("up", *e.Triggers[0].Value)
+	_, _, err := RunTriggers(ctx, "c", "127.0.0.1", cc, store, map[string]any{"status": "up"})
+	s.NoError(err)
+
+	// Rate limits are not consumed, nor enforced
+	t = t.Add(10 * time.Second)
+	e = Explain(ctx, "c", "127.0.0.1", cc, store, map[string]any{"status": "down"})
+	s.Equal(http.StatusAccepted, e.StatusCode)
+	s.Equal("edge_triggered_forward", e.Action)
+	s.Equal("up", e.Triggers[0].Edge.LastValue)
+	s.Equal(1, e.Triggers[0].FlipCount)
+	s.Equal(int64(10), e.Triggers[0].WindowElapsedSeconds)
+	s.Equal(60, e.Triggers[0].WindowSeconds)
+	s.Equal(1, store.counts["CLIENT:c"])
+
+	// Errors are explained too
+	e = Explain(ctx, "c", "127.0.0.1", types.ClientConfig{Trigger: types.TriggerConfig{FieldExpr: "["}}, store,
+		map[string]any{"status": "down"})
+	s.Equal(http.StatusBadRequest, e.StatusCode)
+	s.NotEmpty(e.Error)
+	s.Empty(e.Triggers)
+}
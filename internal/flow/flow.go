@@ -2,118 +2,474 @@ package flow
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"enoti/internal/metrics"
 	"enoti/internal/ports"
 	"enoti/internal/types"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"net/http"
-	"strings"
+	"slices"
+	"strconv"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
 // Auth checks the clientID and clientKey against the config store.
 // Returns nil if authenticated, error otherwise.
-func Auth(ctx context.Context, cc types.ClientConfig, clientID, clientKey string) error {
+func Auth(ctx context.Context, cc types.ClientConfig, clientID, clientKey string) (err error) {
+	_, span := StartSpan(ctx, "Auth", AttrClientID.String(clientID))
+	defer func() { EndSpan(span, err) }()
 	if clientID == "" || clientKey == "" {
 		return fmt.Errorf("missing headers")
 	}
-	// Later we can have more complex auth schemes.
-	if strings.Compare(clientKey, cc.ClientKey) != 0 {
+	// A client stored without a key is misconfigured; it must never authenticate.
+	// Every active key is compared, so the time taken does not reveal which one matched.
+	matched, plaintext := false, false
+	for _, h := range cc.ActiveKeyHashes() {
+		if VerifyKeyHash(clientKey, h) {
+			matched = true
+		}
+	}
+	for _, k := range cc.ActiveKeys() {
+		if keysEqual(clientKey, k) {
+			matched, plaintext = true, true
+		}
+	}
+	if !matched {
 		return fmt.Errorf("invalid credentials")
 	}
+	if plaintext {
+		log.WithField("clientID", clientID).Warn("client authenticated with a plaintext key; put its config again to store the key hashed")
+	}
+	return nil
+}
+
+// VerifySignature checks signature, the hex encoded hmac-sha256 of body keyed with the client's SigningSecret.
+// Clients without a secret always pass; an empty signature passes unless the client requires signing. For clients
+// with a TimestampSkewSeconds, timestamp must be within the window of now and the signature covers
+// "<timestamp>.<body>".
+func VerifySignature(cc types.ClientConfig, body []byte, signature, timestamp string) error {
+	if cc.SigningSecret == "" {
+		return nil
+	}
+	if cc.TimestampSkewSeconds > 0 {
+		if err := verifyTimestamp(timestamp, cc.TimestampSkewSeconds); err != nil {
+			return err
+		}
+	}
+	if signature == "" {
+		if cc.SignatureRequired {
+			return fmt.Errorf("missing signature")
+		}
+		return nil
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature")
+	}
+	mac := hmac.New(sha256.New, []byte(cc.SigningSecret))
+	if cc.TimestampSkewSeconds > 0 {
+		mac.Write([]byte(timestamp + "."))
+	}
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// verifyTimestamp checks that timestamp, in epoch seconds, is within skewSeconds of now either way.
+func verifyTimestamp(timestamp string, skewSeconds int) error {
+	if timestamp == "" {
+		return fmt.Errorf("missing timestamp")
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp")
+	}
+	if d := EpochTime() - ts; d > int64(skewSeconds) || d < -int64(skewSeconds) {
+		return fmt.Errorf("timestamp outside the allowed window")
+	}
 	return nil
 }
 
-// Run is the core logic to process a notification payload. It returns the action to take for the next publishing step.
+// keysEqual compares keys in constant time. subtle.ConstantTimeCompare returns early on a length mismatch, so the
+// keys are hashed first to compare equal-length digests and not leak the stored key's length either.
+func keysEqual(provided, stored string) bool {
+	p := sha256.Sum256([]byte(provided))
+	s := sha256.Sum256([]byte(stored))
+	return subtle.ConstantTimeCompare(p[:], s[:]) == 1
+}
+
+// TriggerOutcome is the result of evaluating one trigger of the client against the payload: the action to take for
+// the next publishing step, and the payload to publish to the trigger's targets for it. Attributes are the message
+// attributes of the targets for it (see MessageAttributes).
+type TriggerOutcome struct {
+	Trigger    types.TriggerConfig
+	ScopeKey   string
+	Action     Action
+	Payload    map[string]any
+	Attributes map[string]any
+	// transformed is set once Payload is no longer the payload of the event as received (see Untransformed).
+	transformed bool
+}
+
+// Forwards reports whether the outcome is to be published.
+func (o TriggerOutcome) Forwards() bool {
+	return o.Action == EdgeTriggeredForward || o.Action == ForwardedAsIs || o.Action == AggregateSent
+}
+
+// Untransformed reports whether the outcome forwards the payload of the event as received: neither aggregated,
+// diffed against the last forwarded payload nor redacted.
+func (o TriggerOutcome) Untransformed() bool {
+	return (o.Action == EdgeTriggeredForward || o.Action == ForwardedAsIs) && !o.transformed
+}
+
+// PrimaryOutcome returns the outcome summarizing those of RunTriggers: the first that forwards, or the first if none
+// does. outcomes must not be empty.
+func PrimaryOutcome(outcomes []TriggerOutcome) TriggerOutcome {
+	for _, o := range outcomes {
+		if o.Forwards() {
+			return o
+		}
+	}
+	return outcomes[0]
+}
+
+// Run is the core logic to process a notification payload. It returns the action to take for the next publishing step,
+// and the payload to publish for it.
 // Note that rate limiting are not deemed as errors, instead they are indicated in the return values and proper statusCode
 // to pass back to the caller.
+// The quota of the limit that throttled the request is reported to the ports.WithQuota of ctx, if any.
+// Events past the daily or monthly quota of the client fail with ErrQuotaExceeded and 403.
+// For clients with several triggers, the action and payload are those of the PrimaryOutcome of RunTriggers.
+// Run reads the package clock (see SetTimNowFn) unless ctx carries its own (see WithClock); it is Engine.RunTriggers
+// on dataStore, and Engine.Process runs the flow for a client without package-level state.
 func Run(ctx context.Context, clientID, clientIP string,
 	cc types.ClientConfig,
 	dataStore ports.DataStore,
 	payload map[string]any) (action Action, statusCode int, newPayload map[string]any, err error) {
 
-	action = NoOp
-	statusCode = http.StatusAccepted
-	newPayload = payload
+	outcomes, statusCode, err := (&Engine{DataStore: dataStore}).RunTriggers(ctx, clientID, clientIP, cc, payload)
+	if len(outcomes) == 0 {
+		return NoOp, statusCode, payload, err
+	}
+	o := PrimaryOutcome(outcomes)
+	return o.Action, statusCode, o.Payload, err
+}
 
-	// Rate limits: IP + client
-	if cc.IPRPM > 0 {
-		ip := clientIP
-		ok, acquireErr := dataStore.Acquire(ctx, "IP:"+ip, cc.IPRPM, time.Minute)
-		if acquireErr != nil {
-			log.WithError(acquireErr).Error("failed to acquire IP rate limit")
-			err = fmt.Errorf("rate limit check failed")
-			return
+// RunTriggers is Run with one outcome per trigger evaluating the payload; see SelectTriggers. Steps deciding for the
+// client as a whole (disabled, passthrough, dedup) yield a single outcome for the trigger of SelectTrigger.
+// No outcome is returned with an error. With a dry run context (see WithDryRun) nothing is written to dataStore.
+func RunTriggers(ctx context.Context, clientID, clientIP string,
+	cc types.ClientConfig,
+	dataStore ports.DataStore,
+	payload map[string]any) (outcomes []TriggerOutcome, statusCode int, err error) {
+
+	statusCode = http.StatusAccepted
+	dataStore = dryRunData(ctx, dataStore)
+	whole := func(action Action) []TriggerOutcome {
+		o := SelectTriggers(cc, payload)[0]
+		o.Action, o.Payload = action, payload
+		return []TriggerOutcome{o}
+	}
+	if cc.ConsistentEdgeReads != nil {
+		ctx = ports.WithConsistentRead(ctx, *cc.ConsistentEdgeReads)
+	}
+	// Whichever step decides, what gets published is redacted
+	ctx = WithRedactFields(ctx, cc.RedactFields)
+	ctx = WithTriggers(ctx, cc.AllTriggers())
+	quiet := ""
+	defer func() {
+		for i, o := range outcomes {
+			switch {
+			case !o.Forwards():
+			case quiet == types.QuietHoursSuppress:
+				outcomes[i].Action = SuppressQuietHours
+			default:
+				outcomes[i] = redactOutcome(cc, o)
+				outcomes[i].Attributes = MessageAttributes(o.Trigger, Redact(payload, cc.RedactFields))
+			}
 		}
-		if !ok {
-			err = fmt.Errorf("rate limit (ip)")
-			return
+		// Quotas counting forwarded events only count those that get this far
+		if err == nil && cc.QuotaCounts != types.QuotaCountsAll && slices.ContainsFunc(outcomes, TriggerOutcome.Forwards) {
+			if code, quotaErr := useQuota(ctx, dataStore, cc, clientID, 1); quotaErr != nil {
+				outcomes, statusCode, err = nil, code, quotaErr
+			}
 		}
+	}()
+
+	// Disabled clients stop here, before consuming any limiter budget
+	if !cc.IsEnabled() {
+		outcomes = whole(ClientDisabled)
+		statusCode = http.StatusForbidden
+		return
 	}
-	if cc.ClientRPM > 0 {
-		ok, acquireErr := dataStore.Acquire(ctx, "CLIENT:"+clientID, cc.ClientRPM, time.Minute)
-		if acquireErr != nil {
-			log.WithError(acquireErr).Error("failed to acquire client rate limit")
-			err = fmt.Errorf("rate limit check failed")
+
+	// Rate limits: IP + client
+	if code, limitErr := acquireLimits(ctx, dataStore, cc, clientID, clientIP); limitErr != nil {
+		statusCode, err = code, limitErr
+		return
+	}
+
+	// Quotas: refused once used up, counting every event from here on or, by default, only forwarded ones
+	counted := 0
+	if cc.QuotaCounts == types.QuotaCountsAll {
+		counted = 1
+	}
+	if code, quotaErr := useQuota(ctx, dataStore, cc, clientID, counted); quotaErr != nil {
+		statusCode, err = code, quotaErr
+		return
+	}
+	// Quiet hours: queued events are left for later, suppressed ones evaluated but not forwarded
+	if quiet = quietHours(ctx, cc, payload); quiet == types.QuietHoursQueue {
+		outcomes = whole(SuppressQuietHours)
+		return
+	}
+	// If pass through mode matched, just acknowledge
+	if CheckPassthrough(cc.Passthrough, payload) {
+		outcomes = whole(ForwardedAsIs)
+		return
+	}
+	// Dedup: repeats of an event accepted within the window are dropped
+	if cc.Dedup != nil {
+		dup, dedupErr := isDuplicate(ctx, dataStore, clientID, *cc.Dedup, payload)
+		if dedupErr != nil && !failOpen(ctx, cc, dedupErr, "dedup") {
+			log.WithError(dedupErr).Error("failed to check dedup")
+			statusCode = acquireErrStatus(dedupErr, http.StatusInternalServerError)
+			err = fmt.Errorf("dedup check failed")
 			return
 		}
-		if !ok {
-			err = fmt.Errorf("rate limit (client)")
+		if dup {
+			outcomes = whole(SuppressDedup)
 			return
 		}
 	}
-
-	// If pass through mode matched, just acknowledge
-	if CheckPassthrough(cc.Passthrough, payload) {
-		action = ForwardedAsIs
+	// When edge state is disabled for the client, always forward (no edge/flap/aggregate)
+	if cc.EdgeState == types.EdgeStateDisabled {
+		outcomes = whole(ForwardedAsIs)
 		return
 	}
-	// Edge scope
+	rateLimited := false
+	for _, o := range SelectTriggers(cc, payload) {
+		o, statusCode, err = runTrigger(ctx, clientID, cc, dataStore, o, payload)
+		if err != nil {
+			return nil, statusCode, err
+		}
+		rateLimited = rateLimited || o.Action == TargetRateLimited
+		outcomes = append(outcomes, o)
+	}
+	// 429 only when nothing at all is forwarded
+	statusCode = http.StatusAccepted
+	if rateLimited && !slices.ContainsFunc(outcomes, TriggerOutcome.Forwards) {
+		statusCode = http.StatusTooManyRequests
+	}
+	return
+}
+
+// maxCASAttempts bounds the evaluations of an event whose edge state keeps changing concurrently.
+const maxCASAttempts = 3
+
+// runTrigger evaluates the trigger of o against the payload and fills in the action and payload of o.
+func runTrigger(ctx context.Context, clientID string, cc types.ClientConfig, dataStore ports.DataStore,
+	o TriggerOutcome, payload map[string]any) (TriggerOutcome, int, error) {
+	trig := o.Trigger
+	o.Action, o.Payload = NoOp, payload
 	// If the trigger field is empty, always forward (no edge/flap/aggregate)
 	// coz there is no field to watch.
-	if cc.Trigger.FieldExpr == "" {
-		action = ForwardedAsIs
-		return
+	if trig.FieldExpr == "" {
+		o.Action = ForwardedAsIs
+		return o, http.StatusAccepted, nil
 	}
-	newVal, err := EvalString(cc.Trigger.FieldExpr, payload)
+	newVal, err := evalTriggerValue(trig, payload)
 	if err != nil {
-		statusCode = http.StatusBadRequest
-		err = fmt.Errorf("trigger field eval error")
-		return
+		return o, http.StatusBadRequest, fmt.Errorf("trigger field eval error")
 	}
-
 	if newVal != nil {
-		scopeKey := ComputeKey(cc.Trigger.FieldExpr)
-		// Edge + flapping; one retry on CAS race
-		action, newPayload, err = EvaluateEdgeAndFlap(
-			ctx, dataStore, clientID, scopeKey, *newVal, cc.Trigger.Flapping,
-			payload,
-		)
+		// Edge + flapping, evaluated again against the new state when another event raced it
+		var newPayload map[string]any
+		for attempt := 1; ; attempt++ {
+			o.Action, newPayload, err = EvaluateEdgeAndFlap(
+				ctx, dataStore, clientID, o.ScopeKey, *newVal, trig,
+				payload,
+			)
+			if !errors.Is(err, ErrCASRaced) {
+				break
+			}
+			if attempt == maxCASAttempts {
+				log.WithFields(log.Fields{"clientID": clientID, "scopeKey": o.ScopeKey}).
+					Warn("edge state kept changing concurrently, suppressing the event")
+				o.Action, newPayload, err = NoOp, nil, nil
+				break
+			}
+		}
+		if failOpen(ctx, cc, err, "edge") {
+			// Without the edge state the event can only be forwarded as is
+			o.Action, newPayload, err = ForwardedAsIs, nil, nil
+		}
 		if err != nil {
-			err = fmt.Errorf("edge evaluation error")
-			statusCode = http.StatusInternalServerError
-			return
+			return o, http.StatusInternalServerError, fmt.Errorf("edge evaluation error")
+		}
+		if newPayload != nil {
+			o.Payload, o.transformed = newPayload, true
 		}
 	}
 
 	// Target limit
-	if (action == EdgeTriggeredForward || action == AggregateSent) && cc.Trigger.Target.SNSRPM > 0 {
-		targetScope := "TARGET:" + clientID + ":" + cc.Trigger.Target.SNSArn
-		ok, acquireErr := dataStore.Acquire(ctx, targetScope, cc.Trigger.Target.SNSRPM, time.Minute)
+	if (o.Action == EdgeTriggeredForward || o.Action == AggregateSent) && trig.Target.SNSRPM > 0 {
+		targetScope := "TARGET:" + clientID + ":" + trig.Target.Destination()
+		ok, acquireErr := acquire(ctx, dataStore, cc, targetScope, trig.Target.SNSRPM, trig.Target.SNSWindow())
 		if acquireErr != nil {
 			log.WithError(acquireErr).Error("failed to acquire target rate limit")
-			statusCode = http.StatusInternalServerError
-			err = fmt.Errorf("rate limit check failed")
-			return
+			return o, acquireErrStatus(acquireErr, http.StatusInternalServerError), fmt.Errorf("rate limit check failed")
 		}
 		if !ok {
-			action = NoOp
-			statusCode = http.StatusTooManyRequests
+			o.Action = TargetRateLimited
+			return o, http.StatusTooManyRequests, nil
 		}
 	}
-	return
+	if o.Action == EdgeTriggeredForward && trig.ForwardDiff {
+		// The event is forwarded either way: a failure only costs the next forward its diff
+		if err := recordForwarded(withFlapWindow(ctx, trig), dataStore, clientID, o.ScopeKey, payload); err != nil {
+			log.WithError(err).WithField("scopeKey", o.ScopeKey).Error("failed to record the forwarded payload")
+		}
+	}
+	return o, http.StatusAccepted, nil
+}
+
+// evalTriggerValue returns the value of the trigger field in payload as evaluated for edges: for threshold
+// triggers, the threshold state of the value.
+func evalTriggerValue(trig types.TriggerConfig, payload map[string]any) (*string, error) {
+	v, err := TriggerValue(trig, payload)
+	if err != nil || v == nil || trig.Type != types.TriggerTypeThreshold {
+		return v, err
+	}
+	return ThresholdState(trig, *v), nil
+}
+
+// rateLimit is a rate limit of the client acquired by acquireLimits, with the result of acquiring it.
+type rateLimit struct {
+	name   string // in the ErrRateLimited error
+	scope  string
+	rate   int
+	window time.Duration
+
+	ok    bool
+	err   error
+	quota ports.Quota
+	slot  string // granted by the store, see ports.WithSlot
+}
+
+// acquireLimits acquires the IP and client rate limits of the client, those that are configured. Each is a round
+// trip to the data store, so they are acquired concurrently, but decide as if acquired in turn: the first of IP and
+// client that fails to be checked or denies the event decides the error and status code, and the quota reported to
+// ports.WithQuota is that of the deciding limit, or of the client limit if both grant. A client slot granted while
+// the IP limit denies is refunded, so that an IP held back does not use up the budget of the client.
+func acquireLimits(ctx context.Context, dataStore ports.DataStore, cc types.ClientConfig,
+	clientID, clientIP string) (statusCode int, err error) {
+	var limits []*rateLimit
+	if cc.IPRPM > 0 && !cc.BypassIPRateLimit {
+		limits = append(limits, &rateLimit{name: "ip", scope: "IP:" + clientIP, rate: cc.IPRPM, window: cc.IPWindow()})
+	}
+	if cc.ClientRPM > 0 {
+		limits = append(limits, &rateLimit{name: "client", scope: "CLIENT:" + clientID, rate: cc.ClientRPM,
+			window: cc.ClientWindow()})
+	}
+	var g errgroup.Group
+	for _, l := range limits {
+		g.Go(func() error {
+			ctx := ports.WithSlot(ports.WithQuota(ctx, &l.quota), &l.slot)
+			l.ok, l.err = acquire(ctx, dataStore, cc, l.scope, l.rate, l.window)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	for i, l := range limits {
+		if l.quota.Limit != 0 {
+			ports.ReportQuota(ctx, l.quota)
+		}
+		if l.err == nil && l.ok {
+			continue
+		}
+		refundLimits(ctx, dataStore, cc, limits[i+1:])
+		if l.err != nil {
+			log.WithError(l.err).Errorf("failed to acquire %s rate limit", l.name)
+			return acquireErrStatus(l.err, http.StatusInternalServerError), fmt.Errorf("rate limit check failed")
+		}
+		return http.StatusAccepted, fmt.Errorf("%w (%s)", ErrRateLimited, l.name)
+	}
+	return http.StatusAccepted, nil
+}
+
+// refundLimits gives back the slots granted by limits, acquired along with one that decided against the event.
+// Limits granted without a slot, by the FailMode rather than the store, have nothing to give back. Failing to is
+// only logged: the slot is then spent as if the event had gone through.
+func refundLimits(ctx context.Context, dataStore ports.DataStore, cc types.ClientConfig, limits []*rateLimit) {
+	for _, l := range limits {
+		if l.err != nil || !l.ok || l.slot == "" {
+			continue
+		}
+		if err := dataStore.Refund(withRateLimit(ctx, cc, l.rate), l.scope, l.slot, l.rate, l.window); err != nil {
+			log.WithError(err).Warnf("failed to refund %s rate limit", l.name)
+		}
+	}
+}
+
+// acquire calls DataStore.Acquire with the client's rate limit strategy and applies the client's FailMode when the
+// backend fails: fail-open grants the slot, fail-closed returns the error.
+func acquire(ctx context.Context, dataStore ports.DataStore, cc types.ClientConfig,
+	scope string, rate int, window time.Duration) (ok bool, err error) {
+	ctx, span := StartSpan(ctx, "Acquire", attribute.String("scope", scope))
+	defer func() {
+		span.SetAttributes(attribute.Bool("granted", ok))
+		EndSpan(span, err)
+	}()
+	ok, err = dataStore.Acquire(withRateLimit(ctx, cc, rate), scope, rate, window)
+	if failOpen(ctx, cc, err, "rate_limit") {
+		return true, nil
+	}
+	return ok, err
+}
+
+// withRateLimit returns ctx set up for the client's rate limit strategy: token buckets hold Burst tokens, or rate.
+func withRateLimit(ctx context.Context, cc types.ClientConfig, rate int) context.Context {
+	if rl := cc.RateLimit; rl != nil && rl.Strategy == types.RateLimitTokenBucket {
+		capacity := rl.Burst
+		if capacity == 0 {
+			capacity = rate
+		}
+		return ports.WithTokenBucket(ctx, capacity)
+	}
+	return ctx
+}
+
+// failOpen reports whether the data store error err is to be ignored per the client's FailMode: fail-open lets the
+// event through as if the failed step had passed, fail-closed rejects it. A canceled request is never failed open.
+// Each fallback is logged and counted by stage in metrics.FailOpen.
+func failOpen(ctx context.Context, cc types.ClientConfig, err error, stage string) bool {
+	if err == nil || cc.FailMode != types.FailModeOpen || ctx.Err() != nil {
+		return false
+	}
+	log.WithError(err).WithField("stage", stage).Warn("data store failed, failing open")
+	metrics.FailOpen.Add(stage, 1)
+	return true
+}
+
+// acquireErrStatus maps throttling to 503 so callers know to retry; other errors keep the given status.
+func acquireErrStatus(err error, def int) int {
+	if errors.Is(err, types.ErrThrottled) {
+		return http.StatusServiceUnavailable
+	}
+	return def
 }
 
 // ComputeKey generates a quick hash of the given string with fixed length.
@@ -124,16 +480,203 @@ func ComputeKey(s string) string {
 	return fmt.Sprintf("e%d", h.Sum32())
 }
 
-// LoadCachedClientConfig loads client config from cache or store.
-func LoadCachedClientConfig(ctx context.Context, cs ports.ClientStore, id string) (types.ClientConfig, error) {
-	if v, ok := cfgCache.Get(id); ok {
-		return v, nil
+// ScopeKey returns the edge scope key for the payload, or "" if the trigger handling it has no field.
+func ScopeKey(cc types.ClientConfig, payload map[string]any) string {
+	return SelectTriggers(cc, payload)[0].ScopeKey
+}
+
+// TriggerScopeKey returns the edge scope key of trig for the payload. Without ScopeFields it is the key of the
+// field alone; otherwise the values of the ScopeFields are folded in, so every entity they identify (e.g. every
+// host) has its own edge state. A missing scope field counts as null.
+func TriggerScopeKey(trig types.TriggerConfig, payload map[string]any) string {
+	if len(trig.ScopeFields) == 0 {
+		return ComputeKey(trig.FieldExpr)
+	}
+	values := make([]*string, len(trig.ScopeFields))
+	for i, f := range trig.ScopeFields {
+		if v, err := EvalString(f, payload); err == nil {
+			values[i] = v
+		}
+	}
+	return scopeKeyOf(trig.FieldExpr, values)
+}
+
+// ResolveScopeKey returns the edge scope key of the first trigger of cc watching field for the given values of its
+// ScopeFields, by scope field, so that the edge state of an entity (e.g. that of "status" for host "db-1") can be
+// named without an event at hand. Scope fields without a value count as null, as when missing from payloads.
+func ResolveScopeKey(cc types.ClientConfig, field string, values map[string]string) (string, error) {
+	all := cc.AllTriggers()
+	i := slices.IndexFunc(all, func(t types.TriggerConfig) bool { return t.FieldExpr == field })
+	if field == "" || i < 0 {
+		return "", fmt.Errorf("no trigger of client %s watches %q", cc.ClientID, field)
+	}
+	scoped := make([]*string, len(all[i].ScopeFields))
+	for f, v := range values {
+		j := slices.Index(all[i].ScopeFields, f)
+		if j < 0 {
+			return "", fmt.Errorf("%q is not a scope field of the trigger watching %q", f, field)
+		}
+		scoped[j] = &v
+	}
+	return positionedScopeKey(all, i, scopeKeyOf(field, scoped)), nil
+}
+
+// scopeKeyOf returns the scope key of field for the values of the scope fields, nil for those missing.
+func scopeKeyOf(field string, values []*string) string {
+	key := ComputeKey(field)
+	if len(values) == 0 {
+		return key
+	}
+	h := fnv.New64a()
+	for _, v := range values {
+		// Quoting keeps the concatenation unambiguous, and a missing value apart from the string "null"
+		if v != nil {
+			_, _ = h.Write([]byte(strconv.Quote(*v)))
+		} else {
+			_, _ = h.Write([]byte("null"))
+		}
+		_, _ = h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%s_%x", key, h.Sum64())
+}
+
+// PublishContext attaches the scope key, message attributes and trigger value of the outcome to ctx for the
+// publishers (see ports.WithPublishKey, ports.WithPublishAttributes and ports.WithPublishValue).
+func PublishContext(ctx context.Context, o TriggerOutcome, payload map[string]any) context.Context {
+	ctx = ports.WithPublishKey(ctx, o.ScopeKey)
+	if o.Attributes != nil {
+		ctx = ports.WithPublishAttributes(ctx, o.Attributes)
+	}
+	if o.Trigger.FieldExpr == "" {
+		return ctx
+	}
+	if v, err := TriggerValue(o.Trigger, payload); err == nil && v != nil {
+		ctx = ports.WithPublishValue(ctx, RoundNumeric(*v, o.Trigger.Numeric))
 	}
-	cc, err := cs.GetClientConfig(ctx, id)
+	return ctx
+}
+
+// TriggerValue returns the value of the trigger's field in payload (see CoerceTyped), narrowed by its ValueRegex if
+// any; nil if the field is missing, not of the trigger's ValueType, or the regex does not match.
+func TriggerValue(trig types.TriggerConfig, payload map[string]any) (*string, error) {
+	raw, err := EvalAnyCompiled(trig.FieldExpr, payload)
+	if err != nil {
+		return nil, err
+	}
+	v := CoerceTyped(raw, trig.ValueType)
+	if v == nil {
+		return nil, nil
+	}
+	re, err := trig.ValueRegexp()
+	if err != nil || re == nil {
+		return v, err
+	}
+	m := re.FindStringSubmatch(*v)
+	switch {
+	case m == nil:
+		return nil, nil
+	case len(m) > 1:
+		return &m[1], nil
+	default:
+		return &m[0], nil
+	}
+}
+
+// SelectTrigger returns the first trigger handling the payload; see SelectTriggers.
+func SelectTrigger(cc types.ClientConfig, payload map[string]any) types.TriggerConfig {
+	return SelectTriggers(cc, payload)[0].Trigger
+}
+
+// SelectTriggers returns the triggers evaluating the payload, with their scope keys: those of cc.AllTriggers whose
+// field evaluates to a value, or the first trigger if there is none. The result is never empty. The triggers are
+// routed to the target of the payload's route, if any (see RouteTarget).
+func SelectTriggers(cc types.ClientConfig, payload map[string]any) []TriggerOutcome {
+	all := cc.AllTriggers()
+	var selected []TriggerOutcome
+	if len(all) > 1 {
+		for i, t := range all {
+			if v, err := EvalString(t.FieldExpr, payload); err == nil && v != nil {
+				selected = append(selected, TriggerOutcome{Trigger: t, ScopeKey: triggerScopeKey(all, i, payload)})
+			}
+		}
+	}
+	if len(selected) == 0 {
+		selected = []TriggerOutcome{{Trigger: all[0], ScopeKey: triggerScopeKey(all, 0, payload)}}
+	}
+	if target, ok := RouteTarget(cc.Routes, payload); ok {
+		for i := range selected {
+			selected[i].Trigger.Target, selected[i].Trigger.Targets = target, nil
+		}
+	}
+	return selected
+}
+
+// triggerScopeKey is the TriggerScopeKey of all[i], set apart by its position when an earlier trigger watches the
+// same field, so that each trigger has its own edge state.
+func triggerScopeKey(all []types.TriggerConfig, i int, payload map[string]any) string {
+	if all[i].FieldExpr == "" {
+		return ""
+	}
+	return positionedScopeKey(all, i, TriggerScopeKey(all[i], payload))
+}
+
+// positionedScopeKey sets key, a scope key of all[i], apart by the position of the trigger if an earlier trigger
+// watches the same field.
+func positionedScopeKey(all []types.TriggerConfig, i int, key string) string {
+	for _, t := range all[:i] {
+		if t.FieldExpr == all[i].FieldExpr {
+			return fmt.Sprintf("%s_t%d", key, i)
+		}
+	}
+	return key
+}
+
+// cfgLoads coalesces the concurrent store reads of the config of a client on cache misses.
+var cfgLoads singleflight.Group
+
+// LoadCachedClientConfig loads client config from cache or store. Concurrent misses for the same client share a
+// single store read.
+func LoadCachedClientConfig(ctx context.Context, cs ports.ClientStore, id string) (cc types.ClientConfig, err error) {
+	return loadClientConfig(ctx, cs, id, cfgCache, &cfgLoads)
+}
+
+// loadClientConfig is LoadCachedClientConfig with the given cache, nil for none, and coalesced reads.
+func loadClientConfig(ctx context.Context, cs ports.ClientStore, id string, cache *TTL[string, types.ClientConfig],
+	loads *singleflight.Group) (cc types.ClientConfig, err error) {
+	ctx, span := StartSpan(ctx, "LoadClientConfig", AttrClientID.String(id))
+	defer func() { EndSpan(span, err) }()
+	if cache != nil {
+		if v, ok := cache.Get(id); ok {
+			span.SetAttributes(attribute.Bool("cached", true))
+			return v, nil
+		}
+	}
+	// The read is shared, so it must not fail with the cancellation of the request that happens to make it
+	v, err, shared := loads.Do(id, func() (any, error) {
+		cc, err := cs.GetClientConfig(context.WithoutCancel(ctx), id)
+		if err != nil {
+			return types.ClientConfig{}, err
+		}
+		// Compiles the payload schema up front, so that requests do not pay for it
+		if _, err := cc.Schema(); err != nil {
+			return types.ClientConfig{}, fmt.Errorf("compile payload_schema: %w", err)
+		}
+		// Caches the client config info for 5 minutes
+		if cache != nil {
+			cache.Set(id, cc, 300*time.Second)
+		}
+		return cc, nil
+	})
+	span.SetAttributes(attribute.Bool("shared", shared))
 	if err != nil {
 		return types.ClientConfig{}, err
 	}
-	// Caches the client config info for 5 minutes
-	cfgCache.Set(id, cc, 300*time.Second)
-	return cc, nil
+	return v.(types.ClientConfig), nil
+}
+
+// InvalidateClientConfig drops the cached config of the client, so that the next request of the process reads it
+// from the store. Other processes keep theirs until it expires.
+func InvalidateClientConfig(id string) {
+	cfgLoads.Forget(id)
+	cfgCache.Delete(id)
 }
@@ -0,0 +1,539 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/metrics"
+	"enoti/internal/types"
+	"errors"
+	"expvar"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func (s *UnitTestSuite) TestRunSkipsEdgeState() {
+	ctx := context.Background()
+	payload := map[string]any{"event": map[string]any{"type": "up"}, "pass": true}
+
+	cases := []struct {
+		name string
+		cc   types.ClientConfig
+	}{
+		{"no trigger", types.ClientConfig{}},
+		{"passthrough", types.ClientConfig{
+			Passthrough: types.Passthrough{FieldExpr: "pass"},
+			Trigger:     types.TriggerConfig{FieldExpr: "event.type"},
+		}},
+		{"edge state disabled", types.ClientConfig{
+			EdgeState: types.EdgeStateDisabled,
+			Trigger:   types.TriggerConfig{FieldExpr: "event.type"},
+		}},
+	}
+	for _, c := range cases {
+		store := newMemDataStore()
+		action, _, _, err := Run(ctx, "c", "127.0.0.1", c.cc, store, payload)
+		s.NoError(err, c.name)
+		s.Equal(ForwardedAsIs, action, c.name)
+		s.Equal(0, store.loads, c.name)
+		s.Equal(0, store.upserts, c.name)
+	}
+
+	// With edge state on, the same trigger does touch the store
+	store := newMemDataStore()
+	action, _, _, err := Run(ctx, "c", "127.0.0.1", types.ClientConfig{
+		Trigger: types.TriggerConfig{FieldExpr: "event.type"},
+	}, store, payload)
+	s.NoError(err)
+	s.Equal(EdgeTriggeredForward, action)
+	s.Equal(1, store.loads)
+	s.Equal(1, store.upserts)
+}
+
+// BenchmarkRunEdgeState reports the backend edge calls per event with edge state on and off.
+func BenchmarkRunEdgeState(b *testing.B) {
+	for _, mode := range []string{types.EdgeStateEnabled, types.EdgeStateDisabled} {
+		b.Run(mode, func(b *testing.B) {
+			ctx := context.Background()
+			store := newMemDataStore()
+			cc := types.ClientConfig{EdgeState: mode, Trigger: types.TriggerConfig{FieldExpr: "v"}}
+			values := []string{"a", "b"}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _, _, _ = Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{"v": values[i%2]})
+			}
+			b.ReportMetric(float64(store.loads+store.upserts)/float64(b.N), "edge-calls/op")
+		})
+	}
+}
+
+func (s *UnitTestSuite) TestRunThrottledAcquire() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	store.acquireErr = types.Err(types.ErrThrottled, errors.New("ProvisionedThroughputExceededException"), "")
+	cc := types.ClientConfig{ClientRPM: 10}
+
+	// Default is fail-closed
+	_, statusCode, _, err := Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{})
+	s.Error(err)
+	s.Equal(http.StatusServiceUnavailable, statusCode)
+
+	cc.FailMode = types.FailModeOpen
+	action, _, _, err := Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{})
+	s.NoError(err)
+	s.Equal(ForwardedAsIs, action)
+
+	// Hard errors fail open too
+	store.acquireErr = errors.New("connection refused")
+	_, _, _, err = Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{})
+	s.NoError(err)
+}
+
+func (s *UnitTestSuite) TestRunFailMode() {
+	ctx := context.Background()
+	payload := map[string]any{"v": "a"}
+	cc := types.ClientConfig{
+		ClientRPM: 10,
+		Dedup:     &types.DedupConfig{WindowSeconds: 60},
+		Trigger:   types.TriggerConfig{FieldExpr: "v"},
+	}
+	down := errors.New("connection refused")
+
+	cases := []struct {
+		name             string
+		acquire, data    error
+		closedStatusCode int
+		stage            string
+	}{
+		{"rate limit", down, nil, http.StatusInternalServerError, "rate_limit"},
+		{"throttled rate limit", types.Err(types.ErrThrottled, down, ""), nil, http.StatusServiceUnavailable,
+			"rate_limit"},
+		{"dedup and edge", nil, down, http.StatusInternalServerError, "dedup"},
+	}
+	for _, c := range cases {
+		store := newMemDataStore()
+		store.acquireErr, store.dataErr = c.acquire, c.data
+
+		cc.FailMode = types.FailModeClosed
+		_, statusCode, _, err := Run(ctx, "c", "127.0.0.1", cc, store, payload)
+		s.Error(err, c.name)
+		s.Equal(c.closedStatusCode, statusCode, c.name)
+
+		cc.FailMode = types.FailModeOpen
+		before := failOpenCount(c.stage)
+		action, statusCode, _, err := Run(ctx, "c", "127.0.0.1", cc, store, payload)
+		s.NoError(err, c.name)
+		s.Equal(http.StatusAccepted, statusCode, c.name)
+		s.Greater(failOpenCount(c.stage), before, "%s: the fallback is counted", c.name)
+		if c.data != nil {
+			s.Equal(ForwardedAsIs, action, "%s: forwarded without the edge state", c.name)
+		} else {
+			s.Equal(EdgeTriggeredForward, action, c.name)
+		}
+	}
+
+	// A failed edge evaluation alone fails open as well
+	cc.Dedup = nil
+	store := newMemDataStore()
+	store.dataErr = down
+	edgeFallbacks := failOpenCount("edge")
+	action, _, _, err := Run(ctx, "c", "127.0.0.1", cc, store, payload)
+	s.NoError(err)
+	s.Equal(ForwardedAsIs, action)
+	s.Greater(failOpenCount("edge"), edgeFallbacks)
+
+	// A canceled request is never failed open
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, _, _, err = Run(canceled, "c", "127.0.0.1", cc, store, payload)
+	s.Error(err)
+}
+
+// failOpenCount returns the number of fail-open fallbacks of stage so far.
+func failOpenCount(stage string) int64 {
+	if v, ok := metrics.FailOpen.Get(stage).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func (s *UnitTestSuite) TestRunConsistentEdgeReads() {
+	ctx := context.Background()
+	payload := map[string]any{"v": "a"}
+	cc := types.ClientConfig{Trigger: types.TriggerConfig{FieldExpr: "v"}}
+
+	store := newMemDataStore()
+	_, _, _, err := Run(ctx, "c", "127.0.0.1", cc, store, payload)
+	s.NoError(err)
+	s.Nil(store.consistentRead, "no override without a client setting")
+
+	for _, consistent := range []bool{true, false} {
+		cc.ConsistentEdgeReads = &consistent
+		store = newMemDataStore()
+		_, _, _, err = Run(ctx, "c", "127.0.0.1", cc, store, payload)
+		s.NoError(err)
+		s.Require().NotNil(store.consistentRead)
+		s.Equal(consistent, *store.consistentRead)
+	}
+}
+
+func (s *UnitTestSuite) TestRunTargetRateLimited() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	cc := types.ClientConfig{Trigger: types.TriggerConfig{
+		FieldExpr: "v",
+		Target:    types.TargetConfig{SNSArn: "arn:aws:sns:us-east-1:000000000000:t", SNSRPM: 1},
+	}}
+
+	action, statusCode, _, err := Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{"v": "a"})
+	s.NoError(err)
+	s.Equal(EdgeTriggeredForward, action)
+	s.Equal(http.StatusAccepted, statusCode)
+
+	action, statusCode, _, err = Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{"v": "b"})
+	s.NoError(err)
+	s.Equal(TargetRateLimited, action)
+	s.Equal(http.StatusTooManyRequests, statusCode)
+	s.Equal("target_rate_limited", StatusTextMap[action])
+}
+
+func (s *UnitTestSuite) TestRunTokenBucketBurst() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	cc := types.ClientConfig{ClientRPM: 2}
+
+	// Fixed window: the burst is cut at the limit
+	for i := range 3 {
+		_, _, _, err := Run(ctx, "fixed", "127.0.0.1", cc, store, map[string]any{})
+		s.Equal(i < 2, err == nil, "request %d", i)
+	}
+
+	// Token bucket: a burst of Burst passes at the same average rate, the next request waits for a refill
+	cc.RateLimit = &types.RateLimitConfig{Strategy: types.RateLimitTokenBucket, Burst: 5}
+	for i := range 5 {
+		action, _, _, err := Run(ctx, "bucket", "127.0.0.1", cc, store, map[string]any{})
+		s.NoError(err)
+		s.Equal(ForwardedAsIs, action, "request %d", i)
+	}
+	_, _, _, err := Run(ctx, "bucket", "127.0.0.1", cc, store, map[string]any{})
+	s.EqualError(err, "rate limit (client)")
+}
+
+func (s *UnitTestSuite) TestRunRateWindows() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	target := types.TargetConfig{SNSArn: "arn:aws:sns:us-east-1:000000000000:t", SNSRPM: 1}
+	cc := types.ClientConfig{IPRPM: 1, ClientRPM: 1, Trigger: types.TriggerConfig{FieldExpr: "v", Target: target}}
+
+	_, _, _, err := Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{"v": "a"})
+	s.NoError(err)
+	s.Equal(time.Minute, store.windows["IP:127.0.0.1"])
+	s.Equal(time.Minute, store.windows["CLIENT:c"])
+	s.Equal(time.Minute, store.windows["TARGET:c:"+target.SNSArn])
+
+	cc.IPWindowSeconds, cc.ClientWindowSeconds, cc.Trigger.Target.SNSWindowSeconds = 10, 20, 30
+	_, _, _, err = Run(ctx, "d", "127.0.0.2", cc, store, map[string]any{"v": "a"})
+	s.NoError(err)
+	s.Equal(10*time.Second, store.windows["IP:127.0.0.2"])
+	s.Equal(20*time.Second, store.windows["CLIENT:d"])
+	s.Equal(30*time.Second, store.windows["TARGET:d:"+target.SNSArn])
+}
+
+func (s *UnitTestSuite) TestRunDedup() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	cc := types.ClientConfig{Dedup: &types.DedupConfig{Fields: []string{"id", "host"}, WindowSeconds: 60}}
+
+	run := func(payload map[string]any) Action {
+		action, _, _, err := Run(ctx, "c", "127.0.0.1", cc, store, payload)
+		s.NoError(err)
+		return action
+	}
+	s.Equal(ForwardedAsIs, run(map[string]any{"id": "1", "host": "a", "v": 1}))
+	s.Equal(SuppressDedup, run(map[string]any{"id": "1", "host": "a", "v": 2}), "other fields do not matter")
+	s.Equal(ForwardedAsIs, run(map[string]any{"id": "1", "host": "b"}))
+	s.Equal(ForwardedAsIs, run(map[string]any{"id": "1"}))
+	s.Equal(SuppressDedup, run(map[string]any{"id": "1"}))
+
+	// Events without any of the fields are not deduplicated
+	s.Equal(ForwardedAsIs, run(map[string]any{"v": 1}))
+	s.Equal(ForwardedAsIs, run(map[string]any{"v": 1}))
+
+	// Passthrough events skip dedup
+	cc.Passthrough = types.Passthrough{FieldExpr: "pass"}
+	s.Equal(ForwardedAsIs, run(map[string]any{"id": "1", "pass": true}))
+}
+
+func (s *UnitTestSuite) TestRunTriggers() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	cc := types.ClientConfig{Triggers: []types.TriggerConfig{
+		{FieldExpr: "status"},
+		{FieldExpr: "region_health"},
+		// Same field as the first trigger, with its own edge state
+		{FieldExpr: "status", OnlyValues: []string{"down"}},
+	}}
+	run := func(payload map[string]any) []Action {
+		outcomes, _, err := RunTriggers(ctx, "c", "127.0.0.1", cc, store, payload)
+		s.NoError(err)
+		var actions []Action
+		for _, o := range outcomes {
+			actions = append(actions, o.Action)
+		}
+		return actions
+	}
+
+	s.Equal([]Action{EdgeTriggeredForward, EdgeTriggeredForward, NoOp}, run(map[string]any{"status": "up", "region_health": "ok"}))
+	s.Equal([]Action{NoOp, EdgeTriggeredForward, NoOp}, run(map[string]any{"status": "up", "region_health": "degraded"}))
+	s.Equal([]Action{EdgeTriggeredForward, EdgeTriggeredForward}, run(map[string]any{"status": "down"}))
+	s.Equal([]Action{EdgeTriggeredForward}, run(map[string]any{"region_health": "ok"}))
+	s.Equal([]Action{NoOp}, run(map[string]any{}), "no trigger field present")
+
+	action, _, _, err := Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{"status": "down", "region_health": "down"})
+	s.NoError(err)
+	s.Equal(EdgeTriggeredForward, action, "the first forwarding outcome")
+}
+
+func (s *UnitTestSuite) TestRunScopeFields() {
+	ctx := context.Background()
+	run := func(cc types.ClientConfig, store *memDataStore, host, status string) Action {
+		action, _, _, err := Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{"host": host, "status": status})
+		s.NoError(err)
+		return action
+	}
+
+	cc := types.ClientConfig{Trigger: types.TriggerConfig{FieldExpr: "status", ScopeFields: []string{"host"}}}
+	store := newMemDataStore()
+	s.Equal(EdgeTriggeredForward, run(cc, store, "a", "down"))
+	s.Equal(EdgeTriggeredForward, run(cc, store, "b", "down"), "host b has its own edge state")
+	s.Equal(NoOp, run(cc, store, "a", "down"))
+	s.Equal(EdgeTriggeredForward, run(cc, store, "b", "up"))
+	s.Equal(NoOp, run(cc, store, "a", "down"), "host a is not affected by host b")
+
+	// Without ScopeFields, the hosts share a single edge state
+	cc.Trigger.ScopeFields = nil
+	store = newMemDataStore()
+	s.Equal(EdgeTriggeredForward, run(cc, store, "a", "down"))
+	s.Equal(NoOp, run(cc, store, "b", "down"))
+}
+
+func (s *UnitTestSuite) TestTriggerScopeKey() {
+	trig := types.TriggerConfig{FieldExpr: "status"}
+	s.Equal(ComputeKey("status"), TriggerScopeKey(trig, map[string]any{"host": "a"}))
+
+	trig.ScopeFields = []string{"host", "region"}
+	key := func(payload map[string]any) string { return TriggerScopeKey(trig, payload) }
+	s.Equal(key(map[string]any{"host": "a", "region": "x"}), key(map[string]any{"region": "x", "host": "a", "v": 1}))
+	s.NotEqual(key(map[string]any{"host": "a", "region": "x"}), key(map[string]any{"host": "b", "region": "x"}))
+	s.NotEqual(key(map[string]any{"host": "ax"}), key(map[string]any{"host": "a", "region": "x"}))
+	s.NotEqual(key(map[string]any{"host": "null"}), key(map[string]any{}))
+}
+
+func (s *UnitTestSuite) TestResolveScopeKey() {
+	cc := types.ClientConfig{ClientID: "c", Triggers: []types.TriggerConfig{
+		{FieldExpr: "status", ScopeFields: []string{"host", "region"}},
+		{FieldExpr: "cpu"},
+		{FieldExpr: "status"},
+	}}
+	payload := map[string]any{"status": "down", "host": "db-1", "cpu": 97}
+	keys := map[string]string{}
+	for _, o := range SelectTriggers(cc, payload) {
+		if _, ok := keys[o.Trigger.FieldExpr]; !ok {
+			keys[o.Trigger.FieldExpr] = o.ScopeKey
+		}
+	}
+
+	key, err := ResolveScopeKey(cc, "status", map[string]string{"host": "db-1"})
+	s.Require().NoError(err)
+	s.Equal(keys["status"], key, "the region missing from the payload counts as null")
+	key, err = ResolveScopeKey(cc, "cpu", nil)
+	s.Require().NoError(err)
+	s.Equal(keys["cpu"], key)
+	key, err = ResolveScopeKey(cc, "status", map[string]string{"host": "db-1", "region": "eu"})
+	s.Require().NoError(err)
+	s.NotEqual(keys["status"], key)
+
+	_, err = ResolveScopeKey(cc, "memory", nil)
+	s.ErrorContains(err, "no trigger")
+	_, err = ResolveScopeKey(cc, "cpu", map[string]string{"host": "db-1"})
+	s.ErrorContains(err, "not a scope field")
+}
+
+func (s *UnitTestSuite) TestRunEventTime() {
+	cc := types.ClientConfig{Trigger: types.TriggerConfig{FieldExpr: "status"}}
+	store := newMemDataStore()
+	t0 := time.Unix(1700000000, 0)
+	run := func(at time.Time, status string) Action {
+		ctx := WithEventTime(context.Background(), at)
+		action, _, _, err := Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{"status": status})
+		s.NoError(err)
+		return action
+	}
+
+	s.Equal(EdgeTriggeredForward, run(t0, "up"))
+	s.Equal(EdgeTriggeredForward, run(t0.Add(2*time.Second), "down"))
+	s.Equal(NoOp, run(t0.Add(time.Second), "up"), "sent before the change to down")
+	edge, _, err := store.Load(context.Background(), "c", ComputeKey("status"))
+	s.Require().NoError(err)
+	s.Equal("down", edge.LastValue)
+	s.Equal(t0.Add(2*time.Second).Unix(), edge.LastChangeTS, "changes are timed by the event")
+	s.Equal(EdgeTriggeredForward, run(t0.Add(3*time.Second), "up"))
+}
+
+func (s *UnitTestSuite) TestRunThreshold() {
+	ctx := context.Background()
+	cc := types.ClientConfig{Trigger: types.TriggerConfig{
+		FieldExpr: "cpu", Type: types.TriggerTypeThreshold, Operator: "gt", Threshold: 90,
+	}}
+	store := newMemDataStore()
+	run := func(cpu any) Action {
+		action, _, _, err := Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{"cpu": cpu})
+		s.NoError(err)
+		return action
+	}
+
+	s.Equal(NoOp, run(50), "starting below the threshold is no edge")
+	s.Equal(EdgeTriggeredForward, run(95), "crossing up")
+	s.Equal(NoOp, run(97), "staying above")
+	s.Equal(NoOp, run(90), "crossing back down is not forwarded by default")
+	s.Equal(NoOp, run("n/a"), "non-numeric values are ignored")
+	s.Equal(EdgeTriggeredForward, run("91.5"), "crossing up again")
+
+	cc.Trigger.ForwardRecovery = true
+	store = newMemDataStore()
+	s.Equal(EdgeTriggeredForward, run(95))
+	s.Equal(NoOp, run(99))
+	s.Equal(EdgeTriggeredForward, run(10), "crossing back down")
+	s.Equal(NoOp, run(20))
+}
+
+func (s *UnitTestSuite) TestTriggerValueRegex() {
+	value := func(trig types.TriggerConfig, msg string) *string {
+		v, err := TriggerValue(trig, map[string]any{"msg": msg})
+		s.NoError(err)
+		return v
+	}
+	group := types.TriggerConfig{FieldExpr: "msg", ValueRegex: `status=(\d)\d\d`}
+	s.Equal("5", *value(group, "GET / status=503 in 3ms"))
+	s.Equal("2", *value(group, "GET / status=200 in 1ms"))
+	s.Nil(value(group, "connection reset"))
+
+	whole := types.TriggerConfig{FieldExpr: "msg", ValueRegex: `[45]\d\d`}
+	s.Equal("404", *value(whole, "GET /x 404"))
+	s.Equal("GET /x 404", *value(types.TriggerConfig{FieldExpr: "msg"}, "GET /x 404"))
+}
+
+func (s *UnitTestSuite) TestRunValueRegex() {
+	ctx := context.Background()
+	cc := types.ClientConfig{Trigger: types.TriggerConfig{FieldExpr: "msg", ValueRegex: `status=(\d)\d\d`}}
+	store := newMemDataStore()
+	run := func(msg string) Action {
+		action, _, _, err := Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{"msg": msg})
+		s.NoError(err)
+		return action
+	}
+	s.Equal(EdgeTriggeredForward, run("status=500 upstream"))
+	s.Equal(NoOp, run("status=503 timeout"), "same class")
+	s.Equal(NoOp, run("no status"), "no match, no edge")
+	s.Equal(EdgeTriggeredForward, run("status=200 ok"))
+	s.Equal(2, store.upserts, "a non-matching value leaves the state untouched")
+}
+
+func (s *UnitTestSuite) TestRunDisabledClient() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	disabled := false
+	cc := types.ClientConfig{ClientRPM: 10, Enabled: &disabled, Trigger: types.TriggerConfig{FieldExpr: "v"}}
+
+	action, statusCode, _, err := Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{"v": "a"})
+	s.NoError(err)
+	s.Equal(ClientDisabled, action)
+	s.Equal(http.StatusForbidden, statusCode)
+	// Nothing consumed or loaded
+	s.Empty(store.counts)
+	s.Equal(0, store.loads)
+
+	enabled := true
+	for _, flag := range []*bool{&enabled, nil} {
+		cc.Enabled = flag
+		action, statusCode, _, err = Run(ctx, "c", "127.0.0.1", cc, store, map[string]any{"v": "a"})
+		s.NoError(err)
+		s.NotEqual(ClientDisabled, action)
+		s.Equal(http.StatusAccepted, statusCode)
+	}
+}
+
+func (s *UnitTestSuite) TestRunRefundsClientLimit() {
+	ctx := context.Background()
+	cc := types.ClientConfig{IPRPM: 1, ClientRPM: 2}
+	store := newMemDataStore()
+	run := func(ip string) error {
+		_, _, _, err := Run(ctx, "c", ip, cc, store, map[string]any{})
+		return err
+	}
+
+	s.NoError(run("10.0.0.1"))
+	// The IP limit denies: the client slot acquired along with it is given back
+	s.EqualError(run("10.0.0.1"), "rate limit (ip)")
+	s.Equal(1, store.counts["CLIENT:c"])
+	s.NoError(run("10.0.0.2"))
+	s.EqualError(run("10.0.0.3"), "rate limit (client)")
+
+	// Token buckets get the token back
+	cc.RateLimit = &types.RateLimitConfig{Strategy: types.RateLimitTokenBucket}
+	s.NoError(run("10.0.1.1"))
+	s.EqualError(run("10.0.1.1"), "rate limit (ip)")
+	s.NoError(run("10.0.1.2"))
+	s.EqualError(run("10.0.1.3"), "rate limit (client)")
+}
+
+// barrierDataStore holds every Acquire until n of them are in flight, so that only concurrent calls return.
+type barrierDataStore struct {
+	*memDataStore
+	arrived sync.WaitGroup
+}
+
+func (b *barrierDataStore) Acquire(ctx context.Context, scope string, rate int, window time.Duration) (bool, error) {
+	b.arrived.Done()
+	b.arrived.Wait()
+	return b.memDataStore.Acquire(ctx, scope, rate, window)
+}
+
+func (s *UnitTestSuite) TestRunAcquiresLimitsConcurrently() {
+	ctx := context.Background()
+	cc := types.ClientConfig{IPRPM: 2, ClientRPM: 1}
+	store := &barrierDataStore{memDataStore: newMemDataStore()}
+	run := func(ip string) error {
+		store.arrived.Add(2)
+		done := make(chan error, 1)
+		go func() {
+			_, _, _, err := Run(ctx, "c", ip, cc, store, map[string]any{})
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(5 * time.Second):
+			s.FailNow("the IP and client limits were not acquired concurrently")
+			return nil
+		}
+	}
+
+	s.NoError(run("10.0.0.1"))
+	// The client limit denies
+	s.EqualError(run("10.0.0.1"), "rate limit (client)")
+	// Both deny: the IP limit takes precedence
+	err := run("10.0.0.1")
+	s.ErrorIs(err, ErrRateLimited)
+	s.EqualError(err, "rate limit (ip)")
+	// Another IP is only held back by the client limit
+	s.EqualError(run("10.0.0.2"), "rate limit (client)")
+
+	// Checks failing take precedence in the same order, and fail closed
+	store.acquireErr = types.Err(types.ErrThrottled, errors.New("ProvisionedThroughputExceededException"), "")
+	store.arrived.Add(2)
+	_, statusCode, _, err := Run(ctx, "c", "10.0.0.3", cc, store, map[string]any{})
+	s.EqualError(err, "rate limit check failed")
+	s.Equal(http.StatusServiceUnavailable, statusCode)
+}
@@ -0,0 +1,80 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"enoti/internal/ports"
+	"enoti/internal/types"
+)
+
+// positionSuffix matches the suffix triggerScopeKey appends to the keys of a trigger repeating an earlier field.
+var positionSuffix = regexp.MustCompile(`_t\d+$`)
+
+// TriggerForScopeKey returns the trigger of cc whose edge states are kept under scopeKey, the reverse of the scope
+// keys of SelectTriggers.
+func TriggerForScopeKey(cc types.ClientConfig, scopeKey string) (types.TriggerConfig, bool) {
+	all := cc.AllTriggers()
+	for i, t := range all {
+		if t.FieldExpr == "" {
+			continue
+		}
+		rest, ok := strings.CutPrefix(scopeKey, ComputeKey(t.FieldExpr))
+		if !ok || (rest != "" && rest[0] != '_') {
+			continue
+		}
+		repeated := false
+		for _, earlier := range all[:i] {
+			repeated = repeated || earlier.FieldExpr == t.FieldExpr
+		}
+		if repeated == strings.HasSuffix(rest, fmt.Sprintf("_t%d", i)) && (repeated || !positionSuffix.MatchString(rest)) {
+			return t, true
+		}
+	}
+	return types.TriggerConfig{}, false
+}
+
+// AggregateDue reports whether the edge of an aggregating trigger holds flips that were never sent, at least
+// AggregateMinItems of them, and its flapping window, as well as any aggregate cooldown, is over at now. Such flips
+// are otherwise only dropped by the next flip of the scope, which starts a new window.
+func AggregateDue(trig types.TriggerConfig, edge *types.Edge, now int64) bool {
+	f := trig.Flapping
+	if f == nil || f.AggregateAt == 0 || len(edge.Recent) < f.AggregateMinItems {
+		return false
+	}
+	return f.WindowClosed(edge.WindowStart, now) && now >= edge.AggUntilTS && hasUnsentFlips(f, edge)
+}
+
+// hasUnsentFlips reports whether Recent holds flips beyond those tolerated by SuppressBelow and a lone flip opening
+// the window, which was forwarded as an edge.
+func hasUnsentFlips(f *types.FlapConfig, edge *types.Edge) bool {
+	if len(edge.Recent) == 0 || edge.FlipCount <= f.SuppressBelow {
+		return false
+	}
+	return len(edge.Recent) > 1 || edge.Recent[0].At != edge.WindowStart || f.SuppressBelow > 0
+}
+
+// FlushAggregate builds the aggregate of the unsent flips of the edge, loaded with version ver, redacted per
+// WithRedactFields, and clears them under CAS, so that concurrent flushes send it only once. It returns nil if there is nothing to send or the CAS
+// was lost to a concurrent update.
+func FlushAggregate(ctx context.Context, store ports.DataStore, clientID string, trig types.TriggerConfig,
+	edge *types.Edge, ver int64) (map[string]any, error) {
+	f := trig.Flapping
+	if f == nil || !hasUnsentFlips(f, edge) {
+		return nil, nil
+	}
+	now := clockNow(ctx).Unix()
+	next := *edge
+	agg := BuildAggregate(&next, f.AggregateMaxItems, redactFields(ctx)...)
+	next.AggUntilTS = now + int64(f.AggregateCooldownSeconds)
+	next.LastAggFingerprint = AggregateFingerprint(next.Recent)
+	next.LastAggTS = now
+	next.Recent = nil
+	ok, err := store.UpsertCAS(withFlapWindow(ctx, trig), clientID, edge.ScopeKey, ver, next)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return agg, nil
+}
@@ -0,0 +1,109 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/types"
+	"time"
+)
+
+func (s *UnitTestSuite) TestTriggerForScopeKey() {
+	cc := types.ClientConfig{Triggers: []types.TriggerConfig{
+		{FieldExpr: "status", ScopeFields: []string{"host"}},
+		{FieldExpr: "region"},
+		{FieldExpr: "status", OnlyValues: []string{"down"}},
+	}}
+	payload := map[string]any{"status": "up", "region": "ok", "host": "a"}
+	for i, o := range SelectTriggers(cc, payload) {
+		trig, ok := TriggerForScopeKey(cc, o.ScopeKey)
+		s.True(ok, o.ScopeKey)
+		s.Equal(cc.Triggers[i], trig, o.ScopeKey)
+	}
+	_, ok := TriggerForScopeKey(cc, ComputeKey("latency"))
+	s.False(ok)
+}
+
+func (s *UnitTestSuite) TestFlushAggregate() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	trig := types.TriggerConfig{FieldExpr: "v", Flapping: &types.FlapConfig{WindowSeconds: 10, AggregateAt: 5}}
+	t := time.Unix(1_700_000_000, 0)
+	SetTimNowFn(func() time.Time { return t })
+	defer RestoreTimeNow()
+
+	for i, v := range []string{"a", "b", "a", "b"} {
+		t = t.Add(time.Second)
+		action, _, err := EvaluateEdgeAndFlap(ctx, store, "c", "k", v, trig, map[string]any{"v": v})
+		s.NoError(err)
+		if i == 0 {
+			s.Equal(EdgeTriggeredForward, action)
+		} else {
+			s.Equal(SuppressFlapping, action)
+		}
+	}
+
+	edge, ver, err := store.Load(ctx, "c", "k")
+	s.NoError(err)
+	s.False(AggregateDue(trig, edge, EpochTime()), "window still open")
+	t = t.Add(10 * time.Second)
+	s.True(AggregateDue(trig, edge, EpochTime()))
+
+	agg, err := FlushAggregate(ctx, store, "c", trig, edge, ver)
+	s.NoError(err)
+	s.Equal("flap_aggregate", agg["type"])
+	s.Equal(3, agg["flip_count"])
+
+	// Flushed once only, even from a stale load
+	agg, err = FlushAggregate(ctx, store, "c", trig, edge, ver)
+	s.NoError(err)
+	s.Nil(agg)
+	edge, _, _ = store.Load(ctx, "c", "k")
+	s.Empty(edge.Recent)
+	s.False(AggregateDue(trig, edge, EpochTime()))
+
+	// The next flip opens a new window as usual
+	action, _, err := EvaluateEdgeAndFlap(ctx, store, "c", "k", "a", trig, map[string]any{"v": "a"})
+	s.NoError(err)
+	s.Equal(EdgeTriggeredForward, action)
+	edge, _, _ = store.Load(ctx, "c", "k")
+	s.False(AggregateDue(trig, edge, EpochTime()+60), "the flip opening the window was forwarded")
+}
+
+func (s *UnitTestSuite) TestAggregateMinItems() {
+	ctx := context.Background()
+	trig := types.TriggerConfig{FieldExpr: "v", Flapping: &types.FlapConfig{
+		WindowSeconds: 10, AggregateAt: 4, AggregateMinItems: 3,
+	}}
+	t := time.Unix(1_700_000_000, 0)
+	SetTimNowFn(func() time.Time { return t })
+	defer RestoreTimeNow()
+
+	flip := func(store *memDataStore, values ...string) []Action {
+		var actions []Action
+		for _, v := range values {
+			t = t.Add(time.Second)
+			action, _, err := EvaluateEdgeAndFlap(ctx, store, "c", "k", v, trig, map[string]any{"v": v})
+			s.NoError(err)
+			actions = append(actions, action)
+		}
+		return actions
+	}
+	due := func(store *memDataStore) bool {
+		edge, _, err := store.Load(ctx, "c", "k")
+		s.NoError(err)
+		return AggregateDue(trig, edge, EpochTime()+10)
+	}
+
+	// Fewer than the minimum buffered at the end of the window: held
+	store := newMemDataStore()
+	s.Equal([]Action{EdgeTriggeredForward, SuppressFlapping, SuppressFlapping}, flip(store, "a", "b", "a"))
+	s.False(due(store))
+
+	// At the minimum: flushed
+	store = newMemDataStore()
+	s.Equal([]Action{EdgeTriggeredForward, SuppressFlapping, SuppressFlapping, SuppressFlapping},
+		flip(store, "a", "b", "a", "b"))
+	s.True(due(store))
+
+	// Inline, the aggregate still fires at aggregate_at
+	s.Equal([]Action{AggregateSent}, flip(store, "a"))
+}
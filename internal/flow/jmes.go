@@ -1,7 +1,13 @@
 package flow
 
 import (
+	"enoti/internal/types"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	json "github.com/goccy/go-json"
 
@@ -20,21 +26,176 @@ func EvalAny(expression string, payload map[string]any) (any, error) {
 	return v, nil
 }
 
-// EvalString coerces the selection to string; primitives are JSON-encoded if needed.
-func EvalString(expression string, payload map[string]any) (*string, error) {
-	v, err := EvalAny(expression, payload)
+// maxCompiledExpressions bounds compiledExpressions. Expressions come from client configs, so the bound is only
+// reached if configs keep changing them; later expressions are then compiled on every use.
+const maxCompiledExpressions = 4096
+
+var (
+	// compiledExpressions caches the compiled JMESPath expressions by source.
+	compiledExpressions sync.Map // string -> *jmespath.JMESPath
+	numCompiled         atomic.Int32
+)
+
+// compileExpression returns the compiled expression, compiling it on first use. Invalid expressions are not cached.
+func compileExpression(expression string) (*jmespath.JMESPath, error) {
+	if c, ok := compiledExpressions.Load(expression); ok {
+		return c.(*jmespath.JMESPath), nil
+	}
+	c, err := jmespath.Compile(expression)
 	if err != nil {
 		return nil, err
 	}
-	if v == nil {
-		return nil, nil
+	if numCompiled.Load() >= maxCompiledExpressions {
+		return c, nil
 	}
+	actual, loaded := compiledExpressions.LoadOrStore(expression, c)
+	if !loaded {
+		numCompiled.Add(1)
+	}
+	return actual.(*jmespath.JMESPath), nil
+}
+
+// EvalAnyCompiled is EvalAny with the expression compiled once and reused by later calls, rather than parsed on
+// every call.
+func EvalAnyCompiled(expression string, payload map[string]any) (any, error) {
+	c, err := compileExpression(expression)
+	if err != nil {
+		return nil, fmt.Errorf("jmespath: %w", err)
+	}
+	v, err := c.Search(payload)
+	if err != nil {
+		return nil, fmt.Errorf("jmespath: %w", err)
+	}
+	return v, nil
+}
+
+// EvalString evaluates the expression and coerces the selection to a string with CoerceString.
+func EvalString(expression string, payload map[string]any) (*string, error) {
+	v, err := EvalAnyCompiled(expression, payload)
+	if err != nil {
+		return nil, err
+	}
+	return CoerceString(v), nil
+}
+
+// CoerceString converts a value decoded from JSON to the string edges are detected on, so that the same value
+// always yields the same string, however the payload encoded it:
+//   - strings are kept as is;
+//   - numbers, of any Go type or json.Number, are formatted as a float64 in the shortest form that reads back the
+//     same, without exponent from 1e-6 to 1e21 ("42" for 42, 42.0 and 4.2e1; "0.5"; "1e+21");
+//   - booleans are "true" or "false";
+//   - null is nil: the field is absent, and makes no edge;
+//   - arrays and objects are JSON-encoded, object keys sorted.
+//
+// The string "42" and the number 42 thus yield the same value; see types.TriggerConfig.ValueType to tell them apart.
+func CoerceString(v any) *string {
+	var s string
 	switch t := v.(type) {
+	case nil:
+		return nil
 	case string:
-		return &t, nil
+		s = t
+	case bool:
+		s = strconv.FormatBool(t)
+	case json.Number:
+		f, err := t.Float64()
+		if err != nil {
+			s = t.String()
+			break
+		}
+		s = formatNumber(f)
 	default:
+		if f, ok := toFloat(v); ok {
+			s = formatNumber(f)
+			break
+		}
 		b, _ := json.Marshal(t)
-		bs := string(b)
-		return &bs, nil
+		s = string(b)
+	}
+	return &s
+}
+
+// toFloat returns v as a float64 if it is a number.
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// formatNumber formats f like encoding/json does a float64.
+func formatNumber(f float64) string {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		s := strconv.FormatFloat(f, 'e', -1, 64)
+		// e-07 -> e-7, as in JSON
+		if n := len(s); n >= 4 && s[n-4] == 'e' && s[n-3] == '-' && s[n-2] == '0' {
+			s = s[:n-2] + s[n-1:]
+		}
+		return s
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// CoerceTyped is CoerceString for a field of the given types.TriggerConfig.ValueType. A value not of that type is
+// nil, as if absent; with ValueTypeNumber and ValueTypeBool, strings spelling a number or a boolean are of the type
+// and are formatted as such, so "42.0" and 42 yield the same "42".
+func CoerceTyped(v any, valueType string) *string {
+	switch valueType {
+	case types.ValueTypeString:
+		if _, ok := v.(string); !ok {
+			return nil
+		}
+	case types.ValueTypeNumber:
+		if str, ok := v.(string); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+			if err != nil {
+				return nil
+			}
+			v = f
+		}
+		if _, ok := v.(json.Number); !ok {
+			if _, ok := toFloat(v); !ok {
+				return nil
+			}
+		}
+	case types.ValueTypeBool:
+		if str, ok := v.(string); ok {
+			switch strings.ToLower(strings.TrimSpace(str)) {
+			case "true":
+				v = true
+			case "false":
+				v = false
+			}
+		}
+		if _, ok := v.(bool); !ok {
+			return nil
+		}
 	}
+	return CoerceString(v)
 }
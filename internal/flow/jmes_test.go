@@ -1,5 +1,12 @@
 package flow
 
+import (
+	"enoti/internal/types"
+	"testing"
+
+	json "github.com/goccy/go-json"
+)
+
 func (s *UnitTestSuite) TestEvalAny() {
 	// Test the JMESPath evaluation
 	obj := map[string]any{
@@ -49,3 +56,118 @@ func (s *UnitTestSuite) TestEvalAny() {
 	s.NoError(err)
 	s.Equal(false, v.(bool))
 }
+
+func (s *UnitTestSuite) TestEvalAnyCompiled() {
+	payloads := []map[string]any{
+		{"status": "up", "event": map[string]any{"type": "deploy", "tags": []any{"a", "b"}}, "cpu": 42.5},
+		{"status": nil, "event": map[string]any{"type": 1}},
+		{},
+	}
+	for _, expr := range []string{
+		"status", "event.type", "event.tags[0]", "cpu > `40`", "contains(keys(@), 'status')", "missing.deeply",
+	} {
+		for _, payload := range payloads {
+			for range 2 { // compiled, then cached
+				want, wantErr := EvalAny(expr, payload)
+				got, err := EvalAnyCompiled(expr, payload)
+				s.Equal(wantErr, err, expr)
+				s.Equal(want, got, expr)
+			}
+		}
+	}
+
+	_, err := EvalAnyCompiled("[", payloads[0])
+	s.Error(err)
+	_, cached := compiledExpressions.Load("[")
+	s.False(cached, "invalid expressions are not cached")
+}
+
+// BenchmarkEvalAny compares evaluating an expression parsed on every call with the compiled one.
+func BenchmarkEvalAny(b *testing.B) {
+	payload := map[string]any{"event": map[string]any{"type": "deploy", "region": "eu-west-1"}, "status": "up"}
+	const expr = "event.type == 'deploy' && status != 'down'"
+	for _, c := range []struct {
+		name string
+		eval func(string, map[string]any) (any, error)
+	}{{"uncompiled", EvalAny}, {"compiled", EvalAnyCompiled}} {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				_, _ = c.eval(expr, payload)
+			}
+		})
+	}
+}
+
+func (s *UnitTestSuite) TestCoerceString() {
+	for _, c := range []struct {
+		in   any
+		want string
+	}{
+		{"up", "up"},
+		{"42", "42"},
+		{"", ""},
+		{42, "42"},
+		{int64(-7), "-7"},
+		{uint8(3), "3"},
+		{42.0, "42"},
+		{42.5, "42.5"},
+		{float32(0.5), "0.5"},
+		{0.1, "0.1"},
+		{1e21, "1e+21"},
+		{1e20, "100000000000000000000"},
+		{1e-7, "1e-7"},
+		{0.000001, "0.000001"},
+		{json.Number("42.0"), "42"},
+		{json.Number("4.2e1"), "42"},
+		{true, "true"},
+		{false, "false"},
+		{[]any{"a", 1.0}, `["a",1]`},
+		{map[string]any{"b": 1.0, "a": true}, `{"a":true,"b":1}`},
+	} {
+		got := CoerceString(c.in)
+		if s.NotNil(got, "%#v", c.in) {
+			s.Equal(c.want, *got, "%#v", c.in)
+		}
+	}
+	s.Nil(CoerceString(nil), "null makes no edge")
+}
+
+func (s *UnitTestSuite) TestCoerceStringAcrossEncodings() {
+	// The same number decodes to the same edge value however it is written
+	for _, body := range []string{`{"v":42}`, `{"v":42.0}`, `{"v":4.2e1}`, `{"v":42.000}`} {
+		var payload map[string]any
+		s.Require().NoError(json.Unmarshal([]byte(body), &payload))
+		v, err := EvalString("v", payload)
+		s.NoError(err)
+		s.Equal("42", *v, body)
+	}
+}
+
+func (s *UnitTestSuite) TestCoerceTyped() {
+	str := func(v string) *string { return &v }
+	for _, c := range []struct {
+		valueType string
+		in        any
+		want      *string
+	}{
+		{"", "42", str("42")},
+		{"", 42.0, str("42")},
+		{types.ValueTypeString, "42", str("42")},
+		{types.ValueTypeString, 42.0, nil},
+		{types.ValueTypeString, true, nil},
+		{types.ValueTypeNumber, 42.0, str("42")},
+		{types.ValueTypeNumber, "42.0", str("42")},
+		{types.ValueTypeNumber, " 4.2e1 ", str("42")},
+		{types.ValueTypeNumber, json.Number("42.50"), str("42.5")},
+		{types.ValueTypeNumber, "n/a", nil},
+		{types.ValueTypeNumber, true, nil},
+		{types.ValueTypeBool, true, str("true")},
+		{types.ValueTypeBool, "FALSE", str("false")},
+		{types.ValueTypeBool, "yes", nil},
+		{types.ValueTypeBool, 1.0, nil},
+		{types.ValueTypeNumber, nil, nil},
+	} {
+		s.Equal(c.want, CoerceTyped(c.in, c.valueType), "%s %#v", c.valueType, c.in)
+	}
+}
@@ -0,0 +1,161 @@
+package flow
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"enoti/internal/types"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// KeyHashParams are the Argon2id parameters used to hash client keys. They are encoded into each hash, so changing
+// them only affects keys hashed afterwards.
+type KeyHashParams struct {
+	MemoryKiB uint32
+	Time      uint32
+	Threads   uint8
+	SaltLen   uint32
+	KeyLen    uint32
+}
+
+// DefaultKeyHashParams follow the OWASP minimum recommendation for Argon2id (19 MiB, 2 iterations, 1 thread).
+var DefaultKeyHashParams = KeyHashParams{MemoryKiB: 19 * 1024, Time: 2, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+// Environment variables overriding DefaultKeyHashParams when hashing client keys.
+const (
+	KeyHashMemoryKiBEnvKey = "KEY_HASH_MEMORY_KIB"
+	KeyHashTimeEnvKey      = "KEY_HASH_TIME"
+	KeyHashThreadsEnvKey   = "KEY_HASH_THREADS"
+)
+
+// KeyHashParamsFromEnv returns DefaultKeyHashParams with any of the KEY_HASH_* overrides applied.
+func KeyHashParamsFromEnv() (KeyHashParams, error) {
+	p := DefaultKeyHashParams
+	for _, o := range []struct {
+		key string
+		min uint64
+		max uint64
+		set func(uint64)
+	}{
+		{KeyHashMemoryKiBEnvKey, 8 * 1024, 4 * 1024 * 1024, func(v uint64) { p.MemoryKiB = uint32(v) }},
+		{KeyHashTimeEnvKey, 1, 100, func(v uint64) { p.Time = uint32(v) }},
+		{KeyHashThreadsEnvKey, 1, 255, func(v uint64) { p.Threads = uint8(v) }},
+	} {
+		s := os.Getenv(o.key)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(s, 10, 32)
+		if err != nil || v < o.min || v > o.max {
+			return p, fmt.Errorf("invalid %s %q: must be between %d and %d", o.key, s, o.min, o.max)
+		}
+		o.set(v)
+	}
+	return p, nil
+}
+
+// HashClientKeys replaces the plaintext keys of cc with their hashes. A key that already matches a hash of existing
+// keeps that hash, so putting an unchanged config does not change it.
+func HashClientKeys(cc, existing types.ClientConfig, p KeyHashParams) (types.ClientConfig, error) {
+	hash := func(key string) (string, error) {
+		for _, h := range existing.ActiveKeyHashes() {
+			if VerifyKeyHash(key, h) {
+				return h, nil
+			}
+		}
+		return HashKey(key, p)
+	}
+	var err error
+	if cc.ClientKey != "" {
+		if cc.ClientKeyHash, err = hash(cc.ClientKey); err != nil {
+			return cc, err
+		}
+		cc.ClientKey = ""
+	}
+	if len(cc.ClientKeys) > 0 {
+		cc.ClientKeyHashes = make([]string, 0, len(cc.ClientKeys))
+		for _, k := range cc.ClientKeys {
+			h, err := hash(k)
+			if err != nil {
+				return cc, err
+			}
+			cc.ClientKeyHashes = append(cc.ClientKeyHashes, h)
+		}
+		cc.ClientKeys = nil
+	}
+	return cc, nil
+}
+
+// keyHashPrefix marks the PHC string format produced by HashKey.
+const keyHashPrefix = "$argon2id$"
+
+// verifiedKeys remembers keys that matched a hash recently, so a client does not pay an Argon2id derivation on
+// every request. Only successes are cached: a wrong key always costs the full derivation.
+var verifiedKeys = NewTTL[[sha256.Size]byte, bool]()
+
+// HashKey hashes key with Argon2id and a random salt, returning the hash in PHC string format:
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>.
+func HashKey(key string, p KeyHashParams) (string, error) {
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	sum := argon2.IDKey([]byte(key), salt, p.Time, p.MemoryKiB, p.Threads, p.KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", keyHashPrefix, argon2.Version, p.MemoryKiB, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(sum)), nil
+}
+
+// VerifyKeyHash reports whether key matches the hash produced by HashKey. Malformed hashes never match.
+func VerifyKeyHash(key, encoded string) bool {
+	cacheKey := sha256.Sum256([]byte(key + "\x00" + encoded))
+	if _, ok := verifiedKeys.Get(cacheKey); ok {
+		return true
+	}
+	p, salt, want, err := parseKeyHash(encoded)
+	if err != nil {
+		return false
+	}
+	got := argon2.IDKey([]byte(key), salt, p.Time, p.MemoryKiB, p.Threads, uint32(len(want)))
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return false
+	}
+	verifiedKeys.Set(cacheKey, true, 5*time.Minute)
+	return true
+}
+
+// IsKeyHash reports whether s looks like a hash produced by HashKey.
+func IsKeyHash(s string) bool {
+	_, _, _, err := parseKeyHash(s)
+	return err == nil
+}
+
+func parseKeyHash(encoded string) (p KeyHashParams, salt, sum []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(encoded, keyHashPrefix), "$")
+	if !strings.HasPrefix(encoded, keyHashPrefix) || len(parts) != 4 {
+		return p, nil, nil, fmt.Errorf("not an argon2id hash")
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[0], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version")
+	}
+	if _, err = fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &p.MemoryKiB, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid salt: %w", err)
+	}
+	if sum, err = base64.RawStdEncoding.DecodeString(parts[3]); err != nil || len(sum) == 0 {
+		return p, nil, nil, fmt.Errorf("invalid hash")
+	}
+	if p.Time == 0 || p.Threads == 0 {
+		return p, nil, nil, fmt.Errorf("invalid argon2 parameters")
+	}
+	return p, salt, sum, nil
+}
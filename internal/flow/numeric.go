@@ -0,0 +1,55 @@
+package flow
+
+import (
+	"enoti/internal/types"
+	"math"
+	"strconv"
+)
+
+// RoundNumeric rounds v to the configured precision if it parses as a number; otherwise v is returned unchanged.
+func RoundNumeric(v string, n *types.NumericConfig) string {
+	if n == nil || n.Precision == nil {
+		return v
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return v
+	}
+	p := math.Pow10(*n.Precision)
+	return strconv.FormatFloat(math.Round(f*p)/p, 'f', -1, 64)
+}
+
+// ThresholdState maps the value of a threshold trigger to types.ThresholdBreaching or types.ThresholdOK, the values
+// its edges are detected on. It returns nil for values that are not numbers.
+func ThresholdState(trig types.TriggerConfig, v string) *string {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) {
+		return nil
+	}
+	state := types.ThresholdOK
+	if trig.Breaches(f) {
+		state = types.ThresholdBreaching
+	}
+	return &state
+}
+
+// WithinTolerance reports whether both values are numbers that differ by no more than the configured
+// absolute or relative epsilon.
+func WithinTolerance(last, cur string, n *types.NumericConfig) bool {
+	if n == nil || (n.Epsilon == 0 && n.RelEpsilon == 0) {
+		return false
+	}
+	a, err := strconv.ParseFloat(last, 64)
+	if err != nil {
+		return false
+	}
+	b, err := strconv.ParseFloat(cur, 64)
+	if err != nil {
+		return false
+	}
+	diff := math.Abs(a - b)
+	if n.Epsilon > 0 && diff <= n.Epsilon {
+		return true
+	}
+	return n.RelEpsilon > 0 && diff <= n.RelEpsilon*math.Max(math.Abs(a), math.Abs(b))
+}
@@ -0,0 +1,55 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/types"
+)
+
+func (s *UnitTestSuite) TestRoundNumeric() {
+	p := 2
+	n := &types.NumericConfig{Precision: &p}
+	s.Equal("42", RoundNumeric("42.0001", n))
+	s.Equal("42.13", RoundNumeric("42.125001", n))
+	s.Equal("abc", RoundNumeric("abc", n))
+	s.Equal("42.0001", RoundNumeric("42.0001", nil))
+}
+
+func (s *UnitTestSuite) TestWithinTolerance() {
+	s.True(WithinTolerance("42.0001", "42.0002", &types.NumericConfig{Epsilon: 0.001}))
+	s.False(WithinTolerance("42.0001", "42.1", &types.NumericConfig{Epsilon: 0.001}))
+	s.True(WithinTolerance("100", "100.5", &types.NumericConfig{RelEpsilon: 0.01}))
+	s.False(WithinTolerance("1", "1.5", &types.NumericConfig{RelEpsilon: 0.01}))
+	s.False(WithinTolerance("a", "b", &types.NumericConfig{Epsilon: 1}))
+	s.False(WithinTolerance("42.0001", "42.0002", nil))
+}
+
+func (s *UnitTestSuite) TestEdgeNearEqualFloats() {
+	ctx := context.Background()
+	store := newMemDataStore()
+	p := 2
+	trig := types.TriggerConfig{FieldExpr: "v", Numeric: &types.NumericConfig{Precision: &p}}
+
+	action, _, err := EvaluateEdgeAndFlap(ctx, store, "c", "k", "42.0001", trig, nil)
+	s.NoError(err)
+	s.Equal(EdgeTriggeredForward, action)
+	edge, _, _ := store.Load(ctx, "c", "k")
+	s.Equal("42", edge.LastValue)
+
+	action, _, err = EvaluateEdgeAndFlap(ctx, store, "c", "k", "42.0002", trig, map[string]any{})
+	s.NoError(err)
+	s.Equal(NoOp, action)
+
+	action, _, err = EvaluateEdgeAndFlap(ctx, store, "c", "k", "42.5", trig, map[string]any{})
+	s.NoError(err)
+	s.Equal(EdgeTriggeredForward, action)
+	edge, _, _ = store.Load(ctx, "c", "k")
+	s.Equal("42.5", edge.LastValue)
+
+	// Epsilon keeps the last value when the change is within tolerance
+	trig.Numeric = &types.NumericConfig{Epsilon: 0.01}
+	action, _, err = EvaluateEdgeAndFlap(ctx, store, "c", "k", "42.505", trig, map[string]any{})
+	s.NoError(err)
+	s.Equal(NoOp, action)
+	edge, _, _ = store.Load(ctx, "c", "k")
+	s.Equal("42.5", edge.LastValue)
+}
@@ -2,11 +2,26 @@ package flow
 
 import "enoti/internal/types"
 
+// CheckPassthrough reports whether the payload is passed through: whether all of the rules of the passthrough
+// match it, or any of them for the "any" operator. A passthrough without rules passes nothing through.
 func CheckPassthrough(passthroughCfg types.Passthrough, payload map[string]any) bool {
-	if passthroughCfg.FieldExpr == "" {
+	rules := passthroughCfg.AllRules()
+	if len(rules) == 0 {
 		return false
 	}
-	match, err := EvalAny(passthroughCfg.FieldExpr, payload)
+	anyOf := passthroughCfg.Operator == types.PassthroughAny
+	for _, r := range rules {
+		if checkPassthroughRule(r, payload) == anyOf {
+			return anyOf
+		}
+	}
+	return !anyOf
+}
+
+// checkPassthroughRule reports whether the rule matches the payload. Expressions that fail or do not yield a
+// boolean match nothing, even negated.
+func checkPassthroughRule(rule types.PassthroughRule, payload map[string]any) bool {
+	match, err := EvalAnyCompiled(rule.FieldExpr, payload)
 	if err != nil {
 		return false
 	}
@@ -15,7 +30,7 @@ func CheckPassthrough(passthroughCfg types.Passthrough, payload map[string]any)
 	if !ok {
 		return false
 	}
-	if passthroughCfg.Negate {
+	if rule.Negate {
 		return !matched
 	} else {
 		return matched
@@ -41,3 +41,56 @@ func (s *UnitTestSuite) TestCheckPassthrough1() {
 	)
 	s.True(v)
 }
+
+// TestCheckPassthroughRules tests rule sets combined with all and any
+func (s *UnitTestSuite) TestCheckPassthroughRules() {
+	fromX := types.PassthroughRule{FieldExpr: "source == 'x'"}
+	high := types.PassthroughRule{FieldExpr: "severity == 'high'"}
+	payload := func(source, severity string) map[string]any {
+		return map[string]any{"source": source, "severity": severity}
+	}
+
+	// AND, the default
+	passthroughCfg := types.Passthrough{Rules: []types.PassthroughRule{fromX, high}}
+	s.True(CheckPassthrough(passthroughCfg, payload("x", "high")))
+	s.False(CheckPassthrough(passthroughCfg, payload("x", "low")))
+	s.False(CheckPassthrough(passthroughCfg, payload("y", "high")))
+	passthroughCfg.Operator = types.PassthroughAll
+	s.True(CheckPassthrough(passthroughCfg, payload("x", "high")))
+	s.False(CheckPassthrough(passthroughCfg, payload("y", "low")))
+
+	// OR
+	passthroughCfg.Operator = types.PassthroughAny
+	s.True(CheckPassthrough(passthroughCfg, payload("x", "low")))
+	s.True(CheckPassthrough(passthroughCfg, payload("y", "high")))
+	s.False(CheckPassthrough(passthroughCfg, payload("y", "low")))
+
+	// Mixed negate: from x AND NOT high
+	notHigh := high
+	notHigh.Negate = true
+	passthroughCfg = types.Passthrough{Rules: []types.PassthroughRule{fromX, notHigh}}
+	s.True(CheckPassthrough(passthroughCfg, payload("x", "low")))
+	s.False(CheckPassthrough(passthroughCfg, payload("x", "high")))
+	// from x OR NOT high
+	passthroughCfg.Operator = types.PassthroughAny
+	s.True(CheckPassthrough(passthroughCfg, payload("y", "low")))
+	s.False(CheckPassthrough(passthroughCfg, payload("y", "high")))
+
+	// The single rule form combines with the rules
+	passthroughCfg = types.Passthrough{FieldExpr: "source == 'x'", Negate: true, Rules: []types.PassthroughRule{high}}
+	s.True(CheckPassthrough(passthroughCfg, payload("y", "high")))
+	s.False(CheckPassthrough(passthroughCfg, payload("x", "high")))
+
+	// Rules that do not yield a boolean never match, negated or not
+	passthroughCfg = types.Passthrough{Rules: []types.PassthroughRule{{FieldExpr: "source", Negate: true}}}
+	s.False(CheckPassthrough(passthroughCfg, payload("x", "high")))
+	s.False(CheckPassthrough(types.Passthrough{Operator: types.PassthroughAll}, payload("x", "high")))
+
+	cc := types.ClientConfig{ClientID: "client", ClientName: "client", ClientKey: "client-key-123",
+		Passthrough: types.Passthrough{Operator: "xor"}}
+	s.ErrorContains(cc.Validate(), "passthrough.operator")
+	cc.Passthrough = types.Passthrough{Rules: []types.PassthroughRule{{Negate: true}}}
+	s.ErrorContains(cc.Validate(), "passthrough.rules[0].field")
+	cc.Passthrough = types.Passthrough{Operator: types.PassthroughAny, Rules: []types.PassthroughRule{fromX, high}}
+	s.NoError(cc.Validate())
+}
@@ -0,0 +1,89 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/pub"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+	"maps"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrEncode is wrapped by the errors PublishOutcome returns when the payload cannot be rendered, as opposed to
+// published.
+var ErrEncode = errors.New("encode payload")
+
+// PublishOutcome publishes the forwarding outcome o of an event to the targets of its trigger: its payload,
+// enriched for the client (see Enrich) with the receive time received (see ReceivedAt), is encoded and published
+// with the PublishContext of the event's payload. body is the event as received, published as is when nothing
+// transforms it (see EncodeOutputBody), or nil. It is the publishing step of the HTTP handler, the queue
+// dispatcher and Engine alike.
+func PublishOutcome(ctx context.Context, publisher ports.Publisher, cc types.ClientConfig, o TriggerOutcome,
+	payload map[string]any, received int64, body []byte) error {
+	b, err := encodeOutcome(ctx, cc, o, received, body)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrEncode, err)
+	}
+	return PublishTargets(PublishContext(ctx, o, payload), publisher, o.Trigger.AllTargets(), b)
+}
+
+// encodeOutcome renders the payload of the forwarding outcome o of an event received as body, enriched for the
+// client, into the published body.
+func encodeOutcome(ctx context.Context, cc types.ClientConfig, o TriggerOutcome, received int64,
+	body []byte) ([]byte, error) {
+	out := Enrich(ctx, cc, o.Action, o.ScopeKey, received, o.Payload)
+	switch {
+	case o.Action == AggregateSent:
+		return EncodeAggregate(o.Trigger, out)
+	case cc.EnrichMetadataKey != "":
+		return EncodeOutput(cc, out)
+	default:
+		return EncodeOutputBody(cc, o, body)
+	}
+}
+
+// PublishTargets publishes b to targets within a "Publish" span. Failures are those of pub.ForTargets, see
+// pub.FailedTargets.
+func PublishTargets(ctx context.Context, publisher ports.Publisher, targets []types.TargetConfig, b []byte) (err error) {
+	ctx, span := StartSpan(ctx, "Publish", attribute.Int("targets", len(targets)))
+	defer func() { EndSpan(span, err) }()
+	return pub.ForTargets(publisher, targets).PublishRaw(ctx, "", b)
+}
+
+// Enrich returns payload, published for the client with the given action, with the metadata of the event under the
+// client's EnrichMetadataKey: the client ID, action, scope key, receive time in epoch seconds and request ID, the
+// ports.PublishID of ctx (omitted if there is none). Without an EnrichMetadataKey, payload is returned as is; it is
+// never modified.
+func Enrich(ctx context.Context, cc types.ClientConfig, action Action, scopeKey string, receivedAt int64,
+	payload map[string]any) map[string]any {
+	if cc.EnrichMetadataKey == "" {
+		return payload
+	}
+	meta := map[string]any{
+		"client_id":   cc.ClientID,
+		"action":      StatusTextMap[action],
+		"scope_key":   scopeKey,
+		"received_at": receivedAt,
+	}
+	if id := ports.PublishID(ctx); id != "" {
+		meta["request_id"] = id
+	}
+	out := maps.Clone(payload)
+	if out == nil {
+		out = map[string]any{}
+	}
+	out[cc.EnrichMetadataKey] = meta
+	return out
+}
+
+// ReceivedAt returns the receive time to stamp on the payloads of the client, in epoch seconds, by the clock of ctx
+// (see WithClock). The clock is only read for clients that are enriched.
+func ReceivedAt(ctx context.Context, cc types.ClientConfig) int64 {
+	if cc.EnrichMetadataKey == "" {
+		return 0
+	}
+	return clockNow(ctx).Unix()
+}
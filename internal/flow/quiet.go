@@ -0,0 +1,28 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/types"
+)
+
+// quietHours returns the action of the client's quiet hours if the event is held back by them: the current time
+// falls in them and the payload does not bypass them. It returns "" otherwise. The clock is only read for clients
+// with quiet hours.
+func quietHours(ctx context.Context, cc types.ClientConfig, payload map[string]any) string {
+	q := cc.QuietHours
+	if q == nil {
+		return ""
+	}
+	if q.Bypass != "" {
+		if bypass, err := EvalAnyCompiled(q.Bypass, payload); err == nil && bypass == true {
+			return ""
+		}
+	}
+	if in, err := q.Contains(clockNow(ctx)); err != nil || !in {
+		return ""
+	}
+	if q.Action == "" {
+		return types.QuietHoursSuppress
+	}
+	return q.Action
+}
@@ -0,0 +1,74 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/types"
+	"time"
+)
+
+func (s *UnitTestSuite) TestRunQuietHours() {
+	ny, err := time.LoadLocation("America/New_York")
+	s.Require().NoError(err)
+	at := func(hhmm string) time.Time {
+		t, err := time.ParseInLocation("2006-01-02 15:04", "2025-03-10 "+hhmm, ny)
+		s.Require().NoError(err)
+		return t
+	}
+	quiet := &types.QuietHoursConfig{Timezone: "America/New_York", Start: "22:00", End: "06:00",
+		Bypass: "severity == 'critical'"}
+	cc := types.ClientConfig{QuietHours: quiet, Trigger: types.TriggerConfig{FieldExpr: "state"}}
+	store := newMemDataStore()
+	run := func(now time.Time, state, severity string) Action {
+		SetTimNowFn(func() time.Time { return now })
+		defer RestoreTimeNow()
+		action, _, _, err := Run(context.Background(), "c", "127.0.0.1", cc, store,
+			map[string]any{"state": state, "severity": severity})
+		s.Require().NoError(err)
+		return action
+	}
+
+	// Across the boundaries, which hold in the client's time zone
+	s.Equal(EdgeTriggeredForward, run(at("21:59"), "up", "info"))
+	s.Equal(SuppressQuietHours, run(at("22:00"), "down", "info"))
+	s.Equal(SuppressQuietHours, run(at("23:59").Add(2*time.Hour), "up", "info"), "past midnight")
+	s.Equal(SuppressQuietHours, run(at("05:59"), "down", "info"))
+	s.Equal(NoOp, run(at("06:00"), "down", "info"), "suppressed events moved the edge")
+
+	// Bypassing payloads are handled as usual
+	s.Equal(EdgeTriggeredForward, run(at("23:00"), "up", "critical"))
+
+	// Queued events leave the edge alone, so the net change is notified afterwards
+	quiet.Action = types.QuietHoursQueue
+	s.Equal(SuppressQuietHours, run(at("23:30"), "down", "info"))
+	s.Equal(SuppressQuietHours, run(at("23:40"), "maintenance", "info"))
+	s.Equal(EdgeTriggeredForward, run(at("06:30"), "maintenance", "info"))
+	s.Equal(SuppressQuietHours, run(at("23:50"), "up", "info"))
+	s.Equal(NoOp, run(at("06:40"), "maintenance", "info"))
+
+	// Passthrough events are held back too
+	cc.Passthrough = types.Passthrough{FieldExpr: "severity == 'info'"}
+	s.Equal(SuppressQuietHours, run(at("23:00"), "up", "info"))
+	s.Equal(ForwardedAsIs, run(at("12:00"), "up", "info"))
+
+	// UTC without a time zone: 05:00 in New York is 09:00 UTC, 14:00 is 18:00 UTC
+	contains, err := types.QuietHoursConfig{Start: "09:00", End: "17:00"}.Contains(at("05:00"))
+	s.NoError(err)
+	s.True(contains)
+	contains, err = types.QuietHoursConfig{Start: "09:00", End: "17:00"}.Contains(at("14:00"))
+	s.NoError(err)
+	s.False(contains)
+
+	cc = types.ClientConfig{ClientID: "client", ClientName: "client", ClientKey: "client-key-123"}
+	for _, q := range []types.QuietHoursConfig{
+		{Start: "22:00", End: "22:00"},
+		{Start: "25:00", End: "06:00"},
+		{Start: "22:00", End: "6"},
+		{Start: "22:00", End: "06:00", Timezone: "Mars/Olympus"},
+		{Start: "22:00", End: "06:00", Action: "drop"},
+	} {
+		cc.QuietHours = &q
+		s.ErrorContains(cc.Validate(), "quiet_hours", q)
+	}
+	cc.QuietHours = &types.QuietHoursConfig{Start: "22:00", End: "06:00", Timezone: "Europe/Paris", Action: "queue"}
+	s.NoError(cc.Validate())
+}
@@ -0,0 +1,83 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrQuotaExceeded is wrapped by the errors Run returns when the daily or monthly quota of the client is used up.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// quotaPeriod is the counter of one quota of a client for the current period.
+type quotaPeriod struct {
+	name  string // "daily" or "monthly"
+	scope string
+	limit int
+	ttl   time.Duration
+}
+
+// quotaPeriods returns the counters of the client's quotas for the UTC day and month of now. They are kept a day
+// past the end of their period.
+func quotaPeriods(cc types.ClientConfig, clientID string, now time.Time) []quotaPeriod {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var periods []quotaPeriod
+	if cc.DailyQuota > 0 {
+		periods = append(periods, quotaPeriod{"daily", "QUOTA:" + clientID + ":" + now.Format("20060102"),
+			cc.DailyQuota, day.AddDate(0, 0, 2).Sub(now)})
+	}
+	if cc.MonthlyQuota > 0 {
+		month := day.AddDate(0, 0, 1-day.Day())
+		periods = append(periods, quotaPeriod{"monthly", "QUOTA:" + clientID + ":" + now.Format("200601"),
+			cc.MonthlyQuota, month.AddDate(0, 1, 1).Sub(now)})
+	}
+	return periods
+}
+
+// useQuota counts n events against the quotas of the client, or with n 0 checks that they are not used up. Nothing
+// is counted unless every quota has room. The error, if any, is meant for the client, with its status code. The
+// clock is only read for clients with quotas.
+func useQuota(ctx context.Context, dataStore ports.DataStore, cc types.ClientConfig, clientID string,
+	n int) (int, error) {
+	if cc.DailyQuota <= 0 && cc.MonthlyQuota <= 0 {
+		return http.StatusAccepted, nil
+	}
+	periods := quotaPeriods(cc, clientID, clockNow(ctx))
+	if n > 0 && len(periods) > 1 {
+		if code, err := useQuota(ctx, dataStore, cc, clientID, 0); err != nil {
+			return code, err
+		}
+	}
+	for _, p := range periods {
+		ok, err := countQuota(ctx, dataStore, p, n)
+		if err != nil {
+			if failOpen(ctx, cc, err, "quota") {
+				continue
+			}
+			log.WithError(err).Error("failed to count quota")
+			return acquireErrStatus(err, http.StatusInternalServerError), fmt.Errorf("quota check failed")
+		}
+		if !ok {
+			return http.StatusForbidden, fmt.Errorf("%w (%s)", ErrQuotaExceeded, p.name)
+		}
+	}
+	return http.StatusAccepted, nil
+}
+
+// countQuota calls DataStore.CountQuota for the period within a span.
+func countQuota(ctx context.Context, dataStore ports.DataStore, p quotaPeriod, n int) (ok bool, err error) {
+	ctx, span := StartSpan(ctx, "CountQuota", attribute.String("scope", p.scope), attribute.Int("n", n))
+	defer func() {
+		span.SetAttributes(attribute.Bool("granted", ok))
+		EndSpan(span, err)
+	}()
+	return dataStore.CountQuota(ctx, p.scope, n, p.limit, p.ttl)
+}
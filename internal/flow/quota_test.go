@@ -0,0 +1,75 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/types"
+	"net/http"
+	"time"
+)
+
+func (s *UnitTestSuite) TestRunQuota() {
+	now := time.Date(2025, 3, 31, 23, 0, 0, 0, time.UTC)
+	SetTimNowFn(func() time.Time { return now })
+	defer RestoreTimeNow()
+	cc := types.ClientConfig{DailyQuota: 2, Trigger: types.TriggerConfig{FieldExpr: "state"}}
+	store := newMemDataStore()
+	run := func(state string) (Action, int, error) {
+		action, code, _, err := Run(context.Background(), "c", "127.0.0.1", cc, store, map[string]any{"state": state})
+		return action, code, err
+	}
+
+	// Only forwarded events count by default
+	for _, state := range []string{"up", "up", "up", "down"} {
+		_, _, err := run(state)
+		s.Require().NoError(err)
+	}
+	_, code, err := run("up")
+	s.ErrorIs(err, ErrQuotaExceeded)
+	s.ErrorContains(err, "daily")
+	s.Equal(http.StatusForbidden, code)
+	_, _, err = run("down")
+	s.ErrorIs(err, ErrQuotaExceeded, "no_op events are refused once it is used up")
+
+	// The next UTC day starts afresh
+	now = now.Add(2 * time.Hour)
+	action, _, err := run("up")
+	s.NoError(err)
+	s.Equal(EdgeTriggeredForward, action)
+
+	// Counting every event
+	cc.QuotaCounts = types.QuotaCountsAll
+	_, _, err = run("up")
+	s.NoError(err)
+	_, _, err = run("up")
+	s.ErrorIs(err, ErrQuotaExceeded)
+
+	// Monthly quotas hold across days, and nothing is counted unless both have room
+	cc = types.ClientConfig{DailyQuota: 2, MonthlyQuota: 3, QuotaCounts: types.QuotaCountsAll}
+	store = newMemDataStore()
+	for range 2 {
+		_, _, err = run("up")
+		s.NoError(err)
+	}
+	_, _, err = run("up")
+	s.ErrorContains(err, "daily")
+	now = now.AddDate(0, 0, 1)
+	_, _, err = run("up")
+	s.NoError(err)
+	_, _, err = run("up")
+	s.ErrorContains(err, "monthly")
+	s.Equal(3, store.counts["QUOTA:c:202504"])
+	s.Equal(1, store.counts["QUOTA:c:20250402"])
+
+	// Dry runs never count
+	cc.MonthlyQuota = 100
+	_, _, _, err = Run(WithDryRun(context.Background()), "c", "127.0.0.1", cc, store, map[string]any{})
+	s.NoError(err)
+	s.Equal(1, store.counts["QUOTA:c:20250402"])
+
+	bad := types.ClientConfig{ClientID: "client", ClientName: "client", ClientKey: "client-key-123", DailyQuota: -1}
+	s.ErrorContains(bad.Validate(), "daily_quota")
+	bad.DailyQuota, bad.QuotaCounts = 1, "some"
+	s.ErrorContains(bad.Validate(), "quota_counts")
+	bad.QuotaCounts = types.QuotaCountsForwarded
+	s.NoError(bad.Validate())
+}
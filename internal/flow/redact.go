@@ -0,0 +1,95 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/types"
+	"maps"
+	"strconv"
+)
+
+// RedactMask replaces the values of redacted fields.
+const RedactMask = "[REDACTED]"
+
+type redactFieldsCtx struct{}
+
+// WithRedactFields sets the fields (see ClientConfig.RedactFields) to redact from the aggregates built with the
+// returned context.
+func WithRedactFields(ctx context.Context, fields []string) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, redactFieldsCtx{}, fields)
+}
+
+// redactFields returns the fields set by WithRedactFields.
+func redactFields(ctx context.Context) []string {
+	fields, _ := ctx.Value(redactFieldsCtx{}).([]string)
+	return fields
+}
+
+// Redact returns payload with the values of the given fields replaced with RedactMask; see types.ParseFieldPath.
+// Fields absent from the payload are skipped, and invalid ones ignored. payload itself is left as is: the objects
+// and arrays on the path to a redacted value are copied.
+func Redact(payload map[string]any, fields []string) map[string]any {
+	for _, f := range fields {
+		path, err := types.ParseFieldPath(f)
+		if err != nil {
+			continue // rejected by ClientConfig.Validate
+		}
+		if v, ok := redactPath(payload, path); ok {
+			payload = v.(map[string]any)
+		}
+	}
+	return payload
+}
+
+// redactPath returns a copy of v with the values at path masked, and whether there were any.
+func redactPath(v any, path []string) (any, bool) {
+	seg, rest := path[0], path[1:]
+	mask := func(child any) (any, bool) {
+		if len(rest) == 0 {
+			return RedactMask, true
+		}
+		return redactPath(child, rest)
+	}
+	switch c := v.(type) {
+	case map[string]any:
+		var out map[string]any
+		for k, child := range c {
+			if seg != "*" && seg != k {
+				continue
+			}
+			if next, ok := mask(child); ok {
+				if out == nil {
+					out = maps.Clone(c)
+				}
+				out[k] = next
+			}
+		}
+		return out, out != nil
+	case []any:
+		var out []any
+		for i, child := range c {
+			if seg != "*" && seg != "["+strconv.Itoa(i)+"]" {
+				continue
+			}
+			if next, ok := mask(child); ok {
+				if out == nil {
+					out = append([]any(nil), c...)
+				}
+				out[i] = next
+			}
+		}
+		return out, out != nil
+	}
+	return nil, false
+}
+
+// redactOutcome applies the client's RedactFields to the payload to publish for o. Aggregates are redacted as they
+// are built (see BuildAggregate).
+func redactOutcome(cc types.ClientConfig, o TriggerOutcome) TriggerOutcome {
+	if len(cc.RedactFields) > 0 && o.Forwards() && o.Action != AggregateSent {
+		o.Payload, o.transformed = Redact(o.Payload, cc.RedactFields), true
+	}
+	return o
+}
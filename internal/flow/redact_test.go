@@ -0,0 +1,117 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/types"
+)
+
+func (s *UnitTestSuite) TestRedact() {
+	payload := map[string]any{
+		"id":   "e1",
+		"user": map[string]any{"email": "a@example.com", "name": "A"},
+		"items": []any{
+			map[string]any{"card": "4111", "sku": "x"},
+			map[string]any{"sku": "y"},
+			map[string]any{"card": "5500", "sku": "z"},
+		},
+		"tags": []any{"t1", "t2"},
+	}
+	out := Redact(payload, []string{"user.email", "items[*].card", "tags[1]", "missing.field", "id.nested"})
+	s.Equal(map[string]any{
+		"id":   "e1",
+		"user": map[string]any{"email": RedactMask, "name": "A"},
+		"items": []any{
+			map[string]any{"card": RedactMask, "sku": "x"},
+			map[string]any{"sku": "y"},
+			map[string]any{"card": RedactMask, "sku": "z"},
+		},
+		"tags": []any{"t1", RedactMask},
+	}, out)
+	s.Equal("a@example.com", payload["user"].(map[string]any)["email"], "the original is left as is")
+	s.Equal("4111", payload["items"].([]any)[0].(map[string]any)["card"])
+
+	s.Equal(map[string]any{"id": "e1", "user": RedactMask, "items": payload["items"], "tags": payload["tags"]},
+		Redact(payload, []string{"user"}), "whole objects are masked")
+	s.Equal(map[string]any{"id": RedactMask, "user": RedactMask, "items": RedactMask, "tags": RedactMask},
+		Redact(payload, []string{"*"}))
+	s.Equal(payload, Redact(payload, nil))
+	s.Nil(Redact(nil, []string{"a"}))
+}
+
+func (s *UnitTestSuite) TestParseFieldPath() {
+	for path, want := range map[string][]string{
+		"a":          {"a"},
+		"a.b.c":      {"a", "b", "c"},
+		"a[0].b":     {"a", "[0]", "b"},
+		"a[*].b":     {"a", "*", "b"},
+		"a[].b[2]":   {"a", "*", "b", "[2]"},
+		"a[1][2].*":  {"a", "[1]", "[2]", "*"},
+		"user-email": {"user-email"},
+	} {
+		got, err := types.ParseFieldPath(path)
+		s.NoError(err, path)
+		s.Equal(want, got, path)
+	}
+	for _, path := range []string{"", ".a", "a.", "a..b", "[0]", "a[0", "a[x]", "a[0]b"} {
+		_, err := types.ParseFieldPath(path)
+		s.Error(err, path)
+	}
+
+	cc := types.ClientConfig{ClientID: "client", ClientName: "client", ClientKey: "client-key-123",
+		RedactFields: []string{"a[x]"}}
+	s.ErrorContains(cc.Validate(), "redact_fields")
+	cc.RedactFields = []string{"a.b", "c[*]"}
+	s.NoError(cc.Validate())
+}
+
+func (s *UnitTestSuite) TestRunRedacts() {
+	ctx := context.Background()
+	redact := []string{"user.email"}
+	payload := func(v string) map[string]any {
+		return map[string]any{"v": v, "user": map[string]any{"email": "a@example.com"}}
+	}
+
+	// Forwarded as is, and on an edge
+	for _, trig := range []types.TriggerConfig{{}, {FieldExpr: "v"}} {
+		cc := types.ClientConfig{Trigger: trig, RedactFields: redact}
+		p := payload("a")
+		action, _, out, err := Run(ctx, "c", "127.0.0.1", cc, newMemDataStore(), p)
+		s.NoError(err)
+		s.True(action == ForwardedAsIs || action == EdgeTriggeredForward)
+		s.Equal(RedactMask, out["user"].(map[string]any)["email"])
+		s.Equal("a", out["v"])
+		s.Equal("a@example.com", p["user"].(map[string]any)["email"], "the incoming payload is left as is")
+	}
+
+	// Aggregates redact every payload they include
+	cc := types.ClientConfig{RedactFields: redact, Trigger: types.TriggerConfig{
+		FieldExpr: "v", Flapping: &types.FlapConfig{WindowSeconds: 600, AggregateAt: 2, AggregateMaxItems: 10},
+	}}
+	store := newMemDataStore()
+	var agg map[string]any
+	for _, v := range []string{"a", "b", "a"} {
+		action, _, out, err := Run(ctx, "c", "127.0.0.1", cc, store, payload(v))
+		s.NoError(err)
+		if action == AggregateSent {
+			agg = out
+		}
+	}
+	s.Require().NotNil(agg)
+	items := agg["recent"].([]map[string]any)
+	s.NotEmpty(items)
+	for _, it := range items {
+		pl := it["payload"].(map[string]any)
+		s.Equal(RedactMask, pl["user"].(map[string]any)["email"])
+		s.NotEmpty(pl["v"])
+	}
+
+	// Stored payloads are redacted as they are decoded
+	edge := types.Edge{Recent: []types.Flip{{At: 1, From: "a", To: "b"}}}
+	encoded, err := EncodePayload(payload("b"))
+	s.NoError(err)
+	edge.Recent[0].Payload = encoded
+	pl := BuildAggregate(&edge, 1, redact...)["recent"].([]map[string]any)[0]["payload"].(map[string]any)
+	s.Equal(RedactMask, pl["user"].(map[string]any)["email"])
+	pl = BuildAggregate(&edge, 1)["recent"].([]map[string]any)[0]["payload"].(map[string]any)
+	s.Equal("a@example.com", pl["user"].(map[string]any)["email"])
+}
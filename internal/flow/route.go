@@ -0,0 +1,17 @@
+package flow
+
+import "enoti/internal/types"
+
+// RouteTarget returns the target of the first of routes matching the payload; false if none does. Routes whose
+// expression fails to evaluate or does not yield a boolean do not match.
+func RouteTarget(routes []types.RouteConfig, payload map[string]any) (types.TargetConfig, bool) {
+	for _, r := range routes {
+		if r.Match == "" {
+			return r.Target, true
+		}
+		if match, err := EvalAnyCompiled(r.Match, payload); err == nil && match == true {
+			return r.Target, true
+		}
+	}
+	return types.TargetConfig{}, false
+}
@@ -0,0 +1,38 @@
+package flow
+
+import "enoti/internal/types"
+
+func (s *UnitTestSuite) TestRouteTarget() {
+	critical := types.TargetConfig{SNSArn: "arn:critical"}
+	fallback := types.TargetConfig{SNSArn: "arn:fallback"}
+	routes := []types.RouteConfig{
+		{Match: "severity == 'critical'", Target: critical},
+		{Match: "severity", Target: types.TargetConfig{SNSArn: "arn:not-a-boolean"}},
+		{Match: "invalid ==", Target: types.TargetConfig{SNSArn: "arn:invalid"}},
+	}
+
+	t, ok := RouteTarget(routes, map[string]any{"severity": "critical"})
+	s.True(ok)
+	s.Equal(critical, t)
+	_, ok = RouteTarget(routes, map[string]any{"severity": "info"})
+	s.False(ok)
+	_, ok = RouteTarget(nil, map[string]any{"severity": "critical"})
+	s.False(ok)
+
+	// A route without a match is the default
+	t, ok = RouteTarget(append(routes, types.RouteConfig{Target: fallback}), map[string]any{"severity": "info"})
+	s.True(ok)
+	s.Equal(fallback, t)
+
+	// Routing replaces the targets of every selected trigger
+	cc := types.ClientConfig{Routes: routes, Triggers: []types.TriggerConfig{
+		{FieldExpr: "a", Targets: []types.TargetConfig{{SNSArn: "arn:a1"}, {SNSArn: "arn:a2"}}},
+		{FieldExpr: "b", Target: types.TargetConfig{SNSArn: "arn:b"}},
+	}}
+	for _, o := range SelectTriggers(cc, map[string]any{"a": 1, "b": 2, "severity": "critical"}) {
+		s.Equal([]types.TargetConfig{critical}, o.Trigger.AllTargets())
+	}
+	for _, o := range SelectTriggers(cc, map[string]any{"a": 1, "b": 2}) {
+		s.NotEqual([]types.TargetConfig{critical}, o.Trigger.AllTargets())
+	}
+}
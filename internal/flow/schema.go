@@ -0,0 +1,39 @@
+package flow
+
+import (
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// ValidatePayload checks payload against the client's PayloadSchema. It returns the violations found, each as
+// "<JSON pointer to the value>: <message>", none if the payload conforms or the client has no schema. The error is
+// that of compiling the schema.
+func ValidatePayload(cc types.ClientConfig, payload map[string]any) ([]string, error) {
+	sch, err := cc.Schema()
+	if err != nil || sch == nil {
+		return nil, err
+	}
+	err = sch.Validate(any(payload))
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return nil, err
+	}
+	var violations []string
+	for _, u := range verr.BasicOutput().Errors {
+		if u.Error == nil {
+			continue
+		}
+		loc := u.InstanceLocation
+		if loc == "" {
+			loc = "/"
+		}
+		violations = append(violations, fmt.Sprintf("%s: %s", loc, u.Error))
+	}
+	if len(violations) == 0 {
+		violations = []string{verr.Error()}
+	}
+	return violations, nil
+}
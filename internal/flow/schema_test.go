@@ -0,0 +1,46 @@
+package flow
+
+import (
+	"enoti/internal/types"
+)
+
+func (s *UnitTestSuite) TestValidatePayload() {
+	cc := types.ClientConfig{PayloadSchema: map[string]any{
+		"type":     "object",
+		"required": []any{"severity"},
+		"properties": map[string]any{
+			"severity": map[string]any{"enum": []any{"info", "warning", "critical"}},
+			"count":    map[string]any{"type": "integer", "minimum": uint64(0)}, // as decoded from YAML
+		},
+	}}
+
+	violations, err := ValidatePayload(cc, map[string]any{"severity": "critical", "count": float64(3)})
+	s.NoError(err)
+	s.Empty(violations)
+
+	violations, err = ValidatePayload(cc, map[string]any{"severity": "fatal", "count": float64(-1)})
+	s.NoError(err)
+	s.Len(violations, 2)
+	s.Contains(violations[0]+violations[1], "/severity: ")
+	s.Contains(violations[0]+violations[1], "/count: ")
+
+	violations, err = ValidatePayload(cc, map[string]any{})
+	s.NoError(err)
+	s.Len(violations, 1)
+	s.Contains(violations[0], "/: ")
+	s.Contains(violations[0], "severity")
+
+	// No schema accepts anything
+	violations, err = ValidatePayload(types.ClientConfig{}, map[string]any{"x": 1})
+	s.NoError(err)
+	s.Empty(violations)
+
+	// Broken and non self-contained schemas are rejected when the config is put
+	cc = types.ClientConfig{ClientID: "client", ClientName: "client", ClientKey: "client-key-123"}
+	cc.PayloadSchema = map[string]any{"type": "nope"}
+	s.ErrorContains(cc.Validate(), "payload_schema")
+	cc.PayloadSchema = map[string]any{"$ref": "file:///etc/passwd"}
+	s.ErrorContains(cc.Validate(), "self-contained")
+	cc.PayloadSchema = map[string]any{"type": "object"}
+	s.NoError(cc.Validate())
+}
@@ -0,0 +1,197 @@
+package flow
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/ratelimit"
+	"enoti/internal/types"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memDataStore is a minimal in-process ports.DataStore for unit tests.
+type memDataStore struct {
+	mu     sync.Mutex
+	edges  map[string]types.Edge
+	counts map[string]int
+	dedup  map[string]time.Time
+	bucket map[string]ratelimit.TokenBucket
+
+	// windows is the window of the last Acquire per scope.
+	windows map[string]time.Duration
+
+	// Number of edge state calls, for asserting which paths touch the store.
+	loads   int
+	upserts int
+
+	// consistentRead is the ports.ConsistentRead override seen by the last Load, if any.
+	consistentRead *bool
+
+	// acquireErr, when set, is returned by every Acquire and CountQuota call.
+	acquireErr error
+	// dataErr, when set, is returned by every Suppress, Load and UpsertCAS call.
+	dataErr error
+}
+
+func newMemDataStore() *memDataStore {
+	return &memDataStore{
+		edges:   map[string]types.Edge{},
+		counts:  map[string]int{},
+		dedup:   map[string]time.Time{},
+		bucket:  map[string]ratelimit.TokenBucket{},
+		windows: map[string]time.Duration{},
+	}
+}
+
+func (m *memDataStore) Acquire(ctx context.Context, scope string, ratePerWindow int, window time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.acquireErr != nil {
+		return false, m.acquireErr
+	}
+	m.windows[scope] = window
+	if capacity, ok := ports.TokenBucket(ctx); ok {
+		next, ok := m.bucket[scope].Take(time.Now().UnixMilli(), capacity, ratePerWindow, window)
+		if ok {
+			m.bucket[scope] = next
+			ports.ReportSlot(ctx, ports.TokenSlot)
+		}
+		return ok, nil
+	}
+	if m.counts[scope] >= ratePerWindow {
+		return false, nil
+	}
+	m.counts[scope]++
+	// Counts never reset: all slots are of the same window
+	ports.ReportSlot(ctx, "0")
+	return true, nil
+}
+
+func (m *memDataStore) Refund(ctx context.Context, scope, slot string, ratePerWindow int, window time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if capacity, ok := ports.TokenBucket(ctx); ok {
+		if b, ok := m.bucket[scope]; ok {
+			b.Tokens = min(float64(capacity), b.Tokens+1)
+			m.bucket[scope] = b
+		}
+		return nil
+	}
+	m.counts[scope] = max(0, m.counts[scope]-1)
+	return nil
+}
+
+// CountQuota counts in the rate counts; quota scopes are keyed by period, so they never need to expire.
+func (m *memDataStore) CountQuota(ctx context.Context, scope string, n, limit int, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.acquireErr != nil {
+		return false, m.acquireErr
+	}
+	if m.counts[scope]+max(n, 1) > limit {
+		return false, nil
+	}
+	m.counts[scope] += n
+	return true, nil
+}
+
+func (m *memDataStore) Suppress(ctx context.Context, clientID, hash string, window time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.dataErr != nil {
+		return false, m.dataErr
+	}
+	k := clientID + "/" + hash
+	now := time.Now()
+	if until, ok := m.dedup[k]; ok && now.Before(until) {
+		return true, nil
+	}
+	m.dedup[k] = now.Add(window)
+	return false, nil
+}
+
+func (m *memDataStore) Release(ctx context.Context, clientID, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.dedup, clientID+"/"+hash)
+	return nil
+}
+
+// Block keeps the expiry of the block with the dedup markers, whose keys all have a slash.
+func (m *memDataStore) Block(ctx context.Context, scope string, d time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dedup["block:"+scope] = time.Now().Add(d)
+	return nil
+}
+
+func (m *memDataStore) Blocked(ctx context.Context, scope string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return time.Now().Before(m.dedup["block:"+scope]), nil
+}
+
+func (m *memDataStore) Load(ctx context.Context, clientID, scopeKey string) (*types.Edge, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loads++
+	if m.dataErr != nil {
+		return nil, 0, m.dataErr
+	}
+	m.consistentRead = nil
+	if v, ok := ports.ConsistentRead(ctx); ok {
+		m.consistentRead = &v
+	}
+	e, ok := m.edges[clientID+"/"+scopeKey]
+	if !ok {
+		return nil, 0, nil
+	}
+	return &e, e.Version, nil
+}
+
+func (m *memDataStore) UpsertCAS(ctx context.Context, clientID, scopeKey string, prevVersion int64, next types.Edge) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.upserts++
+	if m.dataErr != nil {
+		return false, m.dataErr
+	}
+	k := clientID + "/" + scopeKey
+	cur, ok := m.edges[k]
+	if (prevVersion == 0 && ok) || (prevVersion != 0 && (!ok || cur.Version != prevVersion)) {
+		return false, nil
+	}
+	next.ScopeKey = scopeKey
+	next.Version = prevVersion + 1
+	m.edges[k] = next
+	return true, nil
+}
+
+func (m *memDataStore) DeleteEdge(ctx context.Context, clientID, scopeKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.dataErr != nil {
+		return m.dataErr
+	}
+	delete(m.edges, clientID+"/"+scopeKey)
+	return nil
+}
+
+func (m *memDataStore) ScanPendingAggregates(ctx context.Context) ([]types.PendingEdge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pending []types.PendingEdge
+	for k, e := range m.edges {
+		if len(e.Recent) > 0 {
+			// Scope keys never contain a slash
+			i := strings.LastIndex(k, "/")
+			pending = append(pending, types.PendingEdge{ClientID: k[:i], Edge: e, Version: e.Version})
+		}
+	}
+	return pending, nil
+}
+
+func (m *memDataStore) Ping(context.Context) error {
+	return nil
+}
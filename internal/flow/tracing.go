@@ -0,0 +1,36 @@
+package flow
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name of the spans enoti creates.
+const TracerName = "enoti"
+
+// Attributes set on the spans of the flow.
+const (
+	AttrClientID  = attribute.Key("client_id")
+	AttrScopeKey  = attribute.Key("scope_key")
+	AttrAction    = attribute.Key("action")
+	AttrFlipCount = attribute.Key("flip_count")
+)
+
+// StartSpan starts a span named name, a child of the span in ctx if any. Spans come from the global tracer provider,
+// so they are no-ops unless the process configures one.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan ends span, recording err as its status if it is not nil.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -1,6 +1,7 @@
 package flow
 
 import (
+	"container/list"
 	"enoti/internal/types"
 	"sync"
 	"time"
@@ -8,42 +9,150 @@ import (
 
 // TTL is a minimal in-process TTL cache to trim backend reads on hot paths.
 // Caller chooses sensible TTL (e.g., 30–60s for client config).
-// Lazy expiration on Get.
+// Lazy expiration on Get. A TTL made by NewTTLWithMaxEntries holds at most that many entries, evicting the least
+// recently used ones, so that keys never read again do not pile up; one made by NewTTLWithJanitor removes them once
+// expired.
 type TTL[K comparable, V any] struct {
 	mu   sync.RWMutex
 	data map[K]entry[V]
+	// maxEntries bounds the entries when lru is set.
+	maxEntries int
+	// lru orders the keys from the most to the least recently used; nil if the cache is unbounded.
+	lru *list.List
+
+	// stop stops the janitor, if any; see Close.
+	stop      chan struct{}
+	closeOnce sync.Once
 }
 
 type entry[V any] struct {
 	val V
 	exp time.Time
+	// elem is the key in TTL.lru, if any.
+	elem *list.Element
 }
 
 func NewTTL[K comparable, V any]() *TTL[K, V] {
 	return &TTL[K, V]{data: make(map[K]entry[V])}
 }
 
+// NewTTLWithMaxEntries returns a TTL holding at most maxEntries entries: setting another evicts the least recently
+// set or gotten one, expired or not. maxEntries <= 0 is unbounded, as NewTTL.
+func NewTTLWithMaxEntries[K comparable, V any](maxEntries int) *TTL[K, V] {
+	t := NewTTL[K, V]()
+	if maxEntries > 0 {
+		t.maxEntries, t.lru = maxEntries, list.New()
+	}
+	return t
+}
+
+// NewTTLWithJanitor returns a TTL whose expired entries are removed every interval by a goroutine of its own, until
+// Close is called.
+func NewTTLWithJanitor[K comparable, V any](interval time.Duration) *TTL[K, V] {
+	t := NewTTL[K, V]()
+	t.stop = make(chan struct{})
+	go t.janitor(interval)
+	return t
+}
+
+// janitor sweeps the expired entries every interval until t is closed.
+func (t *TTL[K, V]) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.sweep()
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// sweep removes the expired entries.
+func (t *TTL[K, V]) sweep() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for k, e := range t.data {
+		if now.After(e.exp) {
+			t.remove(k, e)
+		}
+	}
+}
+
+// Close stops the janitor of t, if any. The cache itself can still be used.
+func (t *TTL[K, V]) Close() {
+	if t.stop != nil {
+		t.closeOnce.Do(func() { close(t.stop) })
+	}
+}
+
 // Get returns the value and true if found and not expired; otherwise zero value and false.
 func (t *TTL[K, V]) Get(k K) (V, bool) {
-	t.mu.RLock()
+	var zero V
+	if t.lru == nil {
+		t.mu.RLock()
+		e, ok := t.data[k]
+		t.mu.RUnlock()
+		if !ok || time.Now().After(e.exp) {
+			return zero, false
+		}
+		return e.val, true
+	}
+	// Reads reorder the LRU list of bounded caches
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	e, ok := t.data[k]
-	t.mu.RUnlock()
 	if !ok || time.Now().After(e.exp) {
-		var zero V
 		return zero, false
 	}
+	t.lru.MoveToFront(e.elem)
 	return e.val, true
 }
 
 func (t *TTL[K, V]) Set(k K, v V, ttl time.Duration) {
 	t.mu.Lock()
-	t.data[k] = entry[V]{val: v, exp: time.Now().Add(ttl)}
-	t.mu.Unlock()
+	defer t.mu.Unlock()
+	e := entry[V]{val: v, exp: time.Now().Add(ttl)}
+	if t.lru != nil {
+		if old, ok := t.data[k]; ok {
+			e.elem = old.elem
+			t.lru.MoveToFront(e.elem)
+		} else {
+			e.elem = t.lru.PushFront(k)
+			if t.lru.Len() > t.maxEntries {
+				oldest := t.lru.Remove(t.lru.Back()).(K)
+				delete(t.data, oldest)
+			}
+		}
+	}
+	t.data[k] = e
 }
 
+// Delete removes k, if present.
+func (t *TTL[K, V]) Delete(k K) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.data[k]; ok {
+		t.remove(k, e)
+	}
+}
+
+// remove removes the entry e of k; t.mu must be held.
+func (t *TTL[K, V]) remove(k K, e entry[V]) {
+	if e.elem != nil {
+		t.lru.Remove(e.elem)
+	}
+	delete(t.data, k)
+}
+
+// ConfigCacheMaxEntries bounds the client configs cached by the process, and by engines made by NewEngine.
+const ConfigCacheMaxEntries = 10_000
+
 // cfgCache is a small TTL cache avoids a read per request on client config.
 var cfgCache *TTL[string, types.ClientConfig]
 
 func init() {
-	cfgCache = NewTTL[string, types.ClientConfig]()
+	cfgCache = NewTTLWithMaxEntries[string, types.ClientConfig](ConfigCacheMaxEntries)
 }
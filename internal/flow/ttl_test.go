@@ -15,3 +15,81 @@ func (s *UnitTestSuite) TestTTLCache() {
 	s.Equal("", v)
 
 }
+
+func (s *UnitTestSuite) TestTTLCacheMaxEntries() {
+	c := NewTTLWithMaxEntries[int, int](3)
+	for k := range 3 {
+		c.Set(k, k, time.Minute)
+	}
+	// 0 is read, so 1 is the least recently used
+	_, ok := c.Get(0)
+	s.True(ok)
+	c.Set(3, 3, time.Minute)
+	_, ok = c.Get(1)
+	s.False(ok, "evicted")
+	// Setting an existing key uses it without growing the cache
+	c.Set(2, 20, time.Minute)
+	c.Set(4, 4, time.Minute)
+	_, ok = c.Get(0)
+	s.False(ok, "evicted")
+	for k, want := range map[int]int{2: 20, 3: 3, 4: 4} {
+		v, ok := c.Get(k)
+		s.True(ok, k)
+		s.Equal(want, v, k)
+	}
+	s.Len(c.data, 3)
+	s.Equal(3, c.lru.Len())
+
+	// More keys than the cap
+	for k := range 100 {
+		c.Set(k, k, time.Minute)
+	}
+	s.Len(c.data, 3)
+	for k := 97; k < 100; k++ {
+		_, ok := c.Get(k)
+		s.True(ok, k)
+	}
+
+	c.Delete(99)
+	s.Len(c.data, 2)
+	s.Equal(2, c.lru.Len())
+}
+
+func (s *UnitTestSuite) TestTTLCacheJanitor() {
+	c := NewTTLWithJanitor[int, int](20 * time.Millisecond)
+	defer c.Close()
+	for k := range 10 {
+		c.Set(k, k, 10*time.Millisecond)
+	}
+	c.Set(10, 10, time.Minute)
+	size := func() int {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return len(c.data)
+	}
+	s.Equal(11, size())
+
+	// Expired entries are removed though never read again, while Get and Set keep going
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 200 {
+			c.Set(100+i%5, i, time.Minute)
+			_, _ = c.Get(i % 11)
+		}
+	}()
+	s.Eventually(func() bool { return size() == 6 }, time.Second, 5*time.Millisecond)
+	<-done
+	v, ok := c.Get(10)
+	s.True(ok)
+	s.Equal(10, v)
+
+	// Closed, the cache no longer shrinks but still works
+	c.Close()
+	c.Close()
+	c.Set(20, 20, time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+	s.Equal(7, size())
+	_, ok = c.Get(20)
+	s.False(ok)
+}
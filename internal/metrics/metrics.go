@@ -0,0 +1,22 @@
+// Package metrics holds the process-wide counters, published with expvar (see Handler).
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+)
+
+var (
+	// AuthFailures counts authentication failures by client ID ("unknown" for unknown clients).
+	AuthFailures = expvar.NewMap("auth_failures")
+	// AuthIPBlocks counts IPs blocked after repeated authentication failures.
+	AuthIPBlocks = expvar.NewInt("auth_ip_blocks")
+	// AuthBlockedRequests counts requests rejected because their source IP is blocked.
+	AuthBlockedRequests = expvar.NewInt("auth_blocked_requests")
+	// FailOpen counts data store errors ignored per a client's fail-open mode, by stage ("rate_limit", "dedup",
+	// "edge").
+	FailOpen = expvar.NewMap("fail_open")
+)
+
+// Handler serves all counters as JSON.
+func Handler() http.Handler { return expvar.Handler() }
@@ -17,8 +17,25 @@ type ClientStore interface {
 
 	PutClientConfig(ctx context.Context, clientID string, config types.ClientConfig) error
 
+	// PutClientConfigCAS writes config at version expectedVersion+1, only if the stored config is at
+	// expectedVersion: 0 for a client not stored yet or stored before versioning. It MUST return a
+	// types.ErrVersionConflict otherwise, checking and writing atomically.
+	PutClientConfigCAS(ctx context.Context, clientID string, expectedVersion int64, config types.ClientConfig) error
+
 	DeleteClientConfig(ctx context.Context, clientID string) error
 
+	// Ping checks that the store is reachable, for health checks.
+	Ping(ctx context.Context) error
+
 	// ClearAll purges all client configurations and data. Used in tests only.
 	ClearAll(ctx context.Context) error
 }
+
+// ClientPager is implemented by client stores that can list clients a page at a time, for callers that want bounded
+// results.
+type ClientPager interface {
+	// ListClientsPage returns up to limit client IDs, 0 for the store's page size, from cursor, "" for the first
+	// page, and the cursor of the next page, "" after the last. Pages before the last may hold fewer IDs than limit,
+	// even none.
+	ListClientsPage(ctx context.Context, cursor string, limit int) (clientIDs []string, next string, err error)
+}
@@ -7,7 +7,7 @@ import (
 )
 
 // DataStore persists edge-detection state + flapping counters. It also provides
-// a simple rate-limiter for the Acquire() method.
+// a simple rate-limiter for the Acquire() method and dedup markers for Suppress().
 // Implementations MUST support compare-and-set (CAS) semantics to avoid races.
 type DataStore interface {
 	// Acquire attempts a slot in the given scope for the provided window.
@@ -15,6 +15,33 @@ type DataStore interface {
 	// Returns (true,nil) if granted; (false,nil) if rate-limited.
 	Acquire(ctx context.Context, scope string, ratePerWindow int, window time.Duration) (bool, error)
 
+	// Refund gives back the slot of scope granted by an Acquire with the same rate, window and strategy (see
+	// WithTokenBucket), e.g. when the event is denied by another limit after all. slot is the one the Acquire
+	// reported (see WithSlot), so that the very slot is given back even if the window rolled over since: the count
+	// of the window it was counted in goes down by one, the request it logged is removed, or the bucket gets a
+	// token back, up to its capacity.
+	Refund(ctx context.Context, scope, slot string, ratePerWindow int, window time.Duration) error
+
+	// CountQuota adds n to the counter of scope unless that would take it past limit, and reports whether it did;
+	// with n 0, it only reports whether the counter is below limit. The counter expires ttl after it was last added
+	// to: scopes are meant for a single period, e.g. "QUOTA:<client>:<yyyymmdd>", with a ttl outlasting it.
+	CountQuota(ctx context.Context, scope string, n, limit int, ttl time.Duration) (bool, error)
+
+	// Suppress records hash for the client for window and reports whether it was already recorded within the
+	// window, i.e. whether the event it identifies is a duplicate.
+	Suppress(ctx context.Context, clientID, hash string, window time.Duration) (bool, error)
+
+	// Release removes the record of hash for the client made by Suppress, if any, so that the event it identifies
+	// is no longer taken for a duplicate, e.g. after failing to process it.
+	Release(ctx context.Context, clientID, hash string) error
+
+	// Block blocks scope for d, replacing any block it has; d <= 0 lifts the block. Blocks are shared by every
+	// instance using the store, e.g. the IPs locked out after repeated authentication failures.
+	Block(ctx context.Context, scope string, d time.Duration) error
+
+	// Blocked reports whether scope is currently blocked by Block.
+	Blocked(ctx context.Context, scope string) (bool, error)
+
 	// Load returns the edge state and a monotonic version suitable for CAS.
 	// If no state exists, (nil,0,nil) MUST be returned.
 	Load(ctx context.Context, clientID, scopeKey string) (*types.Edge, int64, error)
@@ -23,4 +50,104 @@ type DataStore interface {
 	// If prevVersion==0, the item MUST NOT already exist.
 	// Returns true on success (committed), false if precondition failed, error for I/O.
 	UpsertCAS(ctx context.Context, clientID, scopeKey string, prevVersion int64, next types.Edge) (bool, error)
+
+	// DeleteEdge removes the edge state, so that the next event of the scope starts afresh as the first one.
+	// Removing state that does not exist is not an error.
+	DeleteEdge(ctx context.Context, clientID, scopeKey string) error
+
+	// ScanPendingAggregates returns the edge states of all clients that have flips buffered in Recent, each with
+	// its version for UpsertCAS. Whether they are due to be sent is up to the caller.
+	ScanPendingAggregates(ctx context.Context) ([]types.PendingEdge, error)
+
+	// Ping checks that the store is reachable, for health checks.
+	Ping(ctx context.Context) error
+}
+
+type consistentReadCtx struct{}
+
+// WithConsistentRead overrides, for Load calls made with the returned context, whether the edge state is read
+// strongly consistent. Backends without a choice of read consistency ignore it.
+func WithConsistentRead(ctx context.Context, consistent bool) context.Context {
+	return context.WithValue(ctx, consistentReadCtx{}, consistent)
+}
+
+// ConsistentRead returns the override set by WithConsistentRead, if any.
+func ConsistentRead(ctx context.Context) (consistent bool, ok bool) {
+	consistent, ok = ctx.Value(consistentReadCtx{}).(bool)
+	return
+}
+
+type flapWindowCtx struct{}
+
+// WithFlapWindow tells UpsertCAS calls made with the returned context the flapping window of the trigger owning the
+// edge state, so that backends expiring edge state keep it well beyond the window (see EdgeTTL).
+func WithFlapWindow(ctx context.Context, window time.Duration) context.Context {
+	return context.WithValue(ctx, flapWindowCtx{}, window)
+}
+
+// EdgeTTL returns how long a backend configured to expire edge state after ttl without writes keeps the state
+// written by UpsertCAS with ctx: the longer of ttl and four flapping windows (see WithFlapWindow). It returns 0, no
+// expiry, if ttl is 0.
+func EdgeTTL(ctx context.Context, ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return 0
+	}
+	window, _ := ctx.Value(flapWindowCtx{}).(time.Duration)
+	return max(ttl, 4*window)
+}
+
+type tokenBucketCtx struct{}
+
+// WithTokenBucket makes Acquire calls made with the returned context use a token bucket holding up to capacity
+// tokens, refilled at ratePerWindow per window, instead of counting acquires per window. This allows bursts of up
+// to capacity while keeping the same average rate.
+func WithTokenBucket(ctx context.Context, capacity int) context.Context {
+	return context.WithValue(ctx, tokenBucketCtx{}, capacity)
+}
+
+// TokenBucket returns the bucket capacity set by WithTokenBucket, if any.
+func TokenBucket(ctx context.Context) (capacity int, ok bool) {
+	capacity, ok = ctx.Value(tokenBucketCtx{}).(int)
+	return
+}
+
+// Quota is the state of a rate limit scope after an Acquire: Remaining of Limit acquires are left, and Reset is
+// how long until more become available.
+type Quota struct {
+	Limit     int
+	Remaining int
+	Reset     time.Duration
+}
+
+type quotaCtx struct{}
+
+// WithQuota makes Acquire calls made with the returned context report the quota of their scope into q, each call
+// overwriting the previous report. Backends that cannot tell leave q untouched.
+func WithQuota(ctx context.Context, q *Quota) context.Context {
+	return context.WithValue(ctx, quotaCtx{}, q)
+}
+
+// ReportQuota stores q into the Quota set by WithQuota, if any. It is called by the backends from Acquire.
+func ReportQuota(ctx context.Context, q Quota) {
+	if dst, ok := ctx.Value(quotaCtx{}).(*Quota); ok && dst != nil {
+		*dst = q
+	}
+}
+
+// TokenSlot is the slot reported by Acquire calls taking a token from a bucket: tokens are all alike.
+const TokenSlot = "token"
+
+type slotCtx struct{}
+
+// WithSlot makes Acquire calls made with the returned context report the slot they grant into slot, for Refund to
+// give it back. Backends report a slot for every granted acquire; denied ones leave slot untouched.
+func WithSlot(ctx context.Context, slot *string) context.Context {
+	return context.WithValue(ctx, slotCtx{}, slot)
+}
+
+// ReportSlot stores slot into the string set by WithSlot, if any. It is called by the backends from Acquire.
+func ReportSlot(ctx context.Context, slot string) {
+	if dst, ok := ctx.Value(slotCtx{}).(*string); ok && dst != nil {
+		*dst = slot
+	}
 }
@@ -1,7 +1,93 @@
 package ports
 
-import "context"
+import (
+	"context"
+	"enoti/internal/types"
+)
 
 type Publisher interface {
 	PublishRaw(ctx context.Context, arn string, payload []byte) error
 }
+
+type publishKeyCtx struct{}
+
+// WithPublishKey attaches the message key (the edge scope key) for the payload being published.
+// Publishers that support partitioning or grouping MAY use it; others ignore it.
+func WithPublishKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, publishKeyCtx{}, key)
+}
+
+// PublishKey returns the key set by WithPublishKey, or "" if none.
+func PublishKey(ctx context.Context) string {
+	k, _ := ctx.Value(publishKeyCtx{}).(string)
+	return k
+}
+
+type publishValueCtx struct{}
+
+// WithPublishValue attaches the trigger value of the payload being published, for publishers that act on it.
+func WithPublishValue(ctx context.Context, v string) context.Context {
+	return context.WithValue(ctx, publishValueCtx{}, v)
+}
+
+// PublishValue returns the value set by WithPublishValue, or "" if none.
+func PublishValue(ctx context.Context) string {
+	v, _ := ctx.Value(publishValueCtx{}).(string)
+	return v
+}
+
+type publishIDCtx struct{}
+
+// WithPublishID attaches the ID of the event being published, the ID of the request or message that carried it,
+// for publishers that identify messages. It stays the same when the event is sent again.
+func WithPublishID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, publishIDCtx{}, id)
+}
+
+// PublishID returns the ID set by WithPublishID, or "" if none.
+func PublishID(ctx context.Context) string {
+	id, _ := ctx.Value(publishIDCtx{}).(string)
+	return id
+}
+
+type publishDedupIDCtx struct{}
+
+// WithPublishDedupID attaches the deduplication ID of the payload being published, for publishers to targets that
+// deduplicate messages (e.g. SNS FIFO topics). It identifies the payload before any per-target wrapping.
+func WithPublishDedupID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, publishDedupIDCtx{}, id)
+}
+
+// PublishDedupID returns the ID set by WithPublishDedupID, or "" if none.
+func PublishDedupID(ctx context.Context) string {
+	id, _ := ctx.Value(publishDedupIDCtx{}).(string)
+	return id
+}
+
+type publishTargetCtx struct{}
+
+// WithPublishTarget attaches the target config the payload is being published to, for publishers that need
+// per-target settings beyond the destination.
+func WithPublishTarget(ctx context.Context, t types.TargetConfig) context.Context {
+	return context.WithValue(ctx, publishTargetCtx{}, t)
+}
+
+// PublishTarget returns the target set by WithPublishTarget, if any.
+func PublishTarget(ctx context.Context) (types.TargetConfig, bool) {
+	t, ok := ctx.Value(publishTargetCtx{}).(types.TargetConfig)
+	return t, ok
+}
+
+type publishAttributesCtx struct{}
+
+// WithPublishAttributes attaches the values of the payload fields the targets publish as message attributes (see
+// TargetConfig.AttributeFields), by JMESPath expression. Values are strings or float64 numbers.
+func WithPublishAttributes(ctx context.Context, attrs map[string]any) context.Context {
+	return context.WithValue(ctx, publishAttributesCtx{}, attrs)
+}
+
+// PublishAttributes returns the values set by WithPublishAttributes, or nil if none.
+func PublishAttributes(ctx context.Context) map[string]any {
+	attrs, _ := ctx.Value(publishAttributesCtx{}).(map[string]any)
+	return attrs
+}
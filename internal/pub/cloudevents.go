@@ -0,0 +1,79 @@
+package pub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+const (
+	// CloudEventsContentType is the content type of messages wrapped in a CloudEvents envelope.
+	CloudEventsContentType = "application/cloudevents+json"
+	// DefaultCloudEventsType and DefaultCloudEventsSource are the event type and source of targets without their own.
+	DefaultCloudEventsType   = "enoti.notification"
+	DefaultCloudEventsSource = "enoti"
+)
+
+// CloudEvent is a CloudEvents 1.0 event in the JSON format.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	Type            string          `json:"type"`
+	Source          string          `json:"source"`
+	ID              string          `json:"id"`
+	Time            string          `json:"time"`
+	Subject         string          `json:"subject,omitempty"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// wrapCloudEvent wraps payload, published to the target, in a CloudEvents envelope. The event ID is the publish ID
+// (see ports.PublishID) and the edge scope, so that an event sent again keeps its ID and consumers can deduplicate;
+// it is random if there is no publish ID. The scope is the subject as well. A payload that is not JSON, e.g. from a
+// template, is carried as a string.
+func wrapCloudEvent(ctx context.Context, t types.TargetConfig, payload []byte) ([]byte, error) {
+	ev := CloudEvent{
+		SpecVersion:     "1.0",
+		Type:            t.CloudEventsType,
+		Source:          t.CloudEventsSource,
+		ID:              ports.PublishID(ctx),
+		Time:            time.Now().UTC().Format(time.RFC3339Nano),
+		Subject:         ports.PublishKey(ctx),
+		DataContentType: "application/json",
+		Data:            payload,
+	}
+	if ev.Type == "" {
+		ev.Type = DefaultCloudEventsType
+	}
+	if ev.Source == "" {
+		ev.Source = DefaultCloudEventsSource
+	}
+	if ev.ID == "" {
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		ev.ID = hex.EncodeToString(b)
+	} else if ev.Subject != "" {
+		ev.ID += ":" + ev.Subject
+	}
+	if !json.Valid(payload) {
+		data, err := json.Marshal(string(payload))
+		if err != nil {
+			return nil, err
+		}
+		ev.DataContentType, ev.Data = "text/plain", data
+	}
+	return json.Marshal(ev)
+}
+
+// contentType returns the content type of the messages published with ctx: CloudEventsContentType for targets
+// wrapping them in CloudEvents, JSON otherwise.
+func contentType(ctx context.Context) string {
+	if t, ok := ports.PublishTarget(ctx); ok && t.CloudEvents {
+		return CloudEventsContentType
+	}
+	return "application/json"
+}
@@ -0,0 +1,76 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/segmentio/kafka-go"
+)
+
+func (s *UnitTestSuite) TestCloudEventsEnvelope() {
+	w := &fakeKafkaWriter{}
+	target := types.TargetConfig{KafkaTopic: "alerts", CloudEvents: true, CloudEventsType: "com.example.alert",
+		CloudEventsSource: "/monitoring/eu-1"}
+	p := ForTargets(NewKafka(w), []types.TargetConfig{target})
+	ctx := ports.WithPublishKey(ports.WithPublishID(context.Background(), "req-1"), "e42")
+	data := `{"status":"down","host":{"name":"db-1","cpu":97.5},"tags":["a","b"]}`
+
+	s.Require().NoError(p.PublishRaw(ctx, "", []byte(data)))
+	s.Require().Len(w.msgs, 1)
+	s.Equal([]kafka.Header{{Key: "content-type", Value: []byte(CloudEventsContentType)}}, w.msgs[0].Headers)
+	var ev CloudEvent
+	s.Require().NoError(json.Unmarshal(w.msgs[0].Value, &ev))
+	s.Equal("1.0", ev.SpecVersion)
+	s.Equal("com.example.alert", ev.Type)
+	s.Equal("/monitoring/eu-1", ev.Source)
+	s.Equal("req-1:e42", ev.ID)
+	s.Equal("e42", ev.Subject)
+	s.Equal("application/json", ev.DataContentType)
+	at, err := time.Parse(time.RFC3339Nano, ev.Time)
+	s.NoError(err)
+	s.WithinDuration(time.Now(), at, time.Minute)
+	s.JSONEq(data, string(ev.Data), "data round-trips")
+
+	// The same event sent again keeps its ID
+	s.Require().NoError(p.PublishRaw(ctx, "", []byte(data)))
+	var again CloudEvent
+	s.Require().NoError(json.Unmarshal(w.msgs[1].Value, &again))
+	s.Equal(ev.ID, again.ID)
+
+	// Defaults, a random ID without a publish ID, and bodies that are not JSON
+	target = types.TargetConfig{KafkaTopic: "alerts", CloudEvents: true}
+	s.Require().NoError(ForTargets(NewKafka(w), []types.TargetConfig{target}).
+		PublishRaw(context.Background(), "", []byte("db-1 is down")))
+	var plain CloudEvent
+	s.Require().NoError(json.Unmarshal(w.msgs[2].Value, &plain))
+	s.Equal(DefaultCloudEventsType, plain.Type)
+	s.Equal(DefaultCloudEventsSource, plain.Source)
+	s.Len(plain.ID, 32)
+	s.Equal("text/plain", plain.DataContentType)
+	s.Equal(`"db-1 is down"`, string(plain.Data))
+
+	// Targets without it are published as is
+	s.Require().NoError(ForTargets(NewKafka(w), []types.TargetConfig{{KafkaTopic: "alerts"}}).
+		PublishRaw(ctx, "", []byte(data)))
+	s.Equal(data, string(w.msgs[3].Value))
+	s.Equal("application/json", string(w.msgs[3].Headers[0].Value))
+
+	s.ErrorContains(types.TargetConfig{SlackWebhookURL: "https://hooks.slack.com/x", CloudEvents: true}.Validate(),
+		"cloudevents")
+}
+
+func (s *UnitTestSuite) TestSNSCloudEventsContentType() {
+	var last snsPublished
+	p := s.fakeSNS(&last)
+	topic := "arn:aws:sns:us-east-1:000000000000:t"
+
+	s.Require().NoError(ForTargets(p, []types.TargetConfig{{SNSArn: topic}}).
+		PublishRaw(context.Background(), "", []byte(`{}`)))
+	s.Equal("application/json", last.Attributes["content-type"].Value)
+	s.Require().NoError(ForTargets(p, []types.TargetConfig{{SNSArn: topic, CloudEvents: true}}).
+		PublishRaw(context.Background(), "", []byte(`{}`)))
+	s.Equal(CloudEventsContentType, last.Attributes["content-type"].Value)
+}
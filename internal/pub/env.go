@@ -0,0 +1,130 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+const (
+	PublisherEnvKey = "PUBLISHER"
+	PublisherSNS    = "sns"
+	PublisherSQS    = "sqs"
+	PublisherHTTP   = "http"
+	PublisherStdout = "stdout"
+
+	SNSEndpointKey   = "SNS_ENDPOINT"
+	SQSEndpointKey   = "SQS_ENDPOINT"
+	EBEndpointKey    = "EVENTBRIDGE_ENDPOINT"
+	PublisherURLKey  = "PUBLISHER_URL"
+	DeadLetterKey    = "DEAD_LETTER_TARGET"
+	DefaultAWSRegion = "us-east-1"
+)
+
+// PublisherFromEnv constructs the default Publisher based on environment variables.
+// Supported publishers are "sns", "sqs", "http" and "stdout". It checks the "PUBLISHER" env var to determine
+// which one to use, then reads additional env vars depending on it:
+//   - sns: SNS_ENDPOINT, for a local mock
+//   - sqs: SQS_ENDPOINT, for a local mock; destinations are queue URLs
+//   - http: PUBLISHER_URL, a fixed URL to POST to; unset posts to each destination
+//
+// Default to PublisherSNS if unspecified; any other value is an error, so that a mistyped one is not taken for SNS.
+func PublisherFromEnv() (ports.Publisher, error) {
+	switch v := os.Getenv(PublisherEnvKey); v {
+	case PublisherSQS:
+		return sqsFromEnv()
+
+	case PublisherHTTP:
+		return NewHTTP(os.Getenv(PublisherURLKey), nil), nil
+
+	case PublisherStdout:
+		return NewStdout(os.Stdout), nil
+
+	case PublisherSNS, "":
+		return snsFromEnv()
+
+	default:
+		return nil, fmt.Errorf("invalid %s %q: want %s, %s, %s or %s", PublisherEnvKey, v,
+			PublisherSNS, PublisherSQS, PublisherHTTP, PublisherStdout)
+	}
+}
+
+// snsFromEnv constructs the SNS publisher, honoring SNS_ENDPOINT for a local mock.
+func snsFromEnv() (ports.Publisher, error) {
+	awsCfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	endpoint := os.Getenv(SNSEndpointKey)
+	return NewSNS(awsCfg, func(o *sns.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			localAWSOptions(&o.Region, &o.Credentials)
+		}
+	}), nil
+}
+
+// sqsFromEnv constructs the SQS publisher, honoring SQS_ENDPOINT for a local mock.
+func sqsFromEnv() (ports.Publisher, error) {
+	awsCfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	endpoint := os.Getenv(SQSEndpointKey)
+	return NewSQS(awsCfg, func(o *sqs.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			localAWSOptions(&o.Region, &o.Credentials)
+		}
+	}), nil
+}
+
+// DeadLetterFromEnv returns the dead-letter destination in "DEAD_LETTER_TARGET", an SNS topic ARN or an SQS queue
+// URL, and the publisher sending to it. Both are empty when the variable is unset.
+func DeadLetterFromEnv() (ports.Publisher, string, error) {
+	dest := os.Getenv(DeadLetterKey)
+	switch {
+	case dest == "":
+		return nil, "", nil
+	case strings.HasPrefix(dest, "arn:aws:sns:"):
+		p, err := snsFromEnv()
+		return p, dest, err
+	case strings.HasPrefix(dest, "https://") || strings.HasPrefix(dest, "http://"):
+		p, err := sqsFromEnv()
+		return p, dest, err
+	default:
+		return nil, "", fmt.Errorf("invalid %s %q: want an SNS topic ARN or an SQS queue URL", DeadLetterKey, dest)
+	}
+}
+
+// EventBridgeFromEnv constructs the publisher for EventBridge targets, honoring EVENTBRIDGE_ENDPOINT for a local mock.
+func EventBridgeFromEnv() (ports.Publisher, error) {
+	awsCfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	endpoint := os.Getenv(EBEndpointKey)
+	return NewEventBridge(eventbridge.NewFromConfig(awsCfg, func(o *eventbridge.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			localAWSOptions(&o.Region, &o.Credentials)
+		}
+	})), nil
+}
+
+// localAWSOptions fills in a region and static credentials for a local AWS mock.
+func localAWSOptions(region *string, creds *aws.CredentialsProvider) {
+	if *region == "" {
+		*region = DefaultAWSRegion
+	}
+	*creds = credentials.NewStaticCredentialsProvider("test", "test", "")
+}
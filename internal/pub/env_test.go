@@ -0,0 +1,58 @@
+package pub
+
+func (s *UnitTestSuite) TestPublisherFromEnv() {
+	s.T().Setenv("AWS_REGION", "us-west-2")
+	s.T().Setenv(SNSEndpointKey, "http://localhost:4566")
+	s.T().Setenv(SQSEndpointKey, "http://localhost:4566")
+
+	cases := map[string]any{
+		"":              &snsPub{},
+		PublisherSNS:    &snsPub{},
+		PublisherSQS:    &sqsPub{},
+		PublisherHTTP:   &httpPub{},
+		PublisherStdout: &stdoutPub{},
+	}
+	for name, want := range cases {
+		s.T().Setenv(PublisherEnvKey, name)
+		p, err := PublisherFromEnv()
+		s.NoError(err, name)
+		s.IsType(want, p, name)
+	}
+
+	s.T().Setenv(PublisherEnvKey, "SNS")
+	_, err := PublisherFromEnv()
+	s.ErrorContains(err, PublisherEnvKey)
+
+	s.T().Setenv(PublisherEnvKey, PublisherHTTP)
+	s.T().Setenv(PublisherURLKey, "http://example.com/hook")
+	p, err := PublisherFromEnv()
+	s.NoError(err)
+	s.Equal("http://example.com/hook", p.(*httpPub).endpoint)
+}
+
+func (s *UnitTestSuite) TestDeadLetterFromEnv() {
+	s.T().Setenv("AWS_REGION", "us-west-2")
+	s.T().Setenv(DeadLetterKey, "")
+	p, dest, err := DeadLetterFromEnv()
+	s.NoError(err)
+	s.Nil(p)
+	s.Empty(dest)
+
+	cases := map[string]any{
+		"arn:aws:sns:us-east-1:000000000000:enoti-dlq":                   &snsPub{},
+		"https://sqs.us-east-1.amazonaws.com/000000000000/enoti-dlq":     &sqsPub{},
+		"http://localhost:4566/000000000000/enoti-dlq":                   &sqsPub{},
+		"arn:aws:sqs:us-east-1:000000000000:enoti-dlq (not a queue URL)": nil,
+	}
+	for target, want := range cases {
+		s.T().Setenv(DeadLetterKey, target)
+		p, dest, err := DeadLetterFromEnv()
+		if want == nil {
+			s.ErrorContains(err, DeadLetterKey, target)
+			continue
+		}
+		s.NoError(err, target)
+		s.Equal(target, dest)
+		s.IsType(want, p, target)
+	}
+}
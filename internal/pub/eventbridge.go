@@ -0,0 +1,65 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebTypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	json "github.com/goccy/go-json"
+)
+
+// EventBridgeMaxEntrySize is the PutEvents limit on the size of a single entry.
+const EventBridgeMaxEntrySize = 256 * 1024
+
+// DefaultEventSource is the EventBridge Source used when the target has no EventSource.
+const DefaultEventSource = "enoti"
+
+// EventBridgeAPI is the subset of *eventbridge.Client used by the publisher.
+type EventBridgeAPI interface {
+	PutEvents(ctx context.Context, in *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+type eventBridgePub struct{ cli EventBridgeAPI }
+
+// NewEventBridge creates a publisher putting the payload as the Detail of an event on the bus named in the
+// destination ("eventbridge:<bus>"). DetailType and Source come from the target config (see ports.PublishTarget).
+func NewEventBridge(c EventBridgeAPI) *eventBridgePub { return &eventBridgePub{cli: c} }
+
+func (e *eventBridgePub) PublishRaw(ctx context.Context, arn string, payload []byte) error {
+	target, _ := ports.PublishTarget(ctx)
+	source := target.EventSource
+	if source == "" {
+		source = DefaultEventSource
+	}
+	if !json.Valid(payload) {
+		return fmt.Errorf("eventbridge detail must be valid JSON")
+	}
+	// Time is counted as 14 bytes by EventBridge
+	if size := 14 + len(source) + len(target.DetailType) + len(payload); size > EventBridgeMaxEntrySize {
+		return fmt.Errorf("eventbridge entry is %d bytes, over the %d bytes limit", size, EventBridgeMaxEntrySize)
+	}
+	out, err := e.cli.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []ebTypes.PutEventsRequestEntry{{
+			EventBusName: aws.String(strings.TrimPrefix(arn, types.EventBridgeDestinationPrefix)),
+			Source:       aws.String(source),
+			DetailType:   aws.String(target.DetailType),
+			Detail:       aws.String(string(payload)),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	if out.FailedEntryCount > 0 {
+		var code, msg string
+		if len(out.Entries) > 0 {
+			code, msg = aws.ToString(out.Entries[0].ErrorCode), aws.ToString(out.Entries[0].ErrorMessage)
+		}
+		return fmt.Errorf("eventbridge put events failed: %s: %s", code, msg)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/types"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebTypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+type fakeEventBridge struct {
+	inputs []*eventbridge.PutEventsInput
+	out    *eventbridge.PutEventsOutput
+}
+
+func (f *fakeEventBridge) PutEvents(_ context.Context, in *eventbridge.PutEventsInput, _ ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	f.inputs = append(f.inputs, in)
+	if f.out != nil {
+		return f.out, nil
+	}
+	return &eventbridge.PutEventsOutput{}, nil
+}
+
+func (s *UnitTestSuite) TestEventBridgePublish() {
+	fake := &fakeEventBridge{}
+	target := types.TargetConfig{EventBusName: "alerts", DetailType: "EdgeTriggered"}
+	p := ForTargets(NewEventBridge(fake), []types.TargetConfig{target})
+
+	s.NoError(p.PublishRaw(context.Background(), "", []byte(`{"status":"down"}`)))
+	s.Require().Len(fake.inputs, 1)
+	s.Require().Len(fake.inputs[0].Entries, 1)
+	entry := fake.inputs[0].Entries[0]
+	s.Equal("alerts", aws.ToString(entry.EventBusName))
+	s.Equal("EdgeTriggered", aws.ToString(entry.DetailType))
+	s.Equal(DefaultEventSource, aws.ToString(entry.Source))
+	s.Equal(`{"status":"down"}`, aws.ToString(entry.Detail))
+}
+
+func (s *UnitTestSuite) TestEventBridgeErrors() {
+	fake := &fakeEventBridge{out: &eventbridge.PutEventsOutput{
+		FailedEntryCount: 1,
+		Entries:          []ebTypes.PutEventsResultEntry{{ErrorCode: aws.String("InternalFailure"), ErrorMessage: aws.String("boom")}},
+	}}
+	p := NewEventBridge(fake)
+	ctx := context.Background()
+
+	err := p.PublishRaw(ctx, types.EventBridgeDestinationPrefix+"alerts", []byte(`{}`))
+	s.ErrorContains(err, "InternalFailure: boom")
+
+	err = p.PublishRaw(ctx, "eventbridge:alerts", []byte(`{"v":"`+strings.Repeat("x", EventBridgeMaxEntrySize)+`"}`))
+	s.ErrorContains(err, "over the 262144 bytes limit")
+	s.Len(fake.inputs, 1)
+}
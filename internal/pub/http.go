@@ -0,0 +1,119 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultHTTPTimeout is used when NewHTTP is given a nil client.
+const DefaultHTTPTimeout = 10 * time.Second
+
+// DefaultRetryStatusCodes are the response codes considered transient by the HTTP publisher.
+var DefaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// StatusError is returned when the endpoint answers with a non-2xx status code.
+type StatusError struct {
+	// URL is the endpoint, or the destination naming it when it is the secret URL of a target.
+	URL        string
+	StatusCode int
+	Body       string
+	Retryable  bool
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook %s responded %d: %s", e.URL, e.StatusCode, e.Body)
+}
+
+// IsRetryable reports whether err is a StatusError whose status code was configured as retry-worthy.
+func IsRetryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Retryable
+	}
+	return false
+}
+
+type httpPub struct {
+	endpoint string
+	cli      *http.Client
+	retryOn  map[int]bool
+}
+
+// NewHTTP creates a publisher POSTing the payload to endpoint. If endpoint is empty, the URL comes from the client
+// config instead: the webhook or Slack URL of the target when the destination passed to PublishRaw only names it
+// (see types.TargetConfig.Destination), or the destination itself.
+// A nil client defaults to one with DefaultHTTPTimeout.
+func NewHTTP(endpoint string, c *http.Client) *httpPub {
+	if c == nil {
+		c = &http.Client{Timeout: DefaultHTTPTimeout}
+	}
+	p := &httpPub{endpoint: endpoint, cli: c}
+	return p.RetryOn(DefaultRetryStatusCodes...)
+}
+
+// RetryOn replaces the set of status codes reported as retryable in StatusError.
+func (h *httpPub) RetryOn(codes ...int) *httpPub {
+	h.retryOn = make(map[int]bool, len(codes))
+	for _, c := range codes {
+		h.retryOn[c] = true
+	}
+	return h
+}
+
+func (h *httpPub) PublishRaw(ctx context.Context, arn string, payload []byte) error {
+	url, name := h.endpoint, h.endpoint
+	if url == "" {
+		url, name = targetURL(ctx, arn), arn
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType(ctx))
+	resp, err := h.cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &StatusError{
+			URL:        name,
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+			Retryable:  h.retryOn[resp.StatusCode],
+		}
+	}
+	// Drain so the connection can be reused
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// targetURL returns the URL named by the destination arn: the webhook or Slack URL of the target being published to
+// (see ports.PublishTarget) for "webhook:" and "slack:" destinations, arn itself otherwise.
+func targetURL(ctx context.Context, arn string) string {
+	t, _ := ports.PublishTarget(ctx)
+	switch {
+	case strings.HasPrefix(arn, types.WebhookDestinationPrefix):
+		return t.WebhookURL
+	case strings.HasPrefix(arn, types.SlackDestinationPrefix):
+		return t.SlackWebhookURL
+	default:
+		return arn
+	}
+}
@@ -0,0 +1,92 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/types"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+func (s *UnitTestSuite) TestHTTPPublish() {
+	var gotBody, gotContentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		gotContentType = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	p := NewHTTP(srv.URL, nil)
+	err := p.PublishRaw(context.Background(), "arn:aws:sns:us-east-1:123456789012:ignored", []byte(`{"a":1}`))
+	s.NoError(err)
+	s.Equal(`{"a":1}`, gotBody)
+	s.Equal("application/json", gotContentType)
+
+	// Empty endpoint posts to the destination itself
+	gotBody = ""
+	err = NewHTTP("", nil).PublishRaw(context.Background(), srv.URL, []byte(`{"b":2}`))
+	s.NoError(err)
+	s.Equal(`{"b":2}`, gotBody)
+}
+
+func (s *UnitTestSuite) TestHTTPPublishNon2xx() {
+	code := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	p := NewHTTP(srv.URL, nil)
+	err := p.PublishRaw(context.Background(), "", []byte(`{}`))
+	s.Error(err)
+	s.True(IsRetryable(err))
+
+	code = http.StatusBadRequest
+	err = p.PublishRaw(context.Background(), "", []byte(`{}`))
+	s.Error(err)
+	s.False(IsRetryable(err))
+
+	p.RetryOn(http.StatusBadRequest)
+	err = p.PublishRaw(context.Background(), "", []byte(`{}`))
+	s.True(IsRetryable(err))
+}
+
+func (s *UnitTestSuite) TestHTTPPublishTargetURL() {
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	// The destination only names the URL; the URL itself, token included, is read from the target
+	target := types.TargetConfig{WebhookURL: srv.URL + "/hook?token=s3cr3t"}
+	s.NotContains(target.Destination(), "s3cr3t")
+	p := ForTargets(NewMux(nil).Handle(types.WebhookDestinationPrefix, NewHTTP("", nil)), []types.TargetConfig{target})
+	err := p.PublishRaw(context.Background(), "", []byte(`{}`))
+	s.Equal("token=s3cr3t", gotQuery)
+	s.ErrorContains(err, target.Destination())
+	s.NotContains(err.Error(), "s3cr3t", "errors are logged and dead-lettered")
+}
+
+func (s *UnitTestSuite) TestMuxRoutesByPrefix() {
+	var hit []string
+	record := func(name string) publisherFunc {
+		return func(ctx context.Context, arn string, payload []byte) error {
+			hit = append(hit, name+":"+arn)
+			return nil
+		}
+	}
+	m := NewMux(record("sns")).Handle("https://", record("web"))
+	s.NoError(m.PublishRaw(context.Background(), "https://example.com/hook", nil))
+	s.NoError(m.PublishRaw(context.Background(), "arn:aws:sns:us-east-1:123456789012:t", nil))
+	s.Equal([]string{"web:https://example.com/hook", "sns:arn:aws:sns:us-east-1:123456789012:t"}, hit)
+}
+
+type publisherFunc func(ctx context.Context, arn string, payload []byte) error
+
+func (f publisherFunc) PublishRaw(ctx context.Context, arn string, payload []byte) error {
+	return f(ctx, arn, payload)
+}
@@ -0,0 +1,36 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaWriter is the subset of *kafka.Writer used by the publisher.
+type KafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+type kafkaPub struct{ w KafkaWriter }
+
+// NewKafka creates a publisher writing to the topic named in the destination ("kafka:<topic>").
+// The writer MUST NOT have a fixed Topic set, since the topic comes from each client's target config.
+func NewKafka(w KafkaWriter) *kafkaPub { return &kafkaPub{w: w} }
+
+func (k *kafkaPub) PublishRaw(ctx context.Context, arn string, payload []byte) error {
+	msg := kafka.Message{
+		Topic: strings.TrimPrefix(arn, types.KafkaDestinationPrefix),
+		Value: payload,
+		Headers: []kafka.Header{
+			{Key: "content-type", Value: []byte(contentType(ctx))},
+		},
+	}
+	// Keying by the edge scope keeps all flips of one entity on the same partition.
+	if key := ports.PublishKey(ctx); key != "" {
+		msg.Key = []byte(key)
+	}
+	return k.w.WriteMessages(ctx, msg)
+}
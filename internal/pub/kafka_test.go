@@ -0,0 +1,43 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"errors"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type fakeKafkaWriter struct {
+	msgs []kafka.Message
+	err  error
+}
+
+func (f *fakeKafkaWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	f.msgs = append(f.msgs, msgs...)
+	return f.err
+}
+
+func (s *UnitTestSuite) TestKafkaPublish() {
+	w := &fakeKafkaWriter{}
+	p := NewKafka(w)
+	ctx := ports.WithPublishKey(context.Background(), "e12345")
+	err := p.PublishRaw(ctx, "kafka:alerts", []byte(`{"a":1}`))
+	s.NoError(err)
+	s.Len(w.msgs, 1)
+	s.Equal("alerts", w.msgs[0].Topic)
+	s.Equal("e12345", string(w.msgs[0].Key))
+	s.Equal(`{"a":1}`, string(w.msgs[0].Value))
+	s.Equal([]kafka.Header{{Key: "content-type", Value: []byte("application/json")}}, w.msgs[0].Headers)
+
+	// No key when none is attached
+	err = p.PublishRaw(context.Background(), "kafka:alerts", []byte(`{}`))
+	s.NoError(err)
+	s.Nil(w.msgs[1].Key)
+}
+
+func (s *UnitTestSuite) TestKafkaPublishError() {
+	w := &fakeKafkaWriter{err: errors.New("broker down")}
+	err := NewKafka(w).PublishRaw(context.Background(), "kafka:alerts", []byte(`{}`))
+	s.ErrorContains(err, "broker down")
+}
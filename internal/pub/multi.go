@@ -0,0 +1,116 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// TargetError is the failure of one child of a fan-out publish.
+type TargetError struct {
+	Index       int
+	Destination string
+	Err         error
+}
+
+func (e *TargetError) Error() string {
+	if e.Destination != "" {
+		return fmt.Sprintf("target #%d (%s): %v", e.Index, e.Destination, e.Err)
+	}
+	return fmt.Sprintf("target #%d: %v", e.Index, e.Err)
+}
+
+func (e *TargetError) Unwrap() error { return e.Err }
+
+// FailedTargets returns the indexes of the children that failed in an error returned by a Multi publisher.
+func FailedTargets(err error) []int {
+	var out []int
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return out
+	}
+	for _, e := range joined.Unwrap() {
+		var te *TargetError
+		if errors.As(e, &te) {
+			out = append(out, te.Index)
+		}
+	}
+	return out
+}
+
+type multiPub struct{ children []ports.Publisher }
+
+// NewMulti creates a publisher that calls PublishRaw on every child concurrently. Failures are reported as
+// *TargetError values joined with errors.Join, in child order; use FailedTargets to find which ones failed.
+func NewMulti(publishers ...ports.Publisher) ports.Publisher {
+	return &multiPub{children: publishers}
+}
+
+func (m *multiPub) PublishRaw(ctx context.Context, arn string, payload []byte) error {
+	errs := make([]error, len(m.children))
+	var wg sync.WaitGroup
+	for i, p := range m.children {
+		wg.Add(1)
+		go func(i int, p ports.Publisher) {
+			defer wg.Done()
+			if err := p.PublishRaw(ctx, arn, payload); err != nil {
+				te := &TargetError{Index: i, Err: err}
+				if b, ok := p.(*boundPub); ok {
+					te.Destination = b.dest
+				}
+				errs[i] = te
+			}
+		}(i, p)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+type boundPub struct {
+	p      ports.Publisher
+	dest   string
+	target *types.TargetConfig
+}
+
+// To binds p to a fixed destination; the destination passed to PublishRaw is ignored.
+func To(p ports.Publisher, dest string) ports.Publisher {
+	return &boundPub{p: p, dest: dest}
+}
+
+// toTarget is To for a configured target, which is also made available via ports.PublishTarget. The payload is
+// wrapped in a CloudEvents envelope for targets asking for it; for SNS FIFO targets, its hash is the deduplication ID
+// (see ports.PublishDedupID), taken before wrapping so that the same payload sent again is deduplicated.
+func toTarget(p ports.Publisher, t types.TargetConfig) ports.Publisher {
+	return &boundPub{p: p, dest: t.Destination(), target: &t}
+}
+
+func (b *boundPub) PublishRaw(ctx context.Context, _ string, payload []byte) error {
+	if b.target != nil {
+		ctx = ports.WithPublishTarget(ctx, *b.target)
+		if b.target.SNSFIFO() && ports.PublishDedupID(ctx) == "" {
+			ctx = ports.WithPublishDedupID(ctx, payloadHash(payload))
+		}
+		if b.target.CloudEvents {
+			var err error
+			if payload, err = wrapCloudEvent(ctx, *b.target, payload); err != nil {
+				return err
+			}
+		}
+	}
+	return b.p.PublishRaw(ctx, b.dest, payload)
+}
+
+// ForTargets builds the composite publisher delivering through p to every target, in config order.
+func ForTargets(p ports.Publisher, targets []types.TargetConfig) ports.Publisher {
+	if len(targets) == 1 {
+		return toTarget(p, targets[0])
+	}
+	children := make([]ports.Publisher, 0, len(targets))
+	for _, t := range targets {
+		children = append(children, toTarget(p, t))
+	}
+	return NewMulti(children...)
+}
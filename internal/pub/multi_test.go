@@ -0,0 +1,46 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/types"
+	"errors"
+	"sync"
+)
+
+func (s *UnitTestSuite) TestMultiAllSuccess() {
+	var mu sync.Mutex
+	var got []string
+	rec := publisherFunc(func(ctx context.Context, arn string, payload []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, arn)
+		return nil
+	})
+	targets := []types.TargetConfig{
+		{SNSArn: "arn:aws:sns:us-east-1:123456789012:a"},
+		{WebhookURL: "https://example.com/hook"},
+	}
+	p := ForTargets(rec, targets)
+	s.NoError(p.PublishRaw(context.Background(), "", []byte(`{}`)))
+	s.ElementsMatch([]string{"arn:aws:sns:us-east-1:123456789012:a", targets[1].Destination()}, got)
+}
+
+func (s *UnitTestSuite) TestMultiPartialFailure() {
+	ok := publisherFunc(func(ctx context.Context, arn string, payload []byte) error { return nil })
+	bad := publisherFunc(func(ctx context.Context, arn string, payload []byte) error { return errors.New("boom") })
+	err := NewMulti(ok, bad, ok).PublishRaw(context.Background(), "x", []byte(`{}`))
+	s.Error(err)
+	s.Equal([]int{1}, FailedTargets(err))
+	s.ErrorContains(err, "target #1: boom")
+
+	err = NewMulti(To(ok, "a"), To(bad, "b")).PublishRaw(context.Background(), "", []byte(`{}`))
+	s.ErrorContains(err, "target #1 (b): boom")
+}
+
+func (s *UnitTestSuite) TestMultiAllFailure() {
+	bad := publisherFunc(func(ctx context.Context, arn string, payload []byte) error { return errors.New("boom") })
+	err := NewMulti(bad, bad).PublishRaw(context.Background(), "x", []byte(`{}`))
+	s.Error(err)
+	s.Equal([]int{0, 1}, FailedTargets(err))
+	s.Empty(FailedTargets(nil))
+}
@@ -0,0 +1,36 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"strings"
+)
+
+type route struct {
+	prefix string
+	pub    ports.Publisher
+}
+
+// Mux dispatches PublishRaw to a publisher chosen by the destination prefix (e.g. "webhook:" for webhooks).
+// Destinations matching no route go to the default publisher.
+type Mux struct {
+	def    ports.Publisher
+	routes []route
+}
+
+func NewMux(def ports.Publisher) *Mux { return &Mux{def: def} }
+
+// Handle registers p for destinations starting with prefix. Routes are matched in registration order.
+func (m *Mux) Handle(prefix string, p ports.Publisher) *Mux {
+	m.routes = append(m.routes, route{prefix: prefix, pub: p})
+	return m
+}
+
+func (m *Mux) PublishRaw(ctx context.Context, arn string, payload []byte) error {
+	for _, r := range m.routes {
+		if strings.HasPrefix(arn, r.prefix) {
+			return r.pub.PublishRaw(ctx, arn, payload)
+		}
+	}
+	return m.def.PublishRaw(ctx, arn, payload)
+}
@@ -0,0 +1,101 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"net/http"
+	"slices"
+
+	json "github.com/goccy/go-json"
+)
+
+// PagerDutyEventsURL is the PagerDuty Events API v2 enqueue endpoint.
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+const (
+	pagerDutyDefaultSeverity = "error"
+	pagerDutyMaxSummary      = 1024
+)
+
+type pagerDutyPub struct {
+	routingKey string
+	http       *httpPub
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key,omitempty"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string          `json:"summary"`
+	Source        string          `json:"source"`
+	Severity      string          `json:"severity"`
+	CustomDetails json.RawMessage `json:"custom_details,omitempty"`
+}
+
+// NewPagerDuty creates a publisher sending PagerDuty Events API v2 events. The dedup_key is the edge scope key
+// (see ports.PublishKey), so repeated flips update the same incident. A trigger value listed in the target's
+// PagerDutyResolveValues (see ports.PublishTarget and ports.PublishValue) resolves the incident; anything else
+// triggers it. If routingKey is empty, it is the PagerDutyRoutingKey of the target, the destination only naming it
+// (see types.TargetConfig.Destination).
+// Rate limiting (429) is reported as a retryable StatusError.
+func NewPagerDuty(routingKey string, c *http.Client) *pagerDutyPub {
+	return &pagerDutyPub{routingKey: routingKey, http: NewHTTP(PagerDutyEventsURL, c)}
+}
+
+// WithEndpoint replaces the Events API URL, e.g. for a test server.
+func (p *pagerDutyPub) WithEndpoint(url string) *pagerDutyPub {
+	p.http.endpoint = url
+	return p
+}
+
+func (p *pagerDutyPub) PublishRaw(ctx context.Context, arn string, payload []byte) error {
+	target, _ := ports.PublishTarget(ctx)
+	value := ports.PublishValue(ctx)
+	ev := pagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: "trigger",
+		DedupKey:    ports.PublishKey(ctx),
+	}
+	if ev.RoutingKey == "" {
+		ev.RoutingKey = target.PagerDutyRoutingKey
+	}
+	if value != "" && slices.Contains(target.PagerDutyResolveValues, value) {
+		ev.EventAction = "resolve"
+	} else {
+		severity := target.PagerDutySeverity
+		if severity == "" {
+			severity = pagerDutyDefaultSeverity
+		}
+		ev.Payload = &pagerDutyPayload{
+			Summary:  pagerDutySummary(payload, value),
+			Source:   "enoti",
+			Severity: severity,
+		}
+		if json.Valid(payload) {
+			ev.Payload.CustomDetails = payload
+		}
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return p.http.PublishRaw(ctx, "", b)
+}
+
+func pagerDutySummary(payload []byte, value string) string {
+	var data map[string]any
+	summary := "enoti notification"
+	if err := json.Unmarshal(payload, &data); err == nil && data["type"] == "flap_aggregate" {
+		summary = aggregateSummary(data)
+	} else if value != "" {
+		summary = "enoti: value changed to " + value
+	}
+	if len(summary) > pagerDutyMaxSummary {
+		summary = summary[:pagerDutyMaxSummary]
+	}
+	return summary
+}
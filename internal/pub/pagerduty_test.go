@@ -0,0 +1,80 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	json "github.com/goccy/go-json"
+)
+
+func (s *UnitTestSuite) pagerDutyServer(status int, got *[]pagerDutyEvent) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		var ev pagerDutyEvent
+		s.NoError(json.Unmarshal(b, &ev))
+		*got = append(*got, ev)
+		w.WriteHeader(status)
+	}))
+}
+
+func (s *UnitTestSuite) TestPagerDutyTriggerAndResolve() {
+	var got []pagerDutyEvent
+	srv := s.pagerDutyServer(http.StatusAccepted, &got)
+	defer srv.Close()
+
+	target := types.TargetConfig{PagerDutyRoutingKey: "rk-1", PagerDutyResolveValues: []string{"ok"}}
+	s.True(strings.HasPrefix(target.Destination(), types.PagerDutyDestinationPrefix))
+	s.NotContains(target.Destination(), "rk-1", "the destination only names the routing key")
+	p := ForTargets(NewMux(nil).Handle(types.PagerDutyDestinationPrefix, NewPagerDuty("", nil).WithEndpoint(srv.URL)),
+		[]types.TargetConfig{target})
+	ctx := ports.WithPublishKey(context.Background(), "e123")
+
+	s.NoError(p.PublishRaw(ports.WithPublishValue(ctx, "down"), "", []byte(`{"status":"down"}`)))
+	s.NoError(p.PublishRaw(ports.WithPublishValue(ctx, "ok"), "", []byte(`{"status":"ok"}`)))
+
+	s.Require().Len(got, 2)
+	s.Equal("rk-1", got[0].RoutingKey)
+	s.Equal("trigger", got[0].EventAction)
+	s.Equal("e123", got[0].DedupKey)
+	s.Equal("enoti: value changed to down", got[0].Payload.Summary)
+	s.Equal("error", got[0].Payload.Severity)
+	s.JSONEq(`{"status":"down"}`, string(got[0].Payload.CustomDetails))
+
+	s.Equal("resolve", got[1].EventAction)
+	s.Equal("e123", got[1].DedupKey)
+	s.Nil(got[1].Payload)
+}
+
+func (s *UnitTestSuite) TestPagerDutyAggregateSummary() {
+	var got []pagerDutyEvent
+	srv := s.pagerDutyServer(http.StatusAccepted, &got)
+	defer srv.Close()
+
+	p := NewPagerDuty("rk-2", nil).WithEndpoint(srv.URL)
+	err := p.PublishRaw(context.Background(), "", []byte(`{"type":"flap_aggregate","flip_count":4,"last_value":"down"}`))
+	s.NoError(err)
+	s.Require().Len(got, 1)
+	s.Equal("rk-2", got[0].RoutingKey)
+	s.Equal("4 flips in window, last value down", got[0].Payload.Summary)
+}
+
+func (s *UnitTestSuite) TestPagerDutyRateLimited() {
+	var got []pagerDutyEvent
+	srv := s.pagerDutyServer(http.StatusTooManyRequests, &got)
+	defer srv.Close()
+
+	err := NewPagerDuty("rk", nil).WithEndpoint(srv.URL).PublishRaw(context.Background(), "", []byte(`{}`))
+	s.Error(err)
+	s.True(IsRetryable(err))
+
+	srv400 := s.pagerDutyServer(http.StatusBadRequest, &got)
+	defer srv400.Close()
+	err = NewPagerDuty("rk", nil).WithEndpoint(srv400.URL).PublishRaw(context.Background(), "", []byte(`{}`))
+	s.Error(err)
+	s.False(IsRetryable(err))
+}
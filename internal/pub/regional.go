@@ -0,0 +1,55 @@
+package pub
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// regionalClients lazily creates and caches one AWS service client per region, since a client can only
+// reach resources in its own region. The empty region stands for the region of the base config.
+type regionalClients[C any] struct {
+	mu      sync.Mutex
+	newFn   func(region string) C
+	clients map[string]C
+}
+
+func newRegionalClients[C any](newFn func(region string) C) *regionalClients[C] {
+	return &regionalClients[C]{newFn: newFn, clients: map[string]C{}}
+}
+
+func (r *regionalClients[C]) get(region string) C {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.clients[region]
+	if !ok {
+		c = r.newFn(region)
+		r.clients[region] = c
+	}
+	return c
+}
+
+// arnRegion returns the region of an ARN, or "" if s is not an ARN or has no region.
+func arnRegion(s string) string {
+	a, err := arn.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return a.Region
+}
+
+// sqsURLRegion returns the region of an SQS queue URL (https://sqs.<region>.amazonaws.com/...), or "" for
+// anything else, e.g. a local mock.
+func sqsURLRegion(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	host := u.Hostname()
+	if !strings.HasPrefix(host, "sqs.") || !strings.Contains(host, ".amazonaws.com") {
+		return ""
+	}
+	return strings.SplitN(strings.TrimPrefix(host, "sqs."), ".", 2)[0]
+}
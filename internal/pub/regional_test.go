@@ -0,0 +1,28 @@
+package pub
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func (s *UnitTestSuite) TestSNSClientPerRegion() {
+	p := NewSNS(aws.Config{Region: "us-east-1"})
+
+	east := p.clients.get(arnRegion("arn:aws:sns:us-east-1:123456789012:alerts"))
+	west := p.clients.get(arnRegion("arn:aws:sns:eu-west-1:123456789012:alerts"))
+	s.Equal("us-east-1", east.Options().Region)
+	s.Equal("eu-west-1", west.Options().Region)
+	s.NotSame(east, west)
+
+	// Clients are cached per region
+	s.Same(west, p.clients.get(arnRegion("arn:aws:sns:eu-west-1:123456789012:other")))
+	s.Len(p.clients.clients, 2)
+
+	// Non-ARN destinations use the configured region
+	s.Equal("us-east-1", p.clients.get(arnRegion("alerts")).Options().Region)
+}
+
+func (s *UnitTestSuite) TestSQSURLRegion() {
+	s.Equal("ap-southeast-2", sqsURLRegion("https://sqs.ap-southeast-2.amazonaws.com/123456789012/q.fifo"))
+	s.Equal("", sqsURLRegion("http://localhost:4566/000000000000/q"))
+	s.Equal("", sqsURLRegion("::"))
+}
@@ -0,0 +1,99 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// Defaults applied by NewRetry to zero-valued RetryOptions fields.
+const (
+	DefaultRetryAttempts  = 3
+	DefaultRetryBaseDelay = 100 * time.Millisecond
+	DefaultRetryMaxDelay  = 5 * time.Second
+)
+
+// RetryOptions configures NewRetry. Retryable decides whether an error is worth another attempt; nil retries
+// everything except context cancellation.
+type RetryOptions struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Retryable   func(error) bool
+}
+
+type retryPub struct {
+	inner ports.Publisher
+	opts  RetryOptions
+
+	// sleep and jitter are swapped in tests to avoid real waiting
+	sleep  func(ctx context.Context, d time.Duration) error
+	jitter func(d time.Duration) time.Duration
+}
+
+// NewRetry wraps inner so PublishRaw is retried with exponential backoff and jitter. Attempt n (1-based) waits
+// between half and all of min(BaseDelay*2^(n-1), MaxDelay) before the next try. The loop stops as soon as ctx
+// is done, and the last publish error is returned wrapped.
+func NewRetry(inner ports.Publisher, opts RetryOptions) ports.Publisher {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultRetryAttempts
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = DefaultRetryBaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = DefaultRetryMaxDelay
+	}
+	if opts.Retryable == nil {
+		opts.Retryable = func(err error) bool {
+			return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+		}
+	}
+	return &retryPub{inner: inner, opts: opts, sleep: sleepCtx, jitter: halfJitter}
+}
+
+func (r *retryPub) PublishRaw(ctx context.Context, arn string, payload []byte) error {
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		err = r.inner.PublishRaw(ctx, arn, payload)
+		if err == nil {
+			return nil
+		}
+		if attempt >= r.opts.MaxAttempts || ctx.Err() != nil || !r.opts.Retryable(err) {
+			break
+		}
+		if r.sleep(ctx, r.jitter(r.backoff(attempt))) != nil {
+			break
+		}
+	}
+	return fmt.Errorf("publish to %s failed after %d attempt(s): %w", arn, attempt, err)
+}
+
+// backoff is the un-jittered delay after the given attempt.
+func (r *retryPub) backoff(attempt int) time.Duration {
+	d := r.opts.BaseDelay
+	for i := 1; i < attempt && d < r.opts.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, r.opts.MaxDelay)
+}
+
+func halfJitter(d time.Duration) time.Duration {
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,95 @@
+package pub
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// flakyPub fails the first failures calls, then succeeds.
+type flakyPub struct {
+	failures int
+	calls    int
+}
+
+func (f *flakyPub) PublishRaw(context.Context, string, []byte) error {
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("transient")
+	}
+	return nil
+}
+
+// fakeClock records the sleeps requested by a retryPub instead of waiting.
+type fakeClock struct{ elapsed time.Duration }
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.elapsed += d
+	return nil
+}
+
+func newTestRetry(inner *flakyPub, opts RetryOptions, clock *fakeClock, jitter func(time.Duration) time.Duration) *retryPub {
+	r := NewRetry(inner, opts).(*retryPub)
+	r.sleep = clock.sleep
+	r.jitter = jitter
+	return r
+}
+
+func (s *UnitTestSuite) TestRetrySucceedsAfterFailures() {
+	inner := &flakyPub{failures: 3}
+	clock := &fakeClock{}
+	opts := RetryOptions{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 250 * time.Millisecond}
+	noJitter := func(d time.Duration) time.Duration { return d }
+
+	err := newTestRetry(inner, opts, clock, noJitter).PublishRaw(context.Background(), "arn", nil)
+	s.NoError(err)
+	s.Equal(4, inner.calls)
+	// 100ms, 200ms, then capped at 250ms
+	s.Equal(550*time.Millisecond, clock.elapsed)
+}
+
+func (s *UnitTestSuite) TestRetryJitterBounds() {
+	inner := &flakyPub{failures: 3}
+	clock := &fakeClock{}
+	opts := RetryOptions{MaxAttempts: 4, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	err := newTestRetry(inner, opts, clock, halfJitter).PublishRaw(context.Background(), "arn", nil)
+	s.NoError(err)
+	s.Equal(4, inner.calls)
+	// Each wait is within [d/2, d] for d = 100ms, 200ms, 400ms
+	s.GreaterOrEqual(clock.elapsed, 350*time.Millisecond)
+	s.LessOrEqual(clock.elapsed, 700*time.Millisecond)
+}
+
+func (s *UnitTestSuite) TestRetryGivesUp() {
+	inner := &flakyPub{failures: 10}
+	clock := &fakeClock{}
+	opts := RetryOptions{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	err := newTestRetry(inner, opts, clock, halfJitter).PublishRaw(context.Background(), "arn", nil)
+	s.ErrorContains(err, "after 3 attempt(s)")
+	s.ErrorContains(err, "transient")
+	s.Equal(3, inner.calls)
+
+	// Non-retryable errors stop immediately
+	inner = &flakyPub{failures: 10}
+	opts.Retryable = func(error) bool { return false }
+	err = newTestRetry(inner, opts, clock, halfJitter).PublishRaw(context.Background(), "arn", nil)
+	s.Error(err)
+	s.Equal(1, inner.calls)
+}
+
+func (s *UnitTestSuite) TestRetryStopsOnContextDone() {
+	inner := &flakyPub{failures: 10}
+	clock := &fakeClock{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := newTestRetry(inner, RetryOptions{MaxAttempts: 5}, clock, halfJitter).PublishRaw(ctx, "arn", nil)
+	s.ErrorContains(err, "transient")
+	s.Equal(1, inner.calls)
+	s.Zero(clock.elapsed)
+}
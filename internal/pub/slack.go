@@ -0,0 +1,95 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"enoti/internal/ports"
+	"fmt"
+	"net/http"
+	"sync"
+	"text/template"
+
+	json "github.com/goccy/go-json"
+)
+
+type slackPub struct {
+	http      *httpPub
+	templates sync.Map // template source -> *template.Template
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// NewSlack creates a publisher posting to a Slack incoming webhook. The payload is rendered into the message text
+// with the target's SlackTemplate (see ports.PublishTarget) when set, otherwise with a built-in format that
+// summarizes flap aggregates. If webhookURL is empty, it is the SlackWebhookURL of the target, the destination only
+// naming it (see types.TargetConfig.Destination).
+func NewSlack(webhookURL string, c *http.Client) *slackPub {
+	return &slackPub{http: NewHTTP(webhookURL, c)}
+}
+
+func (s *slackPub) PublishRaw(ctx context.Context, arn string, payload []byte) error {
+	var tmpl string
+	if t, ok := ports.PublishTarget(ctx); ok {
+		tmpl = t.SlackTemplate
+	}
+	text, err := s.render(tmpl, payload)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(slackMessage{Text: text})
+	if err != nil {
+		return err
+	}
+	return s.http.PublishRaw(ctx, arn, b)
+}
+
+// render turns the payload into the Slack message text. Templates are executed against the decoded JSON payload.
+func (s *slackPub) render(tmpl string, payload []byte) (string, error) {
+	var data map[string]any
+	if err := json.Unmarshal(payload, &data); err != nil {
+		// Not a JSON object; send it verbatim
+		return string(payload), nil
+	}
+	if tmpl == "" {
+		return defaultSlackText(data, payload), nil
+	}
+	t, err := s.template(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render slack_template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func (s *slackPub) template(src string) (*template.Template, error) {
+	if t, ok := s.templates.Load(src); ok {
+		return t.(*template.Template), nil
+	}
+	t, err := template.New("slack").Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parse slack_template: %w", err)
+	}
+	s.templates.Store(src, t)
+	return t, nil
+}
+
+func defaultSlackText(data map[string]any, payload []byte) string {
+	if data["type"] == "flap_aggregate" {
+		return aggregateSummary(data)
+	}
+	return "```" + string(payload) + "```"
+}
+
+// aggregateSummary is a one-line description of a flap_aggregate payload built by flow.BuildAggregate.
+func aggregateSummary(data map[string]any) string {
+	text := fmt.Sprintf("%v flips in window, last value %v", data["flip_count"], data["last_value"])
+	if scope, _ := data["scope"].(string); scope != "" {
+		text += " (" + scope + ")"
+	}
+	return text
+}
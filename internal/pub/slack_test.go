@@ -0,0 +1,57 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	json "github.com/goccy/go-json"
+)
+
+func (s *UnitTestSuite) slackServer(got *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		var msg slackMessage
+		s.NoError(json.Unmarshal(b, &msg))
+		*got = append(*got, msg.Text)
+	}))
+}
+
+func (s *UnitTestSuite) TestSlackDefaultRendering() {
+	var got []string
+	srv := s.slackServer(&got)
+	defer srv.Close()
+
+	p := NewSlack("", nil)
+	target := types.TargetConfig{SlackWebhookURL: srv.URL}
+	s.NotContains(target.Destination(), srv.URL, "the webhook URL is a secret")
+	ctx := ports.WithPublishTarget(context.Background(), target)
+	s.NoError(p.PublishRaw(ctx, target.Destination(), []byte(`{"event":{"type":"down"}}`)))
+	s.NoError(p.PublishRaw(ctx, target.Destination(),
+		[]byte(`{"type":"flap_aggregate","scope":"host-1","last_value":"up","flip_count":5,"recent":[]}`)))
+
+	s.Equal([]string{
+		"```{\"event\":{\"type\":\"down\"}}```",
+		"5 flips in window, last value up (host-1)",
+	}, got)
+}
+
+func (s *UnitTestSuite) TestSlackTemplateFromTarget() {
+	var got []string
+	srv := s.slackServer(&got)
+	defer srv.Close()
+
+	target := types.TargetConfig{
+		SlackWebhookURL: srv.URL,
+		SlackTemplate:   `{{if eq .type "flap_aggregate"}}:warning: {{.flip_count}} flips{{else}}:rotating_light: {{.event.type}}{{end}}`,
+	}
+	p := ForTargets(NewMux(nil).Handle(types.SlackDestinationPrefix, NewSlack("", nil)), []types.TargetConfig{target})
+	ctx := context.Background()
+	s.NoError(p.PublishRaw(ctx, "", []byte(`{"event":{"type":"down"}}`)))
+	s.NoError(p.PublishRaw(ctx, "", []byte(`{"type":"flap_aggregate","flip_count":3}`)))
+
+	s.Equal([]string{":rotating_light: down", ":warning: 3 flips"}, got)
+}
@@ -2,23 +2,125 @@ package pub
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"enoti/internal/ports"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
-type snsPub struct{ cli *sns.Client }
+type snsPub struct{ clients *regionalClients[*sns.Client] }
 
-func NewSNS(c *sns.Client) *snsPub { return &snsPub{cli: c} }
+// NewSNS creates a publisher whose SNS client follows the region of each topic ARN, so topics in other regions
+// than cfg's can be targeted. Clients are created on first use and cached per region.
+func NewSNS(cfg aws.Config, optFns ...func(*sns.Options)) *snsPub {
+	return &snsPub{clients: newRegionalClients(func(region string) *sns.Client {
+		return sns.NewFromConfig(cfg, slices.Concat(optFns, []func(*sns.Options){func(o *sns.Options) {
+			if region != "" {
+				o.Region = region
+			}
+		}})...)
+	})}
+}
 
+// PublishRaw publishes payload to the topic, with the message attributes of the target of ctx (see
+// TargetConfig.AttributeFields and ports.PublishAttributes).
 func (s *snsPub) PublishRaw(ctx context.Context, arn string, payload []byte) error {
-	_, err := s.cli.Publish(ctx, &sns.PublishInput{
-		TopicArn: &arn,
-		Message:  aws.String(string(payload)),
-		MessageAttributes: map[string]types.MessageAttributeValue{
-			"content-type": {DataType: aws.String("String"), StringValue: aws.String("application/json")},
-		},
-	})
+	return s.Publish(ctx, arn, payload, targetAttributes(ctx))
+}
+
+// Publish publishes payload to the topic with the given message attributes, whose values must be strings or
+// numbers. The trace context of ctx, if any, travels in the message attributes as well (e.g. traceparent) so that
+// subscribers can continue the trace; the content-type attribute is application/json, or CloudEventsContentType for
+// CloudEvents targets. Messages to FIFO topics (see TargetConfig.SNSFIFO) are grouped by the edge scope key of ctx,
+// preserving the order per entity, and deduplicated by ports.PublishDedupID, or the hash of payload if there is none.
+func (s *snsPub) Publish(ctx context.Context, arn string, payload []byte, attrs map[string]any) error {
+	msgAttrs := map[string]types.MessageAttributeValue{}
+	for k, v := range attrs {
+		switch x := v.(type) {
+		case string:
+			msgAttrs[k] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(x)}
+		case float64:
+			msgAttrs[k] = types.MessageAttributeValue{DataType: aws.String("Number"),
+				StringValue: aws.String(strconv.FormatFloat(x, 'f', -1, 64))}
+		case int:
+			msgAttrs[k] = types.MessageAttributeValue{DataType: aws.String("Number"),
+				StringValue: aws.String(strconv.Itoa(x))}
+		default:
+			return fmt.Errorf("message attribute %s: unsupported value type %T", k, v)
+		}
+	}
+	msgAttrs["content-type"] = types.MessageAttributeValue{DataType: aws.String("String"),
+		StringValue: aws.String(contentType(ctx))}
+	for k, v := range traceAttributes(ctx) {
+		msgAttrs[k] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+	}
+	in := &sns.PublishInput{
+		TopicArn:          &arn,
+		Message:           aws.String(string(payload)),
+		MessageAttributes: msgAttrs,
+	}
+	if t, ok := ports.PublishTarget(ctx); (ok && t.FIFO) || strings.HasSuffix(arn, ".fifo") {
+		group, dedup := messageGroupID(ports.PublishKey(ctx)), ports.PublishDedupID(ctx)
+		if dedup == "" {
+			dedup = payloadHash(payload)
+		}
+		in.MessageGroupId, in.MessageDeduplicationId = aws.String(group), aws.String(dedup)
+	}
+	_, err := s.clients.get(arnRegion(arn)).Publish(ctx, in)
 	return err
 }
+
+// DefaultMessageGroupID is the message group of FIFO messages published without an edge scope key.
+const DefaultMessageGroupID = "enoti"
+
+// messageGroupID returns the FIFO message group of the scope key: the key itself if SNS allows it, up to 128
+// printable ASCII characters, its hash otherwise, and DefaultMessageGroupID without one.
+func messageGroupID(scopeKey string) string {
+	if scopeKey == "" {
+		return DefaultMessageGroupID
+	}
+	if len(scopeKey) > 128 || strings.ContainsFunc(scopeKey, func(r rune) bool { return r <= ' ' || r > '~' }) {
+		return payloadHash([]byte(scopeKey))
+	}
+	return scopeKey
+}
+
+// payloadHash returns the hex SHA-256 of payload, a deduplication ID within the 128 characters SNS allows.
+func payloadHash(payload []byte) string {
+	h := sha256.Sum256(payload)
+	return hex.EncodeToString(h[:])
+}
+
+// targetAttributes returns the message attributes of the target of ctx, by name, from the values attached with
+// ports.WithPublishAttributes.
+func targetAttributes(ctx context.Context) map[string]any {
+	t, ok := ports.PublishTarget(ctx)
+	values := ports.PublishAttributes(ctx)
+	if !ok || len(t.AttributeFields) == 0 || len(values) == 0 {
+		return nil
+	}
+	attrs := make(map[string]any, len(t.AttributeFields))
+	for name, expr := range t.AttributeFields {
+		if v, ok := values[expr]; ok {
+			attrs[name] = v
+		}
+	}
+	return attrs
+}
+
+// traceAttributes returns the trace context of ctx as injected by the global propagator; it is empty unless the
+// process configures one.
+func traceAttributes(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
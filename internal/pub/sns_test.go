@@ -0,0 +1,135 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+// snsAttribute is a message attribute as received by fakeSNS.
+type snsAttribute struct{ DataType, Value string }
+
+// snsPublished is a Publish call as received by fakeSNS.
+type snsPublished struct {
+	Attributes              map[string]snsAttribute
+	MessageGroupID, DedupID string
+}
+
+// fakeSNS serves Publish calls of the query protocol, recording the last one.
+func (s *UnitTestSuite) fakeSNS(last *snsPublished) *snsPub {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.NoError(r.ParseForm())
+		*last = snsPublished{Attributes: map[string]snsAttribute{}, MessageGroupID: r.Form.Get("MessageGroupId"),
+			DedupID: r.Form.Get("MessageDeduplicationId")}
+		// MessageAttributes.entry.N.Name, MessageAttributes.entry.N.Value.DataType and .StringValue
+		for i := 1; ; i++ {
+			prefix := "MessageAttributes.entry." + strconv.Itoa(i)
+			name := r.Form.Get(prefix + ".Name")
+			if name == "" {
+				break
+			}
+			last.Attributes[name] = snsAttribute{r.Form.Get(prefix + ".Value.DataType"), r.Form.Get(prefix + ".Value.StringValue")}
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(`<PublishResponse><PublishResult><MessageId>1</MessageId></PublishResult></PublishResponse>`))
+	}))
+	s.T().Cleanup(srv.Close)
+	return NewSNS(aws.Config{}, func(o *sns.Options) {
+		o.BaseEndpoint = aws.String(srv.URL)
+		localAWSOptions(&o.Region, &o.Credentials)
+	})
+}
+
+func (s *UnitTestSuite) TestSNSAttributeFields() {
+	var last snsPublished
+	p := s.fakeSNS(&last)
+	topic := "arn:aws:sns:us-east-1:000000000000:t"
+	ctx := ports.WithPublishAttributes(context.Background(), map[string]any{
+		"severity":    "critical",
+		"metrics.cpu": 97.5,
+		"region":      "eu-1",
+	})
+
+	target := types.TargetConfig{SNSArn: topic, AttributeFields: map[string]string{
+		"severity": "severity",
+		"cpu":      "metrics.cpu",
+		"missing":  "no.such.field",
+	}}
+	s.Require().NoError(ForTargets(p, []types.TargetConfig{target}).PublishRaw(ctx, "", []byte(`{}`)))
+	s.Equal(map[string]snsAttribute{
+		"content-type": {"String", "application/json"},
+		"severity":     {"String", "critical"},
+		"cpu":          {"Number", "97.5"},
+	}, last.Attributes)
+
+	// Targets only get the attributes they ask for
+	s.Require().NoError(ForTargets(p, []types.TargetConfig{{SNSArn: topic}}).PublishRaw(ctx, "", []byte(`{}`)))
+	s.Equal(map[string]snsAttribute{"content-type": {"String", "application/json"}}, last.Attributes)
+
+	// Publish takes them directly
+	s.Require().NoError(p.Publish(context.Background(), topic, []byte(`{}`), map[string]any{"n": 3, "s": "x"}))
+	s.Equal(snsAttribute{"Number", "3"}, last.Attributes["n"])
+	s.Equal(snsAttribute{"String", "x"}, last.Attributes["s"])
+	s.ErrorContains(p.Publish(context.Background(), topic, []byte(`{}`), map[string]any{"b": true}),
+		"unsupported value type")
+
+	for _, t := range []types.TargetConfig{
+		{KafkaTopic: "alerts", AttributeFields: map[string]string{"severity": "severity"}},
+		{SNSArn: topic, AttributeFields: map[string]string{"AWS.x": "severity"}},
+		{SNSArn: topic, AttributeFields: map[string]string{"a b": "severity"}},
+		{SNSArn: topic, AttributeFields: map[string]string{"content-type": "severity"}},
+		{SNSArn: topic, AttributeFields: map[string]string{"severity": ""}},
+	} {
+		s.ErrorContains(t.Validate(), "attribute_fields")
+	}
+	s.NoError(target.Validate())
+}
+
+func (s *UnitTestSuite) TestSNSFIFO() {
+	var last snsPublished
+	p := s.fakeSNS(&last)
+	fifo := "arn:aws:sns:us-east-1:000000000000:alerts.fifo"
+	standard := "arn:aws:sns:us-east-1:000000000000:alerts"
+	ctx := ports.WithPublishKey(context.Background(), "host_1a2b")
+	data := []byte(`{"host":"db-1","state":"down"}`)
+
+	s.Require().NoError(ForTargets(p, []types.TargetConfig{{SNSArn: fifo}}).PublishRaw(ctx, "", data))
+	s.Equal("host_1a2b", last.MessageGroupID)
+	s.Equal(payloadHash(data), last.DedupID)
+	s.Len(last.DedupID, 64)
+	first := last
+
+	// The same payload has the same ID, even wrapped in CloudEvents with a new time
+	ce := types.TargetConfig{SNSArn: fifo, CloudEvents: true}
+	s.Require().NoError(ForTargets(p, []types.TargetConfig{ce}).PublishRaw(ctx, "", data))
+	s.Equal(first.DedupID, last.DedupID)
+	s.Equal(CloudEventsContentType, last.Attributes["content-type"].Value)
+	s.Require().NoError(ForTargets(p, []types.TargetConfig{{SNSArn: fifo}}).
+		PublishRaw(ctx, "", []byte(`{"host":"db-1","state":"up"}`)))
+	s.NotEqual(first.DedupID, last.DedupID)
+
+	// The flag marks topics whose ARN does not tell
+	s.Require().NoError(ForTargets(p, []types.TargetConfig{{SNSArn: standard, FIFO: true}}).PublishRaw(ctx, "", data))
+	s.Equal("host_1a2b", last.MessageGroupID)
+	s.NotEmpty(last.DedupID)
+
+	// Standard topics get neither
+	s.Require().NoError(ForTargets(p, []types.TargetConfig{{SNSArn: standard}}).PublishRaw(ctx, "", data))
+	s.Empty(last.MessageGroupID)
+	s.Empty(last.DedupID)
+
+	// Without a scope key, or with one SNS does not take
+	s.Require().NoError(p.PublishRaw(context.Background(), fifo, data))
+	s.Equal(DefaultMessageGroupID, last.MessageGroupID)
+	s.Require().NoError(p.PublishRaw(ports.WithPublishKey(context.Background(), "host db-1"), fifo, data))
+	s.Len(last.MessageGroupID, 64)
+
+	s.ErrorContains(types.TargetConfig{KafkaTopic: "alerts", FIFO: true}.Validate(), "fifo")
+	s.NoError(types.TargetConfig{SNSArn: standard, FIFO: true}.Validate())
+}
@@ -0,0 +1,49 @@
+package pub
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// DefaultSQSMessageGroup is the FIFO message group used when the context carries no publish key.
+const DefaultSQSMessageGroup = "enoti"
+
+type sqsPub struct{ clients *regionalClients[*sqs.Client] }
+
+// NewSQS creates a publisher sending the payload to the queue URL given as destination. Like NewSNS, the client
+// follows the region of the queue URL. For FIFO queues the message group is the edge scope (see ports.PublishKey),
+// and the queue is expected to have content-based deduplication enabled.
+func NewSQS(cfg aws.Config, optFns ...func(*sqs.Options)) *sqsPub {
+	return &sqsPub{clients: newRegionalClients(func(region string) *sqs.Client {
+		return sqs.NewFromConfig(cfg, slices.Concat(optFns, []func(*sqs.Options){func(o *sqs.Options) {
+			if region != "" {
+				o.Region = region
+			}
+		}})...)
+	})}
+}
+
+func (s *sqsPub) PublishRaw(ctx context.Context, arn string, payload []byte) error {
+	in := &sqs.SendMessageInput{
+		QueueUrl:    &arn,
+		MessageBody: aws.String(string(payload)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"content-type": {DataType: aws.String("String"), StringValue: aws.String(contentType(ctx))},
+		},
+	}
+	if strings.HasSuffix(arn, ".fifo") {
+		group := ports.PublishKey(ctx)
+		if group == "" {
+			group = DefaultSQSMessageGroup
+		}
+		in.MessageGroupId = &group
+	}
+	_, err := s.clients.get(sqsURLRegion(arn)).SendMessage(ctx, in)
+	return err
+}
@@ -0,0 +1,38 @@
+package pub
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	json "github.com/goccy/go-json"
+)
+
+type stdoutPub struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+type stdoutLine struct {
+	Arn     string `json:"arn"`
+	Payload any    `json:"payload"`
+}
+
+// NewStdout creates a publisher that writes each message to w as a JSON line {"arn": ..., "payload": ...},
+// for local debugging. JSON payloads are embedded as-is, anything else as a string. It is safe for concurrent use.
+func NewStdout(w io.Writer) *stdoutPub { return &stdoutPub{w: w} }
+
+func (s *stdoutPub) PublishRaw(_ context.Context, arn string, payload []byte) error {
+	line := stdoutLine{Arn: arn, Payload: string(payload)}
+	if json.Valid(payload) {
+		line.Payload = json.RawMessage(payload)
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,56 @@
+package pub
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+
+	json "github.com/goccy/go-json"
+)
+
+// chunkWriter writes one byte per call, so unguarded concurrent writes would interleave.
+type chunkWriter struct{ buf bytes.Buffer }
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		c.buf.WriteByte(b)
+	}
+	return len(p), nil
+}
+
+func (s *UnitTestSuite) TestStdoutConcurrentPublish() {
+	w := &chunkWriter{}
+	p := NewStdout(w)
+
+	var wg sync.WaitGroup
+	for _, arn := range []string{"arn:aws:sns:us-east-1:1:a", "arn:aws:sns:us-east-1:1:b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.NoError(p.PublishRaw(context.Background(), arn, []byte(`{"v":"`+strings.Repeat("x", 4096)+`"}`)))
+		}()
+	}
+	wg.Wait()
+
+	var arns []string
+	sc := bufio.NewScanner(&w.buf)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var line struct {
+			Arn     string         `json:"arn"`
+			Payload map[string]any `json:"payload"`
+		}
+		s.NoError(json.Unmarshal(sc.Bytes(), &line))
+		s.Len(line.Payload["v"], 4096)
+		arns = append(arns, line.Arn)
+	}
+	s.ElementsMatch([]string{"arn:aws:sns:us-east-1:1:a", "arn:aws:sns:us-east-1:1:b"}, arns)
+}
+
+func (s *UnitTestSuite) TestStdoutNonJSONPayload() {
+	var buf bytes.Buffer
+	s.NoError(NewStdout(&buf).PublishRaw(context.Background(), "t", []byte("plain")))
+	s.JSONEq(`{"arn":"t","payload":"plain"}`, buf.String())
+}
@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// WindowIndex returns the index of the window-aligned bucket containing nowMS (unix milliseconds) and the fraction
+// of that bucket already elapsed, in [0, 1).
+func WindowIndex(nowMS int64, window time.Duration) (idx int64, elapsed float64) {
+	w := window.Milliseconds()
+	return nowMS / w, float64(nowMS%w) / float64(w)
+}
+
+// SlidingLimit is the sliding window counter approximation: it returns how many requests the current bucket may
+// hold, given prev requests in the previous bucket, so that the requests of the trailing window stay within rate.
+// The previous bucket is weighted by the part of it still inside the trailing window, rounded up so that a full
+// previous bucket leaves no room right after the boundary.
+func SlidingLimit(prev, rate int, elapsed float64) int {
+	return rate - int(math.Ceil(float64(prev)*(1-elapsed)))
+}
+
+// WindowSlot is the slot of an acquire counted in the bucket idx, as reported to ports.ReportSlot.
+func WindowSlot(idx int64) string {
+	return strconv.FormatInt(idx, 10)
+}
+
+// ParseWindowSlot returns the bucket index of a slot made by WindowSlot.
+func ParseWindowSlot(slot string) (int64, error) {
+	idx, err := strconv.ParseInt(slot, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate limit slot %q", slot)
+	}
+	return idx, nil
+}
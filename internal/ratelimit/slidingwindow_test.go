@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+// slidingCounter applies SlidingLimit to in-memory bucket counts, like the DynamoDB data store does.
+type slidingCounter map[int64]int
+
+func (c slidingCounter) take(nowMS int64, rate int) bool {
+	idx, elapsed := WindowIndex(nowMS, time.Minute)
+	if c[idx] >= SlidingLimit(c[idx-1], rate, elapsed) {
+		return false
+	}
+	c[idx]++
+	return true
+}
+
+func (s *UnitTestSuite) TestSlidingWindowAcrossMinuteBoundary() {
+	const rate = 10
+	minute := time.Minute.Milliseconds()
+	start := (time.Now().UnixMilli()/minute + 1) * minute // a minute boundary
+
+	c := slidingCounter{}
+	granted := 0
+	// The full limit right before the boundary, then as much again right after it
+	for _, at := range []int64{start - 1000, start + 1000} {
+		for range rate {
+			if c.take(at, rate) {
+				granted++
+			}
+		}
+	}
+	s.Equal(rate, granted, "a fixed window would grant twice the limit within two seconds")
+
+	// Room comes back as the previous minute slides out of the trailing window
+	s.True(c.take(start+30*1000, rate))
+	s.Equal(1, c[start/minute])
+}
+
+func (s *UnitTestSuite) TestWindowIndex() {
+	idx, elapsed := WindowIndex(90*1000, time.Minute)
+	s.Equal(int64(1), idx)
+	s.InDelta(0.5, elapsed, 1e-9)
+	s.Equal(10, SlidingLimit(0, 10, 0))
+	s.Equal(0, SlidingLimit(10, 10, 0))
+	s.Equal(5, SlidingLimit(10, 10, 0.5))
+}
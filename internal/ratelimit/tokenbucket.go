@@ -0,0 +1,47 @@
+// Package ratelimit holds the backend-independent rate limiting math shared by the data store implementations.
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// TokenBucket is the stored state of a token bucket: the tokens left at LastMS (unix milliseconds).
+// The zero value is a bucket never used, which starts full.
+type TokenBucket struct {
+	Tokens float64
+	LastMS int64
+}
+
+// Take refills the bucket up to capacity at rate tokens per window for the time elapsed since LastMS, then takes
+// one token. It returns the new state and whether a token was available; when it was not, the returned state is
+// the refilled one and need not be stored.
+func (b TokenBucket) Take(nowMS int64, capacity, rate int, window time.Duration) (TokenBucket, bool) {
+	tokens := float64(capacity)
+	if b.LastMS > 0 {
+		elapsed := math.Max(0, float64(nowMS-b.LastMS))
+		tokens = math.Min(float64(capacity), b.Tokens+elapsed*RefillPerMS(rate, window))
+	}
+	if tokens < 1 {
+		return TokenBucket{Tokens: tokens, LastMS: nowMS}, false
+	}
+	return TokenBucket{Tokens: tokens - 1, LastMS: nowMS}, true
+}
+
+// NextTokenIn is how long until the bucket holds one more whole token.
+func (b TokenBucket) NextTokenIn(rate int, window time.Duration) time.Duration {
+	missing := 1 - (b.Tokens - math.Floor(b.Tokens))
+	// Tolerate float noise, so a token due in exactly n ms is not reported as n+1
+	return time.Duration(math.Ceil(missing/RefillPerMS(rate, window)-1e-9)) * time.Millisecond
+}
+
+// RefillPerMS is the refill rate, in tokens per millisecond, of rate tokens per window.
+func RefillPerMS(rate int, window time.Duration) float64 {
+	return float64(rate) / float64(window.Milliseconds())
+}
+
+// FullAfter is how long an empty bucket takes to refill to capacity; state older than that is equivalent to a
+// fresh bucket and may expire.
+func FullAfter(capacity, rate int, window time.Duration) time.Duration {
+	return time.Duration(float64(capacity) / float64(rate) * float64(window))
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+func (s *UnitTestSuite) TestTokenBucketBurst() {
+	// 60 per minute refills a token per second; capacity allows a burst of 10
+	const capacity, rate = 10, 60
+	now := time.Now().UnixMilli()
+	var b TokenBucket
+	var ok bool
+	for i := range capacity {
+		b, ok = b.Take(now, capacity, rate, time.Minute)
+		s.True(ok, "burst request %d", i)
+	}
+	_, ok = b.Take(now, capacity, rate, time.Minute)
+	s.False(ok, "bucket empty")
+	next, ok := b.Take(now+999, capacity, rate, time.Minute)
+	s.False(ok, "not refilled yet")
+	s.Equal(time.Millisecond, next.NextTokenIn(rate, time.Minute))
+
+	b, ok = b.Take(now+1000, capacity, rate, time.Minute)
+	s.True(ok, "one token refilled after a second")
+	_, ok = b.Take(now+1000, capacity, rate, time.Minute)
+	s.False(ok)
+
+	// Never refills over capacity
+	later := now + time.Hour.Milliseconds()
+	for i := range capacity {
+		b, ok = b.Take(later, capacity, rate, time.Minute)
+		s.True(ok, "refilled burst request %d", i)
+	}
+	_, ok = b.Take(later, capacity, rate, time.Minute)
+	s.False(ok)
+}
+
+func (s *UnitTestSuite) TestNextTokenIn() {
+	s.Equal(time.Second, TokenBucket{Tokens: 0}.NextTokenIn(60, time.Minute))
+	s.Equal(500*time.Millisecond, TokenBucket{Tokens: 2.5}.NextTokenIn(60, time.Minute))
+	s.Equal(30*time.Second, TokenBucket{Tokens: 0}.NextTokenIn(2, time.Minute))
+}
+
+func (s *UnitTestSuite) TestFullAfter() {
+	s.Equal(10*time.Second, FullAfter(10, 60, time.Minute))
+	s.Equal(2*time.Minute, FullAfter(20, 10, time.Minute))
+}
@@ -1,25 +1,146 @@
 package types
 
-import "fmt"
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/goccy/go-json"
+	"github.com/jmespath/go-jmespath"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
 
 // ClientConfig is stored per client in DynamoDB and cached in-process.
 // It drives the behavior of the ingestion service for a client.
 // The (ClientID, ClientKey) pair is used for authentication, if a client failed to submit the correct values in
 // `X-Client-ID` and `X-API-Key` headers, the request is rejected with 401 Unauthorized.
+// ClientKeys are further accepted keys, so a key can be rotated without a hard cutover: add the new key, migrate
+// callers, then remove the old one. ClientKey may be left empty when ClientKeys is set.
+// ClientKeyHash and ClientKeyHashes are the Argon2id hashes of ClientKey and ClientKeys. `enoti put` stores only the
+// hashes; plaintext keys are still accepted for configs written before hashing was introduced.
 // ClientName is for display purposes only.
 // Passthrough allows filtering of events before any other processing.
 // IPRPM is the max rate per minute allowed per source IP address. 0 means no limit.
 // ClientRPM is the max rate per minute allowed per client. 0 means no limit.
-// Dedup drives deduplication behavior.
+// IPWindowSeconds and ClientWindowSeconds replace the minute of IPRPM and ClientRPM with a window of that many
+// seconds; 0 keeps the minute.
+// Dedup drives deduplication behavior: events repeating the same Dedup.Fields values within the window are
+// answered "suppress_dedup" and not forwarded. Nil disables it.
 // Trigger drives edge detection and forwarding behavior.
+// Triggers are additional, independent triggers, each with its own edge state and targets; an event is evaluated by
+// every trigger, Trigger included, whose field is present in the payload. Trigger may be left empty when Triggers
+// is set.
+// EdgeState set to "disabled" makes the client a stateless forwarder: edge state is never loaded or written.
+// BypassIPRateLimit skips the IP rate limit regardless of IPRPM, for trusted callers behind a shared gateway.
+// TrustForwardedFor controls whether the source IP of the IP rate limit is taken from `X-Forwarded-For`; nil means
+// trusted. Authentication failures are tracked by a source IP of their own, see api.TrustedProxiesKey.
+// FailMode decides what happens when the data store fails or is throttled: "open" lets the event through, past the
+// rate limits and dedup, and forwarded as is if its edge state cannot be evaluated; "closed" rejects it. Empty keeps
+// the server default ("closed" unless set otherwise).
+// ConsistentEdgeReads overrides the server setting for whether edge state is read strongly consistent (DynamoDB
+// only); nil keeps the server setting. Eventually consistent reads cost half, but can see a stale edge right after
+// a write, deciding the edge against the previous value or costing a CAS retry.
+// RateLimit selects the algorithm behind IPRPM, ClientRPM and the target SNSRPM; nil is the fixed window.
+// Enabled set to false pauses the client without deleting its config: its requests are authenticated, then
+// answered 403 with status "client_disabled" before touching any rate limit. Nil means enabled.
+// SigningSecret, when set, enables HMAC request signing: the `X-Signature` header must hold the hex encoded
+// hmac-sha256 of the raw request body. With SignatureRequired false, unsigned requests are still accepted but
+// signed ones are verified; with it true, unsigned requests are rejected too.
+// TimestampSkewSeconds guards signed requests against replay: the `X-Timestamp` header must hold the epoch seconds
+// the request was signed at, within that many seconds of the server's clock, and the signature is then that of
+// "<timestamp>.<body>". Requests without one or out of the window are answered 401. It needs SignatureRequired.
+// MaxBodyBytes overrides the server's request body size limit for the client; 0 keeps it. Longer bodies are
+// answered 413.
+// CORSOrigins restricts the browser origins allowed to call as the client, e.g. "https://app.example.com"; an
+// origin must be allowed by the server (CORS_ALLOWED_ORIGINS) as well. Empty allows those of the server.
+// RedactFields lists the payload fields whose values are replaced with a mask in everything published for the
+// client, aggregates included, e.g. "user.email" or "items[*].card"; see ParseFieldPath. Edges, dedup and the
+// stored state still see the original values.
+// OutputTemplate is a Go text/template rendering the payload into the published body, so that downstream gets the
+// shape it expects, e.g. `{"summary": {{json .a}}, "ts": {{now}}}`; see OutputFuncs. It is executed against the
+// payload as forwarded (redacted, or the diff for ForwardDiff triggers), after the edge was evaluated on the
+// original. Empty publishes the payload as JSON. Aggregates are rendered with the AggregateTemplate instead.
+// EnrichMetadataKey, when set, is the top-level key under which published payloads and aggregates carry the
+// metadata of the event: {client_id, action, scope_key, received_at, request_id}. A payload field of the same name
+// is replaced. Empty publishes payloads without it.
+// PayloadSchema is a JSON Schema document the payloads of the client must conform to; payloads that do not are
+// answered 422 with the violations, before any rate limit. References to other documents are not resolved, so the
+// schema must be self-contained. Nil accepts any payload.
+// Routes pick the target of each event by its payload: the first route that matches replaces the targets of the
+// event's triggers, for the target rate limit and publishing alike. Events no route matches keep the targets of their
+// trigger. Aggregates flushed after their window closed go to the targets of the trigger.
+// QuietHours holds back the notifications of the client during a daily window; nil disables it.
+// DailyQuota and MonthlyQuota cap the events of the client per UTC day and month; 0 means no cap. Events past a cap
+// are answered 403 "quota exceeded" until the next period. QuotaCounts decides which events count: "forwarded"
+// (default) only those forwarded to a target, "all" every event past the rate limits.
+// Version counts the writes of the config through ClientStore.PutClientConfigCAS, so that an editor working from a
+// stale copy is refused rather than clobbering a concurrent edit. Configs written before versioning are at 0.
 type ClientConfig struct {
-	ClientID    string        `json:"client_id" dynamodbav:"client_id"`
-	ClientName  string        `json:"client_name" dynamodbav:"client_name"`
-	ClientKey   string        `json:"client_key" dynamodbav:"client_key"`
-	IPRPM       int           `json:"ip_rpm" dynamodbav:"ip_rpm"`
-	ClientRPM   int           `json:"client_rpm" dynamodbav:"client_rpm"`
-	Passthrough Passthrough   `json:"passthrough" dynamodbav:"passthrough"`
-	Trigger     TriggerConfig `json:"trigger" dynamodbav:"trigger"`
+	Version    int64    `json:"version,omitempty" dynamodbav:"cfg_ver,omitempty"`
+	ClientID   string   `json:"client_id" dynamodbav:"client_id"`
+	ClientName string   `json:"client_name" dynamodbav:"client_name"`
+	ClientKey  string   `json:"client_key" dynamodbav:"client_key"`
+	ClientKeys []string `json:"client_keys,omitempty" dynamodbav:"client_keys,omitempty"`
+
+	ClientKeyHash   string   `json:"client_key_hash,omitempty" dynamodbav:"client_key_hash,omitempty"`
+	ClientKeyHashes []string `json:"client_key_hashes,omitempty" dynamodbav:"client_key_hashes,omitempty"`
+
+	IPRPM     int `json:"ip_rpm" dynamodbav:"ip_rpm"`
+	ClientRPM int `json:"client_rpm" dynamodbav:"client_rpm"`
+
+	IPWindowSeconds     int `json:"ip_window_seconds,omitempty" dynamodbav:"ip_window_seconds,omitempty"`
+	ClientWindowSeconds int `json:"client_window_seconds,omitempty" dynamodbav:"client_window_seconds,omitempty"`
+
+	Passthrough Passthrough     `json:"passthrough" dynamodbav:"passthrough"`
+	Dedup       *DedupConfig    `json:"dedup,omitempty" dynamodbav:"dedup,omitempty"`
+	Trigger     TriggerConfig   `json:"trigger" dynamodbav:"trigger"`
+	Triggers    []TriggerConfig `json:"triggers,omitempty" dynamodbav:"triggers,omitempty"`
+	EdgeState   string          `json:"edge_state,omitempty" dynamodbav:"edge_state,omitempty"`
+
+	BypassIPRateLimit bool  `json:"bypass_ip_rate_limit,omitempty" dynamodbav:"bypass_ip_rate_limit,omitempty"`
+	TrustForwardedFor *bool `json:"trust_forwarded_for,omitempty" dynamodbav:"trust_forwarded_for,omitempty"`
+
+	FailMode string `json:"fail_mode,omitempty" dynamodbav:"fail_mode,omitempty"`
+
+	ConsistentEdgeReads *bool `json:"consistent_edge_reads,omitempty" dynamodbav:"consistent_edge_reads,omitempty"`
+
+	Enabled *bool `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"`
+
+	RateLimit *RateLimitConfig `json:"rate_limit,omitempty" dynamodbav:"rate_limit,omitempty"`
+
+	SigningSecret     string `json:"signing_secret,omitempty" dynamodbav:"signing_secret,omitempty"`
+	SignatureRequired bool   `json:"signature_required,omitempty" dynamodbav:"signature_required,omitempty"`
+	// TimestampSkewSeconds > 0 requires signed requests to carry an X-Timestamp within as many seconds of now.
+	TimestampSkewSeconds int `json:"timestamp_skew_seconds,omitempty" dynamodbav:"timestamp_skew_seconds,omitempty"`
+
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty" dynamodbav:"max_body_bytes,omitempty"`
+
+	CORSOrigins []string `json:"cors_origins,omitempty" dynamodbav:"cors_origins,omitempty"`
+
+	RedactFields []string `json:"redact_fields,omitempty" dynamodbav:"redact_fields,omitempty"`
+
+	OutputTemplate string `json:"output_template,omitempty" dynamodbav:"output_template,omitempty"`
+
+	EnrichMetadataKey string `json:"enrich_metadata_key,omitempty" dynamodbav:"enrich_metadata_key,omitempty"`
+
+	PayloadSchema map[string]any `json:"payload_schema,omitempty" dynamodbav:"payload_schema,omitempty"`
+
+	Routes []RouteConfig `json:"routes,omitempty" dynamodbav:"routes,omitempty"`
+
+	QuietHours *QuietHoursConfig `json:"quiet_hours,omitempty" dynamodbav:"quiet_hours,omitempty"`
+
+	DailyQuota   int    `json:"daily_quota,omitempty" dynamodbav:"daily_quota,omitempty"`
+	MonthlyQuota int    `json:"monthly_quota,omitempty" dynamodbav:"monthly_quota,omitempty"`
+	QuotaCounts  string `json:"quota_counts,omitempty" dynamodbav:"quota_counts,omitempty"`
 }
 
 const (
@@ -28,42 +149,417 @@ const (
 
 	ClientIDHdrName  = "x-client-id"
 	ClientKeyHdrName = "x-client-key"
+	SignatureHdrName = "x-signature"
+	TimestampHdrName = "x-timestamp"
+	RequestIDHdrName = "x-request-id"
+	// IdempotencyKeyHdrName marks retries of the same /notify request; IdempotentReplayedHdrName marks the responses
+	// replayed to them.
+	IdempotencyKeyHdrName     = "idempotency-key"
+	IdempotentReplayedHdrName = "idempotent-replayed"
+
+	SigningSecretMinLength = 16
 
 	MinWindowSizeSeconds = 10 // 10 seconds
+	MinRateWindowSeconds = 5
+
+	MaxNumericPrecision = 15
+
+	EdgeStateEnabled  = "enabled"
+	EdgeStateDisabled = "disabled"
+
+	FailModeOpen   = "open"
+	FailModeClosed = "closed"
+
+	RateLimitFixed       = "fixed"
+	RateLimitTokenBucket = "token_bucket"
+
+	QuietHoursSuppress = "suppress"
+	QuietHoursQueue    = "queue"
+
+	PassthroughAll = "all"
+	PassthroughAny = "any"
+
+	QuotaCountsForwarded = "forwarded"
+	QuotaCountsAll       = "all"
 )
 
+// RateLimitConfig chooses how the rate limits of a client are enforced.
+// With Strategy "fixed" (default), at most the limit is granted within any trailing window (a sliding window).
+// With "token_bucket", each limit is a bucket refilled at the limit's rate per window that holds up to Burst tokens
+// (default: the limit itself), so short bursts pass as long as the average rate stays within the limit.
+type RateLimitConfig struct {
+	Strategy string `json:"strategy,omitempty" dynamodbav:"strategy,omitempty"`
+	Burst    int    `json:"burst,omitempty" dynamodbav:"burst,omitempty"`
+}
+
 // Passthrough allows filtering of events before any other processing but after IP/Client rate limits.
 // Anything matching the Passthrough rule is forwarded as-is to the target without applying dedup or trigger logic.
 // The FieldExpr is a JMESPath expression that yields a boolean.
 // When negate is true, the rule is inverted (i.e. events NOT matching the expression are passed through).
 // To check the key existence at root level, use "contains(keys(@), '<key-name>')"; to check for existence in a map, use
 // "contains(<map-field>, '<key-name>')".
+// Rules are further conditions, each with its own Negate, combined with the one of FieldExpr (if set) by Operator:
+// "all" (default) passes an event through when every rule matches, "any" when at least one does.
 type Passthrough struct {
-	FieldExpr string `json:"field" dynamodbav:"field"` // JMESPath expression that yields boolean
+	FieldExpr string            `json:"field" dynamodbav:"field"` // JMESPath expression that yields boolean
+	Negate    bool              `json:"negate" dynamodbav:"not_match"`
+	Rules     []PassthroughRule `json:"rules,omitempty" dynamodbav:"rules,omitempty"`
+	Operator  string            `json:"operator,omitempty" dynamodbav:"operator,omitempty"`
+}
+
+// PassthroughRule is one condition of a Passthrough: FieldExpr yields a boolean, inverted when Negate is true.
+type PassthroughRule struct {
+	FieldExpr string `json:"field" dynamodbav:"field"`
 	Negate    bool   `json:"negate" dynamodbav:"not_match"`
 }
 
+// AllRules returns the rules of the passthrough: that of FieldExpr, if set, then Rules.
+func (p Passthrough) AllRules() []PassthroughRule {
+	if p.FieldExpr == "" {
+		return p.Rules
+	}
+	return append([]PassthroughRule{{FieldExpr: p.FieldExpr, Negate: p.Negate}}, p.Rules...)
+}
+
+// QuietHoursConfig is a daily window, from Start to End ("HH:MM", End excluded) in the IANA Timezone (UTC if
+// empty), during which events are answered "suppress_quiet_hours" instead of being forwarded. A window whose End is
+// before its Start spans midnight, e.g. 22:00 to 06:00. Events for which Bypass, a JMESPath expression yielding a
+// boolean, is true (e.g. "severity == 'critical'") are handled as usual.
+// Action decides what becomes of the events held back. With "suppress" (default), they are evaluated as usual and
+// only their notifications are dropped: edge state follows them, so the changes they carried are never notified.
+// With "queue", they are not evaluated at all: edge state stays as it was before the quiet hours, so the first event
+// after them notifies the net change, if any.
+type QuietHoursConfig struct {
+	Timezone string `json:"timezone,omitempty" dynamodbav:"timezone,omitempty"`
+	Start    string `json:"start" dynamodbav:"start"`
+	End      string `json:"end" dynamodbav:"end"`
+	Action   string `json:"action,omitempty" dynamodbav:"action,omitempty"`
+	Bypass   string `json:"bypass,omitempty" dynamodbav:"bypass,omitempty"`
+}
+
+// Contains reports whether t falls in the quiet hours.
+func (q QuietHoursConfig) Contains(t time.Time) (bool, error) {
+	loc, start, end, err := q.parse()
+	if err != nil {
+		return false, err
+	}
+	t = t.In(loc)
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if start < end {
+		return now >= start && now < end, nil
+	}
+	return now >= start || now < end, nil
+}
+
+// parse returns the location of the quiet hours and their start and end as offsets from midnight.
+func (q QuietHoursConfig) parse() (loc *time.Location, start, end time.Duration, err error) {
+	loc, err = time.LoadLocation(q.Timezone)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("quiet_hours.timezone: %w", err)
+	}
+	clock := func(name, v string) (time.Duration, error) {
+		t, err := time.Parse("15:04", v)
+		if err != nil {
+			return 0, fmt.Errorf("quiet_hours.%s must be a time of day as HH:MM", name)
+		}
+		return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+	}
+	if start, err = clock("start", q.Start); err != nil {
+		return nil, 0, 0, err
+	}
+	if end, err = clock("end", q.End); err != nil {
+		return nil, 0, 0, err
+	}
+	return loc, start, end, nil
+}
+
+// RouteConfig sends the events for which Match, a JMESPath expression yielding a boolean, is true to Target. An
+// empty Match matches every event, for a default route after the others.
+type RouteConfig struct {
+	Match  string       `json:"match,omitempty" dynamodbav:"match,omitempty"`
+	Target TargetConfig `json:"target" dynamodbav:"target"`
+}
+
+// DedupConfig suppresses duplicate events. Fields are JMESPath expressions whose values identify an event; an
+// event is a duplicate when an earlier one with the same values was accepted less than WindowSeconds ago.
+// Events in which none of the Fields is present are never deduplicated.
+type DedupConfig struct {
+	Fields        []string `json:"fields" dynamodbav:"fields"`
+	WindowSeconds int      `json:"window_seconds" dynamodbav:"window_seconds"`
+}
+
+// WindowClosed reports whether the flapping window opened at windowStart is over at now, both in epoch seconds: a
+// flip at now then opens a new window. A flip exactly WindowSeconds after the start still falls in the window.
+func (f FlapConfig) WindowClosed(windowStart, now int64) bool {
+	return f.WindowSeconds > 0 && now-windowStart > int64(f.WindowSeconds)
+}
+
+// Window is the dedup window.
+func (d DedupConfig) Window() time.Duration { return time.Duration(d.WindowSeconds) * time.Second }
+
 // TriggerConfig drives edge detection and forwarding behavior.
 type TriggerConfig struct {
-	// FieldExpr selects the value used for edge detection (string-coerced).
+	// FieldExpr selects the value used for edge detection, coerced to a string (see flow.CoerceString).
 	FieldExpr string `json:"field" dynamodbav:"field"`
-	// ScopeFields narrows edge tracking to a logical entity (default = Dedup.Fields).
+	// ValueType, when set, is the type the field must have: "string", "number" or "bool". Values of another type
+	// are ignored like a missing field, except strings spelling a number or boolean, which are normalized, so
+	// "42.0" and 42 are the same edge value for "number". Empty accepts any type.
+	ValueType string `json:"value_type,omitempty" dynamodbav:"value_type,omitempty"`
+	// ScopeFields narrows edge tracking to a logical entity: each combination of their values has its own edge
+	// state. Empty tracks a single state per field.
 	ScopeFields []string     `json:"scope_fields,omitempty" dynamodbav:"scope_fields"`
 	Target      TargetConfig `json:"target" dynamodbav:"target"`
-	Flapping    *FlapConfig  `json:"flapping,omitempty" dynamodbav:"flapping"`
+	// Targets are additional destinations the same notification is fanned out to.
+	Targets  []TargetConfig `json:"targets,omitempty" dynamodbav:"targets,omitempty"`
+	Flapping *FlapConfig    `json:"flapping,omitempty" dynamodbav:"flapping"`
+	// Numeric dampens noise on number-valued fields before edge comparison. Nil compares the raw strings.
+	Numeric *NumericConfig `json:"numeric,omitempty" dynamodbav:"numeric,omitempty"`
+	// DependsOn gates forwarding on the current edge state of another trigger of the same client.
+	DependsOn *TriggerDependency `json:"depends_on,omitempty" dynamodbav:"depends_on,omitempty"`
+	// ForwardDiff forwards edges as a JSON merge patch (RFC 7386) against the last forwarded payload of the scope
+	// instead of the full payload. The first edge of a scope is always forwarded in full.
+	ForwardDiff bool `json:"forward_diff,omitempty" dynamodbav:"forward_diff,omitempty"`
+	// IgnoreValues are noise values that are never treated as an edge; the last value is kept as-is. With a Numeric
+	// precision, both lists are matched against the rounded value.
+	IgnoreValues []string `json:"ignore_values,omitempty" dynamodbav:"ignore_values,omitempty"`
+	// OnlyValues, when non-empty, are the only values considered; any other value is ignored like IgnoreValues.
+	OnlyValues []string `json:"only_values,omitempty" dynamodbav:"only_values,omitempty"`
+	// ValueRegex, when set, replaces the field value with its first capture group, or the whole match if the
+	// regex has no group, before edge detection. Values it does not match are ignored.
+	ValueRegex string `json:"value_regex,omitempty" dynamodbav:"value_regex,omitempty"`
+	// Type "threshold" compares the numeric field against Threshold with Operator ("gt", "gte", "lt", "lte"), and
+	// edges are the transitions between the "breaching" and "ok" states instead of every value change. Only
+	// transitions into "breaching" are forwarded, unless ForwardRecovery also forwards those back to "ok".
+	// Non-numeric values are ignored. Empty Type is the default, value change mode.
+	Type            string  `json:"type,omitempty" dynamodbav:"type,omitempty"`
+	Operator        string  `json:"operator,omitempty" dynamodbav:"operator,omitempty"`
+	Threshold       float64 `json:"threshold,omitempty" dynamodbav:"threshold,omitempty"`
+	ForwardRecovery bool    `json:"forward_recovery,omitempty" dynamodbav:"forward_recovery,omitempty"`
+}
+
+const (
+	TriggerTypeThreshold = "threshold"
+
+	ThresholdBreaching = "breaching"
+	ThresholdOK        = "ok"
+
+	ValueTypeString = "string"
+	ValueTypeNumber = "number"
+	ValueTypeBool   = "bool"
+)
+
+// valueRegexps caches the compiled ValueRegex patterns, so each is compiled once.
+var valueRegexps sync.Map // pattern -> *regexp.Regexp
+
+// ValueRegexp returns the compiled ValueRegex, or nil if there is none.
+func (t TriggerConfig) ValueRegexp() (*regexp.Regexp, error) {
+	if t.ValueRegex == "" {
+		return nil, nil
+	}
+	if re, ok := valueRegexps.Load(t.ValueRegex); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(t.ValueRegex)
+	if err != nil {
+		return nil, err
+	}
+	valueRegexps.Store(t.ValueRegex, re)
+	return re, nil
+}
+
+// Breaches reports whether v breaches the Threshold of a threshold trigger.
+func (t TriggerConfig) Breaches(v float64) bool {
+	switch t.Operator {
+	case "gt":
+		return v > t.Threshold
+	case "gte":
+		return v >= t.Threshold
+	case "lt":
+		return v < t.Threshold
+	case "lte":
+		return v <= t.Threshold
+	}
+	return false
+}
+
+// Ignores reports whether v is filtered out by IgnoreValues or OnlyValues.
+func (t TriggerConfig) Ignores(v string) bool {
+	if slices.Contains(t.IgnoreValues, v) {
+		return true
+	}
+	return len(t.OnlyValues) > 0 && !slices.Contains(t.OnlyValues, v)
+}
+
+// TriggerDependency is met when the last value recorded for the trigger watching Field is one of Values.
+// Edges of the dependent trigger are still recorded when it is not met, just not forwarded.
+type TriggerDependency struct {
+	Field  string   `json:"field" dynamodbav:"field"`
+	Values []string `json:"values" dynamodbav:"values"`
+}
+
+// IsEnabled reports whether the client is enabled; configs without the flag are.
+func (c ClientConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// ActiveKeys returns the non-empty keys the client may authenticate with: ClientKey followed by ClientKeys.
+func (c ClientConfig) ActiveKeys() []string {
+	var keys []string
+	for _, k := range append([]string{c.ClientKey}, c.ClientKeys...) {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
 }
 
+// ActiveKeyHashes returns the non-empty key hashes: ClientKeyHash followed by ClientKeyHashes.
+func (c ClientConfig) ActiveKeyHashes() []string {
+	var hashes []string
+	for _, h := range append([]string{c.ClientKeyHash}, c.ClientKeyHashes...) {
+		if h != "" {
+			hashes = append(hashes, h)
+		}
+	}
+	return hashes
+}
+
+// AllTriggers returns Trigger followed by Triggers. Trigger is omitted only when it has no field and Triggers is
+// non-empty, so single-trigger configs behave exactly as before.
+func (c ClientConfig) AllTriggers() []TriggerConfig {
+	if len(c.Triggers) == 0 {
+		return []TriggerConfig{c.Trigger}
+	}
+	if c.Trigger.FieldExpr == "" {
+		return c.Triggers
+	}
+	return append([]TriggerConfig{c.Trigger}, c.Triggers...)
+}
+
+// NumericConfig only applies when the trigger value parses as a number; other values are compared as-is.
+type NumericConfig struct {
+	// Precision is the number of decimal places the value is rounded to before comparison and storage.
+	// Nil means no rounding.
+	Precision *int `json:"precision,omitempty" dynamodbav:"precision,omitempty"`
+	// Epsilon treats a new value within this absolute distance of the last value as unchanged; 0 disables it.
+	Epsilon float64 `json:"epsilon,omitempty" dynamodbav:"epsilon,omitempty"`
+	// RelEpsilon is like Epsilon but relative to the larger magnitude of the two values; 0 disables it.
+	RelEpsilon float64 `json:"rel_epsilon,omitempty" dynamodbav:"rel_epsilon,omitempty"`
+}
+
+// AllTargets returns Target followed by Targets. Target is omitted only when it has no destination and
+// Targets is non-empty, so single-target configs behave exactly as before.
+func (t TriggerConfig) AllTargets() []TargetConfig {
+	if len(t.Targets) == 0 {
+		return []TargetConfig{t.Target}
+	}
+	if t.Target.Destination() == "" {
+		return t.Targets
+	}
+	return append([]TargetConfig{t.Target}, t.Targets...)
+}
+
+// TargetConfig is where forwarded notifications are published to.
+// WebhookURL, when set, takes precedence over SlackWebhookURL, then PagerDutyRoutingKey, then EventBusName,
+// then KafkaTopic, then SNSArn.
+// SlackTemplate is a Go text/template rendering the payload into the Slack message text.
+// PagerDutyResolveValues are the trigger values (e.g. "ok") that resolve the PagerDuty incident instead of
+// triggering it; PagerDutySeverity defaults to "error".
+// EventBusName, when set, sends to an EventBridge bus with the given DetailType and EventSource ("enoti" if empty).
+// SNSRPM limits the publishes to the target per minute, or per SNSWindowSeconds when set; 0 means no limit.
+// CloudEvents wraps the published body in a CloudEvents 1.0 JSON envelope of the given CloudEventsType and
+// CloudEventsSource ("enoti.notification" and "enoti" if empty), with the body as its data. Slack and PagerDuty
+// targets have formats of their own and do not support it.
+// AttributeFields sets SNS message attributes, by name, from the JMESPath expressions of the forwarded payload, for
+// subscription filter policies. Strings are String attributes, numbers Number ones and booleans the strings "true"
+// and "false"; attributes whose field is missing or of another type are left out.
+// FIFO marks the SNS topic as a FIFO topic, which topics whose ARN ends with ".fifo" are anyway (see SNSFIFO).
 type TargetConfig struct {
-	SNSArn string `json:"sns_arn" dynamodbav:"sns_arn"`
-	SNSRPM int    `json:"sns_rpm" dynamodbav:"rate_per_minute"`
+	SNSArn           string `json:"sns_arn" dynamodbav:"sns_arn"`
+	SNSRPM           int    `json:"sns_rpm" dynamodbav:"rate_per_minute"`
+	SNSWindowSeconds int    `json:"sns_window_seconds,omitempty" dynamodbav:"sns_window_seconds,omitempty"`
+	WebhookURL       string `json:"webhook_url,omitempty" dynamodbav:"webhook_url,omitempty"`
+	SlackWebhookURL  string `json:"slack_webhook_url,omitempty" dynamodbav:"slack_webhook_url,omitempty"`
+	SlackTemplate    string `json:"slack_template,omitempty" dynamodbav:"slack_template,omitempty"`
+	KafkaTopic       string `json:"kafka_topic,omitempty" dynamodbav:"kafka_topic,omitempty"`
+
+	PagerDutyRoutingKey    string   `json:"pagerduty_routing_key,omitempty" dynamodbav:"pagerduty_routing_key,omitempty"`
+	PagerDutyResolveValues []string `json:"pagerduty_resolve_values,omitempty" dynamodbav:"pagerduty_resolve_values,omitempty"`
+	PagerDutySeverity      string   `json:"pagerduty_severity,omitempty" dynamodbav:"pagerduty_severity,omitempty"`
+
+	EventBusName string `json:"event_bus_name,omitempty" dynamodbav:"event_bus_name,omitempty"`
+	DetailType   string `json:"detail_type,omitempty" dynamodbav:"detail_type,omitempty"`
+	EventSource  string `json:"event_source,omitempty" dynamodbav:"event_source,omitempty"`
+
+	CloudEvents       bool   `json:"cloudevents,omitempty" dynamodbav:"cloudevents,omitempty"`
+	CloudEventsType   string `json:"cloudevents_type,omitempty" dynamodbav:"cloudevents_type,omitempty"`
+	CloudEventsSource string `json:"cloudevents_source,omitempty" dynamodbav:"cloudevents_source,omitempty"`
+
+	AttributeFields map[string]string `json:"attribute_fields,omitempty" dynamodbav:"attribute_fields,omitempty"`
+	FIFO            bool              `json:"fifo,omitempty" dynamodbav:"fifo,omitempty"`
+}
+
+// SNSFIFO reports whether the target is an SNS FIFO topic, whose messages carry a group and deduplication ID.
+func (t TargetConfig) SNSFIFO() bool {
+	return t.SNSArn != "" && t.Destination() == t.SNSArn && (t.FIFO || strings.HasSuffix(t.SNSArn, ".fifo"))
+}
+
+// WebhookDestinationPrefix marks a webhook URL in the destination handed to the publisher.
+const WebhookDestinationPrefix = "webhook:"
+
+// KafkaDestinationPrefix marks a Kafka topic in the destination handed to the publisher.
+const KafkaDestinationPrefix = "kafka:"
+
+// SlackDestinationPrefix marks a Slack incoming-webhook URL in the destination handed to the publisher.
+const SlackDestinationPrefix = "slack:"
+
+// PagerDutyDestinationPrefix marks a PagerDuty Events API v2 integration in the destination handed to the publisher.
+const PagerDutyDestinationPrefix = "pagerduty:"
+
+// EventBridgeDestinationPrefix marks an EventBridge event bus name in the destination handed to the publisher.
+const EventBridgeDestinationPrefix = "eventbridge:"
+
+// Destination returns the address handed to the publisher: "webhook:<URL ID>", "slack:<URL ID>",
+// "pagerduty:<routing key ID>", "eventbridge:<bus>", "kafka:<topic>" or the SNS ARN, in that order of precedence.
+// Destinations are logged and key the target rate limits, so secrets are only named by a hash of them: webhook URLs,
+// whose query strings commonly carry tokens, Slack incoming-webhook URLs and PagerDuty routing keys. The publishers
+// read the secret itself from the target (see ports.PublishTarget).
+func (t TargetConfig) Destination() string {
+	if t.WebhookURL != "" {
+		return WebhookDestinationPrefix + secretID(t.WebhookURL)
+	}
+	if t.SlackWebhookURL != "" {
+		return SlackDestinationPrefix + secretID(t.SlackWebhookURL)
+	}
+	if t.PagerDutyRoutingKey != "" {
+		return PagerDutyDestinationPrefix + secretID(t.PagerDutyRoutingKey)
+	}
+	if t.EventBusName != "" {
+		return EventBridgeDestinationPrefix + t.EventBusName
+	}
+	if t.KafkaTopic != "" {
+		return KafkaDestinationPrefix + t.KafkaTopic
+	}
+	return t.SNSArn
+}
+
+// secretID names a secret in destinations without revealing it.
+func secretID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
 }
 
 // FlapConfig tolerates early flips and aggregates noisy patterns.
+//
+// Flips are counted in tumbling windows of WindowSeconds. A scope's first window opens at its first observation;
+// every later one opens at the first flip after the previous window closed, so there are no windows without flips.
+// A window opened at start covers the flips at start through start+WindowSeconds inclusive (see WindowClosed). The
+// flip opening a window counts as its first flip and is forwarded as an edge, unless SuppressBelow tolerates it; it
+// never aggregates. Flips of the previous window that were never sent are dropped, unless the aggregate flusher sent
+// them when the window closed.
 type FlapConfig struct {
-	// WindowSeconds is the time window in seconds to count flips (edges)
-	// for accumulating "flips". When the window expires, the count resets and if there are
-	// flips, we trigger an edge notification.
-	WindowSeconds int `json:"window_seconds" dynamodbav:"window_seconds"` // sliding window for counting flips
+	// WindowSeconds is the length of the tumbling windows flips are counted in.
+	WindowSeconds int `json:"window_seconds" dynamodbav:"window_seconds"`
 
 	// SuppressBelow is the initial seconds *within* the time window, within which, not to trigger Edge notification
 	// E.g.,within [0, SuppressBelow) flips, no forwards, just ignore. 0 means no suppression, as long as there is a flip of value, do send.
@@ -76,8 +572,110 @@ type FlapConfig struct {
 	// AggregateMaxItems is the max number of recent flips to include in the aggregate message; 0 means all
 	AggregateMaxItems int `json:"aggregate_max_items" dynamodbav:"aggregate_max_items"`
 
+	// AggregateMinItems holds an aggregate back while fewer flips than this are buffered, so that flushing the end of
+	// a window does not send tiny aggregates; the flips stay buffered. 0 means no minimum. At most AggregateAt.
+	AggregateMinItems int `json:"aggregate_min_items,omitempty" dynamodbav:"aggregate_min_items,omitempty"`
+
 	// AggregateCooldownSeconds is the minimal seconds between aggregated sends; 0 means no cooldown
 	AggregateCooldownSeconds int `json:"aggregate_cooldown_seconds" dynamodbav:"aggregate_cooldown_seconds"`
+
+	// SuppressIdenticalSeconds drops an aggregate that has the same distinct values and flip count as the last one
+	// sent less than this many seconds ago; 0 means identical aggregates are always sent
+	SuppressIdenticalSeconds int `json:"suppress_identical_seconds,omitempty" dynamodbav:"suppress_identical_seconds,omitempty"`
+
+	// AggregateTemplate is a Go text/template rendering the aggregate into the published body, e.g. Slack blocks or a
+	// PagerDuty event. It is executed against the aggregate object ({{.flip_count}}, {{.recent}}, ...); empty
+	// publishes the aggregate as JSON.
+	AggregateTemplate string `json:"aggregate_template,omitempty" dynamodbav:"aggregate_template,omitempty"`
+}
+
+// aggregateTemplates caches the parsed AggregateTemplate sources, so each is parsed once.
+var aggregateTemplates sync.Map // source -> *template.Template
+
+// Template returns the parsed AggregateTemplate, or nil if there is none.
+func (f FlapConfig) Template() (*template.Template, error) {
+	if f.AggregateTemplate == "" {
+		return nil, nil
+	}
+	if t, ok := aggregateTemplates.Load(f.AggregateTemplate); ok {
+		return t.(*template.Template), nil
+	}
+	t, err := template.New("aggregate").Parse(f.AggregateTemplate)
+	if err != nil {
+		return nil, err
+	}
+	aggregateTemplates.Store(f.AggregateTemplate, t)
+	return t, nil
+}
+
+// OutputFuncs are the functions available to OutputTemplate besides the builtins: json encodes a value as JSON,
+// and now is the current time in epoch seconds.
+var OutputFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"now": func() int64 { return time.Now().Unix() },
+}
+
+// outputTemplates caches the parsed OutputTemplate sources, so each is parsed once.
+var outputTemplates sync.Map // source -> *template.Template
+
+// Output returns the parsed OutputTemplate, or nil if there is none.
+func (c ClientConfig) Output() (*template.Template, error) {
+	if c.OutputTemplate == "" {
+		return nil, nil
+	}
+	if t, ok := outputTemplates.Load(c.OutputTemplate); ok {
+		return t.(*template.Template), nil
+	}
+	t, err := template.New("output").Funcs(OutputFuncs).Parse(c.OutputTemplate)
+	if err != nil {
+		return nil, err
+	}
+	outputTemplates.Store(c.OutputTemplate, t)
+	return t, nil
+}
+
+// payloadSchemas caches the compiled PayloadSchema documents by their JSON encoding, so each is compiled once.
+var payloadSchemas sync.Map // JSON document -> *jsonschema.Schema
+
+// errSchemaRef refuses to load the documents referenced by a PayloadSchema.
+type errSchemaRef struct{}
+
+func (errSchemaRef) Load(url string) (any, error) {
+	return nil, fmt.Errorf("reference to %s: payload_schema must be self-contained", url)
+}
+
+// Schema returns the compiled PayloadSchema, or nil if there is none.
+func (c ClientConfig) Schema() (*jsonschema.Schema, error) {
+	if c.PayloadSchema == nil {
+		return nil, nil
+	}
+	// Encoded and decoded again, so that the document holds the JSON types the compiler expects whatever it was
+	// decoded from (e.g. YAML integers)
+	b, err := json.Marshal(c.PayloadSchema)
+	if err != nil {
+		return nil, err
+	}
+	if sch, ok := payloadSchemas.Load(string(b)); ok {
+		return sch.(*jsonschema.Schema), nil
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	compiler := jsonschema.NewCompiler()
+	compiler.UseLoader(errSchemaRef{})
+	if err := compiler.AddResource("payload_schema.json", doc); err != nil {
+		return nil, err
+	}
+	sch, err := compiler.Compile("payload_schema.json")
+	if err != nil {
+		return nil, err
+	}
+	payloadSchemas.Store(string(b), sch)
+	return sch, nil
 }
 
 func (c ClientConfig) Validate() error {
@@ -87,19 +685,194 @@ func (c ClientConfig) Validate() error {
 	if c.ClientName == "" {
 		return fmt.Errorf("client_name is required")
 	}
-	if c.ClientKey == "" {
+	if len(c.ActiveKeys()) == 0 && len(c.ActiveKeyHashes()) == 0 {
 		return fmt.Errorf("client_key is required")
 	}
-	if len(c.ClientKey) < ClientKeyMinLength {
+	if c.ClientKey != "" && len(c.ClientKey) < ClientKeyMinLength {
 		return fmt.Errorf("api_key must be at least %d characters", ClientKeyMinLength)
 	}
+	for i, k := range c.ClientKeys {
+		if len(k) < ClientKeyMinLength {
+			return fmt.Errorf("client_keys[%d] must be at least %d characters", i, ClientKeyMinLength)
+		}
+	}
 	if c.IPRPM < 0 {
 		return fmt.Errorf("ip_rpm must be non-negative. 0 for non limit")
 	}
 	if c.ClientRPM < 0 {
 		return fmt.Errorf("client_rpm must be non-negative. 0 for non limit")
 	}
-	flapping := c.Trigger.Flapping
+	if err := validateRateWindow("ip_window_seconds", c.IPWindowSeconds); err != nil {
+		return err
+	}
+	if err := validateRateWindow("client_window_seconds", c.ClientWindowSeconds); err != nil {
+		return err
+	}
+	if c.Passthrough.FieldExpr != "" {
+		if err := validateExpr("passthrough.field", c.Passthrough.FieldExpr); err != nil {
+			return err
+		}
+	}
+	if op := c.Passthrough.Operator; op != "" && op != PassthroughAll && op != PassthroughAny {
+		return fmt.Errorf("passthrough.operator must be one of %q, %q", PassthroughAll, PassthroughAny)
+	}
+	for i, r := range c.Passthrough.Rules {
+		if r.FieldExpr == "" {
+			return fmt.Errorf("passthrough.rules[%d].field is required", i)
+		}
+		if err := validateExpr(fmt.Sprintf("passthrough.rules[%d].field", i), r.FieldExpr); err != nil {
+			return err
+		}
+	}
+	if d := c.Dedup; d != nil {
+		if len(d.Fields) == 0 || slices.Contains(d.Fields, "") {
+			return fmt.Errorf("dedup.fields must list at least one non-empty field")
+		}
+		if d.WindowSeconds <= 0 {
+			return fmt.Errorf("dedup.window_seconds must be positive")
+		}
+		for _, f := range d.Fields {
+			if err := validateExpr("dedup.fields", f); err != nil {
+				return err
+			}
+		}
+	}
+	if c.EdgeState != "" && c.EdgeState != EdgeStateEnabled && c.EdgeState != EdgeStateDisabled {
+		return fmt.Errorf("edge_state must be one of %q, %q", EdgeStateEnabled, EdgeStateDisabled)
+	}
+	if c.FailMode != "" && c.FailMode != FailModeOpen && c.FailMode != FailModeClosed {
+		return fmt.Errorf("fail_mode must be one of %q, %q", FailModeOpen, FailModeClosed)
+	}
+	if rl := c.RateLimit; rl != nil {
+		if rl.Strategy != "" && rl.Strategy != RateLimitFixed && rl.Strategy != RateLimitTokenBucket {
+			return fmt.Errorf("rate_limit.strategy must be one of %q, %q", RateLimitFixed, RateLimitTokenBucket)
+		}
+		if rl.Burst < 0 {
+			return fmt.Errorf("rate_limit.burst must be non-negative")
+		}
+	}
+	if c.SigningSecret != "" && len(c.SigningSecret) < SigningSecretMinLength {
+		return fmt.Errorf("signing_secret must be at least %d characters", SigningSecretMinLength)
+	}
+	if c.SignatureRequired && c.SigningSecret == "" {
+		return fmt.Errorf("signature_required needs a signing_secret")
+	}
+	if c.TimestampSkewSeconds < 0 {
+		return fmt.Errorf("timestamp_skew_seconds must be non-negative. 0 for no timestamp check")
+	}
+	if c.TimestampSkewSeconds > 0 && !c.SignatureRequired {
+		return fmt.Errorf("timestamp_skew_seconds needs signature_required")
+	}
+	if c.MaxBodyBytes < 0 {
+		return fmt.Errorf("max_body_bytes must be non-negative. 0 for the server default")
+	}
+	for _, o := range c.CORSOrigins {
+		if u, err := url.Parse(o); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.Path != "" || u.RawQuery != "" {
+			return fmt.Errorf("cors_origins: %q is not an origin, e.g. https://app.example.com", o)
+		}
+	}
+	if _, err := c.Output(); err != nil {
+		return fmt.Errorf("output_template: %w", err)
+	}
+	if _, err := c.Schema(); err != nil {
+		return fmt.Errorf("payload_schema: %w", err)
+	}
+	for _, f := range c.RedactFields {
+		if _, err := ParseFieldPath(f); err != nil {
+			return fmt.Errorf("redact_fields: %w", err)
+		}
+	}
+	if c.DailyQuota < 0 || c.MonthlyQuota < 0 {
+		return fmt.Errorf("daily_quota and monthly_quota must be non-negative. 0 for no quota")
+	}
+	if c.QuotaCounts != "" && c.QuotaCounts != QuotaCountsForwarded && c.QuotaCounts != QuotaCountsAll {
+		return fmt.Errorf("quota_counts must be one of %q, %q", QuotaCountsForwarded, QuotaCountsAll)
+	}
+	if q := c.QuietHours; q != nil {
+		if _, start, end, err := q.parse(); err != nil {
+			return err
+		} else if start == end {
+			return fmt.Errorf("quiet_hours.start and quiet_hours.end must differ")
+		}
+		if q.Action != "" && q.Action != QuietHoursSuppress && q.Action != QuietHoursQueue {
+			return fmt.Errorf("quiet_hours.action must be one of %q, %q", QuietHoursSuppress, QuietHoursQueue)
+		}
+		if q.Bypass != "" {
+			if err := validateExpr("quiet_hours.bypass", q.Bypass); err != nil {
+				return err
+			}
+		}
+	}
+	for i, r := range c.Routes {
+		if r.Target.Destination() == "" {
+			return fmt.Errorf("routes[%d].target has no destination", i)
+		}
+		if r.Match != "" {
+			if err := validateExpr(fmt.Sprintf("routes[%d].match", i), r.Match); err != nil {
+				return err
+			}
+		}
+		if err := r.Target.Validate(); err != nil {
+			return fmt.Errorf("routes[%d]: %w", i, err)
+		}
+	}
+	fields := map[string]bool{}
+	for _, t := range c.AllTriggers() {
+		fields[t.FieldExpr] = true
+	}
+	for i, t := range c.Triggers {
+		if t.FieldExpr == "" {
+			return fmt.Errorf("triggers[%d].field is required", i)
+		}
+	}
+	for _, t := range c.AllTriggers() {
+		if err := t.Validate(); err != nil {
+			return err
+		}
+		if d := t.DependsOn; d != nil {
+			if d.Field == "" || d.Field == t.FieldExpr || !fields[d.Field] {
+				return fmt.Errorf("depends_on.field must be the field of another trigger of the client")
+			}
+			for _, other := range c.AllTriggers() {
+				if other.FieldExpr == d.Field && !slices.Equal(other.ScopeFields, t.ScopeFields) {
+					return fmt.Errorf("depends_on.field must be the field of a trigger with the same scope_fields")
+				}
+			}
+			if len(d.Values) == 0 {
+				return fmt.Errorf("depends_on.values must not be empty")
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks the trigger's own settings; dependencies are checked by ClientConfig.Validate.
+func (t TriggerConfig) Validate() error {
+	if t.FieldExpr != "" {
+		if err := validateExpr("trigger.field", t.FieldExpr); err != nil {
+			return err
+		}
+	}
+	for _, f := range t.ScopeFields {
+		if err := validateExpr("trigger.scope_fields", f); err != nil {
+			return err
+		}
+	}
+	for _, tc := range t.AllTargets() {
+		if err := tc.Validate(); err != nil {
+			return err
+		}
+	}
+	if n := t.Numeric; n != nil {
+		if n.Precision != nil && (*n.Precision < 0 || *n.Precision > MaxNumericPrecision) {
+			return fmt.Errorf("trigger.numeric.precision must be between 0 and %d", MaxNumericPrecision)
+		}
+		if n.Epsilon < 0 || n.RelEpsilon < 0 {
+			return fmt.Errorf("trigger.numeric epsilons must be non-negative")
+		}
+	}
+	flapping := t.Flapping
 	if flapping != nil {
 		if flapping.WindowSeconds < MinWindowSizeSeconds {
 			return fmt.Errorf("flapping.window_seconds must be greater than or equal to %d seconds", MinWindowSizeSeconds)
@@ -107,6 +880,194 @@ func (c ClientConfig) Validate() error {
 		if flapping.SuppressBelow < 0 || flapping.SuppressBelow > flapping.WindowSeconds {
 			return fmt.Errorf("flapping.suppress_below must be non-negative and less than or equal to window_seconds")
 		}
+		if flapping.AggregateMinItems < 0 || flapping.AggregateMinItems > flapping.AggregateAt {
+			return fmt.Errorf("flapping.aggregate_min_items must be non-negative and less than or equal to aggregate_at")
+		}
+		if flapping.SuppressIdenticalSeconds < 0 {
+			return fmt.Errorf("flapping.suppress_identical_seconds must be non-negative")
+		}
+		if _, err := flapping.Template(); err != nil {
+			return fmt.Errorf("flapping.aggregate_template: %w", err)
+		}
+	}
+	if _, err := t.ValueRegexp(); err != nil {
+		return fmt.Errorf("trigger.value_regex: %w", err)
+	}
+	switch t.ValueType {
+	case "", ValueTypeString, ValueTypeNumber, ValueTypeBool:
+	default:
+		return fmt.Errorf("trigger.value_type must be empty, %q, %q or %q", ValueTypeString, ValueTypeNumber,
+			ValueTypeBool)
+	}
+	switch t.Type {
+	case "":
+	case TriggerTypeThreshold:
+		if !slices.Contains([]string{"gt", "gte", "lt", "lte"}, t.Operator) {
+			return fmt.Errorf("trigger.operator must be one of gt, gte, lt, lte")
+		}
+	default:
+		return fmt.Errorf("trigger.type must be empty or %q", TriggerTypeThreshold)
+	}
+	for _, v := range t.IgnoreValues {
+		if slices.Contains(t.OnlyValues, v) {
+			return fmt.Errorf("trigger value %q is in both ignore_values and only_values", v)
+		}
+	}
+	return nil
+}
+
+func (t TargetConfig) Validate() error {
+	if err := validateRateWindow("target sns_window_seconds", t.SNSWindowSeconds); err != nil {
+		return err
+	}
+	if t.SNSArn != "" {
+		if a, err := arn.Parse(t.SNSArn); err != nil || a.Service != "sns" || a.Region == "" || a.Resource == "" {
+			return fmt.Errorf("target sns_arn %q is not an SNS topic ARN, e.g. arn:aws:sns:<region>:<account>:<topic>",
+				t.SNSArn)
+		}
+	}
+	if t.WebhookURL != "" {
+		u, err := url.Parse(t.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("target webhook_url must be an absolute http(s) URL")
+		}
+	}
+	if t.SlackWebhookURL != "" {
+		u, err := url.Parse(t.SlackWebhookURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("target slack_webhook_url must be an absolute https URL")
+		}
+	}
+	if t.EventBusName != "" && t.DetailType == "" {
+		return fmt.Errorf("target detail_type is required with event_bus_name")
+	}
+	switch t.PagerDutySeverity {
+	case "", "critical", "error", "warning", "info":
+	default:
+		return fmt.Errorf("target pagerduty_severity must be one of critical, error, warning, info")
+	}
+	if t.SlackTemplate != "" {
+		if _, err := template.New("slack").Parse(t.SlackTemplate); err != nil {
+			return fmt.Errorf("target slack_template: %w", err)
+		}
+	}
+	if dest := t.Destination(); t.CloudEvents &&
+		(strings.HasPrefix(dest, SlackDestinationPrefix) || strings.HasPrefix(dest, PagerDutyDestinationPrefix)) {
+		return fmt.Errorf("target cloudevents is not supported by slack and pagerduty targets")
+	}
+	if len(t.AttributeFields) > 0 && (t.SNSArn == "" || t.Destination() != t.SNSArn) {
+		return fmt.Errorf("target attribute_fields is only supported by sns targets")
+	}
+	if t.FIFO && !t.SNSFIFO() {
+		return fmt.Errorf("target fifo is only supported by sns targets")
+	}
+	for name, expr := range t.AttributeFields {
+		if err := validateAttributeName(name); err != nil {
+			return fmt.Errorf("target attribute_fields: %w", err)
+		}
+		if expr == "" {
+			return fmt.Errorf("target attribute_fields: %s has no field", name)
+		}
+		if err := validateExpr("target attribute_fields", expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateExpr checks that expr, of the setting name, compiles as a JMESPath expression, so that a typo fails the
+// put of the config rather than every event.
+func validateExpr(name, expr string) error {
+	if _, err := jmespath.Compile(expr); err != nil {
+		return fmt.Errorf("%s: invalid JMESPath expression %q: %w", name, expr, err)
+	}
+	return nil
+}
+
+// validateAttributeName checks name against the SNS rules for message attribute names. Names enoti sets itself are
+// refused as well.
+func validateAttributeName(name string) error {
+	lower := strings.ToLower(name)
+	switch {
+	case name == "" || len(name) > 256:
+		return fmt.Errorf("attribute name %q must be 1 to 256 characters", name)
+	case strings.Trim(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-.") != "":
+		return fmt.Errorf("attribute name %q may only contain letters, digits, _, - and .", name)
+	case name[0] == '.' || name[len(name)-1] == '.' || strings.Contains(name, ".."):
+		return fmt.Errorf("attribute name %q must not start or end with a period or have consecutive periods", name)
+	case strings.HasPrefix(lower, "aws.") || strings.HasPrefix(lower, "amazon."):
+		return fmt.Errorf("attribute name %q must not start with AWS. or Amazon.", name)
+	case lower == "content-type" || lower == "traceparent" || lower == "tracestate" || lower == "baggage":
+		return fmt.Errorf("attribute name %q is reserved", name)
+	}
+	return nil
+}
+
+// IPWindow is the window of the IPRPM limit.
+func (c ClientConfig) IPWindow() time.Duration { return rateWindow(c.IPWindowSeconds) }
+
+// ClientWindow is the window of the ClientRPM limit.
+func (c ClientConfig) ClientWindow() time.Duration { return rateWindow(c.ClientWindowSeconds) }
+
+// SNSWindow is the window of the SNSRPM limit.
+func (t TargetConfig) SNSWindow() time.Duration { return rateWindow(t.SNSWindowSeconds) }
+
+// rateWindow returns a rate limit window of seconds, defaulting to a minute.
+func rateWindow(seconds int) time.Duration {
+	if seconds == 0 {
+		return time.Minute
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func validateRateWindow(name string, seconds int) error {
+	if seconds != 0 && seconds < MinRateWindowSeconds {
+		return fmt.Errorf("%s must be at least %d seconds. 0 for a minute", name, MinRateWindowSeconds)
 	}
 	return nil
 }
+
+// ParseFieldPath splits a field path, keys separated by dots with optional array subscripts as in JMESPath, e.g.
+// "user.email", "items[0].card" or "items[*].card", into its segments: keys, indices as "[0]", and "*" for any key
+// of an object or any element of an array.
+func ParseFieldPath(path string) ([]string, error) {
+	var segs []string
+	rest := path
+	for rest != "" {
+		i := strings.IndexAny(rest, ".[")
+		if i < 0 {
+			i = len(rest)
+		}
+		if key := rest[:i]; key != "" {
+			segs = append(segs, key)
+		} else if len(segs) == 0 || rest[0] == '.' {
+			return nil, fmt.Errorf("field path %q has an empty key", path)
+		}
+		rest = rest[i:]
+		for strings.HasPrefix(rest, "[") {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("field path %q has an unclosed subscript", path)
+			}
+			switch sub := rest[1:end]; {
+			case sub == "*" || sub == "":
+				segs = append(segs, "*")
+			case strings.Trim(sub, "0123456789") == "":
+				segs = append(segs, "["+sub+"]")
+			default:
+				return nil, fmt.Errorf("field path %q has an invalid subscript [%s]", path, sub)
+			}
+			rest = rest[end+1:]
+		}
+		if rest != "" {
+			if rest[0] != '.' || len(rest) == 1 {
+				return nil, fmt.Errorf("field path %q is malformed", path)
+			}
+			rest = rest[1:]
+		}
+	}
+	if len(segs) == 0 {
+		return nil, fmt.Errorf("field path is empty")
+	}
+	return segs, nil
+}
@@ -9,9 +9,13 @@ var (
 	ErrNotFound            = errors.New("not found")
 	ErrPrecondition        = errors.New("precondition failed")
 	ErrInvalidClientConfig = errors.New("invalid client config")
+	// ErrVersionConflict is returned by conditional config writes when the stored config is at another version.
+	ErrVersionConflict = errors.New("client config version conflict")
 
 	ErrInvalidBackend  = errors.New("invalid backend")
 	ErrDataStoreAccess = errors.New("data store read/write error")
+	// ErrThrottled marks a transient backend capacity error, as opposed to a hard failure.
+	ErrThrottled = errors.New("data store throttled")
 )
 
 func Err(typedError error, innerErr error, msgTemplate string, args ...any) error {
@@ -21,3 +25,10 @@ func Err(typedError error, innerErr error, msgTemplate string, args ...any) erro
 		return errors.Join(typedError, innerErr, fmt.Errorf(msgTemplate, args...))
 	}
 }
+
+// VersionConflict returns the ErrVersionConflict of a conditional write of the config of clientID expecting it at
+// expectedVersion.
+func VersionConflict(clientID string, expectedVersion int64) error {
+	return fmt.Errorf("%w: client %s was changed since version %d; get it again and retry", ErrVersionConflict,
+		clientID, expectedVersion)
+}
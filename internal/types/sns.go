@@ -1,4 +1,28 @@
 package types
 
+// SNSInboundEvent is the event a Lambda function subscribed to an SNS topic receives.
+// Field names follow the JSON delivered by Lambda, so it can be unmarshalled directly.
 type SNSInboundEvent struct {
+	Records []SNSInboundRecord `json:"Records"`
+}
+
+type SNSInboundRecord struct {
+	EventSource string     `json:"EventSource"`
+	SNS         SNSMessage `json:"Sns"`
+}
+
+// SNSMessage is the notification itself. Client credentials are expected in MessageAttributes, under the same
+// names as the HTTP headers (ClientIDHdrName, ClientKeyHdrName).
+type SNSMessage struct {
+	MessageID         string                         `json:"MessageId"`
+	TopicArn          string                         `json:"TopicArn"`
+	Subject           string                         `json:"Subject"`
+	Message           string                         `json:"Message"`
+	Timestamp         string                         `json:"Timestamp"`
+	MessageAttributes map[string]SNSMessageAttribute `json:"MessageAttributes"`
+}
+
+type SNSMessageAttribute struct {
+	Type  string `json:"Type"`
+	Value string `json:"Value"`
 }
@@ -14,10 +14,23 @@ type Edge struct {
 	Recent []Flip `dynamodbav:"recent" json:"recent"`
 	// AggUntilTS is the timestamp until which no new aggregate can be sent (cooldown).
 	AggUntilTS int64 `dynamodbav:"agg_until_ts" json:"agg_until_ts"`
+	// LastAggFingerprint and LastAggTS describe the last aggregate sent, for suppressing identical ones.
+	LastAggFingerprint string `dynamodbav:"last_agg_fp,omitempty" json:"last_agg_fp,omitempty"`
+	LastAggTS          int64  `dynamodbav:"last_agg_ts,omitempty" json:"last_agg_ts,omitempty"`
+	// LastForwarded is the last payload forwarded for the scope (encoded like Flip.Payload); only kept for
+	// triggers with ForwardDiff.
+	LastForwarded string `dynamodbav:"last_forwarded,omitempty" json:"last_forwarded,omitempty"`
 	// Version is maintained by the store; do not set in callers.
 	Version int64 `dynamodbav:"ver" json:"-"`
 }
 
+// PendingEdge is an edge state with flips buffered in Recent, along with its client and version.
+type PendingEdge struct {
+	ClientID string
+	Edge     Edge
+	Version  int64
+}
+
 type Flip struct {
 	At      int64  `dynamodbav:"at" json:"at"`
 	From    string `dynamodbav:"from" json:"from"`
@@ -3,8 +3,11 @@ package tests
 import (
 	"context"
 	"enoti/cmd/enoti/cmds"
+	"enoti/internal/api"
 	"enoti/internal/flow"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 )
@@ -14,8 +17,13 @@ func (s *IntegrationTestSuite) TestAuthCorrect() {
 	err := cmds.PutConfig(ctx, s.clientStore, "./configs/bare_minimum.yml")
 	s.NoError(err)
 
-	cfg, err := s.clientStore.GetClientConfig(ctx, "example-client-id-bare-minimum")
+	// The store only keeps the key hash; the plaintext key comes from the file
+	cfg, err := cmds.LoadConfigFile("./configs/bare_minimum.yml")
 	s.NoError(err)
+	stored, err := s.clientStore.GetClientConfig(ctx, cfg.ClientID)
+	s.NoError(err)
+	s.Empty(stored.ClientKey)
+	s.NotEmpty(stored.ClientKeyHash)
 
 	resp, err := s.notify(cfg.ClientID, cfg.ClientKey,
 		`{}
@@ -38,8 +46,13 @@ func (s *IntegrationTestSuite) TestAuthInvalidPayloadClientKey() {
 	err := cmds.PutConfig(ctx, s.clientStore, "./configs/bare_minimum.yml")
 	s.NoError(err)
 
-	cfg, err := s.clientStore.GetClientConfig(ctx, "example-client-id-bare-minimum")
+	// The store only keeps the key hash; the plaintext key comes from the file
+	cfg, err := cmds.LoadConfigFile("./configs/bare_minimum.yml")
+	s.NoError(err)
+	stored, err := s.clientStore.GetClientConfig(ctx, cfg.ClientID)
 	s.NoError(err)
+	s.Empty(stored.ClientKey)
+	s.NotEmpty(stored.ClientKeyHash)
 
 	resp, err := s.notify(cfg.ClientID, "bad-client-key",
 		`{}
@@ -47,3 +60,34 @@ func (s *IntegrationTestSuite) TestAuthInvalidPayloadClientKey() {
 
 	s.assertFailureStatus(resp, http.StatusUnauthorized, err, aws.String("invalid credentials"))
 }
+
+func (s *IntegrationTestSuite) TestAuthFailureLockout() {
+	ctx := context.Background()
+	err := cmds.PutConfig(ctx, s.clientStore, "./configs/bare_minimum.yml")
+	s.NoError(err)
+	cfg, err := cmds.LoadConfigFile("./configs/bare_minimum.yml")
+	s.NoError(err)
+
+	// Successful requests do not consume the failure budget
+	for range api.DefaultAuthFailBlockAfter + 1 {
+		resp, err := s.notifyFrom("192.0.2.10", cfg.ClientID, cfg.ClientKey, `{}`)
+		s.assertSuccessStatus(resp, flow.StatusTextMap[flow.ForwardedAsIs], err)
+	}
+
+	// Failure counts and blocks outlive the run in the data store: fail from an address of its own
+	ip := fmt.Sprintf("2001:db8::%x", time.Now().UnixNano()&0xffffffff)
+	defer func() { s.NoError(flow.UnblockIP(ctx, s.dataStore, ip)) }()
+	for range api.DefaultAuthFailBlockAfter {
+		resp, err := s.notifyFrom(ip, cfg.ClientID, "bad-client-key", `{}`)
+		s.assertFailureStatus(resp, http.StatusUnauthorized, err, nil)
+	}
+	// The failure over the threshold trips the lockout, which then holds even for the right key
+	resp, err := s.notifyFrom(ip, cfg.ClientID, "bad-client-key", `{}`)
+	s.assertFailureStatus(resp, http.StatusUnauthorized, err, nil)
+	resp, err = s.notifyFrom(ip, cfg.ClientID, cfg.ClientKey, `{}`)
+	s.assertFailureStatus(resp, http.StatusTooManyRequests, err, nil)
+
+	// Other IPs are unaffected
+	resp, err = s.notifyFrom("192.0.2.12", cfg.ClientID, cfg.ClientKey, `{}`)
+	s.assertSuccessStatus(resp, flow.StatusTextMap[flow.ForwardedAsIs], err)
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"enoti/cmd/enoti/cmds"
+	"enoti/internal/api"
+	"enoti/internal/flow"
+	"enoti/internal/types"
+	"fmt"
+	"net/http"
+)
+
+// notifyBatch sends payloads to /notify/batch of the test server.
+func (s *IntegrationTestSuite) notifyBatch(clientID, clientKey string, payloads any) *http.Response {
+	body, err := json.Marshal(payloads)
+	s.Require().NoError(err)
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/notify/batch", TestServerPort),
+		bytes.NewReader(body))
+	s.Require().NoError(err)
+	req.Header.Add(types.ClientIDHdrName, clientID)
+	req.Header.Add(types.ClientKeyHdrName, clientKey)
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	return resp
+}
+
+// TestNotifyBatch submits a batch whose items are forwarded, suppressed and rate limited.
+func (s *IntegrationTestSuite) TestNotifyBatch() {
+	ctx := context.Background()
+	s.NoError(cmds.PutConfig(ctx, s.clientStore, "./configs/batch.yml"))
+	published := 0
+	s.publisher.SetOnPublish(func(ctx context.Context, arn string, payload []byte) error {
+		published++
+		return nil
+	})
+
+	resp := s.notifyBatch("example-client-id-batch", "example-api-key-1234567890", []map[string]any{
+		{"id": 1, "status": "up"},
+		{"id": 1, "status": "up"},
+		{"id": 2, "status": "down"},
+		{"id": 3, "status": "up"},
+		{"id": 4, "status": "up"},
+		{"id": 5, "status": "down"},
+	})
+	defer func() { _ = resp.Body.Close() }()
+	s.Equal(http.StatusOK, resp.StatusCode)
+	var results []api.BatchItemResult
+	s.NoError(json.NewDecoder(resp.Body).Decode(&results))
+	s.Equal([]api.BatchItemResult{
+		{Index: 0, Status: flow.StatusTextMap[flow.EdgeTriggeredForward], HTTPStatus: http.StatusAccepted},
+		{Index: 1, Status: flow.StatusTextMap[flow.SuppressDedup], HTTPStatus: http.StatusAccepted},
+		{Index: 2, Status: flow.StatusTextMap[flow.EdgeTriggeredForward], HTTPStatus: http.StatusAccepted},
+		{Index: 3, Status: flow.StatusTextMap[flow.TargetRateLimited], HTTPStatus: http.StatusTooManyRequests},
+		{Index: 4, Status: flow.StatusTextMap[flow.NoOp], HTTPStatus: http.StatusAccepted},
+		{Index: 5, Status: "rate_limited", HTTPStatus: http.StatusAccepted, Error: "rate limit (client)"},
+	}, results)
+	s.Equal(2, published)
+}
+
+func (s *IntegrationTestSuite) TestNotifyBatchLimits() {
+	ctx := context.Background()
+	s.NoError(cmds.PutConfig(ctx, s.clientStore, "./configs/batch.yml"))
+
+	resp := s.notifyBatch("example-client-id-batch", "example-api-key-1234567890",
+		make([]map[string]any, api.MaxBatchItems+1))
+	_ = resp.Body.Close()
+	s.Equal(http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	resp = s.notifyBatch("example-client-id-batch", "example-api-key-1234567890", map[string]any{"status": "up"})
+	_ = resp.Body.Close()
+	s.Equal(http.StatusBadRequest, resp.StatusCode, "not an array")
+
+	resp = s.notifyBatch("example-client-id-batch", "bad-client-key", []map[string]any{{"status": "up"}})
+	_ = resp.Body.Close()
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"context"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"fmt"
+	"time"
+)
+
+// TestListClients lists exactly the clients put after the store is cleared.
+func (s *IntegrationTestSuite) TestListClients() {
+	ctx := context.Background()
+	s.Require().NoError(s.clientStore.ClearAll(ctx))
+	want := []string{"example-client-id-list-a", "example-client-id-list-b", "example-client-id-list-c"}
+	for _, id := range want {
+		s.Require().NoError(s.clientStore.PutClientConfig(ctx, id, types.ClientConfig{ClientID: id,
+			ClientName: "example-client-name", ClientKey: "example-api-key-1234567890"}))
+	}
+	all, err := s.clientStore.ListClients(ctx)
+	s.NoError(err)
+	s.ElementsMatch(want, all)
+}
+
+// TestListClientsPaged puts more clients than fit a page of two and reads them back page by page, on backends
+// that page.
+func (s *IntegrationTestSuite) TestListClientsPaged() {
+	ctx := context.Background()
+	run := time.Now().UnixNano()
+	var want []string
+	for i := range 5 {
+		id := fmt.Sprintf("example-client-id-page-%d-%d", run, i)
+		want = append(want, id)
+		s.Require().NoError(s.clientStore.PutClientConfig(ctx, id, types.ClientConfig{ClientID: id,
+			ClientName: "example-client-name", ClientKey: "example-api-key-1234567890"}))
+	}
+	all, err := s.clientStore.ListClients(ctx)
+	s.NoError(err)
+	s.Subset(all, want)
+
+	pager, ok := s.clientStore.(ports.ClientPager)
+	if !ok {
+		s.T().Skip("the client store does not page")
+	}
+	var paged []string
+	pages := 0
+	cursor := ""
+	for {
+		ids, next, err := pager.ListClientsPage(ctx, cursor, 2)
+		s.Require().NoError(err)
+		s.LessOrEqual(len(ids), 2)
+		paged = append(paged, ids...)
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	s.GreaterOrEqual(pages, 3)
+	s.Subset(paged, want)
+	s.ElementsMatch(all, paged)
+}
+
+// TestPutClientConfigCAS has two editors read the same config and write it back: the first write bumps the
+// version, and the stale one is refused.
+func (s *IntegrationTestSuite) TestPutClientConfigCAS() {
+	ctx := context.Background()
+	id := fmt.Sprintf("example-client-id-cas-%d", time.Now().UnixNano())
+	cc := types.ClientConfig{ClientID: id, ClientName: "example-client-name", ClientKey: "example-api-key-1234567890"}
+	s.Require().NoError(s.clientStore.PutClientConfigCAS(ctx, id, 0, cc))
+	s.ErrorIs(s.clientStore.PutClientConfigCAS(ctx, id, 0, cc), types.ErrVersionConflict, "already created")
+
+	first, err := s.clientStore.GetClientConfig(ctx, id)
+	s.Require().NoError(err)
+	s.Equal(int64(1), first.Version)
+	second := first
+
+	first.ClientRPM = 10
+	s.Require().NoError(s.clientStore.PutClientConfigCAS(ctx, id, first.Version, first))
+	second.ClientRPM = 20
+	err = s.clientStore.PutClientConfigCAS(ctx, id, second.Version, second)
+	s.ErrorIs(err, types.ErrVersionConflict)
+	s.ErrorContains(err, "since version 1")
+
+	got, err := s.clientStore.GetClientConfig(ctx, id)
+	s.Require().NoError(err)
+	s.Equal(int64(2), got.Version)
+	s.Equal(10, got.ClientRPM, "the stale write did not land")
+
+	// A config put without a version is taken as unversioned
+	s.Require().NoError(s.clientStore.PutClientConfig(ctx, id, types.ClientConfig{ClientID: id,
+		ClientName: "example-client-name", ClientKey: "example-api-key-1234567890"}))
+	s.ErrorIs(s.clientStore.PutClientConfigCAS(ctx, id, 2, got), types.ErrVersionConflict)
+	s.NoError(s.clientStore.PutClientConfigCAS(ctx, id, 0, got))
+}
@@ -0,0 +1,240 @@
+package tests
+
+import (
+	"context"
+	"enoti/internal/backends/ddb"
+	redisbackend "enoti/internal/backends/redis"
+	"enoti/internal/ports"
+	"enoti/internal/types"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TestSuppressBackendParity runs the same Suppress and Release sequence against the DynamoDB and the Redis data stores,
+// so it needs both the AWS Mock and Redis running regardless of TEST_USE_REDIS_BACKEND.
+func (s *IntegrationTestSuite) TestSuppressBackendParity() {
+	ctx := context.Background()
+	stores := map[string]ports.DataStore{
+		"ddb":   ddb.NewDataStore(TestTableName, s.newDDBClient(ctx)),
+		"redis": redisbackend.NewDataStore(s.newRedisClient()),
+	}
+	// Fresh hashes, so reruns within the window do not see the markers of the previous run
+	run := time.Now().UnixNano()
+	steps := []struct {
+		hash       string
+		sleep      time.Duration
+		release    bool
+		suppressed bool
+	}{
+		{hash: "h1", suppressed: false},
+		{hash: "h1", suppressed: true},
+		{hash: "h2", suppressed: false},
+		{hash: "h1", suppressed: true},
+		{hash: "h1", sleep: 3 * time.Second, suppressed: false}, // window expired
+		{hash: "h1", suppressed: true},
+		{hash: "h1", release: true, suppressed: false},
+	}
+
+	results := map[string][]bool{}
+	for name, store := range stores {
+		for i, step := range steps {
+			time.Sleep(step.sleep)
+			hash := fmt.Sprintf("%s-%d", step.hash, run)
+			if step.release {
+				s.NoError(store.Release(ctx, "example-client-id-parity", hash), "%s step %d", name, i)
+			}
+			suppressed, err := store.Suppress(ctx, "example-client-id-parity", hash, 2*time.Second)
+			s.NoError(err, "%s step %d", name, i)
+			s.Equal(step.suppressed, suppressed, "%s step %d", name, i)
+			results[name] = append(results[name], suppressed)
+		}
+	}
+	s.Equal(results["ddb"], results["redis"])
+}
+
+// TestUpsertCASRace has concurrent writers commit on the same loaded version: exactly one of them must win.
+func (s *IntegrationTestSuite) TestUpsertCASRace() {
+	ctx := context.Background()
+	scopeKey := fmt.Sprintf("cas-race-%d", time.Now().UnixNano())
+	ok, err := s.dataStore.UpsertCAS(ctx, "example-client-id-race", scopeKey, 0, types.Edge{LastValue: "a"})
+	s.NoError(err)
+	s.True(ok)
+	_, ver, err := s.dataStore.Load(ctx, "example-client-id-race", scopeKey)
+	s.NoError(err)
+
+	var committed atomic.Int32
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Go(func() {
+			ok, err := s.dataStore.UpsertCAS(ctx, "example-client-id-race", scopeKey, ver,
+				types.Edge{LastValue: fmt.Sprint(i)})
+			s.NoError(err)
+			if ok {
+				committed.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	s.Equal(int32(1), committed.Load())
+	_, next, err := s.dataStore.Load(ctx, "example-client-id-race", scopeKey)
+	s.NoError(err)
+	s.Greater(next, ver)
+}
+
+// TestEdgeRoundTrip stores every field of an edge state, on create and on update, and loads them back.
+func (s *IntegrationTestSuite) TestEdgeRoundTrip() {
+	ctx := context.Background()
+	clientID := "example-client-id-roundtrip"
+	scopeKey := fmt.Sprintf("roundtrip-%d", time.Now().UnixNano())
+	for i, next := range []types.Edge{
+		{LastValue: "down", LastChangeTS: 10, WindowStart: 10, AggUntilTS: 20,
+			LastAggFingerprint: "fp", LastAggTS: 5, LastForwarded: `{"v":"down"}`},
+		{LastValue: "up", LastChangeTS: 30, WindowStart: 10, FlipCount: 1,
+			Recent: []types.Flip{{At: 30, From: "down", To: "up"}}, LastAggFingerprint: "fp2", LastAggTS: 25,
+			LastForwarded: `{"v":"up"}`},
+	} {
+		ok, err := s.dataStore.UpsertCAS(ctx, clientID, scopeKey, int64(i), next)
+		s.Require().NoError(err)
+		s.Require().True(ok)
+		edge, ver, err := s.dataStore.Load(ctx, clientID, scopeKey)
+		s.Require().NoError(err)
+		s.Require().NotNil(edge)
+		s.Equal(int64(i+1), ver)
+		s.Equal(next.LastValue, edge.LastValue)
+		s.Equal(next.LastChangeTS, edge.LastChangeTS)
+		s.Equal(next.FlipCount, edge.FlipCount)
+		s.Equal(len(next.Recent), len(edge.Recent))
+		s.Equal(next.AggUntilTS, edge.AggUntilTS)
+		s.Equal(next.LastAggFingerprint, edge.LastAggFingerprint, "step %d", i)
+		s.Equal(next.LastAggTS, edge.LastAggTS, "step %d", i)
+		s.Equal(next.LastForwarded, edge.LastForwarded, "step %d", i)
+	}
+}
+
+// TestDeleteEdge deletes an edge state: the scope starts afresh, and other scopes keep theirs.
+func (s *IntegrationTestSuite) TestDeleteEdge() {
+	ctx := context.Background()
+	clientID := "example-client-id-delete"
+	scopeKey := fmt.Sprintf("delete-%d", time.Now().UnixNano())
+	for _, key := range []string{scopeKey, scopeKey + "_other"} {
+		ok, err := s.dataStore.UpsertCAS(ctx, clientID, key, 0, types.Edge{LastValue: "down"})
+		s.Require().NoError(err)
+		s.Require().True(ok)
+	}
+
+	s.NoError(s.dataStore.DeleteEdge(ctx, clientID, scopeKey))
+	edge, ver, err := s.dataStore.Load(ctx, clientID, scopeKey)
+	s.NoError(err)
+	s.Nil(edge)
+	s.Zero(ver)
+	edge, _, err = s.dataStore.Load(ctx, clientID, scopeKey+"_other")
+	s.NoError(err)
+	s.Require().NotNil(edge)
+	s.Equal("down", edge.LastValue)
+
+	// The state is created anew, and deleting state that does not exist is no error
+	ok, err := s.dataStore.UpsertCAS(ctx, clientID, scopeKey, 0, types.Edge{LastValue: "up"})
+	s.NoError(err)
+	s.True(ok)
+	s.NoError(s.dataStore.DeleteEdge(ctx, clientID, scopeKey))
+	s.NoError(s.dataStore.DeleteEdge(ctx, clientID, scopeKey))
+}
+
+// TestBlock blocks a scope, replaces its block with a shorter one, lets it expire and lifts another.
+func (s *IntegrationTestSuite) TestBlock() {
+	ctx := context.Background()
+	scope := fmt.Sprintf("block-%d", time.Now().UnixNano())
+	blocked := func(scope string) bool {
+		b, err := s.dataStore.Blocked(ctx, scope)
+		s.Require().NoError(err)
+		return b
+	}
+	s.False(blocked(scope))
+	s.NoError(s.dataStore.Block(ctx, scope, time.Hour))
+	s.True(blocked(scope))
+	s.False(blocked(scope + "_other"))
+
+	s.NoError(s.dataStore.Block(ctx, scope, time.Second))
+	time.Sleep(2100 * time.Millisecond) // stores keep expiries in whole seconds
+	s.False(blocked(scope), "expired")
+
+	s.NoError(s.dataStore.Block(ctx, scope, time.Hour))
+	s.NoError(s.dataStore.Block(ctx, scope, 0))
+	s.False(blocked(scope), "lifted")
+	s.NoError(s.dataStore.Block(ctx, scope, 0))
+}
+
+// TestRefund uses up the slots of a scope with either strategy, refunds one by the slot its acquire reported and
+// acquires it again.
+func (s *IntegrationTestSuite) TestRefund() {
+	for name, ctx := range map[string]context.Context{
+		"window": context.Background(),
+		"bucket": ports.WithTokenBucket(context.Background(), 2),
+	} {
+		scope := fmt.Sprintf("CLIENT:refund-%s-%d", name, time.Now().UnixNano())
+		var slot string
+		ctx := ports.WithSlot(ctx, &slot)
+		acquire := func() bool {
+			ok, err := s.dataStore.Acquire(ctx, scope, 2, time.Hour)
+			s.Require().NoError(err)
+			return ok
+		}
+		s.True(acquire(), name)
+		s.True(acquire(), name)
+		s.False(acquire(), name)
+		s.NotEmpty(slot, name)
+		s.NoError(s.dataStore.Refund(ctx, scope, slot, 2, time.Hour), name)
+		s.True(acquire(), "%s: refunded", name)
+		s.False(acquire(), name)
+		s.NoError(s.dataStore.Refund(ctx, scope+"_other", slot, 2, time.Hour), "%s: nothing to refund", name)
+	}
+}
+
+// TestAcquireRace has concurrent acquires on the same scope: no more than the rate may be granted.
+func (s *IntegrationTestSuite) TestAcquireRace() {
+	ctx := context.Background()
+	scope := fmt.Sprintf("CLIENT:acquire-race-%d", time.Now().UnixNano())
+	var granted atomic.Int32
+	var wg sync.WaitGroup
+	for range 30 {
+		wg.Go(func() {
+			ok, err := s.dataStore.Acquire(ctx, scope, 10, time.Minute)
+			s.NoError(err)
+			if ok {
+				granted.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	s.LessOrEqual(granted.Load(), int32(10))
+	s.Positive(granted.Load())
+}
+
+// TestCountQuotaRace has concurrent counts on the same quota: no more than the limit may be counted, and checks see
+// the quota used up afterwards.
+func (s *IntegrationTestSuite) TestCountQuotaRace() {
+	ctx := context.Background()
+	scope := fmt.Sprintf("QUOTA:quota-race-%d", time.Now().UnixNano())
+	ok, err := s.dataStore.CountQuota(ctx, scope, 0, 10, time.Hour)
+	s.NoError(err)
+	s.True(ok, "an unused quota has room")
+
+	var counted atomic.Int32
+	var wg sync.WaitGroup
+	for range 30 {
+		wg.Go(func() {
+			ok, err := s.dataStore.CountQuota(ctx, scope, 1, 10, time.Hour)
+			s.NoError(err)
+			if ok {
+				counted.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	s.Equal(int32(10), counted.Load())
+	ok, err = s.dataStore.CountQuota(ctx, scope, 0, 10, time.Hour)
+	s.NoError(err)
+	s.False(ok)
+}
@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"context"
+	"enoti/cmd/enoti/cmds"
+	"enoti/internal/flow"
+	"time"
+)
+
+// TestDedup tests that an event repeating the dedup fields of an earlier one is suppressed within the window,
+// and delivered again once the window has expired.
+func (s *IntegrationTestSuite) TestDedup() {
+	ctx := context.Background()
+	err := cmds.PutConfig(ctx, s.clientStore, "./configs/dedup.yml")
+	s.NoError(err)
+
+	cnt := 0
+	s.publisher.SetOnPublish(func(ctx context.Context, arn string, payload []byte) error {
+		cnt += 1
+		return nil
+	})
+	notify := func(message, host, statusText string) {
+		r, err := s.notify(
+			"example-client-id-dedup",
+			"example-api-key-1234567890",
+			map[string]any{
+				"message": message,
+				"event": map[string]any{
+					"id":   "e1",
+					"host": host,
+				},
+			},
+		)
+		s.assertSuccessStatus(r, statusText, err)
+	}
+
+	notify("first", "h1", flow.StatusTextMap[flow.ForwardedAsIs])
+	// Only the dedup fields count
+	notify("second", "h1", flow.StatusTextMap[flow.SuppressDedup])
+	// Another host is another event
+	notify("first", "h2", flow.StatusTextMap[flow.ForwardedAsIs])
+	s.Equal(2, cnt)
+
+	// Delivered again after the window
+	time.Sleep(3 * time.Second)
+	notify("third", "h1", flow.StatusTextMap[flow.ForwardedAsIs])
+	s.Equal(3, cnt)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"enoti/cmd/enoti/cmds"
+	"enoti/internal/api"
 	"enoti/internal/flow"
 	"fmt"
 	"time"
@@ -418,3 +419,166 @@ func (s *IntegrationTestSuite) TestEdgeTriggerAggregateCrossWindowsSuppress() {
 	s.Equal(2, cnt)
 	s.Equal(10000, maxID) // The last 4 events plus this one are sent out
 }
+
+// TestEdgeTriggerAggregateFlush tests that flips buffered at the end of a flapping window are flushed as an
+// aggregate by the flusher, without waiting for another event.
+func (s *IntegrationTestSuite) TestEdgeTriggerAggregateFlush() {
+	ctx := context.Background()
+	err := cmds.PutConfig(ctx, s.clientStore, "./configs/edge_trigger_agg_short_window.yml")
+	s.NoError(err)
+	t := time.Now()
+	flow.SetTimNowFn(func() time.Time {
+		return t
+	})
+	var aggregates []map[string]any
+	s.publisher.SetOnPublish(func(ctx context.Context, arn string, payload []byte) error {
+		var m map[string]any
+		s.NoError(json.Unmarshal(payload, &m))
+		// Edges of other tests may be flushed too
+		if m["type"] == "flap_aggregate" && m["last_value"] == "flush-b" {
+			aggregates = append(aggregates, m)
+		}
+		return nil
+	})
+	for i, typ := range []string{"flush-a", "flush-b", "flush-a", "flush-b"} {
+		t = t.Add(time.Second)
+		r, err := s.notify(
+			"example-client-id-edge-trigger-agg-short-window",
+			"example-api-key-1234567890",
+			map[string]any{
+				"id":    i,
+				"event": map[string]any{"type": typ},
+			},
+		)
+		if i == 0 {
+			s.assertSuccessStatus(r, flow.StatusTextMap[flow.EdgeTriggeredForward], err)
+		} else {
+			s.assertSuccessStatus(r, flow.StatusTextMap[flow.SuppressFlapping], err)
+		}
+	}
+
+	// Window still open: nothing to flush
+	_, err = api.FlushPendingAggregates(ctx, s.clientStore, s.dataStore, s.publisher)
+	s.NoError(err)
+	s.Empty(aggregates)
+
+	t = t.Add(10 * time.Second)
+	_, err = api.FlushPendingAggregates(ctx, s.clientStore, s.dataStore, s.publisher)
+	s.NoError(err)
+	s.Len(aggregates, 1)
+	s.EqualValues(3, aggregates[0]["flip_count"])
+	s.Len(aggregates[0]["recent"], 3)
+
+	// Sent once only
+	_, err = api.FlushPendingAggregates(ctx, s.clientStore, s.dataStore, s.publisher)
+	s.NoError(err)
+	s.Len(aggregates, 1)
+}
+
+// TestEdgeTriggerScopeFields tests that scope_fields give each entity its own edge state: the same value
+// reported by two hosts is forwarded once per host, and a change on one host does not affect the other.
+func (s *IntegrationTestSuite) TestEdgeTriggerScopeFields() {
+	ctx := context.Background()
+	err := cmds.PutConfig(ctx, s.clientStore, "./configs/edge_trigger_scope_fields.yml")
+	s.NoError(err)
+
+	cnt := 0
+	s.publisher.SetOnPublish(func(ctx context.Context, arn string, payload []byte) error {
+		cnt += 1
+		return nil
+	})
+	notify := func(host, typ string, action flow.Action) {
+		r, err := s.notify(
+			"example-client-id-edge-trigger-scope-fields",
+			"example-api-key-1234567890",
+			map[string]any{
+				"message": "Hello, Edge Trigger!",
+				"event": map[string]any{
+					"host": host,
+					"type": typ,
+				},
+			},
+		)
+		s.assertSuccessStatus(r, flow.StatusTextMap[action], err)
+	}
+
+	notify("server-a", "down", flow.EdgeTriggeredForward)
+	notify("server-b", "down", flow.EdgeTriggeredForward)
+	notify("server-a", "down", flow.NoOp)
+	notify("server-b", "up", flow.EdgeTriggeredForward)
+	notify("server-a", "down", flow.NoOp)
+	notify("server-a", "up", flow.EdgeTriggeredForward)
+	s.Equal(4, cnt)
+}
+
+// TestEdgeTriggerWithoutScopeFields tests the fallback to a single edge state per field without scope_fields:
+// the same value reported by two hosts is forwarded only once.
+func (s *IntegrationTestSuite) TestEdgeTriggerWithoutScopeFields() {
+	ctx := context.Background()
+	err := cmds.PutConfig(ctx, s.clientStore, "./configs/edge_trigger_simple.yml")
+	s.NoError(err)
+
+	cnt := 0
+	s.publisher.SetOnPublish(func(ctx context.Context, arn string, payload []byte) error {
+		cnt += 1
+		return nil
+	})
+	for i, host := range []string{"server-a", "server-b"} {
+		r, err := s.notify(
+			"example-client-id-edge-trigger-simple",
+			"example-api-key-1234567890",
+			map[string]any{
+				"message": "Hello, Edge Trigger!",
+				"event": map[string]any{
+					"host": host,
+					"type": "scope-fallback",
+				},
+			},
+		)
+		if i == 0 {
+			s.assertSuccessStatus(r, flow.StatusTextMap[flow.EdgeTriggeredForward], err)
+		} else {
+			s.assertSuccessStatus(r, flow.StatusTextMap[flow.NoOp], err)
+		}
+	}
+	s.Equal(1, cnt)
+}
+
+// TestEdgeTriggerThreshold tests the threshold trigger type: only crossing the threshold is an edge, in both
+// directions as the config forwards recoveries.
+func (s *IntegrationTestSuite) TestEdgeTriggerThreshold() {
+	ctx := context.Background()
+	err := cmds.PutConfig(ctx, s.clientStore, "./configs/edge_trigger_threshold.yml")
+	s.NoError(err)
+
+	cnt := 0
+	s.publisher.SetOnPublish(func(ctx context.Context, arn string, payload []byte) error {
+		cnt += 1
+		return nil
+	})
+	steps := []struct {
+		cpu    float64
+		action flow.Action
+	}{
+		{50, flow.NoOp},                 // below
+		{95, flow.EdgeTriggeredForward}, // crossing up
+		{97, flow.NoOp},                 // staying above
+		{99, flow.NoOp},
+		{40, flow.EdgeTriggeredForward}, // crossing back down
+		{60, flow.NoOp},
+	}
+	for _, step := range steps {
+		r, err := s.notify(
+			"example-client-id-edge-trigger-threshold",
+			"example-api-key-1234567890",
+			map[string]any{
+				"message": "Hello, Threshold!",
+				"metric": map[string]any{
+					"cpu": step.cpu,
+				},
+			},
+		)
+		s.assertSuccessStatus(r, flow.StatusTextMap[step.action], err)
+	}
+	s.Equal(2, cnt)
+}
@@ -0,0 +1,29 @@
+package tests
+
+import (
+	"enoti/internal/backends/memory"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// MemoryBackendTestSuite runs the scenarios of IntegrationTestSuite against the in-memory backend, checking it
+// behaves like DynamoDB and Redis. Unlike them it needs no service running.
+type MemoryBackendTestSuite struct {
+	IntegrationTestSuite
+}
+
+func (s *MemoryBackendTestSuite) SetupSuite() {
+	store := memory.NewStore()
+	s.clientStore, s.dataStore = store, store
+	s.startServer()
+}
+
+// TestSuppressBackendParity compares DynamoDB and Redis only.
+func (s *MemoryBackendTestSuite) TestSuppressBackendParity() {
+	s.T().Skip("compares the DynamoDB and Redis backends")
+}
+
+func TestMemoryBackendTestSuite(t *testing.T) {
+	suite.Run(t, new(MemoryBackendTestSuite))
+}
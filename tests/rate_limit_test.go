@@ -40,6 +40,26 @@ func (s *IntegrationTestSuite) TestRateLimitIP() {
 	s.assertFailureStatus(r, http.StatusAccepted, err, aws.String("rate limit (ip)"))
 }
 
+// TestRateLimitIPBypass tests that a client configured to bypass IP rate limiting
+// is never rejected by it, even past its ip_rpm.
+func (s *IntegrationTestSuite) TestRateLimitIPBypass() {
+	ctx := context.Background()
+	err := cmds.PutConfig(ctx, s.clientStore, "./configs/rate_limit_ip_bypass.yml")
+	s.NoError(err)
+
+	for i := 0; i < 5; i++ {
+		r, err := s.notify(
+			"example-client-id-rate-limit-ip-bypass",
+			"example-api-key-1234567890",
+			map[string]any{
+				"message": "Test message",
+			},
+		)
+		s.NoError(err)
+		s.assertSuccessStatus(r, flow.StatusTextMap[flow.ForwardedAsIs], nil)
+	}
+}
+
 // TestRateLimitClient tests client-based rate limiting.
 // The config allows 3 requests per minute per client.
 func (s *IntegrationTestSuite) TestRateLimitClient() {
@@ -71,6 +91,37 @@ func (s *IntegrationTestSuite) TestRateLimitClient() {
 	s.assertFailureStatus(r, http.StatusAccepted, err, aws.String("rate limit (client)"))
 }
 
+// TestRateLimitTokenBucket tests the token bucket strategy.
+// The config refills 2 tokens per minute into a bucket of 5.
+func (s *IntegrationTestSuite) TestRateLimitTokenBucket() {
+	ctx := context.Background()
+	err := cmds.PutConfig(ctx, s.clientStore, "./configs/rate_limit_token_bucket.yml")
+	s.NoError(err)
+
+	// A burst of 5 should succeed, although the rate is 2 per minute
+	for i := 0; i < 5; i++ {
+		r, err := s.notify(
+			"example-client-id-rate-limit-token-bucket",
+			"example-api-key-1234567890",
+			map[string]any{
+				"message": "Test message",
+			},
+		)
+		s.NoError(err)
+		s.assertSuccessStatus(r, flow.StatusTextMap[flow.ForwardedAsIs], nil)
+	}
+
+	// 6th request should fail until the bucket refills
+	r, err := s.notify(
+		"example-client-id-rate-limit-token-bucket",
+		"example-api-key-1234567890",
+		map[string]any{
+			"message": "Test message",
+		},
+	)
+	s.assertFailureStatus(r, http.StatusAccepted, err, aws.String("rate limit (client)"))
+}
+
 // TestRateLimitSNS tests SNS target rate limiting.
 // The config allows 2 SNS publishes per minute.
 func (s *IntegrationTestSuite) TestRateLimitSNS() {
@@ -112,8 +163,7 @@ func (s *IntegrationTestSuite) TestRateLimitSNS() {
 			},
 		},
 	)
-	s.NoError(err)
-	s.Equal(http.StatusTooManyRequests, r.StatusCode)
+	s.assertFailureStatus(r, http.StatusTooManyRequests, err, aws.String(flow.StatusTextMap[flow.TargetRateLimited]))
 	s.Equal(2, cnt) // Still only 2 publishes
 }
 
@@ -148,7 +198,7 @@ func (s *IntegrationTestSuite) TestRateLimitCombined() {
 			s.assertSuccessStatus(r, flow.StatusTextMap[flow.EdgeTriggeredForward], nil)
 		} else {
 			// 4th and 5th should be accepted but not published due to SNS rate limit
-			s.Equal(http.StatusTooManyRequests, r.StatusCode)
+			s.assertFailureStatus(r, http.StatusTooManyRequests, err, aws.String(flow.StatusTextMap[flow.TargetRateLimited]))
 		}
 	}
 	s.Equal(3, cnt) // Only 3 SNS publishes due to sns_rpm limit
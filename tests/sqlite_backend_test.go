@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"enoti/internal/backends/sqlite"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// SQLiteBackendTestSuite runs the scenarios of IntegrationTestSuite against the SQLite backend, on a file in a
+// temporary directory.
+type SQLiteBackendTestSuite struct {
+	IntegrationTestSuite
+}
+
+func (s *SQLiteBackendTestSuite) SetupSuite() {
+	db, err := sqlite.Open(filepath.Join(s.T().TempDir(), "enoti.db"))
+	if err != nil {
+		s.FailNow("Failed to open SQLite", err)
+	}
+	s.clientStore, s.dataStore = sqlite.NewClientStore(db), sqlite.NewDataStore(db)
+	s.startServer()
+}
+
+// TestSuppressBackendParity compares DynamoDB and Redis only.
+func (s *SQLiteBackendTestSuite) TestSuppressBackendParity() {
+	s.T().Skip("compares the DynamoDB and Redis backends")
+}
+
+func TestSQLiteBackendTestSuite(t *testing.T) {
+	suite.Run(t, new(SQLiteBackendTestSuite))
+}